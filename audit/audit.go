@@ -0,0 +1,106 @@
+// Package audit records who did what to which files, and to the users and
+// settings of File Browser, so that admins can find out afterwards.
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The actions recorded. Those of the resource PATCH requests are named after
+// their action parameter.
+const (
+	ActionRead          = "read"
+	ActionCreate        = "create"
+	ActionWrite         = "write"
+	ActionDelete        = "delete"
+	ActionCopy          = "copy"
+	ActionRename        = "rename"
+	ActionArchive       = "archive"
+	ActionExtract       = "extract"
+	ActionDownload      = "download"
+	ActionUpload        = "upload"
+	ActionShareCreate   = "share_create"
+	ActionShareDelete   = "share_delete"
+	ActionShareUpdate   = "share_update"
+	ActionShareView     = "share_view"
+	ActionShareDownload = "share_download"
+	ActionGrantCreate   = "grant_create"
+	ActionGrantDelete   = "grant_delete"
+	ActionCommand       = "command"
+	ActionLogin         = "login"
+	ActionUserCreate    = "user_create"
+	ActionUserUpdate    = "user_update"
+	ActionUserDelete    = "user_delete"
+	ActionSettings      = "settings_update"
+	ActionUnblock       = "unblock"
+)
+
+// Event is an action recorded in the audit log. Its paths are relative to the
+// scope of the user, the users and settings changed being told in Detail.
+type Event struct {
+	ID          uint      `json:"id" storm:"id,increment"`
+	Time        time.Time `json:"time"`
+	User        string    `json:"user,omitempty"`
+	IP          string    `json:"ip"`
+	Action      string    `json:"action"`
+	Source      string    `json:"src,omitempty"`
+	Destination string    `json:"dst,omitempty"`
+	// Share is the hash of the share the files were accessed through, by
+	// whoever had its link, which is why the user is left empty then.
+	Share string `json:"share,omitempty"`
+	// Detail is what else tells the action apart, such as the command run.
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status"`
+}
+
+// Filter selects the events of a query. Its zero value selects them all.
+type Filter struct {
+	User   string
+	Action string
+	// Path selects the events whose source or destination is it or within it.
+	Path  string
+	Share string
+	Since time.Time
+	Until time.Time
+	// Limit is the most events returned, the latest first, if not zero.
+	Limit int
+}
+
+// Matches reports whether the filter selects the event.
+func (f Filter) Matches(e *Event) bool {
+	switch {
+	case f.User != "" && e.User != f.User,
+		f.Action != "" && e.Action != f.Action,
+		f.Share != "" && e.Share != f.Share,
+		!f.Since.IsZero() && e.Time.Before(f.Since),
+		!f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.Path == "":
+		return true
+	default:
+		return within(e.Source, f.Path) || within(e.Destination, f.Path)
+	}
+}
+
+func within(p, dir string) bool {
+	if p == "" {
+		return false
+	}
+	dir = strings.TrimSuffix(dir, "/")
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// ParseTime parses the bounds of the filters, which are either times in the
+// RFC 3339 format or durations before now, like 24h.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected a RFC 3339 time or a duration", s)
+	}
+	return now.Add(-d), nil
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	e := &Event{Time: now, User: "alice", Action: ActionRename, Source: "/docs/a.txt", Destination: "/archive/a.txt"}
+
+	for _, test := range []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{User: "alice", Action: ActionRename}, true},
+		{Filter{User: "bob"}, false},
+		{Filter{Action: ActionDelete}, false},
+		{Filter{Path: "/docs"}, true},
+		{Filter{Path: "/archive/"}, true},
+		{Filter{Path: "/"}, true},
+		// Paths only select what is within them, not what starts alike.
+		{Filter{Path: "/doc"}, false},
+		{Filter{Share: "abc"}, false},
+		{Filter{Since: now.Add(-time.Hour), Until: now.Add(time.Hour)}, true},
+		{Filter{Since: now.Add(time.Second)}, false},
+		{Filter{Until: now}, false},
+	} {
+		if got := test.filter.Matches(e); got != test.want {
+			t.Errorf("%+v.Matches() = %t, want %t", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got, err := ParseTime("24h", now); err != nil || !got.Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("expected a day ago, got %s %v", got, err)
+	}
+	if got, err := ParseTime("2025-12-31T00:00:00Z", now); err != nil || !got.Equal(time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the time given, got %s %v", got, err)
+	}
+	if _, err := ParseTime("yesterday", now); err == nil {
+		t.Error("expected an invalid time to be refused")
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// A rotated file, which is compressed.
+	f, err := os.Create(filepath.Join(dir, "audit-2026-01-01T00-00-00.000.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	if err := json.NewEncoder(gz).Encode(&Event{Time: start, User: "alice", Action: ActionDelete, Source: "/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log := NewStorage(NewFileBackend(filepath.Join(dir, "audit.log")))
+	for i, user := range []string{"bob", "alice"} {
+		log.Record(&Event{Time: start.Add(time.Duration(i+1) * time.Minute), User: user, Action: ActionDelete, Source: "/b.txt"})
+	}
+	log.Record(&Event{User: "alice", Action: ActionRead, Source: "/b.txt"})
+
+	events, err := log.Find(Filter{User: "alice", Action: ActionDelete})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Source != "/b.txt" || events[1].Source != "/a.txt" {
+		t.Fatalf("expected the deletions of alice, the latest first, got %+v", events)
+	}
+
+	if events, err := log.Find(Filter{Limit: 1}); err != nil || len(events) != 1 || events[0].Action != ActionRead {
+		t.Errorf("expected the latest event, got %+v %v", events, err)
+	}
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+)
+
+// fileBackend keeps the audit log in a file of JSON lines, rotated once it
+// grows past 100 MB, keeping the last 10 rotated files compressed.
+type fileBackend struct {
+	log *lumberjack.Logger
+}
+
+// NewFileBackend returns a backend keeping the audit log in the file at path.
+func NewFileBackend(path string) StorageBackend {
+	return fileBackend{log: &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    100,
+		MaxBackups: 10,
+		Compress:   true,
+	}}
+}
+
+func (b fileBackend) Save(e *Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = b.log.Write(append(line, '\n'))
+	return err
+}
+
+func (b fileBackend) Find(f Filter) ([]*Event, error) {
+	paths, err := b.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+	for _, path := range paths {
+		found, err := readEvents(path, f)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, found...)
+	}
+
+	slices.SortStableFunc(events, func(a, b *Event) int {
+		return b.Time.Compare(a.Time)
+	})
+	if f.Limit > 0 && len(events) > f.Limit {
+		events = events[:f.Limit]
+	}
+	return events, nil
+}
+
+// files returns the path of the log along with those of its rotated files,
+// which lumberjack names after it with the time they were rotated at.
+func (b fileBackend) files() ([]string, error) {
+	name := b.log.Filename
+	ext := filepath.Ext(name)
+	rotated, err := filepath.Glob(strings.TrimSuffix(name, ext) + "-*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+	return append(rotated, name), nil
+}
+
+func readEvents(path string, f Filter) ([]*Event, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var events []*Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var e Event
+		// Lines cut short by a crash are skipped.
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if f.Matches(&e) {
+			events = append(events, &e)
+		}
+	}
+	return events, scanner.Err()
+}
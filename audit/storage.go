@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"log"
+	"time"
+)
+
+// StorageBackend is the interface to implement for an audit log storage.
+type StorageBackend interface {
+	Save(e *Event) error
+	// Find returns the events the filter selects, the latest first.
+	Find(f Filter) ([]*Event, error)
+}
+
+// Storage is a storage. A nil Storage records nothing, the audit log being
+// disabled.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates an audit log storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// Record saves an event, timing it now unless it already is. Failing to
+// record doesn't fail the action, so the error is only logged.
+func (s *Storage) Record(e *Event) {
+	if s == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := s.back.Save(e); err != nil {
+		log.Printf("Warning: Failed to record %s of %q in the audit log: %v", e.Action, e.Source, err)
+	}
+}
+
+// Find wraps a StorageBackend.Find.
+func (s *Storage) Find(f Filter) ([]*Event, error) {
+	return s.back.Find(f)
+}
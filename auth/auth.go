@@ -15,6 +15,16 @@ type Auther interface {
 	LoginPage() bool
 }
 
+// PasswordAuther is implemented by authers that can verify a plain username
+// and password pair. It lets clients that can only send HTTP Basic
+// credentials, such as WebDAV clients, authenticate through the configured
+// auther instead of the browser login flow.
+type PasswordAuther interface {
+	// AuthPassword authenticates the given credentials. The request is only
+	// given for context, its credentials being ignored.
+	AuthPassword(r *http.Request, username, password string, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error)
+}
+
 func DataBase() {
 	initializeDatabase()
 }
@@ -2,12 +2,15 @@ package auth
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 var db *sql.DB
@@ -15,24 +18,69 @@ var err error
 
 var authDB = "auth.db"
 
+// authErrTable is where failed logins were tracked by the Host header of their
+// requests, before login limits replaced it.
 var authErrTable = "auth_errors"
-var authErrColumns = []string{"host TEXT", "block_until INTEGER"}
+
+var loginLimits = "login_limits"
+var loginLimitsColumns = []string{
+	"limit_key TEXT PRIMARY KEY",
+	"failures INTEGER",
+	"last_failure INTEGER",
+	"blocked_until INTEGER",
+	"expires INTEGER",
+}
 
 var tokenTracker = "token_tracker"
-var tokenTrackerColumns = []string{"token TEXT UNIQUE"}
+var tokenTrackerColumns = []string{
+	"token TEXT UNIQUE",
+	"id TEXT",
+	"user_id INTEGER",
+	"ip TEXT",
+	"user_agent TEXT",
+	"issued_at INTEGER",
+	"last_seen INTEGER",
+	"expires_at INTEGER",
+}
 
-var (
-	forbiddenCache = struct {
-		sync.RWMutex
-		data map[string]int64
-	}{data: make(map[string]int64)}
+// lastSeenResolution is how often the time a session was last seen is
+// recorded at most, so that every request doesn't write to the database.
+const lastSeenResolution = time.Minute
 
+var (
 	jwtCache = struct {
 		sync.RWMutex
 		data []string
 	}{}
+
+	sessionCache = struct {
+		sync.RWMutex
+		data   map[string]*Session
+		loaded bool
+	}{data: make(map[string]*Session)}
 )
 
+// Session is a login of a user. The JWTs it was renewed with all belong to
+// it, and are refused once it is revoked.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    uint      `json:"userID"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// ExpiresAt is when the JWT the session was last renewed with expires,
+	// the session ending with it. Zero for the sessions tracked before it was.
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	token string
+}
+
+// expired reports whether the session ended by now.
+func (s *Session) expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !s.ExpiresAt.After(now)
+}
+
 func initializeDatabase() {
 	// Initialize the database connection and create the table in the init function
 	db, err = makeDBConnection()
@@ -40,15 +88,35 @@ func initializeDatabase() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	err = createTable(authErrTable, authErrColumns)
+	_, err = db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", authErrTable))
 	if err != nil {
-		log.Fatalf("Failed to create table [%s]: %v", authErrTable, err)
+		log.Fatalf("Failed to drop table [%s]: %v", authErrTable, err)
+	}
+
+	err = createTable(loginLimits, loginLimitsColumns)
+	if err != nil {
+		log.Fatalf("Failed to create table [%s]: %v", loginLimits, err)
 	}
 
 	err = createTable(tokenTracker, tokenTrackerColumns)
 	if err != nil {
 		log.Fatalf("Failed to create table [%s]: %v", tokenTracker, err)
 	}
+
+	// Tables created before sessions were tracked only have the token.
+	err = addMissingColumns(tokenTracker, tokenTrackerColumns)
+	if err != nil {
+		log.Fatalf("Failed to migrate table [%s]: %v", tokenTracker, err)
+	}
+
+	// Nothing cached of a database opened before holds for this one.
+	jwtCache.Lock()
+	jwtCache.data = nil
+	jwtCache.Unlock()
+	sessionCache.Lock()
+	sessionCache.data = make(map[string]*Session)
+	sessionCache.loaded = false
+	sessionCache.Unlock()
 }
 
 func makeDBConnection() (*sql.DB, error) {
@@ -89,55 +157,140 @@ func joinColumns(columns []string) string {
 	return strings.Join(columns, ", ")
 }
 
-func getForbiddenRecord(host string) (int64, error) {
-	forbiddenCache.RLock()
-	blockUntil, found := forbiddenCache.data[host]
-	forbiddenCache.RUnlock()
-	if found {
-		return blockUntil, nil
+func addMissingColumns(tableName string, columns []string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	query := fmt.Sprintf("SELECT block_until FROM %s WHERE host = ?", authErrTable) //nolint:gosec
-	err := db.QueryRow(query, host).Scan(&blockUntil)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, nil // No record found
+	existing := map[string]bool{}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
 		}
-		log.Printf("Warning: Failed to get blocked records for host [%s] from %s table - %s", host, authErrTable, err)
-		return 0, err
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	forbiddenCache.Lock()
-	forbiddenCache.data[host] = blockUntil
-	forbiddenCache.Unlock()
+	for _, column := range columns {
+		name, _, _ := strings.Cut(column, " ")
+		if existing[name] {
+			continue
+		}
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", tableName, column) //nolint:gosec
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return blockUntil, nil
+func scanLoginLimit(scan func(dest ...any) error) (LoginLimit, error) {
+	var (
+		l                                  LoginLimit
+		lastFailure, blockedUntil, expires int64
+	)
+	if err := scan(&l.Key, &l.Failures, &lastFailure, &blockedUntil, &expires); err != nil {
+		return LoginLimit{}, err
+	}
+	l.LastFailure, l.BlockedUntil, l.Expires = time.Unix(lastFailure, 0), time.Unix(blockedUntil, 0), time.Unix(expires, 0)
+	return l, nil
 }
 
-func putForbiddenRecord(host string, blockUntil int64) {
-	query := fmt.Sprintf("INSERT OR REPLACE INTO %s (host, block_until) VALUES (?, ?)", authErrTable) //nolint:gosec
-	_, err := db.Exec(query, host, blockUntil)
+func getLoginLimit(key string) (LoginLimit, error) {
+	query := fmt.Sprintf("SELECT limit_key, failures, last_failure, blocked_until, expires FROM %s WHERE limit_key = ?", loginLimits) //nolint:gosec
+	l, err := scanLoginLimit(db.QueryRow(query, key).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LoginLimit{Key: key}, nil
+	}
 	if err != nil {
-		log.Printf("Warning: Failed to put block_until [%d] for host [%s] in %s table - %s", blockUntil, host, authErrTable, err)
-		return
+		log.Printf("Warning: Failed to get login limit [%s] from %s table - %s", key, loginLimits, err)
+	}
+	return l, err
+}
+
+func updateLoginLimit(key string, fn func(*LoginLimit)) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	forbiddenCache.Lock()
-	forbiddenCache.data[host] = blockUntil
-	forbiddenCache.Unlock()
+	// The expired limits are removed along the way, as the usernames failing
+	// to log in are up to the clients.
+	query := fmt.Sprintf("DELETE FROM %s WHERE expires <= ?", loginLimits) //nolint:gosec
+	if _, err := tx.Exec(query, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf("SELECT limit_key, failures, last_failure, blocked_until, expires FROM %s WHERE limit_key = ?", loginLimits) //nolint:gosec
+	l, err := scanLoginLimit(tx.QueryRow(query, key).Scan)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		l = LoginLimit{Key: key}
+	case err != nil:
+		return err
+	}
+
+	fn(&l)
+	if l.Failures == 0 {
+		query = fmt.Sprintf("DELETE FROM %s WHERE limit_key = ?", loginLimits) //nolint:gosec
+		_, err = tx.Exec(query, key)
+	} else {
+		query = fmt.Sprintf("INSERT OR REPLACE INTO %s (limit_key, failures, last_failure, blocked_until, expires) VALUES (?, ?, ?, ?, ?)", loginLimits) //nolint:gosec
+		_, err = tx.Exec(query, key, l.Failures, l.LastFailure.Unix(), l.BlockedUntil.Unix(), l.Expires.Unix())
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to update login limit [%s] in %s table - %s", key, loginLimits, err)
+		return err
+	}
+	return tx.Commit()
 }
 
-func removeForbiddenRecord(host string) {
-	query := fmt.Sprintf("DELETE FROM %s WHERE host = ?", authErrTable) //nolint:gosec
-	_, err := db.Exec(query, host)
+func removeLoginLimit(key string) (bool, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE limit_key = ?", loginLimits) //nolint:gosec
+	res, err := db.Exec(query, key)
 	if err != nil {
-		log.Printf("Warning: Failed to remove host [%s] from %s table - %s", host, authErrTable, err)
-		return
+		log.Printf("Warning: Failed to remove login limit [%s] from %s table - %s", key, loginLimits, err)
+		return false, err
 	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// getLoginLimits returns the login limits which aren't expired yet, removing
+// the others.
+func getLoginLimits(now time.Time) ([]LoginLimit, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE expires <= ?", loginLimits) //nolint:gosec
+	if _, err := db.Exec(query, now.Unix()); err != nil {
+		log.Printf("Warning: Failed to remove expired login limits from %s table - %s", loginLimits, err)
+		return nil, err
+	}
+
+	query = fmt.Sprintf("SELECT limit_key, failures, last_failure, blocked_until, expires FROM %s", loginLimits) //nolint:gosec
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	forbiddenCache.Lock()
-	delete(forbiddenCache.data, host)
-	forbiddenCache.Unlock()
+	limits := []LoginLimit{}
+	for rows.Next() {
+		l, err := scanLoginLimit(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, l)
+	}
+	return limits, rows.Err()
 }
 
 func GetAllowedJWT() []string {
@@ -151,7 +304,7 @@ func GetAllowedJWT() []string {
 	}
 	jwtCache.RUnlock()
 
-	query := fmt.Sprintf("SELECT * FROM %s", tokenTracker) //nolint:gosec
+	query := fmt.Sprintf("SELECT token FROM %s", tokenTracker) //nolint:gosec
 	rows, err := db.Query(query)
 	if err != nil {
 		log.Printf("Warning: Failed to get allowed JWTs from %s table - %s", tokenTracker, err)
@@ -182,46 +335,36 @@ func GetAllowedJWT() []string {
 	return tokens
 }
 
-func PutAllowedJWT(token string) error {
-	query := fmt.Sprintf("INSERT OR IGNORE INTO %s (token) VALUES (?)", tokenTracker) //nolint:gosec
+func RemoveAllowedJWT(token string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE token = ?", tokenTracker) //nolint:gosec
 	_, err := db.Exec(query, token)
 	if err != nil {
-		log.Printf("Warning: Failed to put token in %s: %v", tokenTracker, err)
+		log.Printf("Warning: Failed to remove token from %s: %v", tokenTracker, err)
 		return err
 	}
 
-	jwtCache.Lock()
-	for _, t := range jwtCache.data {
-		if t == token {
-			jwtCache.Unlock()
-			return nil // already present
+	forgetJWT(token)
+	sessionCache.Lock()
+	for id, s := range sessionCache.data {
+		if s.token == token {
+			delete(sessionCache.data, id)
 		}
 	}
-	jwtCache.data = append(jwtCache.data, token)
-	jwtCache.Unlock()
+	sessionCache.Unlock()
 
 	return nil
 }
 
-func RemoveAllowedJWT(token string) error {
-	query := fmt.Sprintf("DELETE FROM %s WHERE token = ?", tokenTracker) //nolint:gosec
-	_, err := db.Exec(query, token)
-	if err != nil {
-		log.Printf("Warning: Failed to remove token from %s: %v", tokenTracker, err)
-		return err
-	}
-
+func forgetJWT(tokens ...string) {
 	jwtCache.Lock()
 	filtered := jwtCache.data[:0]
 	for _, t := range jwtCache.data {
-		if t != token {
+		if !slices.Contains(tokens, t) {
 			filtered = append(filtered, t)
 		}
 	}
 	jwtCache.data = filtered
 	jwtCache.Unlock()
-
-	return nil
 }
 
 func RemoveAllJWT() error {
@@ -236,5 +379,205 @@ func RemoveAllJWT() error {
 	jwtCache.data = []string{}
 	jwtCache.Unlock()
 
+	sessionCache.Lock()
+	sessionCache.data = make(map[string]*Session)
+	sessionCache.Unlock()
+
+	return nil
+}
+
+func loadSessions() error {
+	sessionCache.RLock()
+	loaded := sessionCache.loaded
+	sessionCache.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	query := fmt.Sprintf("SELECT token, id, user_id, ip, user_agent, issued_at, last_seen, expires_at FROM %s WHERE id IS NOT NULL", tokenTracker) //nolint:gosec
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Printf("Warning: Failed to get sessions from %s table - %s", tokenTracker, err)
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := make(map[string]*Session)
+	var expired []string
+	for rows.Next() {
+		var (
+			s                  Session
+			issuedAt, lastSeen int64
+			expiresAt          sql.NullInt64
+		)
+		if err := rows.Scan(&s.token, &s.ID, &s.UserID, &s.IP, &s.UserAgent, &issuedAt, &lastSeen, &expiresAt); err != nil {
+			log.Printf("Warning: Failed to scan session from %s table - %s", tokenTracker, err)
+			continue
+		}
+		s.IssuedAt, s.LastSeen = time.Unix(issuedAt, 0), time.Unix(lastSeen, 0)
+		if expiresAt.Valid {
+			s.ExpiresAt = time.Unix(expiresAt.Int64, 0)
+		}
+		if s.expired(now) {
+			expired = append(expired, s.token)
+			continue
+		}
+		sessions[s.ID] = &s
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Expired sessions are left out for good.
+	query = fmt.Sprintf("DELETE FROM %s WHERE expires_at <= ?", tokenTracker) //nolint:gosec
+	if _, err := db.Exec(query, now.Unix()); err != nil {
+		log.Printf("Warning: Failed to remove expired sessions from %s table - %s", tokenTracker, err)
+		return err
+	}
+	forgetJWT(expired...)
+
+	sessionCache.Lock()
+	sessionCache.data = sessions
+	sessionCache.loaded = true
+	sessionCache.Unlock()
+	return nil
+}
+
+// PutSession allows the JWT of a session, which replaces the one it was
+// allowed with so far, if any. The sessions expired by then are removed.
+func PutSession(token string, s Session) error {
+	now := time.Now()
+	if err := removeSessions(func(s *Session) bool { return s.expired(now) }); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = ?", tokenTracker) //nolint:gosec
+	if _, err := tx.Exec(query, s.ID); err != nil {
+		return err
+	}
+	var expiresAt sql.NullInt64
+	if !s.ExpiresAt.IsZero() {
+		expiresAt = sql.NullInt64{Int64: s.ExpiresAt.Unix(), Valid: true}
+	}
+	query = fmt.Sprintf("INSERT OR REPLACE INTO %s (token, id, user_id, ip, user_agent, issued_at, last_seen, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", tokenTracker) //nolint:gosec
+	if _, err := tx.Exec(query, token, s.ID, s.UserID, s.IP, s.UserAgent, s.IssuedAt.Unix(), s.LastSeen.Unix(), expiresAt); err != nil {
+		log.Printf("Warning: Failed to put session in %s: %v", tokenTracker, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.token = token
+	sessionCache.Lock()
+	if previous, ok := sessionCache.data[s.ID]; ok {
+		defer forgetJWT(previous.token)
+	}
+	sessionCache.data[s.ID] = &s
+	sessionCache.Unlock()
+
+	jwtCache.Lock()
+	jwtCache.data = append(jwtCache.data, token)
+	jwtCache.Unlock()
+	return nil
+}
+
+// GetSession returns a session, unless it was revoked.
+func GetSession(id string) (Session, bool) {
+	if err := loadSessions(); err != nil {
+		return Session{}, false
+	}
+
+	sessionCache.RLock()
+	defer sessionCache.RUnlock()
+	s, ok := sessionCache.data[id]
+	if !ok {
+		return Session{}, false
+	}
+	return *s, true
+}
+
+// GetSessions returns the sessions of a user which haven't expired yet, the
+// latest first.
+func GetSessions(userID uint) ([]Session, error) {
+	if err := loadSessions(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessionCache.RLock()
+	sessions := []Session{}
+	for _, s := range sessionCache.data {
+		if s.UserID == userID && !s.expired(now) {
+			sessions = append(sessions, *s)
+		}
+	}
+	sessionCache.RUnlock()
+
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return b.IssuedAt.Compare(a.IssuedAt)
+	})
+	return sessions, nil
+}
+
+// TouchSession records that a session was just seen.
+func TouchSession(id string) {
+	now := time.Now()
+	sessionCache.Lock()
+	s, ok := sessionCache.data[id]
+	if !ok || now.Sub(s.LastSeen) < lastSeenResolution {
+		sessionCache.Unlock()
+		return
+	}
+	s.LastSeen = now
+	sessionCache.Unlock()
+
+	query := fmt.Sprintf("UPDATE %s SET last_seen = ? WHERE id = ?", tokenTracker) //nolint:gosec
+	if _, err := db.Exec(query, now.Unix(), id); err != nil {
+		log.Printf("Warning: Failed to update session [%s] in %s: %v", id, tokenTracker, err)
+	}
+}
+
+// RemoveSession revokes a session.
+func RemoveSession(id string) error {
+	return removeSessions(func(s *Session) bool { return s.ID == id })
+}
+
+// RemoveUserSessions revokes the sessions of a user, but the one given, if
+// any.
+func RemoveUserSessions(userID uint, except string) error {
+	return removeSessions(func(s *Session) bool { return s.UserID == userID && s.ID != except })
+}
+
+func removeSessions(match func(s *Session) bool) error {
+	if err := loadSessions(); err != nil {
+		return err
+	}
+
+	sessionCache.Lock()
+	defer sessionCache.Unlock()
+
+	var tokens []string
+	for id, s := range sessionCache.data {
+		if !match(s) {
+			continue
+		}
+		query := fmt.Sprintf("DELETE FROM %s WHERE id = ?", tokenTracker) //nolint:gosec
+		if _, err := db.Exec(query, id); err != nil {
+			log.Printf("Warning: Failed to remove session [%s] from %s: %v", id, tokenTracker, err)
+			return err
+		}
+		delete(sessionCache.data, id)
+		tokens = append(tokens, s.token)
+	}
+
+	forgetJWT(tokens...)
 	return nil
 }
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openTestDatabase points the auth database at a fresh file, with the table
+// of tokens created by older versions holding the given ones.
+func openTestDatabase(t *testing.T, legacy ...string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "auth.db")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := old.Exec("CREATE TABLE token_tracker (token TEXT UNIQUE)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range legacy {
+		if _, err := old.Exec("INSERT INTO token_tracker (token) VALUES (?)", token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := old.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := authDB
+	authDB = path
+	initializeDatabase()
+	t.Cleanup(func() {
+		_ = db.Close()
+		authDB = previous
+	})
+}
+
+func TestSessions(t *testing.T) {
+	openTestDatabase(t, "legacy")
+
+	if got := GetAllowedJWT(); !slices.Equal(got, []string{"legacy"}) {
+		t.Fatalf("expected the legacy token to be kept, got %v", got)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	first := Session{ID: "a", UserID: 1, IP: "10.0.0.1", UserAgent: "curl", IssuedAt: now.Add(-time.Hour), LastSeen: now.Add(-time.Hour)}
+	if err := PutSession("jwt-a1", first); err != nil {
+		t.Fatal(err)
+	}
+	// Renewing a session replaces the JWT it is allowed with.
+	if err := PutSession("jwt-a2", first); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []Session{
+		{ID: "b", UserID: 1, IssuedAt: now, LastSeen: now},
+		{ID: "c", UserID: 2, IssuedAt: now, LastSeen: now},
+	} {
+		if err := PutSession("jwt-"+s.ID, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	allowed := GetAllowedJWT()
+	if slices.Contains(allowed, "jwt-a1") || !slices.Contains(allowed, "jwt-a2") {
+		t.Errorf("expected only the renewed JWT to be allowed, got %v", allowed)
+	}
+
+	// The sessions are loaded back from the database.
+	sessionCache.loaded = false
+	sessions, err := GetSessions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "b" || sessions[1].ID != "a" {
+		t.Fatalf("expected the sessions of the user latest first, got %+v", sessions)
+	}
+	if got := sessions[1]; got.IP != first.IP || got.UserAgent != first.UserAgent || !got.IssuedAt.Equal(first.IssuedAt) {
+		t.Errorf("expected %+v, got %+v", first, got)
+	}
+
+	TouchSession("a")
+	if s, ok := GetSession("a"); !ok || !s.LastSeen.After(first.LastSeen) {
+		t.Errorf("expected the session to be seen, got %+v", s)
+	}
+
+	if err := RemoveUserSessions(1, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetSession("a"); ok {
+		t.Error("expected the session to be revoked")
+	}
+	if _, ok := GetSession("b"); !ok {
+		t.Error("expected the kept session not to be revoked")
+	}
+	if slices.Contains(GetAllowedJWT(), "jwt-a2") {
+		t.Error("expected the JWT of the revoked session not to be allowed")
+	}
+
+	if err := RemoveSession("c"); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, err := GetSessions(2); err != nil || len(sessions) != 0 {
+		t.Errorf("expected no sessions, got %+v %v", sessions, err)
+	}
+
+	// Expired sessions aren't listed, and are removed once another is put or
+	// the sessions are loaded.
+	expired := Session{ID: "d", UserID: 3, IssuedAt: now, LastSeen: now, ExpiresAt: time.Now().Add(time.Second)}
+	if err := PutSession("jwt-d", expired); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, err := GetSessions(3); err != nil || len(sessions) != 1 || !sessions[0].ExpiresAt.Equal(expired.ExpiresAt) {
+		t.Errorf("expected the session until it expires, got %+v %v", sessions, err)
+	}
+	sessionCache.Lock()
+	sessionCache.data["d"].ExpiresAt = now.Add(-time.Minute)
+	sessionCache.Unlock()
+	if sessions, err := GetSessions(3); err != nil || len(sessions) != 0 {
+		t.Errorf("expected the expired session not to be listed, got %+v %v", sessions, err)
+	}
+	if err := PutSession("jwt-e", Session{ID: "e", UserID: 3, IssuedAt: now, LastSeen: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetSession("d"); ok || slices.Contains(GetAllowedJWT(), "jwt-d") {
+		t.Error("expected the expired session to be removed")
+	}
+
+	if _, err := db.Exec("UPDATE token_tracker SET expires_at = ? WHERE id = ?", now.Add(-time.Minute).Unix(), "e"); err != nil {
+		t.Fatal(err)
+	}
+	sessionCache.loaded = false
+	if _, ok := GetSession("e"); ok || slices.Contains(GetAllowedJWT(), "jwt-e") {
+		t.Error("expected the expired session not to be loaded")
+	}
+	var rows int
+	if err := db.QueryRow("SELECT COUNT(*) FROM token_tracker WHERE id IN ('d', 'e')").Scan(&rows); err != nil || rows != 0 {
+		t.Errorf("expected the expired sessions to be deleted, got %d %v", rows, err)
+	}
+	if !slices.Contains(GetAllowedJWT(), "legacy") {
+		t.Error("expected the legacy token to be kept")
+	}
+}
@@ -48,6 +48,16 @@ func (a *HookAuth) Auth(r *http.Request, usr users.Store, stg *settings.Settings
 		return nil, os.ErrPermission
 	}
 
+	return a.authenticate(cred, usr, stg, srv)
+}
+
+// AuthPassword authenticates a plain username and password pair through the
+// hook command.
+func (a *HookAuth) AuthPassword(_ *http.Request, username, password string, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
+	return a.authenticate(hookCred{Username: username, Password: password}, usr, stg, srv)
+}
+
+func (a *HookAuth) authenticate(cred hookCred, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
 	a.Users = usr
 	a.Settings = stg
 	a.Server = srv
@@ -66,11 +76,11 @@ func (a *HookAuth) Auth(r *http.Request, usr users.Store, stg *settings.Settings
 		}
 		return u, nil
 	case "block":
-		return nil, os.ErrPermission
+		return nil, refuse(a.Cred.Username, nil)
 	case "pass":
 		u, err := a.Users.Get(a.Server.Root, a.Server.FollowExternalSymlinks, a.Cred.Username)
 		if err != nil || !users.CheckPwd(a.Cred.Password, u.Password) {
-			return nil, os.ErrPermission
+			return nil, refuse(a.Cred.Username, nil)
 		}
 		return u, nil
 	default:
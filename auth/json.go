@@ -3,14 +3,16 @@ package auth
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
-	"time"
 
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
 	"github.com/thevickypedia/filebrowser/v2/settings"
 	"github.com/thevickypedia/filebrowser/v2/users"
 )
@@ -29,10 +31,23 @@ type jsonCred struct {
 	Otp       string `json:"otp"`
 }
 
+// ErrOtpRequired tells that the password was right, but that the user must
+// also give a one-time password.
+var ErrOtpRequired = fmt.Errorf("%w: a one-time password is required", os.ErrPermission)
+
 // JSONAuth is a json implementation of an Auther.
 type JSONAuth struct {
-	ReCaptcha          *ReCaptcha `json:"recaptcha" yaml:"recaptcha"`
-	AuthenticatorToken string     `json:"authenticatorToken" yaml:"authenticatorToken"`
+	ReCaptcha *ReCaptcha `json:"recaptcha" yaml:"recaptcha"`
+	// Deprecated: AuthenticatorToken was the one-time password secret the
+	// whole instance shared. It is moved onto the users who didn't enroll an
+	// authenticator of their own on start up.
+	AuthenticatorToken string            `json:"authenticatorToken,omitempty" yaml:"authenticatorToken,omitempty"`
+	Passkeys           *passkeys.Storage `json:"-" yaml:"-"`
+}
+
+// jsonBody is the optional body of a login request.
+type jsonBody struct {
+	Passkey *PasskeyAssertion `json:"passkey"`
 }
 
 // decodeUnicodeEscape decodes Unicode escape sequences in a string
@@ -104,100 +119,9 @@ func extractCredentials(value string) (*jsonCred, error) {
 	return authDetails, nil
 }
 
-func rHost(r *http.Request) string {
-	return strings.Split(r.Host, ":")[0]
-}
-
-// mutex to handle concurrent access to the errors map
-// var mutex = &sync.Mutex{}
-
-// authCounter is a map to store the error counts for each host
-var authCounter = make(map[string]int)
-
-// forbidden is an array to store the hosts that are temporarily forbidden
-var forbidden []string
-
-func handleAuthError(r *http.Request) {
-	host := rHost(r)
-	if count, exists := authCounter[host]; exists {
-		authCounter[host] = count + 1
-		log.Printf("Warning: Failed auth, attempt #%d for %s", authCounter[host], host)
-		attempt := authCounter[host]
-		if attempt >= 10 {
-			epoch := time.Now().Unix()
-			until := epoch + 2_592_000
-			formattedTime := time.Unix(until, 0).Format("2006-01-02 15:04:05 MST")
-			log.Printf("Warning: %s is blocked until %s", host, formattedTime)
-			removeForbiddenRecord(host)
-			putForbiddenRecord(host, until)
-		} else if attempt > 3 {
-			var alreadyBlocked bool
-			alreadyBlocked = false
-			for _, blocked := range forbidden {
-				if host == blocked {
-					alreadyBlocked = true
-					break
-				}
-			}
-			if !alreadyBlocked {
-				forbidden = append(forbidden, host)
-			}
-
-			mapped := map[int]int{4: 5, 5: 10, 6: 20, 7: 40, 8: 80, 9: 160, 10: 220}
-			minutes, ok := mapped[attempt]
-			if !ok {
-				log.Printf("Warning: Something went horribly wrong for %dth attempt", attempt)
-				minutes = 60 // Default to 1 hour
-			}
-			epoch := time.Now().Unix()
-			until := epoch + int64(minutes*60)
-			formattedTime := time.Unix(until, 0).Format("2006-01-02 15:04:05 MST")
-			log.Printf("Warning: %s is blocked (for %d minutes) until %s", host, minutes, formattedTime)
-			removeForbiddenRecord(host)
-			putForbiddenRecord(host, until)
-		}
-	} else {
-		log.Printf("Warning: Failed auth, attempt #1 for %s", host)
-		authCounter[host] = 1
-	}
-}
-
-func removeItem(slice []string, item string) []string {
-	for i := 0; i < len(slice); i++ {
-		if slice[i] == item {
-			// Found the item, remove it by slicing the slice
-			return append(slice[:i], slice[i+1:]...)
-		}
-	}
-	// If item is not found, return the original slice
-	return slice
-}
-
-// Auth authenticates the user via a json in authorization header.
-func (a JSONAuth) Auth(r *http.Request, usr users.Store, _ *settings.Settings, srv *settings.Server) (*users.User, error) {
-	var block bool
-	block = false
-	host := rHost(r)
-	for _, blocked := range forbidden {
-		if host == blocked {
-			block = true
-			break
-		}
-	}
-	if block {
-		timestamp, err := getForbiddenRecord(host)
-		if err != nil {
-			log.Printf("Warning: Unable to check if %s was forbidden, allowing..", host)
-		} else {
-			epoch := time.Now().Unix()
-			if timestamp > epoch {
-				formattedTime := time.Unix(timestamp, 0).Format("2006-01-02 15:04:05 MST")
-				log.Printf("Warning: %s is forbidden until %s due to repeated login failures", host, formattedTime)
-				return nil, os.ErrPermission
-			}
-		}
-	}
-
+// Auth authenticates the user via a json in authorization header, and the
+// passkey assertion in the body, if any.
+func (a JSONAuth) Auth(r *http.Request, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		return nil, os.ErrPermission
@@ -222,32 +146,107 @@ func (a JSONAuth) Auth(r *http.Request, usr users.Store, _ *settings.Settings, s
 		}
 	}
 
+	var body jsonBody
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			log.Printf("Warning: Failed to decode the login body. %s", err)
+			return nil, os.ErrPermission
+		}
+	}
+
+	return a.authenticate(r, cred, body.Passkey, usr, stg, srv)
+}
+
+// AuthPassword authenticates a plain username and password pair. Since there
+// is nowhere to supply a one-time password or a passkey, it always refuses to
+// log in users who must prove a second factor, or enroll one.
+func (a JSONAuth) AuthPassword(r *http.Request, username, password string, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
+	u, err := a.authenticate(r, &jsonCred{Username: username, Password: password}, nil, usr, stg, srv)
+	if err != nil {
+		return nil, err
+	}
+	if u.MustEnrollOtp() {
+		log.Printf("Warning: Password login refused for %s - an OTP authenticator must be enrolled", username)
+		return nil, os.ErrPermission
+	}
+	return u, nil
+}
+
+func (a JSONAuth) authenticate(r *http.Request, cred *jsonCred, passkey *PasskeyAssertion, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, error) {
+	var passkeyUser *users.User
+	if passkey != nil {
+		u, verified, err := verifyPasskey(r, passkey, a.Passkeys, usr, stg, srv)
+		switch {
+		case errors.Is(err, os.ErrPermission):
+			log.Printf("Warning: Login error for %s - invalid passkey: %v", cred.Username, err)
+			return nil, refuse(cred.Username, nil)
+		case err != nil:
+			return nil, err
+		}
+
+		// A passkey the authenticator verified its owner for is enough on
+		// its own.
+		if cred.Password == "" {
+			if !verified || (cred.Username != "" && cred.Username != u.Username) {
+				log.Printf("Warning: Login error for %s - passkey of %s not verified", cred.Username, u.Username)
+				return nil, refuse(u.Username, nil)
+			}
+			return u, nil
+		}
+		passkeyUser = u
+	}
+
 	u, err := usr.Get(srv.Root, srv.FollowExternalSymlinks, cred.Username)
 	if err != nil {
 		log.Printf("Warning: Login error for %s - lookup failed: %v", cred.Username, err)
 		// Even if the user is not found, we check the password against a dummy hash
 		// to prevent user enumeration timing attacks.
 		users.CheckPwd(cred.Password, dummyHash)
-		handleAuthError(r)
-		return nil, os.ErrPermission
+		return nil, refuse(cred.Username, nil)
 	}
 
 	if !users.CheckPwd(cred.Password, u.Password) {
 		log.Printf("Warning: Login error for %s - invalid password", cred.Username)
-		handleAuthError(r)
-		return nil, os.ErrPermission
+		return nil, refuse(cred.Username, nil)
 	}
 
-	if !users.CheckOtp(cred.Otp, a.AuthenticatorToken) {
-		log.Printf("Warning: Login error for %s - invalid otp: [%s]", cred.Username, cred.Otp)
-		handleAuthError(r)
-		return nil, os.ErrPermission
+	codes := len(u.TOTP.RecoveryCodes)
+	ok := checkSecondFactor(u, cred.Otp, passkeyUser)
+	// A recovery code was used up.
+	if len(u.TOTP.RecoveryCodes) != codes {
+		if err := usr.Update(u, "TOTP"); err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		log.Printf("Warning: Login error for %s - invalid second factor (%q), otp: [%s]", cred.Username, u.SecondFactor, cred.Otp)
+		if u.TOTP.Enrolled() && u.SecondFactor != users.SecondFactorPasskey {
+			return nil, refuse(u.Username, ErrOtpRequired)
+		}
+		return nil, refuse(u.Username, nil)
 	}
 
-	forbidden = removeItem(forbidden, host)
 	return u, nil
 }
 
+// checkSecondFactor reports whether the one-time password, or the user whose
+// passkey was asserted, satisfies what u must prove besides their password.
+// Users who must enroll an authenticator are let in to do so.
+func checkSecondFactor(u *users.User, otp string, passkeyUser *users.User) bool {
+	passkey := passkeyUser != nil && passkeyUser.ID == u.ID
+
+	switch u.SecondFactor {
+	case users.SecondFactorTOTP:
+		return u.MustEnrollOtp() || users.CheckOtp(u, otp)
+	case users.SecondFactorPasskey:
+		return passkey
+	case users.SecondFactorAny:
+		return passkey || users.CheckOtp(u, otp)
+	default:
+		return !u.TOTP.Enrolled() || users.CheckOtp(u, otp)
+	}
+}
+
 // LoginPage tells that json auth doesn't require a login page.
 func (a JSONAuth) LoginPage() bool {
 	return true
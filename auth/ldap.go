@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// MethodLDAPAuth is used to identify LDAP auth.
+const MethodLDAPAuth settings.AuthMethod = "ldap"
+
+const (
+	// DefaultLDAPUserFilter is the filter users are searched with when none
+	// is configured.
+	DefaultLDAPUserFilter = "(uid={username})"
+	// DefaultLDAPUsernameAttribute is the attribute usernames are taken from
+	// when none is configured.
+	DefaultLDAPUsernameAttribute = "uid"
+	// DefaultLDAPGroupAttribute is the attribute listing the groups of the
+	// users when none is configured.
+	DefaultLDAPGroupAttribute = "memberOf"
+
+	ldapTimeout = 10 * time.Second
+)
+
+// LDAPGroup grants the members of a group of the directory their permissions,
+// commands and scope.
+type LDAPGroup struct {
+	DN       string            `json:"dn"`
+	Perm     users.Permissions `json:"perm"`
+	Scope    string            `json:"scope,omitempty"`
+	Commands []string          `json:"commands,omitempty"`
+}
+
+// LDAPAuth is an LDAP implementation of an auther. Users are searched for with
+// the service account, if any, and logged in by binding as them.
+type LDAPAuth struct {
+	URL                string      `json:"url"`
+	StartTLS           bool        `json:"startTLS"`
+	InsecureSkipVerify bool        `json:"insecureSkipVerify"`
+	CACert             string      `json:"caCert"`
+	BindDN             string      `json:"bindDN"`
+	BindPassword       string      `json:"bindPassword"`
+	BaseDN             string      `json:"baseDN"`
+	UserFilter         string      `json:"userFilter"`
+	UsernameAttribute  string      `json:"usernameAttribute"`
+	GroupAttribute     string      `json:"groupAttribute"`
+	Groups             []LDAPGroup `json:"groups"`
+}
+
+// Auth authenticates the user via a json in authorization header, against the
+// directory.
+func (a LDAPAuth) Auth(r *http.Request, usr users.Store, setting *settings.Settings, srv *settings.Server) (*users.User, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, os.ErrPermission
+	}
+
+	cred, err := extractCredentials(authHeader)
+	if err != nil {
+		log.Printf("Warning: Failed to extract credentials. %s", err)
+		return nil, os.ErrPermission
+	}
+
+	return a.authenticate(cred.Username, cred.Password, usr, setting, srv)
+}
+
+// AuthPassword authenticates a plain username and password pair against the
+// directory.
+func (a LDAPAuth) AuthPassword(_ *http.Request, username, password string, usr users.Store, setting *settings.Settings, srv *settings.Server) (*users.User, error) {
+	return a.authenticate(username, password, usr, setting, srv)
+}
+
+// LoginPage tells that LDAP auth requires a login page.
+func (a LDAPAuth) LoginPage() bool {
+	return true
+}
+
+func (a LDAPAuth) authenticate(username, password string, usr users.Store, setting *settings.Settings, srv *settings.Server) (*users.User, error) {
+	// Binding without a password is an unauthenticated bind, which most
+	// directories accept whatever the DN.
+	if username == "" || password == "" {
+		return nil, refuse(username, nil)
+	}
+
+	entry, err := a.verify(username, password)
+	if errors.Is(err, os.ErrPermission) {
+		log.Printf("Warning: Login error for %s - %v", username, err)
+		return nil, refuse(username, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if name := entry.GetAttributeValue(cmp.Or(a.UsernameAttribute, DefaultLDAPUsernameAttribute)); name != "" {
+		username = name
+	}
+	groups := entry.GetAttributeValues(cmp.Or(a.GroupAttribute, DefaultLDAPGroupAttribute))
+	mapped, ok := a.mapGroups(groups)
+	if !ok && len(a.Groups) > 0 {
+		// Those who left all the mapped groups are back to the defaults,
+		// rather than keeping what their groups gave them.
+		mapped, ok = LDAPGroup{Perm: defaultPerm(setting), Commands: []string{}}, true
+	}
+
+	user, err := usr.Get(srv.Root, srv.FollowExternalSymlinks, username)
+	if errors.Is(err, fberrors.ErrNotExist) {
+		return createUser(usr, setting, srv, username, func(user *users.User) {
+			if !ok {
+				return
+			}
+			user.Perm = mapped.Perm
+			user.Commands = mapped.Commands
+			if mapped.Scope != "" {
+				user.Scope = mapped.Scope
+			}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The directory is the authority on the permissions of the members of
+	// mapped groups, which are synced on every login.
+	if !ok {
+		return user, nil
+	}
+
+	var fields []string
+	if user.Perm != mapped.Perm {
+		user.Perm = mapped.Perm
+		fields = append(fields, "Perm")
+	}
+	if !slices.Equal(user.Commands, mapped.Commands) {
+		user.Commands = mapped.Commands
+		fields = append(fields, "Commands")
+	}
+	if mapped.Scope != "" {
+		scope, err := setting.MakeUserDir(user.Username, mapped.Scope, srv.Root)
+		if err != nil {
+			return nil, err
+		}
+		if scope != user.Scope {
+			user.Scope = scope
+			fields = append(fields, "Scope")
+		}
+	}
+	if len(fields) > 0 {
+		if err := usr.Update(user, fields...); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// verify looks the user up in the directory and binds as them. It returns
+// their entry, or an error wrapping os.ErrPermission when they can't log in.
+func (a LDAPAuth) verify(username, password string) (*ldap.Entry, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.BindDN != "" {
+		if err := conn.Bind(a.BindDN, a.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service bind: %w", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(cmp.Or(a.UserFilter, DefaultLDAPUserFilter), "{username}", ldap.EscapeFilter(username))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		filter,
+		[]string{cmp.Or(a.UsernameAttribute, DefaultLDAPUsernameAttribute), cmp.Or(a.GroupAttribute, DefaultLDAPGroupAttribute)},
+		nil,
+	))
+	switch {
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject):
+		return nil, fmt.Errorf("%w: user not found", os.ErrPermission)
+	case err != nil:
+		return nil, fmt.Errorf("LDAP search: %w", err)
+	case len(res.Entries) != 1:
+		return nil, fmt.Errorf("%w: %d users match %s", os.ErrPermission, len(res.Entries), filter)
+	}
+
+	entry := res.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, fmt.Errorf("%w: invalid password", os.ErrPermission)
+		}
+		return nil, fmt.Errorf("LDAP bind: %w", err)
+	}
+	return entry, nil
+}
+
+func (a LDAPAuth) dial() (*ldap.Conn, error) {
+	if a.URL == "" || a.BaseDN == "" {
+		return nil, errors.New("the LDAP URL and base DN must be configured")
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.InsecureSkipVerify} //nolint:gosec
+	if a.CACert != "" {
+		pem, err := os.ReadFile(a.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", a.CACert)
+		}
+	}
+
+	conn, err := ldap.DialURL(a.URL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("LDAP dial: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if a.StartTLS {
+		// Unlike ldaps, StartTLS isn't told the host to check the certificate
+		// against.
+		if u, err := url.Parse(a.URL); err == nil {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// mapGroups returns the permissions and commands granted by the mapped groups
+// among groups, and the scope of the first of them having one. ok is false
+// when none of them is mapped.
+func (a LDAPAuth) mapGroups(groups []string) (mapped LDAPGroup, ok bool) {
+	dns := make([]*ldap.DN, 0, len(groups))
+	for _, group := range groups {
+		if dn, err := ldap.ParseDN(group); err == nil {
+			dns = append(dns, dn)
+		}
+	}
+
+	mapped.Commands = []string{}
+	for _, group := range a.Groups {
+		dn, err := ldap.ParseDN(group.DN)
+		if err != nil || !slices.ContainsFunc(dns, dn.EqualFold) {
+			continue
+		}
+
+		ok = true
+		mapped.Perm.Merge(group.Perm)
+		for _, command := range group.Commands {
+			if !slices.Contains(mapped.Commands, command) {
+				mapped.Commands = append(mapped.Commands, command)
+			}
+		}
+		if mapped.Scope == "" {
+			mapped.Scope = group.Scope
+		}
+	}
+	return mapped, ok
+}
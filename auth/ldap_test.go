@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jimlambrt/gldap"
+	"github.com/jimlambrt/gldap/testdirectory"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+const (
+	ldapEditors = "cn=Editors," + testdirectory.DefaultGroupDN
+	ldapSharers = "cn=sharers," + testdirectory.DefaultGroupDN
+)
+
+func ldapUser(uid string, groups ...string) *gldap.Entry {
+	return gldap.NewEntry("uid="+uid+","+testdirectory.DefaultUserDN, map[string][]string{
+		"uid":      {uid},
+		"password": {uid + "-password"},
+		"memberOf": groups,
+	})
+}
+
+// ldapLogin returns a login request with the credentials encoded the way the
+// login page does.
+func ldapLogin(host, username, password string) *http.Request {
+	encode := func(s string) string {
+		var b strings.Builder
+		for _, r := range s {
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+		return b.String()
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/login", http.NoBody)
+	r.Host = host
+	r.Header.Set("Authorization", base64.StdEncoding.EncodeToString([]byte(encode(username)+","+encode(password)+",,")))
+	return r
+}
+
+func TestLDAPAuth(t *testing.T) {
+	t.Parallel()
+
+	service := gldap.NewEntry("cn=service,"+testdirectory.DefaultUserDN, map[string][]string{
+		"password": {"service-password"},
+	})
+	directory := testdirectory.Start(t, testdirectory.WithNoTLS(t), testdirectory.WithDefaults(t, &testdirectory.Defaults{
+		Users: []*gldap.Entry{service, ldapUser("alice", ldapEditors, ldapSharers), ldapUser("bob")},
+	}))
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caCert, []byte(directory.Cert()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &mockUserStore{users: make(map[string]*users.User)}
+	srv := &settings.Server{Root: t.TempDir()}
+	s := &settings.Settings{
+		Key: []byte("key"),
+		Defaults: settings.UserDefaults{
+			Perm:     users.Permissions{Admin: true, Download: true},
+			Commands: []string{"ls"},
+		},
+	}
+	a := LDAPAuth{
+		URL:          fmt.Sprintf("ldap://%s:%d", directory.Host(), directory.Port()),
+		StartTLS:     true,
+		CACert:       caCert,
+		BindDN:       service.DN,
+		BindPassword: "service-password",
+		BaseDN:       testdirectory.DefaultUserDN,
+		Groups: []LDAPGroup{
+			// Group DNs are compared the way the directory does.
+			{DN: "CN=editors, " + testdirectory.DefaultGroupDN, Perm: users.Permissions{Create: true, Modify: true}, Scope: "/shared", Commands: []string{"git"}},
+			{DN: ldapSharers, Perm: users.Permissions{Share: true}, Commands: []string{"git", "tar"}},
+		},
+	}
+
+	user, err := a.Auth(ldapLogin("alice.example", "alice", "alice-password"), store, s, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := users.Permissions{Create: true, Modify: true, Share: true}
+	if user.Username != "alice" || user.Perm != want || user.Scope != "/shared" || !slices.Equal(user.Commands, []string{"git", "tar"}) || !user.LockPassword {
+		t.Errorf("expected alice to be created from her groups, got %+v", user)
+	}
+
+	// Users out of the mapped groups get the defaults, but never as admins.
+	user, err = a.AuthPassword(httptest.NewRequest(http.MethodGet, "/", http.NoBody), "bob", "bob-password", store, s, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Perm != (users.Permissions{Download: true}) || len(user.Commands) != 0 {
+		t.Errorf("expected bob to be created with the defaults, got %+v", user)
+	}
+
+	// What the groups grant is synced on every login.
+	directory.SetUsers(service, ldapUser("alice", ldapSharers), ldapUser("bob", ldapEditors))
+	if user, err = a.Auth(ldapLogin("alice.example", "alice", "alice-password"), store, s, srv); err != nil ||
+		user.Perm != (users.Permissions{Share: true}) || !slices.Equal(user.Commands, []string{"git", "tar"}) || user.Scope != "/shared" {
+		t.Errorf("expected alice's permissions to be synced, got %+v %v", user, err)
+	}
+	if user, err = a.Auth(ldapLogin("bob.example", "bob", "bob-password"), store, s, srv); err != nil ||
+		user.Perm != (users.Permissions{Create: true, Modify: true}) || !slices.Equal(user.Commands, []string{"git"}) || user.Scope != "/shared" {
+		t.Errorf("expected bob's permissions to be synced, got %+v %v", user, err)
+	}
+
+	// Leaving the mapped groups takes away what they gave.
+	directory.SetUsers(service, ldapUser("alice", ldapSharers), ldapUser("bob"))
+	if user, err = a.Auth(ldapLogin("bob.example", "bob", "bob-password"), store, s, srv); err != nil ||
+		user.Perm != (users.Permissions{Download: true}) || len(user.Commands) != 0 {
+		t.Errorf("expected bob to be back to the defaults, got %+v %v", user, err)
+	}
+
+	for name, login := range map[string]*http.Request{
+		"wrong password": ldapLogin("wrong.example", "alice", "bob-password"),
+		"empty password": ldapLogin("empty.example", "alice", ""),
+		"unknown user":   ldapLogin("unknown.example", "mallory", "mallory-password"),
+		"no credentials": httptest.NewRequest(http.MethodPost, "/api/login", http.NoBody),
+	} {
+		if _, err := a.Auth(login, store, s, srv); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("%s: expected the login to be refused, got %v", name, err)
+		}
+	}
+
+	// The directory must be trusted.
+	untrusted := a
+	untrusted.CACert = ""
+	if _, err := untrusted.Auth(ldapLogin("alice.example", "alice", "alice-password"), store, s, srv); err == nil || errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected an untrusted directory to fail, got %v", err)
+	}
+}
+
+func TestLDAPAuthLDAPS(t *testing.T) {
+	t.Parallel()
+
+	directory := testdirectory.Start(t, testdirectory.WithDefaults(t, &testdirectory.Defaults{
+		Users:              []*gldap.Entry{ldapUser("carol")},
+		AllowAnonymousBind: true,
+	}))
+
+	store := &mockUserStore{users: make(map[string]*users.User)}
+	srv := &settings.Server{Root: t.TempDir()}
+	a := LDAPAuth{
+		URL:                fmt.Sprintf("ldaps://%s:%d", directory.Host(), directory.Port()),
+		InsecureSkipVerify: true,
+		BaseDN:             testdirectory.DefaultUserDN,
+	}
+
+	user, err := a.Auth(ldapLogin("carol.example", "carol", "carol-password"), store, &settings.Settings{Key: []byte("key")}, srv)
+	if err != nil || user.Username != "carol" {
+		t.Fatalf("expected carol to log in with an anonymous search, got %+v %v", user, err)
+	}
+	// The directory accepts unauthenticated binds.
+	if _, err := a.Auth(ldapLogin("carol.example", "carol", ""), store, &settings.Settings{Key: []byte("key")}, srv); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected an empty password to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// Failed logins are counted against the client they come from and the user
+// they are for, under keys with these prefixes.
+const (
+	LimitIPPrefix   = "ip:"
+	LimitUserPrefix = "user:"
+)
+
+// LimitIPKey returns the key the failed logins of a client are counted under.
+func LimitIPKey(ip string) string {
+	return LimitIPPrefix + ip
+}
+
+// ClientIP returns the address of the client a request comes from, as its
+// failed logins are counted against. The addresses forwarded by proxies are
+// only believed from those trusted by the limits, and only as far as they
+// were added by trusted proxies, clients being able to send any.
+func ClientIP(r *http.Request, limits settings.LoginLimits) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !limits.TrustsProxy(ip) {
+		return ip
+	}
+
+	// Every proxy appends the address it was connected from.
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(addr))
+		}
+	}
+	if len(forwarded) == 0 {
+		if real := strings.TrimSpace(r.Header.Get("X-Real-Ip")); real != "" {
+			return real
+		}
+	}
+	for _, addr := range slices.Backward(forwarded) {
+		if addr == "" {
+			continue
+		}
+		if !limits.TrustsProxy(addr) {
+			return addr
+		}
+		ip = addr
+	}
+	return ip
+}
+
+// LimitUserKey returns the key the failed logins of a user are counted under.
+func LimitUserKey(username string) string {
+	return LimitUserPrefix + username
+}
+
+// LoginError is a login refused because of the credentials it was given. Its
+// failure is counted against the client, and the user if it is known.
+type LoginError struct {
+	Username string
+	Err      error
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("login of %q refused: %v", e.Username, e.Err)
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// refuse refuses the login of a user with err, which is os.ErrPermission
+// unless given.
+func refuse(username string, err error) error {
+	return &LoginError{Username: username, Err: cmp.Or(err, os.ErrPermission)}
+}
+
+// LockoutError is a login refused because its client, or the user it is for,
+// failed to log in too often.
+type LockoutError struct {
+	Key   string
+	Until time.Time
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s is locked out until %s", e.Key, e.Until.Format(time.RFC3339))
+}
+
+func (e *LockoutError) Is(target error) bool {
+	return target == os.ErrPermission
+}
+
+// LoginLimit is what is remembered of the failed logins of a client or user.
+type LoginLimit struct {
+	Key          string    `json:"key"`
+	Failures     uint      `json:"failures"`
+	LastFailure  time.Time `json:"lastFailure"`
+	BlockedUntil time.Time `json:"blockedUntil"`
+	// Expires is when the failures are forgotten.
+	Expires time.Time `json:"expires"`
+}
+
+// Blocked reports whether logins are refused at the given time.
+func (l LoginLimit) Blocked(now time.Time) bool {
+	return now.Before(l.BlockedUntil)
+}
+
+// LimitsBackend stores the login limits.
+type LimitsBackend interface {
+	// Get returns the limit of key, which has no failures if there is none.
+	Get(key string) (LoginLimit, error)
+	// Update changes the limit of key atomically, which fn is given without
+	// failures if there is none. Limits left without failures are removed.
+	Update(key string, fn func(*LoginLimit)) error
+	// Delete removes the limit of key, returning fberrors.ErrNotExist if
+	// there is none.
+	Delete(key string) error
+	// All returns the limits which aren't expired.
+	All() ([]LoginLimit, error)
+}
+
+// NewLimitsBackend returns the backend storing the login limits in Redis if
+// given its URL, for deployments with multiple replicas, or else in the auth
+// database.
+func NewLimitsBackend(redisURL string) (LimitsBackend, error) {
+	if redisURL != "" {
+		return newRedisLimits(redisURL)
+	}
+	return databaseLimits{}, nil
+}
+
+// databaseLimits stores the login limits in the auth database.
+type databaseLimits struct{}
+
+func (databaseLimits) Get(key string) (LoginLimit, error) {
+	return getLoginLimit(key)
+}
+
+func (databaseLimits) Update(key string, fn func(*LoginLimit)) error {
+	return updateLoginLimit(key, fn)
+}
+
+func (databaseLimits) Delete(key string) error {
+	ok, err := removeLoginLimit(key)
+	if err == nil && !ok {
+		return fberrors.ErrNotExist
+	}
+	return err
+}
+
+func (databaseLimits) All() ([]LoginLimit, error) {
+	return getLoginLimits(time.Now())
+}
+
+// Limiter locks out the clients, and the users, who fail to log in too often.
+// A nil Limiter doesn't limit logins.
+type Limiter struct {
+	back LimitsBackend
+	// mu serializes the updates of the limits, which the backends only keep
+	// consistent across replicas.
+	mu sync.Mutex
+}
+
+// NewLimiter creates a limiter storing its limits in the backend.
+func NewLimiter(back LimitsBackend) *Limiter {
+	return &Limiter{back: back}
+}
+
+// Login runs the login of a client unless it, or the user it is for, is locked
+// out. Its failures, which authers tell with a LoginError, are counted, while
+// succeeding forgets the previous ones.
+func (l *Limiter) Login(ip string, limits settings.LoginLimits, login func() (*users.User, error)) (*users.User, error) {
+	if l == nil {
+		return login()
+	}
+
+	keys := []string{LimitIPKey(ip)}
+	if err := l.Check(keys...); err != nil {
+		return nil, err
+	}
+
+	user, err := login()
+	var refused *LoginError
+	switch {
+	case err == nil:
+		keys = append(keys, LimitUserKey(user.Username))
+	case errors.As(err, &refused) && refused.Username != "":
+		keys = append(keys, LimitUserKey(refused.Username))
+	}
+
+	// Locked out users aren't told whether their credentials were right.
+	if lockout := l.Check(keys...); lockout != nil {
+		return nil, lockout
+	}
+
+	switch {
+	case err == nil:
+		if err := l.Reset(keys...); err != nil {
+			log.Printf("Warning: Failed to reset the login limits of %v: %v", keys, err)
+		}
+	case refused != nil:
+		if err := l.Fail(limits, keys...); err != nil {
+			log.Printf("Warning: Failed to count the failed login of %v: %v", keys, err)
+		}
+	}
+	return user, err
+}
+
+// Check returns a LockoutError if any of the keys is locked out.
+func (l *Limiter) Check(keys ...string) error {
+	if l == nil {
+		return nil
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		limit, err := l.back.Get(key)
+		if err != nil {
+			// Logins aren't refused for the backend being unavailable.
+			log.Printf("Warning: Unable to check if %s is locked out, allowing: %v", key, err)
+			continue
+		}
+		if limit.Blocked(now) {
+			log.Printf("Warning: %s is locked out until %s due to repeated login failures", key, limit.BlockedUntil.Format(time.RFC3339))
+			return &LockoutError{Key: key, Until: limit.BlockedUntil}
+		}
+	}
+	return nil
+}
+
+// Fail counts a failed login against the keys, locking them out once they
+// failed more often than the limits allow.
+func (l *Limiter) Fail(limits settings.LoginLimits, keys ...string) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var errs []error
+	for _, key := range keys {
+		errs = append(errs, l.back.Update(key, func(limit *LoginLimit) {
+			if !now.Before(limit.Expires) {
+				*limit = LoginLimit{Key: key}
+			}
+			limit.Failures++
+			limit.LastFailure = now
+			log.Printf("Warning: Failed auth, attempt #%d for %s", limit.Failures, key)
+
+			if attempts := limits.GetAttempts(); limit.Failures > attempts {
+				lockout := lockoutDuration(limits, limit.Failures-attempts-1)
+				limit.BlockedUntil = now.Add(lockout)
+				log.Printf("Warning: %s is blocked (for %s) until %s", key, lockout, limit.BlockedUntil.Format(time.RFC3339))
+			}
+			limit.Expires = later(now, limit.BlockedUntil).Add(limits.GetWindow())
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// lockoutDuration returns the lockout doubled the given number of times, up
+// to the longest allowed.
+func lockoutDuration(limits settings.LoginLimits, doublings uint) time.Duration {
+	lockout, maxLockout := limits.GetLockout(), limits.GetMaxLockout()
+	for ; doublings > 0 && lockout < maxLockout; doublings-- {
+		lockout *= 2
+	}
+	return min(lockout, maxLockout)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Reset forgets the failed logins of the keys.
+func (l *Limiter) Reset(keys ...string) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var errs []error
+	for _, key := range keys {
+		// Most logins have nothing to forget, and shouldn't write.
+		limit, err := l.back.Get(key)
+		if err != nil || limit.Failures == 0 {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, l.back.Update(key, func(limit *LoginLimit) {
+			*limit = LoginLimit{Key: key}
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// List returns the limits of the clients and users who failed to log in
+// lately, those locked out first.
+func (l *Limiter) List() ([]LoginLimit, error) {
+	limits, err := l.back.All()
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(limits, func(a, b LoginLimit) int {
+		return cmp.Or(b.BlockedUntil.Compare(a.BlockedUntil), strings.Compare(a.Key, b.Key))
+	})
+	return limits, nil
+}
+
+// Unblock forgets the failed logins of a key, letting it log in again.
+func (l *Limiter) Unblock(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.back.Delete(key)
+}
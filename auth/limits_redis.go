@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+const redisLimitsPrefix = "filebrowser:login:"
+
+// redisUpdateRetries is how many times an update racing with another replica
+// is retried.
+const redisUpdateRetries = 10
+
+// redisLimits stores the login limits in Redis, for multi replica deployments.
+type redisLimits struct {
+	client *redis.Client
+}
+
+func newRedisLimits(redisURL string) (*redisLimits, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &redisLimits{client: client}, nil
+}
+
+func (b *redisLimits) get(ctx context.Context, c redis.Cmdable, key string) (LoginLimit, error) {
+	values, err := c.HGetAll(ctx, redisLimitsPrefix+key).Result()
+	if err != nil {
+		return LoginLimit{}, err
+	}
+
+	limit := LoginLimit{Key: key}
+	if len(values) == 0 {
+		return limit, nil
+	}
+	unix := func(field string) time.Time {
+		n, _ := strconv.ParseInt(values[field], 10, 64)
+		return time.Unix(n, 0)
+	}
+	failures, err := strconv.ParseUint(values["failures"], 10, 0)
+	if err != nil {
+		return LoginLimit{}, fmt.Errorf("invalid login limit %s in redis: %w", key, err)
+	}
+	limit.Failures = uint(failures)
+	limit.LastFailure, limit.BlockedUntil, limit.Expires = unix("lastFailure"), unix("blockedUntil"), unix("expires")
+	return limit, nil
+}
+
+func (b *redisLimits) Get(key string) (LoginLimit, error) {
+	return b.get(context.Background(), b.client, key)
+}
+
+func (b *redisLimits) Update(key string, fn func(*LoginLimit)) error {
+	ctx := context.Background()
+	name := redisLimitsPrefix + key
+
+	update := func(tx *redis.Tx) error {
+		limit, err := b.get(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+		fn(&limit)
+
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			if limit.Failures == 0 {
+				p.Del(ctx, name)
+				return nil
+			}
+			p.HSet(ctx, name,
+				"failures", limit.Failures,
+				"lastFailure", limit.LastFailure.Unix(),
+				"blockedUntil", limit.BlockedUntil.Unix(),
+				"expires", limit.Expires.Unix(),
+			)
+			p.ExpireAt(ctx, name, limit.Expires)
+			return nil
+		})
+		return err
+	}
+
+	for range redisUpdateRetries {
+		err := b.client.Watch(ctx, update, name)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update login limit %s in redis: too much contention", key)
+}
+
+func (b *redisLimits) Delete(key string) error {
+	n, err := b.client.Del(context.Background(), redisLimitsPrefix+key).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fberrors.ErrNotExist
+	}
+	return nil
+}
+
+func (b *redisLimits) All() ([]LoginLimit, error) {
+	ctx := context.Background()
+
+	limits := []LoginLimit{}
+	iter := b.client.Scan(ctx, 0, redisLimitsPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		limit, err := b.get(ctx, b.client, strings.TrimPrefix(iter.Val(), redisLimitsPrefix))
+		if err != nil {
+			return nil, err
+		}
+		// Keys may expire while being scanned.
+		if limit.Failures > 0 {
+			limits = append(limits, limit)
+		}
+	}
+	return limits, iter.Err()
+}
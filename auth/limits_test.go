@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestLimiter(t *testing.T) {
+	openTestDatabase(t)
+
+	back, err := NewLimitsBackend("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewLimiter(back)
+	limits := settings.LoginLimits{Attempts: 2}
+
+	alice := &users.User{Username: "alice"}
+	succeed := func() (*users.User, error) { return alice, nil }
+	fail := func() (*users.User, error) { return nil, refuse("alice", nil) }
+	login := func(ip string, fn func() (*users.User, error)) error {
+		t.Helper()
+		_, err := limiter.Login(ip, limits, fn)
+		return err
+	}
+
+	// Logins refused for other reasons aren't counted.
+	for range 5 {
+		if err := login("10.0.0.1", func() (*users.User, error) { return nil, os.ErrPermission }); !errors.Is(err, os.ErrPermission) {
+			t.Fatalf("expected the login to be refused, got %v", err)
+		}
+	}
+
+	for range 2 {
+		if err := login("10.0.0.1", fail); errors.As(err, new(*LockoutError)) {
+			t.Fatalf("expected a failure before the lockout, got %v", err)
+		}
+	}
+	// Succeeding forgets the failures.
+	if err := login("10.0.0.1", succeed); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		_ = login("10.0.0.1", fail)
+	}
+
+	var lockout *LockoutError
+	if err := login("10.0.0.1", succeed); !errors.As(err, &lockout) || !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected the client to be locked out, got %v", err)
+	}
+	if until := time.Until(lockout.Until); until <= 0 || until > settings.DefaultLoginLockout {
+		t.Errorf("expected the first lockout to last %s, got %s", settings.DefaultLoginLockout, until)
+	}
+	// Locked out users aren't let in from other clients either, even with the
+	// right credentials.
+	if err := login("10.0.0.2", succeed); !errors.As(err, &lockout) || lockout.Key != LimitUserKey("alice") {
+		t.Errorf("expected the user to be locked out, got %v", err)
+	}
+
+	list, err := limiter.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Failures != 3 || !list[0].Blocked(time.Now()) {
+		t.Fatalf("expected the client and user to be locked out, got %+v", list)
+	}
+
+	for _, key := range []string{LimitIPKey("10.0.0.1"), LimitUserKey("alice")} {
+		if err := limiter.Unblock(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := limiter.Unblock(LimitUserKey("alice")); !errors.Is(err, fberrors.ErrNotExist) {
+		t.Errorf("expected the limit to be gone, got %v", err)
+	}
+	if err := login("10.0.0.1", succeed); err != nil {
+		t.Errorf("expected the user to be unblocked, got %v", err)
+	}
+}
+
+func TestLimiterExpiry(t *testing.T) {
+	openTestDatabase(t)
+
+	limiter := NewLimiter(databaseLimits{})
+	limits := settings.LoginLimits{Attempts: 1, Window: "1s"}
+	key := LimitIPKey("10.0.0.1")
+
+	// Failures are forgotten once they expire.
+	expire := func(key string) {
+		t.Helper()
+		if err := limiter.back.Update(key, func(l *LoginLimit) {
+			*l = LoginLimit{Key: key, Failures: 9, Expires: time.Now().Add(-time.Second)}
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expire(key)
+	if err := limiter.Fail(limits, key); err != nil {
+		t.Fatal(err)
+	}
+	if limit, err := limiter.back.Get(key); err != nil || limit.Failures != 1 || limit.Blocked(time.Now()) {
+		t.Errorf("expected the failures to start over, got %+v %v", limit, err)
+	}
+
+	expire(key)
+	if list, err := limiter.List(); err != nil || len(list) != 0 {
+		t.Errorf("expected the expired limit to be removed, got %+v %v", list, err)
+	}
+
+	// The expired limits of others are removed by the failures counted, not
+	// to pile up under the usernames clients make up.
+	unknown := LimitUserKey("nobody")
+	expire(unknown)
+	if err := limiter.Fail(limits, key); err != nil {
+		t.Fatal(err)
+	}
+	var rows int
+	if err := db.QueryRow("SELECT COUNT(*) FROM login_limits WHERE limit_key = ?", unknown).Scan(&rows); err != nil || rows != 0 {
+		t.Errorf("expected the expired limit to be removed, got %d %v", rows, err)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	limits := settings.LoginLimits{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}}
+	for _, tc := range []struct {
+		name, remote, forwarded, real, want string
+	}{
+		{"direct", "203.0.113.1:1234", "", "", "203.0.113.1"},
+		{"forged by the client", "203.0.113.1:1234", "198.51.100.1", "198.51.100.2", "203.0.113.1"},
+		{"forwarded", "192.0.2.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"forwarded through proxies", "10.0.0.1:1234", "198.51.100.9, 198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"only proxies", "10.0.0.1:1234", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"real", "10.0.0.1:1234", "", "198.51.100.1", "198.51.100.1"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/login", http.NoBody)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if tc.real != "" {
+			r.Header.Set("X-Real-Ip", tc.real)
+		}
+		if got := ClientIP(r, limits); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+
+	if err := limits.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := (settings.LoginLimits{TrustedProxies: []string{"proxy"}}).Validate(); err == nil {
+		t.Error("expected the invalid proxy to be refused")
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	limits := settings.LoginLimits{Lockout: "1m", MaxLockout: "10m"}
+	for doublings, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute} {
+		if got := lockoutDuration(limits, uint(doublings)); got != want {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", doublings, got, want)
+		}
+	}
+	if got := lockoutDuration(settings.LoginLimits{}, 1000); got != settings.DefaultLoginMaxLockout {
+		t.Errorf("expected the lockouts to be capped, got %s", got)
+	}
+}
@@ -0,0 +1,368 @@
+package auth
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// MethodOIDCAuth is used to identify OpenID Connect auth.
+const MethodOIDCAuth settings.AuthMethod = "oidc"
+
+const (
+	// DefaultOIDCUsernameClaim is the claim usernames are taken from when
+	// none is configured. Unlike preferred_username, the subject is unique and
+	// can't be changed by the users.
+	DefaultOIDCUsernameClaim = "sub"
+	// DefaultOIDCGroupsClaim is the claim groups are taken from when none is
+	// configured.
+	DefaultOIDCGroupsClaim = "groups"
+
+	// OIDCSessionCookie is the cookie keeping who signed in with the identity
+	// provider, for the login requests to authenticate.
+	OIDCSessionCookie = "oidc_session"
+	// OIDCStateCookie is the cookie keeping the state of a sign in between
+	// the redirection to the identity provider and the callback.
+	OIDCStateCookie = "oidc_state"
+
+	oidcStateDuration = 10 * time.Minute
+)
+
+// oidcProviders caches the discovered providers by issuer.
+var oidcProviders sync.Map
+
+// OIDCGroup grants the members of a group of the identity provider their
+// permissions, and a scope when they are created.
+type OIDCGroup struct {
+	Name  string            `json:"name"`
+	Perm  users.Permissions `json:"perm"`
+	Scope string            `json:"scope,omitempty"`
+}
+
+// OIDCAuth is an OpenID Connect implementation of an auther, which signs users
+// in with an identity provider through the authorization code flow with PKCE.
+type OIDCAuth struct {
+	Issuer        string      `json:"issuer"`
+	ClientID      string      `json:"clientID"`
+	ClientSecret  string      `json:"clientSecret"`
+	RedirectURL   string      `json:"redirectURL"`
+	Scopes        []string    `json:"scopes"`
+	UsernameClaim string      `json:"usernameClaim"`
+	GroupsClaim   string      `json:"groupsClaim"`
+	Groups        []OIDCGroup `json:"groups"`
+}
+
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// oidcSession is who signed in with the identity provider, as the issuer and
+// subject of their ID token.
+type oidcSession struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// identity returns what the users created for the session are linked to.
+func (s oidcSession) identity() string {
+	return s.Issuer + " " + s.Subject
+}
+
+// Auth authenticates the user who signed in with the identity provider,
+// creating them on their first login. Users who weren't created for the same
+// identity can't be signed in as, whatever their username.
+func (a OIDCAuth) Auth(r *http.Request, usr users.Store, setting *settings.Settings, srv *settings.Server) (*users.User, error) {
+	cookie, err := r.Cookie(OIDCSessionCookie)
+	if err != nil {
+		return nil, os.ErrPermission
+	}
+
+	var session oidcSession
+	if err := parseSigned(cookie.Value, OIDCSessionCookie, &session, setting.Key); err != nil || session.Subject == "" || session.Username == "" {
+		return nil, os.ErrPermission
+	}
+
+	user, err := usr.Get(srv.Root, srv.FollowExternalSymlinks, session.Username)
+	if errors.Is(err, fberrors.ErrNotExist) {
+		return createUser(usr, setting, srv, session.Username, func(user *users.User) {
+			user.OIDCSubject = session.identity()
+			perm, scope, ok := a.mapGroups(session.Groups)
+			if ok {
+				user.Perm = perm
+			}
+			if scope != "" {
+				user.Scope = scope
+			}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.OIDCSubject != session.identity() {
+		return nil, fmt.Errorf("%w: %s wasn't created for this identity", os.ErrPermission, user.Username)
+	}
+
+	// The identity provider is the authority on the permissions of the
+	// members of mapped groups. Those who left all of them are back to the
+	// defaults, rather than keeping what their groups gave them.
+	perm, _, ok := a.mapGroups(session.Groups)
+	if !ok && len(a.Groups) > 0 {
+		perm, ok = defaultPerm(setting), true
+	}
+	if ok && perm != user.Perm {
+		user.Perm = perm
+		if err := usr.Update(user, "Perm"); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// LoginPage tells that OIDC auth doesn't require a login page.
+func (a OIDCAuth) LoginPage() bool {
+	return false
+}
+
+// AuthCodeURL starts signing in with the identity provider. It returns the URL
+// to redirect the user to, and the cookie keeping the state of the sign in.
+func (a OIDCAuth) AuthCodeURL(r *http.Request, setting *settings.Settings, srv *settings.Server) (string, *http.Cookie, error) {
+	config, _, err := a.config(r, srv)
+	if err != nil {
+		return "", nil, err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	value, err := sign(&oidcState{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{OIDCStateCookie},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateDuration)),
+		},
+	}, setting.Key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	url := config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return url, oidcCookie(r, srv, OIDCStateCookie, value, oidcStateDuration), nil
+}
+
+// Exchange completes signing in with the identity provider, from the request
+// it redirected the user back with. It returns the cookie of their session,
+// which lasts for expiration.
+func (a OIDCAuth) Exchange(r *http.Request, setting *settings.Settings, srv *settings.Server, expiration time.Duration) (*http.Cookie, error) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		return nil, fmt.Errorf("%w: the identity provider refused to sign in: %s %s", os.ErrPermission, e, query.Get("error_description"))
+	}
+
+	cookie, err := r.Cookie(OIDCStateCookie)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing sign in state", os.ErrPermission)
+	}
+	var state oidcState
+	if err := parseSigned(cookie.Value, OIDCStateCookie, &state, setting.Key); err != nil {
+		return nil, fmt.Errorf("%w: invalid sign in state: %w", os.ErrPermission, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		return nil, fmt.Errorf("%w: sign in state mismatch", os.ErrPermission)
+	}
+
+	config, provider, err := a.config(r, srv)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := config.Exchange(r.Context(), query.Get("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", os.ErrPermission, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no ID token in the token response", os.ErrPermission)
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: a.ClientID}).Verify(r.Context(), rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", os.ErrPermission, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(state.Nonce)) != 1 {
+		return nil, fmt.Errorf("%w: ID token nonce mismatch", os.ErrPermission)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	usernameClaim := cmp.Or(a.UsernameClaim, DefaultOIDCUsernameClaim)
+	username, _ := claims[usernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("%w: no %q claim in the ID token", os.ErrPermission, usernameClaim)
+	}
+
+	value, err := sign(&oidcSession{
+		Username: username,
+		Groups:   claimStrings(claims[cmp.Or(a.GroupsClaim, DefaultOIDCGroupsClaim)]),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idToken.Issuer,
+			Subject:   idToken.Subject,
+			Audience:  jwt.ClaimStrings{OIDCSessionCookie},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
+		},
+	}, setting.Key)
+	if err != nil {
+		return nil, err
+	}
+	return oidcCookie(r, srv, OIDCSessionCookie, value, expiration), nil
+}
+
+// mapGroups returns the permissions granted by the mapped groups among
+// groups, and the scope of the first of them having one. ok is false when
+// none of them is mapped.
+func (a OIDCAuth) mapGroups(groups []string) (perm users.Permissions, scope string, ok bool) {
+	for _, group := range a.Groups {
+		if !slices.Contains(groups, group.Name) {
+			continue
+		}
+
+		ok = true
+		perm.Merge(group.Perm)
+		if scope == "" {
+			scope = group.Scope
+		}
+	}
+	return perm, scope, ok
+}
+
+func (a OIDCAuth) config(r *http.Request, srv *settings.Server) (*oauth2.Config, *oidc.Provider, error) {
+	if a.Issuer == "" || a.ClientID == "" {
+		return nil, nil, errors.New("the OIDC issuer and client ID must be configured")
+	}
+
+	var provider *oidc.Provider
+	if cached, ok := oidcProviders.Load(a.Issuer); ok {
+		provider = cached.(*oidc.Provider)
+	} else {
+		discovered, err := oidc.NewProvider(r.Context(), a.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("OIDC discovery: %w", err)
+		}
+		oidcProviders.Store(a.Issuer, discovered)
+		provider = discovered
+	}
+
+	redirectURL := a.RedirectURL
+	if redirectURL == "" {
+		scheme := "http"
+		if isSecure(r) {
+			scheme = "https"
+		}
+		redirectURL = scheme + "://" + r.Host + srv.BaseURL + "/api/auth/oidc/callback"
+	}
+
+	scopes := a.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+	if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     a.ClientID,
+		ClientSecret: a.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}, provider, nil
+}
+
+// oidcCookie returns a cookie only sent back to the server, for maxAge.
+func oidcCookie(r *http.Request, srv *settings.Server, name, value string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     srv.BaseURL + "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		// The callback is a navigation from the identity provider.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func sign(claims jwt.Claims, key []byte) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// parseSigned parses a value signed for audience, which tells the cookies
+// apart from each other and from the auth tokens signed with the same key.
+func parseSigned(value, audience string, claims jwt.Claims, key []byte) error {
+	_, err := jwt.ParseWithClaims(value, claims, func(_ *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithAudience(audience))
+	return err
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// claimStrings returns the strings of a claim holding one or several.
+func claimStrings(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return []string{claim}
+	case []interface{}:
+		var values []string
+		for _, v := range claim {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
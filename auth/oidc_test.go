@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// stubIdP is an identity provider issuing ID tokens for the codes it was told
+// about, once given the verifier of their challenge.
+type stubIdP struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &stubIdP{key: key, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.URL,
+			"authorization_endpoint":                idp.URL + "/authorize",
+			"token_endpoint":                        idp.URL + "/token",
+			"jwks_uri":                              idp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// authorize signs a user in for the authorization URL, returning the code
+// the client is redirected back with.
+func (idp *stubIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("expected a PKCE challenge, got %s", authURL)
+	}
+
+	claims["nonce"] = query.Get("nonce")
+	b, _ := json.Marshal(claims)
+	query.Set("claims", string(b))
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := "code-" + query.Get("state")
+	idp.codes[code] = query
+	return code
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	query, ok := idp.codes[r.FormValue("code")]
+	delete(idp.codes, r.FormValue("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != query.Get("code_challenge") {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if id, secret, _ := r.BasicAuth(); id != query.Get("client_id") || secret != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	claims := jwt.MapClaims{}
+	_ = json.Unmarshal([]byte(query.Get("claims")), &claims)
+	claims["iss"] = idp.URL
+	claims["aud"] = query.Get("client_id")
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, _ := token.SignedString(idp.key)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func TestOIDCAuth(t *testing.T) {
+	t.Parallel()
+
+	idp := newStubIdP(t)
+	store := &mockUserStore{users: make(map[string]*users.User)}
+	srv := &settings.Server{Root: t.TempDir(), BaseURL: "/fb"}
+	s := &settings.Settings{
+		Key: []byte("key"),
+		Defaults: settings.UserDefaults{
+			Perm: users.Permissions{Admin: true, Download: true},
+		},
+	}
+	a := OIDCAuth{
+		Issuer:        idp.URL,
+		ClientID:      "filebrowser",
+		ClientSecret:  "secret",
+		UsernameClaim: "preferred_username",
+		Groups: []OIDCGroup{
+			{Name: "editors", Perm: users.Permissions{Create: true, Modify: true}, Scope: "/shared"},
+			{Name: "sharers", Perm: users.Permissions{Share: true}},
+		},
+	}
+
+	// signIn goes through the flow, returning the request to log in with.
+	signIn := func(claims jwt.MapClaims, tamper func(callback *http.Request)) (*http.Request, error) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "http://files.example/fb/api/auth/oidc/login", http.NoBody)
+		authURL, state, err := a.AuthCodeURL(req, s, srv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if redirect := mustQuery(t, authURL).Get("redirect_uri"); redirect != "http://files.example/fb/api/auth/oidc/callback" {
+			t.Errorf("expected the callback to be derived from the request, got %q", redirect)
+		}
+		if state.Path != "/fb/" || !state.HttpOnly {
+			t.Errorf("expected an HTTP only state cookie for the base URL, got %+v", state)
+		}
+
+		code := idp.authorize(t, authURL, claims)
+		callback := httptest.NewRequest(http.MethodGet, "http://files.example/fb/api/auth/oidc/callback?"+url.Values{
+			"code":  {code},
+			"state": {mustQuery(t, authURL).Get("state")},
+		}.Encode(), http.NoBody)
+		callback.AddCookie(state)
+		if tamper != nil {
+			tamper(callback)
+		}
+
+		session, err := a.Exchange(callback, s, srv, time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		login := httptest.NewRequest(http.MethodPost, "/fb/api/login", http.NoBody)
+		login.AddCookie(session)
+		return login, nil
+	}
+
+	login, err := signIn(jwt.MapClaims{"sub": "1", "preferred_username": "alice", "groups": []string{"editors", "sharers", "other"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := a.Auth(login, store, s, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := users.Permissions{Create: true, Modify: true, Share: true}
+	if user.Username != "alice" || user.Perm != want || user.Scope != "/shared" || !user.LockPassword {
+		t.Errorf("expected alice to be created from her groups, got %+v", user)
+	}
+
+	// Users out of the mapped groups get the defaults, but never as admins.
+	login, err = signIn(jwt.MapClaims{"sub": "2", "preferred_username": "bob"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = a.Auth(login, store, s, srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Perm != (users.Permissions{Download: true}) {
+		t.Errorf("expected bob to be created with the defaults, got %+v", user.Perm)
+	}
+
+	// The permissions of existing users follow their groups.
+	login, err = signIn(jwt.MapClaims{"sub": "2", "preferred_username": "bob", "groups": "sharers"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err = a.Auth(login, store, s, srv); err != nil || user.Perm != (users.Permissions{Share: true}) {
+		t.Errorf("expected bob's permissions to be synced, got %+v %v", user, err)
+	}
+
+	// Leaving the mapped groups takes away what they gave.
+	login, err = signIn(jwt.MapClaims{"sub": "2", "preferred_username": "bob", "groups": "other"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err = a.Auth(login, store, s, srv); err != nil || user.Perm != (users.Permissions{Download: true}) {
+		t.Errorf("expected bob to be back to the defaults, got %+v %v", user, err)
+	}
+
+	// Users are only signed in as by the identity they were created for, so
+	// that picking their username doesn't take them over.
+	store.users["admin"] = &users.User{Username: "admin", Perm: users.Permissions{Admin: true}}
+	for _, claims := range []jwt.MapClaims{
+		{"sub": "3", "preferred_username": "admin"},
+		{"sub": "3", "preferred_username": "bob"},
+	} {
+		login, err = signIn(claims, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user, err := a.Auth(login, store, s, srv); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("expected %s not to be signed in as, got %+v %v", claims["preferred_username"], user, err)
+		}
+	}
+	if store.users["admin"].Perm != (users.Permissions{Admin: true}) {
+		t.Errorf("expected the permissions of admin to be left alone, got %+v", store.users["admin"].Perm)
+	}
+
+	// Usernames are the subjects unless told otherwise.
+	a.UsernameClaim = ""
+	login, err = signIn(jwt.MapClaims{"sub": "4", "preferred_username": "admin"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err := a.Auth(login, store, s, srv); err != nil || user.Username != "4" {
+		t.Errorf("expected the user to be named after the subject, got %+v %v", user, err)
+	}
+	a.UsernameClaim = "preferred_username"
+
+	for name, tamper := range map[string]func(*http.Request){
+		"forged state": func(r *http.Request) {
+			q := r.URL.Query()
+			q.Set("state", "forged")
+			r.URL.RawQuery = q.Encode()
+		},
+		"missing state cookie": func(r *http.Request) {
+			r.Header.Del("Cookie")
+		},
+		"refused": func(r *http.Request) {
+			r.URL.RawQuery = "error=access_denied"
+		},
+	} {
+		if _, err := signIn(jwt.MapClaims{"preferred_username": "mallory"}, tamper); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("%s: expected the sign in to be refused, got %v", name, err)
+		}
+	}
+
+	if _, err := signIn(jwt.MapClaims{"sub": "5"}, nil); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a token without username to be refused, got %v", err)
+	}
+
+	// Only the sessions signed by the server are accepted.
+	forged, _ := sign(&oidcSession{Username: "alice", RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    idp.URL,
+		Subject:   "1",
+		Audience:  jwt.ClaimStrings{OIDCSessionCookie},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}, []byte("other key"))
+	login = httptest.NewRequest(http.MethodPost, "/fb/api/login", http.NoBody)
+	login.AddCookie(&http.Cookie{Name: OIDCSessionCookie, Value: forged})
+	if _, err := a.Auth(login, store, s, srv); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a forged session to be refused, got %v", err)
+	}
+	if _, err := a.Auth(httptest.NewRequest(http.MethodPost, "/fb/api/login", http.NoBody), store, s, srv); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a login without session to be refused, got %v", err)
+	}
+}
+
+func mustQuery(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
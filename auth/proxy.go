@@ -28,6 +28,13 @@ func (a ProxyAuth) Auth(r *http.Request, usr users.Store, setting *settings.Sett
 }
 
 func (a ProxyAuth) createUser(usr users.Store, setting *settings.Settings, srv *settings.Server, username string) (*users.User, error) {
+	return createUser(usr, setting, srv, username, nil)
+}
+
+// createUser provisions a user authenticated elsewhere, with a random password
+// they can't change. When set, adjust is given the user before their home
+// directory is made.
+func createUser(usr users.Store, setting *settings.Settings, srv *settings.Server, username string, adjust func(*users.User)) (*users.User, error) {
 	const randomPasswordLength = settings.DefaultMinimumPasswordLength + 10
 	pwd, err := users.RandomPwd(randomPasswordLength)
 	if err != nil {
@@ -46,9 +53,11 @@ func (a ProxyAuth) createUser(usr users.Store, setting *settings.Settings, srv *
 		LockPassword: true,
 	}
 	setting.Defaults.Apply(user)
-	user.Perm.Admin = false
-	user.Perm.Execute = false
+	user.Perm = defaultPerm(setting)
 	user.Commands = []string{}
+	if adjust != nil {
+		adjust(user)
+	}
 
 	var userHome string
 	userHome, err = setting.MakeUserDir(user.Username, user.Scope, srv.Root)
@@ -69,3 +78,12 @@ func (a ProxyAuth) createUser(usr users.Store, setting *settings.Settings, srv *
 func (a ProxyAuth) LoginPage() bool {
 	return false
 }
+
+// defaultPerm returns the default permissions of the users created on their
+// first login, which never let them administer nor execute commands.
+func defaultPerm(setting *settings.Settings) users.Permissions {
+	perm := setting.Defaults.Perm
+	perm.Admin = false
+	perm.Execute = false
+	return perm
+}
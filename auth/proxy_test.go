@@ -14,10 +14,17 @@ type mockUserStore struct {
 }
 
 func (m *mockUserStore) Get(_ string, _ bool, id interface{}) (*users.User, error) {
-	if v, ok := id.(string); ok {
+	switch v := id.(type) {
+	case string:
 		if u, ok := m.users[v]; ok {
 			return u, nil
 		}
+	case uint:
+		for _, u := range m.users {
+			if u.ID == v {
+				return u, nil
+			}
+		}
 	}
 	return nil, fberrors.ErrNotExist
 }
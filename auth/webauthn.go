@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+const (
+	webAuthnRegistration = "webauthn_registration"
+	webAuthnLogin        = "webauthn_login"
+	webAuthnTimeout      = 5 * time.Minute
+)
+
+// usedChallenges keeps the login challenges already answered until they
+// expire, so that an assertion can't be replayed.
+var usedChallenges = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: map[string]time.Time{}}
+
+// WebAuthnChallenge is a ceremony begun for the browser to answer. Options are
+// given to the browser, and the session sent back with its answer.
+type WebAuthnChallenge struct {
+	Options interface{} `json:"options"`
+	Session string      `json:"session"`
+}
+
+// PasskeyAssertion is the answer of the browser to a login challenge.
+type PasskeyAssertion struct {
+	Session   string          `json:"session"`
+	Assertion json.RawMessage `json:"assertion"`
+}
+
+type webAuthnSession struct {
+	Data webauthn.SessionData `json:"data"`
+	jwt.RegisteredClaims
+}
+
+// passkeyUser is a user as seen by the WebAuthn ceremonies.
+type passkeyUser struct {
+	user        *users.User
+	credentials []*passkeys.Credential
+}
+
+func (u passkeyUser) WebAuthnID() []byte {
+	return userHandle(u.user.ID)
+}
+
+func (u passkeyUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		credentials = append(credentials, c.Credential)
+	}
+	return credentials
+}
+
+// userHandle is the opaque ID of a user for their authenticators.
+func userHandle(id uint) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+// relyingParty returns the relying party of the ceremonies, which is the host
+// the request was sent to.
+func relyingParty(r *http.Request, stg *settings.Settings) (*webauthn.WebAuthn, error) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	scheme := "http"
+	if isSecure(r) {
+		scheme = "https"
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          host,
+		RPDisplayName: cmp.Or(stg.Branding.Name, "File Browser"),
+		RPOrigins:     []string{scheme + "://" + r.Host},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnTimeout},
+		},
+	})
+}
+
+func signSession(data *webauthn.SessionData, audience string, stg *settings.Settings) (string, error) {
+	return sign(&webAuthnSession{
+		Data: *data,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(webAuthnTimeout)),
+		},
+	}, stg.Key)
+}
+
+func parseSession(value, audience string, stg *settings.Settings) (*webauthn.SessionData, error) {
+	var session webAuthnSession
+	if err := parseSigned(value, audience, &session, stg.Key); err != nil {
+		return nil, fmt.Errorf("%w: invalid WebAuthn session: %w", os.ErrPermission, err)
+	}
+	return &session.Data, nil
+}
+
+// BeginPasskeyRegistration begins registering a passkey for user, who already
+// has credentials.
+func BeginPasskeyRegistration(r *http.Request, user *users.User, credentials []*passkeys.Credential, stg *settings.Settings) (*WebAuthnChallenge, error) {
+	rp, err := relyingParty(r, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	pu := passkeyUser{user: user, credentials: credentials}
+	// Passkeys are discoverable, so that they can be used without typing a
+	// username.
+	options, data, err := rp.BeginRegistration(pu,
+		webauthn.WithExclusions(webauthn.Credentials(pu.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := signSession(data, webAuthnRegistration, stg)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnChallenge{Options: options, Session: session}, nil
+}
+
+// FinishPasskeyRegistration verifies the response of the browser to a
+// registration challenge, returning the passkey to keep for user.
+func FinishPasskeyRegistration(r *http.Request, user *users.User, credentials []*passkeys.Credential, stg *settings.Settings, session, name string, response io.Reader) (*passkeys.Credential, error) {
+	data, err := parseSession(session, webAuthnRegistration, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := relyingParty(r, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", fberrors.ErrInvalidRequestParams, err)
+	}
+
+	credential, err := rp.CreateCredential(passkeyUser{user: user, credentials: credentials}, *data, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", os.ErrPermission, err)
+	}
+
+	return passkeys.New(user.ID, cmp.Or(name, "Passkey"), credential), nil
+}
+
+// BeginPasskeyLogin begins logging in with a passkey. Whose passkey is only
+// known from the answer of the browser.
+func BeginPasskeyLogin(r *http.Request, stg *settings.Settings) (*WebAuthnChallenge, error) {
+	rp, err := relyingParty(r, stg)
+	if err != nil {
+		return nil, err
+	}
+
+	options, data, err := rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := signSession(data, webAuthnLogin, stg)
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnChallenge{Options: options, Session: session}, nil
+}
+
+// verifyPasskey verifies the answer of the browser to a login challenge. It
+// returns the user whose passkey it is, and whether they were verified by the
+// authenticator, e.g. with a PIN or biometrics.
+func verifyPasskey(r *http.Request, assertion *PasskeyAssertion, store *passkeys.Storage, usr users.Store, stg *settings.Settings, srv *settings.Server) (*users.User, bool, error) {
+	if store == nil {
+		return nil, false, fmt.Errorf("%w: passkeys are not supported", os.ErrPermission)
+	}
+
+	data, err := parseSession(assertion.Session, webAuthnLogin, stg)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rp, err := relyingParty(r, stg)
+	if err != nil {
+		return nil, false, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(assertion.Assertion)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", os.ErrPermission, err)
+	}
+
+	var (
+		user       *users.User
+		credential *passkeys.Credential
+	)
+	handler := func(rawID, handle []byte) (webauthn.User, error) {
+		credential, err = store.Get(passkeys.EncodeID(rawID))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(handle, userHandle(credential.UserID)) {
+			return nil, errors.New("the passkey is someone else's")
+		}
+		user, err = usr.Get(srv.Root, srv.FollowExternalSymlinks, credential.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return passkeyUser{user: user, credentials: []*passkeys.Credential{credential}}, nil
+	}
+
+	_, verified, err := rp.ValidatePasskeyLogin(handler, *data, parsed)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", os.ErrPermission, err)
+	}
+	if verified.Authenticator.CloneWarning {
+		return nil, false, fmt.Errorf("%w: the authenticator of passkey %s may have been cloned", os.ErrPermission, credential.ID)
+	}
+	if !useChallenge(data) {
+		return nil, false, fmt.Errorf("%w: the challenge was already answered", os.ErrPermission)
+	}
+
+	credential.Credential = *verified
+	credential.LastUsedAt = time.Now()
+	if err := store.Save(credential); err != nil {
+		return nil, false, err
+	}
+	return user, parsed.Response.AuthenticatorData.Flags.HasUserVerified(), nil
+}
+
+// useChallenge reports whether the challenge of a session wasn't answered
+// yet, marking it answered.
+func useChallenge(data *webauthn.SessionData) bool {
+	usedChallenges.Lock()
+	defer usedChallenges.Unlock()
+
+	now := time.Now()
+	for challenge, expires := range usedChallenges.expires {
+		if expires.Before(now) {
+			delete(usedChallenges.expires, challenge)
+		}
+	}
+
+	if _, ok := usedChallenges.expires[data.Challenge]; ok {
+		return false
+	}
+	usedChallenges.expires[data.Challenge] = now.Add(webAuthnTimeout)
+	return true
+}
@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/pquerna/otp/totp"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+const (
+	webAuthnHost   = "files.example"
+	webAuthnOrigin = "http://" + webAuthnHost
+)
+
+var b64 = base64.RawURLEncoding
+
+type mockPasskeysBackend map[string]*passkeys.Credential
+
+func (m mockPasskeysBackend) FindByUserID(id uint) ([]*passkeys.Credential, error) {
+	var v []*passkeys.Credential
+	for _, c := range m {
+		if c.UserID == id {
+			v = append(v, c)
+		}
+	}
+	return v, nil
+}
+
+func (m mockPasskeysBackend) Get(id string) (*passkeys.Credential, error) {
+	if c, ok := m[id]; ok {
+		return c, nil
+	}
+	return nil, fberrors.ErrNotExist
+}
+
+func (m mockPasskeysBackend) Save(c *passkeys.Credential) error {
+	m[c.ID] = c
+	return nil
+}
+
+func (m mockPasskeysBackend) Delete(id string) error {
+	delete(m, id)
+	return nil
+}
+
+// authenticator is a virtual authenticator keeping a single passkey. As many
+// passkey providers do, a counterless one doesn't count its signatures.
+type authenticator struct {
+	t           *testing.T
+	id          []byte
+	key         *ecdsa.PrivateKey
+	handle      []byte
+	count       uint32
+	counterless bool
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return &authenticator{t: t, id: id, key: key}
+}
+
+func (a *authenticator) clientData(typ string, challenge protocol.URLEncodedBase64) []byte {
+	b, err := json.Marshal(map[string]string{"type": typ, "challenge": b64.EncodeToString(challenge), "origin": webAuthnOrigin})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return b
+}
+
+func (a *authenticator) authData(flags byte) []byte {
+	rpID := sha256.Sum256([]byte(webAuthnHost))
+	data := append(rpID[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.count)
+}
+
+// register answers a registration challenge with a new passkey, of user.
+func (a *authenticator) register(challenge *WebAuthnChallenge, user *users.User) []byte {
+	options := challenge.Options.(*protocol.CredentialCreation)
+	a.handle = options.Response.User.ID.(protocol.URLEncodedBase64)
+	if !bytes.Equal(a.handle, userHandle(user.ID)) {
+		a.t.Fatalf("expected the user handle of %s, got %x", user.Username, a.handle)
+	}
+
+	key, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // EC2
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	// User present and verified, with attested credential data.
+	authData := a.authData(0x45)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.id)))
+	authData = append(append(authData, a.id...), key...)
+
+	attestation, err := cbor.Marshal(map[string]interface{}{"fmt": "none", "attStmt": map[string]interface{}{}, "authData": authData})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.id),
+		"rawId": b64.EncodeToString(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", options.Response.Challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+		},
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return b
+}
+
+// assert answers a login challenge, telling whether the user was verified.
+func (a *authenticator) assert(challenge *WebAuthnChallenge, verified bool) *PasskeyAssertion {
+	options := challenge.Options.(*protocol.CredentialAssertion)
+	clientData := a.clientData("webauthn.get", options.Response.Challenge)
+
+	if !a.counterless {
+		a.count++
+	}
+	flags := byte(0x01)
+	if verified {
+		flags |= 0x04
+	}
+	authData := a.authData(flags)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.id),
+		"rawId": b64.EncodeToString(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(a.handle),
+		},
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return &PasskeyAssertion{Session: challenge.Session, Assertion: b}
+}
+
+func webAuthnRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/webauthn", http.NoBody)
+	r.Host = webAuthnHost
+	return r
+}
+
+// jsonLogin returns a login request with the credentials encoded the way the
+// login page does, and a passkey assertion if any.
+func jsonLogin(t *testing.T, username, password, otp string, assertion *PasskeyAssertion) *http.Request {
+	t.Helper()
+
+	encode := func(s string) string {
+		var b strings.Builder
+		for _, r := range s {
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+		return b.String()
+	}
+	var body io.Reader = http.NoBody
+	if assertion != nil {
+		b, err := json.Marshal(jsonBody{Passkey: assertion})
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = bytes.NewReader(b)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/login", body)
+	r.Host = webAuthnHost
+	r.Header.Set("Authorization", base64.StdEncoding.EncodeToString([]byte(
+		encode(username)+","+encode(password)+",,"+encode(otp))))
+	return r
+}
+
+// TestPasskeys isn't parallel, since failures are counted by host, which is
+// the relying party of all the ceremonies.
+func TestPasskeys(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	password, err := users.HashPwd("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := &users.User{ID: 1, Username: "alice", Password: password, SecondFactor: users.SecondFactorPasskey}
+	bob := &users.User{ID: 2, Username: "bob", Password: password, SecondFactor: users.SecondFactorAny}
+	carol := &users.User{ID: 3, Username: "carol", Password: password}
+	store := &mockUserStore{users: map[string]*users.User{"alice": alice, "bob": bob, "carol": carol}}
+	srv := &settings.Server{Root: t.TempDir()}
+	stg := &settings.Settings{Key: []byte("key")}
+	a := JSONAuth{Passkeys: passkeys.NewStorage(mockPasskeysBackend{})}
+
+	authn := newAuthenticator(t)
+	challenge, err := BeginPasskeyRegistration(webAuthnRequest(), alice, nil, stg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := FinishPasskeyRegistration(webAuthnRequest(), alice, nil, stg, challenge.Session, "", bytes.NewReader(authn.register(challenge, alice)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.ID != b64.EncodeToString(authn.id) || credential.UserID != alice.ID || credential.Name != "Passkey" {
+		t.Fatalf("unexpected passkey %+v", credential)
+	}
+	if err := a.Passkeys.Save(credential); err != nil {
+		t.Fatal(err)
+	}
+
+	// The registration can't be finished with a session of the login.
+	login := func() *WebAuthnChallenge {
+		t.Helper()
+		challenge, err := BeginPasskeyLogin(webAuthnRequest(), stg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return challenge
+	}
+	if _, err := FinishPasskeyRegistration(webAuthnRequest(), alice, nil, stg, login().Session, "", bytes.NewReader(authn.register(challenge, alice))); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected a login session to be refused, got %v", err)
+	}
+
+	// A verified passkey is enough on its own.
+	assertion := authn.assert(login(), true)
+	user, err := a.Auth(jsonLogin(t, "", "", "", assertion), store, stg, srv)
+	if err != nil || user.ID != alice.ID {
+		t.Fatalf("expected alice to log in with her passkey, got %+v %v", user, err)
+	}
+	if c, _ := a.Passkeys.Get(credential.ID); c.LastUsedAt.IsZero() || c.Credential.Authenticator.SignCount != authn.count {
+		t.Errorf("expected the passkey to be updated, got %+v", c)
+	}
+
+	// Without a counter, only the challenge tells a replay apart.
+	counterless := newAuthenticator(t)
+	counterless.counterless = true
+	challenge, err = BeginPasskeyRegistration(webAuthnRequest(), carol, nil, stg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err = FinishPasskeyRegistration(webAuthnRequest(), carol, nil, stg, challenge.Session, "Phone", bytes.NewReader(counterless.register(challenge, carol)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Passkeys.Save(credential); err != nil {
+		t.Fatal(err)
+	}
+	counterlessAssertion := counterless.assert(login(), true)
+	if user, err := a.Auth(jsonLogin(t, "carol", "", "", counterlessAssertion), store, stg, srv); err != nil || user.ID != carol.ID {
+		t.Fatalf("expected carol to log in with her passkey, got %+v %v", user, err)
+	}
+
+	for name, tc := range map[string]struct {
+		auther    JSONAuth
+		username  string
+		password  string
+		otp       func() string
+		assertion func() *PasskeyAssertion
+	}{
+		"replayed assertion": {auther: a, assertion: func() *PasskeyAssertion { return assertion }},
+		"replayed challenge": {auther: a, assertion: func() *PasskeyAssertion { return counterlessAssertion }},
+		"unverified user":    {auther: a, assertion: func() *PasskeyAssertion { return authn.assert(login(), false) }},
+		"other username":     {auther: a, username: "bob", assertion: func() *PasskeyAssertion { return authn.assert(login(), true) }},
+		"no passkeys":        {auther: JSONAuth{}, assertion: func() *PasskeyAssertion { return authn.assert(login(), true) }},
+		"password only":      {auther: a, username: "alice", password: "password"},
+		"wrong password":     {auther: a, username: "alice", password: "wrong", assertion: func() *PasskeyAssertion { return authn.assert(login(), false) }},
+		"passkey of another": {auther: a, username: "bob", password: "password", assertion: func() *PasskeyAssertion { return authn.assert(login(), false) }},
+		"no second factor":   {auther: a, username: "bob", password: "password"},
+		"no otp secret":      {auther: a, username: "bob", password: "password", otp: func() string { return "123456" }},
+	} {
+		var (
+			otp       string
+			assertion *PasskeyAssertion
+		)
+		if tc.otp != nil {
+			otp = tc.otp()
+		}
+		if tc.assertion != nil {
+			assertion = tc.assertion()
+		}
+		if _, err := tc.auther.Auth(jsonLogin(t, tc.username, tc.password, otp, assertion), store, stg, srv); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("%s: expected the login to be refused, got %v", name, err)
+		}
+	}
+
+	// Otherwise, the passkey is the second factor of the password, whether
+	// the user was verified or not.
+	if user, err := a.Auth(jsonLogin(t, "alice", "password", "", authn.assert(login(), false)), store, stg, srv); err != nil || user.ID != alice.ID {
+		t.Errorf("expected alice to log in with her password and passkey, got %+v %v", user, err)
+	}
+
+	bob.TOTP = users.TOTP{Secret: secret}
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err := a.Auth(jsonLogin(t, "bob", "password", code, nil), store, stg, srv); err != nil || user.ID != bob.ID {
+		t.Errorf("expected bob to log in with a one-time password, got %+v %v", user, err)
+	}
+	if _, err := a.Auth(jsonLogin(t, "bob", "password", "", nil), store, stg, srv); !errors.Is(err, ErrOtpRequired) {
+		t.Errorf("expected bob to be asked for a one-time password, got %v", err)
+	}
+
+	// Users who must enroll an authenticator log in to do so, but not with
+	// their password alone.
+	carol.SecondFactor = users.SecondFactorTOTP
+	if user, err := a.Auth(jsonLogin(t, "carol", "password", "", nil), store, stg, srv); err != nil || !user.MustEnrollOtp() {
+		t.Errorf("expected carol to log in to enroll an authenticator, got %+v %v", user, err)
+	}
+	if _, err := a.AuthPassword(webAuthnRequest(), "carol", "password", store, stg, srv); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected carol's password alone to be refused, got %v", err)
+	}
+	carol.SecondFactor = users.SecondFactorDefault
+
+	// Passwords alone are only enough for users without a second factor.
+	if _, err := a.AuthPassword(webAuthnRequest(), "alice", "password", store, stg, srv); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected alice's password alone to be refused, got %v", err)
+	}
+	if user, err := a.AuthPassword(webAuthnRequest(), "carol", "password", store, stg, srv); err != nil || user.ID != carol.ID {
+		t.Errorf("expected carol to log in with her password, got %+v %v", user, err)
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+)
+
+// auditLogDatabase is the audit log of the servers recording to the database.
+const auditLogDatabase = "db"
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the audit log",
+	Long: `Query the audit log of the file and admin actions, which the server
+records in the database or in a file of JSON lines as set with
+"--auditLog".`,
+	Args: cobra.NoArgs,
+}
+
+func printAuditEvents(events []*audit.Event) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Time\tUser\tIP\tAction\tSource\tDestination\tShare\tDetail\tStatus")
+
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t\n",
+			e.Time.Format(time.RFC3339),
+			e.User,
+			e.IP,
+			e.Action,
+			e.Source,
+			e.Destination,
+			e.Share,
+			e.Detail,
+			e.Status,
+		)
+	}
+
+	w.Flush()
+}
+
+var errAuditDisabled = errors.New(`the audit log is disabled, enable it with "--auditLog"`)
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+)
+
+func init() {
+	auditCmd.AddCommand(auditLsCmd)
+	flags := auditLsCmd.Flags()
+	flags.String("auditLog", "", `audit log to query, "db" for the database or the path of its file (the one the server is set to by default)`)
+	flags.String("user", "", "only list the actions of this user")
+	flags.String("action", "", "only list this action, e.g. delete")
+	flags.String("path", "", "only list the actions on this path or within it")
+	flags.String("share", "", "only list the accesses through the share of this hash")
+	flags.String("since", "", "only list the actions since this RFC 3339 time, or this long ago, e.g. 24h")
+	flags.String("until", "", "only list the actions before this RFC 3339 time, or this long ago")
+	flags.Int("limit", 100, "most actions listed, the latest first (all if 0)")
+}
+
+var auditLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the recorded actions",
+	Long: `List the recorded file and admin actions, the latest first. For
+example, to find out who deleted a file:
+
+  filebrowser audit ls --action delete --path /docs/report.pdf`,
+	Args: cobra.NoArgs,
+	RunE: withViperAndStore(func(cmd *cobra.Command, _ []string, v *viper.Viper, st *store) error {
+		server, err := st.Settings.GetServer()
+		if err != nil {
+			return err
+		}
+		if v.IsSet("auditLog") {
+			server.AuditLog = v.GetString("auditLog")
+		}
+		auditLog := openAudit(server, st.Storage)
+		if auditLog == nil {
+			return errAuditDisabled
+		}
+
+		flags := cmd.Flags()
+		var filter audit.Filter
+		for name, field := range map[string]*string{
+			"user":   &filter.User,
+			"action": &filter.Action,
+			"path":   &filter.Path,
+			"share":  &filter.Share,
+		} {
+			if *field, err = flags.GetString(name); err != nil {
+				return err
+			}
+		}
+		if filter.Limit, err = flags.GetInt("limit"); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for name, bound := range map[string]*time.Time{
+			"since": &filter.Since,
+			"until": &filter.Until,
+		} {
+			value, err := flags.GetString(name)
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				continue
+			}
+			if *bound, err = audit.ParseTime(value, now); err != nil {
+				return err
+			}
+		}
+
+		events, err := auditLog.Find(filter)
+		if err != nil {
+			return err
+		}
+		printAuditEvents(events)
+		return nil
+	}, storeOptions{}),
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+func init() {
+	cmdsCmd.AddCommand(cmdsPolicyCmd)
+}
+
+var cmdsPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Command policies management utility",
+	Long: `Command policies management utility.
+
+The policies restrict how the commands of their names are
+run, by the users and as hooks: how long they may run, how
+much they may output, which arguments they accept, which
+variables of the environment they see and, on Linux, their
+resource limits and namespaces. The commands with a policy
+are never run through the shell.`,
+	Args: cobra.NoArgs,
+}
+
+func printPolicies(policies map[string]settings.CommandPolicy) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Command\tTimeout\tMax Output\tArgs\tEnv\tMax Memory\tMax CPU Time\tMax File Size\tMax Open Files\tNamespaces")
+
+	for _, name := range slices.Sorted(maps.Keys(policies)) {
+		p := policies[name]
+		env := "inherited"
+		if p.ClearEnv {
+			env = strings.Join(p.Env, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%d\t%s\t%d\t%d\t%s\t\n",
+			name,
+			p.Timeout,
+			p.MaxOutput,
+			strings.Join(p.Args, " "),
+			env,
+			p.MaxMemory,
+			p.MaxCPUTime,
+			p.MaxFileSize,
+			p.MaxOpenFiles,
+			strings.Join(p.Namespaces, ","),
+		)
+	}
+
+	w.Flush()
+}
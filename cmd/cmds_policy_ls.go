@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdsPolicyCmd.AddCommand(cmdsPolicyLsCmd)
+}
+
+var cmdsPolicyLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the command policies",
+	Long:  `List the command policies.`,
+	Args:  cobra.NoArgs,
+	RunE: withStore(func(_ *cobra.Command, _ []string, st *store) error {
+		s, err := st.Settings.Get()
+		if err != nil {
+			return err
+		}
+		printPolicies(s.CommandPolicies)
+		return nil
+	}, storeOptions{}),
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmdsPolicyCmd.AddCommand(cmdsPolicyRmCmd)
+}
+
+var cmdsPolicyRmCmd = &cobra.Command{
+	Use:   "rm <command>",
+	Short: "Remove the policy of a command",
+	Long:  `Remove the policy of a command, which is then run unrestricted.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		s, err := st.Settings.Get()
+		if err != nil {
+			return err
+		}
+		if _, ok := s.CommandPolicies[args[0]]; !ok {
+			return fmt.Errorf("no policy for the command %q", args[0])
+		}
+
+		delete(s.CommandPolicies, args[0])
+		if err := st.Settings.Save(s); err != nil {
+			return err
+		}
+		printPolicies(s.CommandPolicies)
+		return nil
+	}, storeOptions{}),
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+func init() {
+	cmdsPolicyCmd.AddCommand(cmdsPolicySetCmd)
+	flags := cmdsPolicySetCmd.Flags()
+	flags.String("timeout", "", "how long the command may run before it is killed, like 30s")
+	flags.Int64("maxOutput", 0, "how many bytes the command may output before it is killed")
+	flags.StringArray("arg", nil, "regular expression any argument must match in full, repeated for each pattern allowed")
+	flags.Bool("clearEnv", false, "run the command without the environment of the server")
+	flags.StringSlice("env", nil, "variables of the environment of the server kept with --clearEnv")
+	flags.Uint64("maxMemory", 0, "bytes of memory the command may use (Linux)")
+	flags.String("maxCpuTime", "", "CPU time the command may use, like 10s (Linux)")
+	flags.Uint64("maxFileSize", 0, "bytes the files written by the command may grow to (Linux)")
+	flags.Uint64("maxOpenFiles", 0, "files the command may open at once (Linux)")
+	flags.StringSlice("namespace", nil, "namespaces to isolate the command in, among user, mount, pid, net, ipc and uts (Linux)")
+}
+
+var cmdsPolicySetCmd = &cobra.Command{
+	Use:   "set <command>",
+	Short: "Set the policy of a command",
+	Long: `Set the policy of a command, replacing the one it had. The
+flags left out don't restrict anything.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withStore(func(cmd *cobra.Command, args []string, st *store) error {
+		flags := cmd.Flags()
+		var (
+			policy settings.CommandPolicy
+			err    error
+		)
+		if policy.Timeout, err = flags.GetString("timeout"); err != nil {
+			return err
+		}
+		if policy.MaxOutput, err = flags.GetInt64("maxOutput"); err != nil {
+			return err
+		}
+		if policy.Args, err = flags.GetStringArray("arg"); err != nil {
+			return err
+		}
+		if policy.ClearEnv, err = flags.GetBool("clearEnv"); err != nil {
+			return err
+		}
+		if policy.Env, err = flags.GetStringSlice("env"); err != nil {
+			return err
+		}
+		if policy.MaxMemory, err = flags.GetUint64("maxMemory"); err != nil {
+			return err
+		}
+		if policy.MaxCPUTime, err = flags.GetString("maxCpuTime"); err != nil {
+			return err
+		}
+		if policy.MaxFileSize, err = flags.GetUint64("maxFileSize"); err != nil {
+			return err
+		}
+		if policy.MaxOpenFiles, err = flags.GetUint64("maxOpenFiles"); err != nil {
+			return err
+		}
+		if policy.Namespaces, err = flags.GetStringSlice("namespace"); err != nil {
+			return err
+		}
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+
+		s, err := st.Settings.Get()
+		if err != nil {
+			return err
+		}
+		if s.CommandPolicies == nil {
+			s.CommandPolicies = map[string]settings.CommandPolicy{}
+		}
+		s.CommandPolicies[args[0]] = policy
+		if err := st.Settings.Save(s); err != nil {
+			return err
+		}
+		printPolicies(s.CommandPolicies)
+		return nil
+	}, storeOptions{}),
+}
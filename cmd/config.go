@@ -36,6 +36,7 @@ func addConfigFlags(flags *pflag.FlagSet) {
 	flags.Bool("createUserDir", false, "generate user's home directory automatically")
 	flags.Uint("minimumPasswordLength", settings.DefaultMinimumPasswordLength, "minimum password length for new users")
 	flags.String("shell", "", "shell command to which other commands should be appended")
+	flags.Uint("versions", 0, "number of previous versions kept when files are overwritten (0 to disable)")
 
 	// NB: these are string so they can be presented as octal in the help text
 	// as that's the conventional representation for modes in Unix.
@@ -45,8 +46,26 @@ func addConfigFlags(flags *pflag.FlagSet) {
 	flags.String("auth.method", string(auth.MethodJSONAuth), "authentication type")
 	flags.String("auth.header", "", "HTTP header for auth.method=proxy")
 	flags.String("auth.command", "", "command for auth.method=hook")
+	flags.String("auth.oidc.issuer", "", "issuer URL for auth.method=oidc")
+	flags.String("auth.oidc.clientID", "", "client ID for auth.method=oidc")
+	flags.String("auth.oidc.clientSecret", "", "client secret for auth.method=oidc")
+	flags.String("auth.oidc.redirectURL", "", "callback URL registered with the identity provider for auth.method=oidc (default derived from the request)")
+	flags.StringSlice("auth.oidc.scopes", []string{"profile", "email"}, "scopes requested, besides openid, for auth.method=oidc")
+	flags.String("auth.oidc.usernameClaim", auth.DefaultOIDCUsernameClaim, "ID token claim holding the username for auth.method=oidc")
+	flags.String("auth.oidc.groupsClaim", auth.DefaultOIDCGroupsClaim, "ID token claim holding the groups for auth.method=oidc")
+	flags.String("auth.oidc.groups", "", `JSON list of groups granting permissions for auth.method=oidc, e.g. [{"name":"admins","perm":{"admin":true}}]`)
+	flags.String("auth.ldap.url", "", "URL of the directory for auth.method=ldap, e.g. ldaps://ldap.example.com")
+	flags.Bool("auth.ldap.startTLS", false, "upgrade ldap:// connections with StartTLS for auth.method=ldap")
+	flags.Bool("auth.ldap.insecureSkipVerify", false, "don't verify the certificate of the directory for auth.method=ldap")
+	flags.String("auth.ldap.caCert", "", "path to the PEM certificates trusted for the directory for auth.method=ldap")
+	flags.String("auth.ldap.bindDN", "", "DN of the account searching for users for auth.method=ldap (default anonymous)")
+	flags.String("auth.ldap.bindPassword", "", "password of auth.ldap.bindDN for auth.method=ldap")
+	flags.String("auth.ldap.baseDN", "", "DN users are searched under for auth.method=ldap")
+	flags.String("auth.ldap.userFilter", auth.DefaultLDAPUserFilter, "filter users are searched with, {username} being replaced, for auth.method=ldap")
+	flags.String("auth.ldap.usernameAttribute", auth.DefaultLDAPUsernameAttribute, "attribute holding the username for auth.method=ldap")
+	flags.String("auth.ldap.groupAttribute", auth.DefaultLDAPGroupAttribute, "attribute holding the group DNs of the users for auth.method=ldap")
+	flags.String("auth.ldap.groups", "", `JSON list of groups granting permissions for auth.method=ldap, e.g. [{"dn":"cn=admins,ou=groups,dc=example,dc=org","perm":{"admin":true}}]`)
 
-	flags.String("authenticatorToken", "", "OTP shared secret (leave blank to disable)")
 	flags.String("auth.logoutPage", "", "url of custom logout page")
 
 	flags.String("recaptcha.host", "https://www.google.com", "use another host for ReCAPTCHA. recaptcha.net might be useful in China")
@@ -62,6 +81,12 @@ func addConfigFlags(flags *pflag.FlagSet) {
 
 	flags.Uint64("tus.chunkSize", settings.DefaultTusChunkSize, "the tus chunk size")
 	flags.Uint16("tus.retryCount", settings.DefaultTusRetryCount, "the tus retry count")
+
+	flags.Uint("loginLimits.attempts", settings.DefaultLoginAttempts, "failed logins allowed before clients and users are locked out")
+	flags.String("loginLimits.lockout", "5m", "first lockout, doubled on every failure after it")
+	flags.String("loginLimits.maxLockout", "720h", "longest lockout")
+	flags.String("loginLimits.window", "24h", "how long failed logins are remembered once the last lockout ended")
+	flags.StringSlice("loginLimits.trustedProxies", []string{}, "addresses or CIDR ranges of the proxies whose X-Forwarded-For and X-Real-IP headers tell the clients locked out")
 }
 
 func getAuthMethod(flags *pflag.FlagSet, defaults ...interface{}) (settings.AuthMethod, map[string]interface{}, error) {
@@ -118,19 +143,11 @@ func getNoAuth() auth.Auther {
 
 func getJSONAuth(flags *pflag.FlagSet, defaultAuther map[string]interface{}) (auth.Auther, error) {
 	jsonAuth := &auth.JSONAuth{}
-	authenticationToken, err := flags.GetString("authenticatorToken")
-	if err != nil {
-		return nil, err
+	// Kept until it is moved onto the users on start up.
+	if atok, ok := defaultAuther["authenticatorToken"].(string); ok {
+		jsonAuth.AuthenticatorToken = atok
 	}
 
-	if authenticationToken == "" {
-		if atok, ok := defaultAuther["authenticatorToken"].(string); ok {
-			authenticationToken = atok
-		}
-	}
-
-	jsonAuth.AuthenticatorToken = authenticationToken
-
 	host, err := flags.GetString("recaptcha.host")
 	if err != nil {
 		return nil, err
@@ -184,6 +201,135 @@ func getHookAuth(flags *pflag.FlagSet, defaultAuther map[string]interface{}) (au
 	return &auth.HookAuth{Command: command}, nil
 }
 
+func getOIDCAuth(flags *pflag.FlagSet, defaultAuther map[string]interface{}) (auth.Auther, error) {
+	oidcAuth := &auth.OIDCAuth{}
+	if defaultAuther != nil {
+		b, err := json.Marshal(defaultAuther)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, oidcAuth); err != nil {
+			return nil, err
+		}
+	}
+
+	// Updates only change what is set.
+	isSet := func(name string) bool {
+		return defaultAuther == nil || flags.Changed(name)
+	}
+
+	errs := []error{}
+	for name, value := range map[string]*string{
+		"auth.oidc.issuer":        &oidcAuth.Issuer,
+		"auth.oidc.clientID":      &oidcAuth.ClientID,
+		"auth.oidc.clientSecret":  &oidcAuth.ClientSecret,
+		"auth.oidc.redirectURL":   &oidcAuth.RedirectURL,
+		"auth.oidc.usernameClaim": &oidcAuth.UsernameClaim,
+		"auth.oidc.groupsClaim":   &oidcAuth.GroupsClaim,
+	} {
+		if isSet(name) {
+			var err error
+			*value, err = flags.GetString(name)
+			errs = append(errs, err)
+		}
+	}
+
+	if isSet("auth.oidc.scopes") {
+		var err error
+		oidcAuth.Scopes, err = flags.GetStringSlice("auth.oidc.scopes")
+		errs = append(errs, err)
+	}
+
+	if isSet("auth.oidc.groups") {
+		groups, err := flags.GetString("auth.oidc.groups")
+		errs = append(errs, err)
+		oidcAuth.Groups = nil
+		if groups != "" {
+			if err := json.Unmarshal([]byte(groups), &oidcAuth.Groups); err != nil {
+				errs = append(errs, fmt.Errorf("invalid 'auth.oidc.groups': %w", err))
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if oidcAuth.Issuer == "" || oidcAuth.ClientID == "" {
+		return nil, errors.New("you must set the flags 'auth.oidc.issuer' and 'auth.oidc.clientID' for method 'oidc'")
+	}
+
+	return oidcAuth, nil
+}
+
+func getLDAPAuth(flags *pflag.FlagSet, defaultAuther map[string]interface{}) (auth.Auther, error) {
+	ldapAuth := &auth.LDAPAuth{}
+	if defaultAuther != nil {
+		b, err := json.Marshal(defaultAuther)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, ldapAuth); err != nil {
+			return nil, err
+		}
+	}
+
+	// Updates only change what is set.
+	isSet := func(name string) bool {
+		return defaultAuther == nil || flags.Changed(name)
+	}
+
+	errs := []error{}
+	for name, value := range map[string]*string{
+		"auth.ldap.url":               &ldapAuth.URL,
+		"auth.ldap.caCert":            &ldapAuth.CACert,
+		"auth.ldap.bindDN":            &ldapAuth.BindDN,
+		"auth.ldap.bindPassword":      &ldapAuth.BindPassword,
+		"auth.ldap.baseDN":            &ldapAuth.BaseDN,
+		"auth.ldap.userFilter":        &ldapAuth.UserFilter,
+		"auth.ldap.usernameAttribute": &ldapAuth.UsernameAttribute,
+		"auth.ldap.groupAttribute":    &ldapAuth.GroupAttribute,
+	} {
+		if isSet(name) {
+			var err error
+			*value, err = flags.GetString(name)
+			errs = append(errs, err)
+		}
+	}
+
+	for name, value := range map[string]*bool{
+		"auth.ldap.startTLS":           &ldapAuth.StartTLS,
+		"auth.ldap.insecureSkipVerify": &ldapAuth.InsecureSkipVerify,
+	} {
+		if isSet(name) {
+			var err error
+			*value, err = flags.GetBool(name)
+			errs = append(errs, err)
+		}
+	}
+
+	if isSet("auth.ldap.groups") {
+		groups, err := flags.GetString("auth.ldap.groups")
+		errs = append(errs, err)
+		ldapAuth.Groups = nil
+		if groups != "" {
+			if err := json.Unmarshal([]byte(groups), &ldapAuth.Groups); err != nil {
+				errs = append(errs, fmt.Errorf("invalid 'auth.ldap.groups': %w", err))
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if ldapAuth.URL == "" || ldapAuth.BaseDN == "" {
+		return nil, errors.New("you must set the flags 'auth.ldap.url' and 'auth.ldap.baseDN' for method 'ldap'")
+	}
+
+	return ldapAuth, nil
+}
+
 func getAuthentication(flags *pflag.FlagSet, defaults ...interface{}) (settings.AuthMethod, auth.Auther, error) {
 	method, defaultAuther, err := getAuthMethod(flags, defaults...)
 	if err != nil {
@@ -200,6 +346,10 @@ func getAuthentication(flags *pflag.FlagSet, defaults ...interface{}) (settings.
 		auther, err = getJSONAuth(flags, defaultAuther)
 	case auth.MethodHookAuth:
 		auther, err = getHookAuth(flags, defaultAuther)
+	case auth.MethodOIDCAuth:
+		auther, err = getOIDCAuth(flags, defaultAuther)
+	case auth.MethodLDAPAuth:
+		auther, err = getLDAPAuth(flags, defaultAuther)
 	default:
 		return "", nil, fberrors.ErrInvalidAuthMethod
 	}
@@ -221,6 +371,7 @@ func printSettings(ser *settings.Server, set *settings.Settings, auther auth.Aut
 	fmt.Fprintf(w, "Minimum Password Length:\t%d\n", set.MinimumPasswordLength)
 	fmt.Fprintf(w, "Auth Method:\t%s\n", set.AuthMethod)
 	fmt.Fprintf(w, "Shell:\t%s\t\n", strings.Join(set.Shell, " "))
+	fmt.Fprintf(w, "Versions Kept:\t%d\n", set.Versions)
 
 	fmt.Fprintln(w, "\nBranding:")
 	fmt.Fprintf(w, "\tName:\t%s\n", set.Branding.Name)
@@ -245,11 +396,24 @@ func printSettings(ser *settings.Server, set *settings.Settings, auther auth.Aut
 	fmt.Fprintf(w, "\tResize Preview:\t%t\n", ser.ResizePreview)
 	fmt.Fprintf(w, "\tType Detection by Header:\t%t\n", ser.TypeDetectionByHeader)
 	fmt.Fprintf(w, "\tFollow External Symlinks:\t%t\n", ser.FollowExternalSymlinks)
+	fmt.Fprintf(w, "\tWebDAV Prefix:\t%s\n", ser.WebDAVPrefix)
+	fmt.Fprintf(w, "\tTrash Directory:\t%s\n", ser.TrashDir)
+	fmt.Fprintf(w, "\tTrash Retention:\t%s\n", ser.TrashRetention)
+	fmt.Fprintf(w, "\tVersions Directory:\t%s\n", ser.VersionsDir)
+	fmt.Fprintf(w, "\tAudit Log:\t%s\n", ser.AuditLog)
+	fmt.Fprintf(w, "\tMetrics Enabled:\t%t\n", ser.EnableMetrics)
 
 	fmt.Fprintln(w, "\nTUS:")
 	fmt.Fprintf(w, "\tChunk size:\t%d\n", set.Tus.ChunkSize)
 	fmt.Fprintf(w, "\tRetry count:\t%d\n", set.Tus.RetryCount)
 
+	fmt.Fprintln(w, "\nLogin Limits:")
+	fmt.Fprintf(w, "\tAttempts:\t%d\n", set.LoginLimits.GetAttempts())
+	fmt.Fprintf(w, "\tLockout:\t%s\n", set.LoginLimits.GetLockout())
+	fmt.Fprintf(w, "\tMax Lockout:\t%s\n", set.LoginLimits.GetMaxLockout())
+	fmt.Fprintf(w, "\tWindow:\t%s\n", set.LoginLimits.GetWindow())
+	fmt.Fprintf(w, "\tTrusted Proxies:\t%s\n", strings.Join(set.LoginLimits.TrustedProxies, " "))
+
 	fmt.Fprintln(w, "\nDefaults:")
 	fmt.Fprintf(w, "\tScope:\t%s\n", set.Defaults.Scope)
 	fmt.Fprintf(w, "\tDateFormat:\t%t\n", set.Defaults.DateFormat)
@@ -267,6 +431,11 @@ func printSettings(ser *settings.Server, set *settings.Settings, auther auth.Aut
 	fmt.Fprintf(w, "\t\tBy:\t%s\n", set.Defaults.Sorting.By)
 	fmt.Fprintf(w, "\t\tAsc:\t%t\n", set.Defaults.Sorting.Asc)
 
+	fmt.Fprintf(w, "\tQuota:\n")
+	fmt.Fprintf(w, "\t\tBytes:\t%d\n", set.Defaults.Quota.Bytes)
+	fmt.Fprintf(w, "\t\tFiles:\t%d\n", set.Defaults.Quota.Files)
+	fmt.Fprintf(w, "\tSecond Factor:\t%s\n", set.Defaults.SecondFactor)
+
 	fmt.Fprintf(w, "\tPermissions:\n")
 	fmt.Fprintf(w, "\t\tAdmin:\t%t\n", set.Defaults.Perm.Admin)
 	fmt.Fprintf(w, "\t\tExecute:\t%t\n", set.Defaults.Perm.Execute)
@@ -329,6 +498,20 @@ func getSettings(flags *pflag.FlagSet, set *settings.Settings, ser *settings.Ser
 		case "disableImageResolutionCalc":
 			ser.ImageResolutionCal, err = flags.GetBool(flag.Name)
 			ser.ImageResolutionCal = !ser.ImageResolutionCal
+		case "webdavPrefix":
+			ser.WebDAVPrefix, err = flags.GetString(flag.Name)
+		case "trashDir":
+			ser.TrashDir, err = flags.GetString(flag.Name)
+		case "trashRetention":
+			ser.TrashRetention, err = flags.GetString(flag.Name)
+		case "versionsDir":
+			ser.VersionsDir, err = flags.GetString(flag.Name)
+		case "auditLog":
+			ser.AuditLog, err = flags.GetString(flag.Name)
+		case "enableMetrics":
+			ser.EnableMetrics, err = flags.GetBool(flag.Name)
+		case "metricsToken":
+			ser.MetricsToken, err = flags.GetString(flag.Name)
 
 		// Settings flags from [addConfigFlags]
 		case "signup":
@@ -339,6 +522,8 @@ func getSettings(flags *pflag.FlagSet, set *settings.Settings, ser *settings.Ser
 			set.CreateUserDir, err = flags.GetBool(flag.Name)
 		case "minimumPasswordLength":
 			set.MinimumPasswordLength, err = flags.GetUint(flag.Name)
+		case "versions":
+			set.Versions, err = flags.GetUint(flag.Name)
 		case "shell":
 			var shell string
 			shell, err = flags.GetString(flag.Name)
@@ -369,6 +554,16 @@ func getSettings(flags *pflag.FlagSet, set *settings.Settings, ser *settings.Ser
 			set.Tus.ChunkSize, err = flags.GetUint64(flag.Name)
 		case "tus.retryCount":
 			set.Tus.RetryCount, err = flags.GetUint16(flag.Name)
+		case "loginLimits.attempts":
+			set.LoginLimits.Attempts, err = flags.GetUint(flag.Name)
+		case "loginLimits.lockout":
+			set.LoginLimits.Lockout, err = flags.GetString(flag.Name)
+		case "loginLimits.maxLockout":
+			set.LoginLimits.MaxLockout, err = flags.GetString(flag.Name)
+		case "loginLimits.window":
+			set.LoginLimits.Window, err = flags.GetString(flag.Name)
+		case "loginLimits.trustedProxies":
+			set.LoginLimits.TrustedProxies, err = flags.GetStringSlice(flag.Name)
 		}
 
 		if err != nil {
@@ -387,6 +582,11 @@ func getSettings(flags *pflag.FlagSet, set *settings.Settings, ser *settings.Ser
 		return nil, err
 	}
 
+	err = set.LoginLimits.Validate()
+	if err != nil {
+		return nil, err
+	}
+
 	err = getUserDefaults(flags, &set.Defaults, all)
 	if err != nil {
 		return nil, err
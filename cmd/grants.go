@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/grants"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func init() {
+	rootCmd.AddCommand(grantsCmd)
+}
+
+var grantsCmd = &cobra.Command{
+	Use:   "grants",
+	Short: "Grants management utility",
+	Long: `Grants management utility.
+
+Grants give users access to the directories of others, which
+they find under "` + grants.Root + `".`,
+	Args: cobra.NoArgs,
+}
+
+func printGrants(list []*grants.Grant) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tOwner ID\tPath\tGrantee ID\tGroup\tName\tPermissions")
+
+	for _, g := range list {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%d\t%s\t%s\t%s\t\n",
+			g.ID,
+			g.OwnerID,
+			g.Path,
+			g.GranteeID,
+			g.Group,
+			g.Name,
+			grantPerm(g.Perm),
+		)
+	}
+
+	w.Flush()
+}
+
+// grantPerm formats the permissions a grant gives.
+func grantPerm(perm users.Permissions) string {
+	var s string
+	for _, p := range []struct {
+		name string
+		ok   bool
+	}{
+		{"create", perm.Create},
+		{"rename", perm.Rename},
+		{"modify", perm.Modify},
+		{"delete", perm.Delete},
+		{"download", perm.Download},
+	} {
+		if !p.ok {
+			continue
+		}
+		if s != "" {
+			s += ","
+		}
+		s += p.name
+	}
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/grants"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func init() {
+	grantsCmd.AddCommand(grantsLsCmd)
+	grantsLsCmd.Flags().String("user", "", "only list the grants made by or to this user, or their groups, by ID or username")
+}
+
+var grantsLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the grants",
+	Args:  cobra.NoArgs,
+	RunE: withStore(func(cmd *cobra.Command, _ []string, st *store) error {
+		name, err := cmd.Flags().GetString("user")
+		if err != nil {
+			return err
+		}
+
+		var list []*grants.Grant
+		if name == "" {
+			list, err = st.Grants.All()
+		} else {
+			var user *users.User
+			username, id := parseUsernameOrID(name)
+			if id != 0 {
+				user, err = st.Users.Get("", false, id)
+			} else {
+				user, err = st.Users.Get("", false, username)
+			}
+			if err != nil {
+				return err
+			}
+
+			var given []*grants.Grant
+			list, err = st.Grants.FindByOwner(user.ID)
+			if err == nil {
+				given, err = st.Grants.FindFor(user)
+			}
+			list = append(list, given...)
+		}
+		if err != nil {
+			return err
+		}
+
+		printGrants(list)
+		return nil
+	}, storeOptions{}),
+}
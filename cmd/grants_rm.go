@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	grantsCmd.AddCommand(grantsRmCmd)
+}
+
+var grantsRmCmd = &cobra.Command{
+	Use:   "rm <id>",
+	Short: "Remove a grant",
+	Long:  `Remove a grant, revoking the access of its grantee.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		id, err := strconv.ParseUint(args[0], 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid grant ID %q: %w", args[0], err)
+		}
+		if _, err := st.Grants.Get(uint(id)); err != nil {
+			return fmt.Errorf("no grant with the ID %d: %w", id, err)
+		}
+		return st.Grants.Delete(uint(id))
+	}, storeOptions{}),
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	limitsCmd.AddCommand(limitsLsCmd)
+}
+
+var limitsLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the clients and users who failed to log in",
+	Long: `List the clients and users who failed to log in lately, those
+locked out first.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		limiter, err := getLimiter(cmd)
+		if err != nil {
+			return err
+		}
+
+		limits, err := limiter.List()
+		if err != nil {
+			return err
+		}
+		printLimits(limits)
+		return nil
+	},
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	limitsCmd.AddCommand(limitsRmCmd)
+}
+
+var limitsRmCmd = &cobra.Command{
+	Use:   "rm <key>",
+	Short: "Unblock a client or user",
+	Long: `Unblock a client or user, given its key as printed by 'limits ls',
+forgetting their failed logins.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limiter, err := getLimiter(cmd)
+		if err != nil {
+			return err
+		}
+
+		if err := limiter.Unblock(args[0]); err != nil {
+			return err
+		}
+		fmt.Println("unblocked successfully")
+		return nil
+	},
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/share"
+)
+
+func init() {
+	rootCmd.AddCommand(sharesCmd)
+}
+
+var sharesCmd = &cobra.Command{
+	Use:   "shares",
+	Short: "Shares management utility",
+	Long: `Shares management utility.
+
+The shares are edited in place, so that the links already
+sent out keep working with their new options.`,
+	Args: cobra.NoArgs,
+}
+
+func printShares(links []*share.Link) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Hash\tUser ID\tPath\tExpires\tPassword\tDownloads\tVisits\tUpload")
+
+	for _, link := range links {
+		expires := "never"
+		if link.Expire != 0 {
+			expires = time.Unix(link.Expire, 0).Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%t\t%s\t%s\t%t\t\n",
+			link.Hash,
+			link.UserID,
+			link.Path,
+			expires,
+			link.PasswordHash != "",
+			shareCounter(link.Downloads, link.MaxDownloads),
+			shareCounter(link.Visits, link.MaxVisits),
+			link.Upload,
+		)
+	}
+
+	w.Flush()
+}
+
+// shareCounter formats the accesses counted against their limit, if any.
+func shareCounter(count, limit uint) string {
+	if limit == 0 {
+		return fmt.Sprint(count)
+	}
+	return fmt.Sprintf("%d/%d", count, limit)
+}
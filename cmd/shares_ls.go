@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/share"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func init() {
+	sharesCmd.AddCommand(sharesLsCmd)
+	sharesLsCmd.Flags().String("user", "", "only list the shares of this user, by ID or username")
+}
+
+var sharesLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the shares",
+	Long:  `List the shares, but for those expired.`,
+	Args:  cobra.NoArgs,
+	RunE: withStore(func(cmd *cobra.Command, _ []string, st *store) error {
+		owner, err := cmd.Flags().GetString("user")
+		if err != nil {
+			return err
+		}
+
+		var links []*share.Link
+		if owner == "" {
+			links, err = st.Share.All()
+		} else {
+			var user *users.User
+			username, id := parseUsernameOrID(owner)
+			if id != 0 {
+				user, err = st.Users.Get("", false, id)
+			} else {
+				user, err = st.Users.Get("", false, username)
+			}
+			if err != nil {
+				return err
+			}
+			links, err = st.Share.FindByUserID(user.ID)
+		}
+		if err != nil && !errors.Is(err, fberrors.ErrNotExist) {
+			return err
+		}
+
+		printShares(links)
+		return nil
+	}, storeOptions{}),
+}
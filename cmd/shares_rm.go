@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	sharesCmd.AddCommand(sharesRmCmd)
+}
+
+var sharesRmCmd = &cobra.Command{
+	Use:   "rm <hash>",
+	Short: "Remove a share",
+	Long:  `Remove a share, revoking its link. Its access log is kept.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		if _, err := st.Share.GetByHash(args[0]); err != nil {
+			return fmt.Errorf("no share with the hash %q: %w", args[0], err)
+		}
+		return st.Share.Delete(args[0])
+	}, storeOptions{}),
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/share"
+)
+
+func init() {
+	sharesCmd.AddCommand(sharesUpdateCmd)
+
+	flags := sharesUpdateCmd.Flags()
+	flags.Duration("expires", 0, "time from now the share expires in, e.g. 72h (0 for never)")
+	flags.String("password", "", "new password of the share")
+	flags.Bool("noPassword", false, "remove the password of the share")
+	flags.Uint("maxDownloads", 0, "downloads the share allows (0 for no limit)")
+	flags.Uint("maxVisits", 0, "visits the share allows (0 for no limit)")
+	flags.Uint("maxFiles", 0, "files the file request takes (0 for no limit)")
+	flags.Int64("maxBytes", 0, "bytes the file request takes (0 for no limit)")
+	flags.StringSlice("extension", nil, "extension the file request takes, e.g. .pdf (repeatable, none for any)")
+}
+
+var sharesUpdateCmd = &cobra.Command{
+	Use:   "update <hash>",
+	Short: "Updates an existing share",
+	Long: `Updates an existing share, whose link stays the same. Set the
+flags for the options you want to change. A new password
+also invalidates the links to the files of the share handed
+out before.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withStore(func(cmd *cobra.Command, args []string, st *store) error {
+		flags := cmd.Flags()
+		link, err := st.Share.GetByHash(args[0])
+		if err != nil {
+			return fmt.Errorf("no share with the hash %q: %w", args[0], err)
+		}
+
+		var body share.UpdateBody
+		if flags.Changed("expires") {
+			expires, err := flags.GetDuration("expires")
+			if err != nil {
+				return err
+			}
+			seconds := ""
+			if expires != 0 {
+				seconds = strconv.FormatInt(int64(expires/time.Second), 10)
+			}
+			body.Expires = &seconds
+			body.Unit = "seconds"
+		}
+
+		noPassword, err := flags.GetBool("noPassword")
+		if err != nil {
+			return err
+		}
+		if noPassword {
+			body.Password = new(string)
+		}
+		if flags.Changed("password") {
+			password, err := flags.GetString("password")
+			if err != nil {
+				return err
+			}
+			body.Password = &password
+		}
+
+		for name, field := range map[string]**uint{
+			"maxDownloads": &body.MaxDownloads,
+			"maxVisits":    &body.MaxVisits,
+			"maxFiles":     &body.MaxFiles,
+		} {
+			if !flags.Changed(name) {
+				continue
+			}
+			value, err := flags.GetUint(name)
+			if err != nil {
+				return err
+			}
+			*field = &value
+		}
+		if flags.Changed("maxBytes") {
+			maxBytes, err := flags.GetInt64("maxBytes")
+			if err != nil {
+				return err
+			}
+			body.MaxBytes = &maxBytes
+		}
+		if flags.Changed("extension") {
+			extensions, err := flags.GetStringSlice("extension")
+			if err != nil {
+				return err
+			}
+			body.Extensions = &extensions
+		}
+
+		if err := link.Update(&body, time.Now()); err != nil {
+			return err
+		}
+		if err := st.Share.Save(link); err != nil {
+			return err
+		}
+		printShares([]*share.Link{link})
+		return nil
+	}, storeOptions{}),
+}
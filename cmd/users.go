@@ -82,6 +82,9 @@ func addUserFlags(flags *pflag.FlagSet) {
 	flags.Bool("dateFormat", false, "use date format (true for absolute time, false for relative)")
 	flags.Bool("hideDotfiles", false, "hide dotfiles in file listings")
 	flags.String("aceEditorTheme", "", "ace editor's syntax highlighting theme for users")
+	flags.Int64("quota.bytes", 0, "storage quota for users in bytes (0 for unlimited)")
+	flags.Int64("quota.files", 0, "maximum number of files for users (0 for unlimited)")
+	flags.String("secondFactor", "", "second factor required to log in with auth.method=json (totp, passkey or any; blank for the OTP of those who enrolled one)")
 }
 
 func getAndParseViewMode(flags *pflag.FlagSet) (users.ViewMode, error) {
@@ -98,6 +101,20 @@ func getAndParseViewMode(flags *pflag.FlagSet) (users.ViewMode, error) {
 	return viewMode, nil
 }
 
+func getAndParseSecondFactor(flags *pflag.FlagSet) (users.SecondFactor, error) {
+	secondFactorStr, err := flags.GetString("secondFactor")
+	if err != nil {
+		return "", err
+	}
+
+	secondFactor := users.SecondFactor(secondFactorStr)
+	if !secondFactor.Valid() {
+		return "", errors.New("second factor must be blank, \"" + string(users.SecondFactorTOTP) + "\", \"" + string(users.SecondFactorPasskey) + "\" or \"" + string(users.SecondFactorAny) + "\"")
+	}
+
+	return secondFactor, nil
+}
+
 func getUserDefaults(flags *pflag.FlagSet, defaults *settings.UserDefaults, all bool) error {
 	errs := []error{}
 
@@ -142,6 +159,12 @@ func getUserDefaults(flags *pflag.FlagSet, defaults *settings.UserDefaults, all
 			defaults.DateFormat, err = flags.GetBool(flag.Name)
 		case "hideDotfiles":
 			defaults.HideDotfiles, err = flags.GetBool(flag.Name)
+		case "quota.bytes":
+			defaults.Quota.Bytes, err = flags.GetInt64(flag.Name)
+		case "quota.files":
+			defaults.Quota.Files, err = flags.GetInt64(flag.Name)
+		case "secondFactor":
+			defaults.SecondFactor, err = getAndParseSecondFactor(flags)
 		}
 
 		if err != nil {
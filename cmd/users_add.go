@@ -9,6 +9,7 @@ import (
 func init() {
 	usersCmd.AddCommand(usersAddCmd)
 	addUserFlags(usersAddCmd.Flags())
+	usersAddCmd.Flags().StringSlice("groups", []string{}, "groups the user is in, which directories can be granted to")
 }
 
 var usersAddCmd = &cobra.Command{
@@ -52,6 +53,11 @@ var usersAddCmd = &cobra.Command{
 			return err
 		}
 
+		user.Groups, err = flags.GetStringSlice("groups")
+		if err != nil {
+			return err
+		}
+
 		s.Defaults.Apply(user)
 
 		servSettings, err := st.Settings.GetServer()
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	usersCmd.AddCommand(usersOtpCmd)
+}
+
+var usersOtpCmd = &cobra.Command{
+	Use:   "otp",
+	Short: "Manage the one-time password authenticators of users",
+	Long:  `Manage the authenticators users enrolled to prove one-time passwords with.`,
+	Args:  cobra.NoArgs,
+}
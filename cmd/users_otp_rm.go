@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func init() {
+	usersOtpCmd.AddCommand(usersOtpRmCmd)
+}
+
+var usersOtpRmCmd = &cobra.Command{
+	Use:   "rm <id|username>",
+	Short: "Remove the authenticator of a user",
+	Long: `Remove the authenticator and recovery codes of a user, e.g.
+when they lost them. Users whose second factor is totp must
+enroll a new authenticator on their next login.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		user, err := getUserByUsernameOrID(st.Storage, args[0])
+		if err != nil {
+			return err
+		}
+
+		user.TOTP = users.TOTP{}
+		if err := st.Users.Update(user, "TOTP"); err != nil {
+			return err
+		}
+		fmt.Println("authenticator removed successfully")
+		return nil
+	}, storeOptions{}),
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
+	"github.com/thevickypedia/filebrowser/v2/storage"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func init() {
+	usersCmd.AddCommand(usersPasskeysCmd)
+}
+
+var usersPasskeysCmd = &cobra.Command{
+	Use:   "passkeys",
+	Short: "Manage the passkeys of users",
+	Long:  `Manage the passkeys users registered to log in with.`,
+	Args:  cobra.NoArgs,
+}
+
+func getUserByUsernameOrID(st *storage.Storage, arg string) (*users.User, error) {
+	username, id := parseUsernameOrID(arg)
+	if id != 0 {
+		return st.Users.Get("", false, id)
+	}
+	return st.Users.Get("", false, username)
+}
+
+func printPasskeys(credentials []*passkeys.Credential) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tCreated\tLast Used")
+
+	for _, c := range credentials {
+		lastUsed := "never"
+		if !c.LastUsedAt.IsZero() {
+			lastUsed = c.LastUsedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", c.ID, c.Name, c.CreatedAt.Format(time.RFC3339), lastUsed)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	usersPasskeysCmd.AddCommand(usersPasskeysLsCmd)
+}
+
+var usersPasskeysLsCmd = &cobra.Command{
+	Use:   "ls <id|username>",
+	Short: "List the passkeys of a user",
+	Long:  `List the passkeys of a user.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		user, err := getUserByUsernameOrID(st.Storage, args[0])
+		if err != nil {
+			return err
+		}
+
+		credentials, err := st.Passkeys.FindByUserID(user.ID)
+		if err != nil {
+			return err
+		}
+		printPasskeys(credentials)
+		return nil
+	}, storeOptions{}),
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+func init() {
+	usersPasskeysCmd.AddCommand(usersPasskeysRmCmd)
+}
+
+var usersPasskeysRmCmd = &cobra.Command{
+	Use:   "rm <id|username> [passkey]",
+	Short: "Revoke passkeys of a user",
+	Long: `Revoke a passkey of a user, given its ID as printed by
+'users passkeys ls', or all of their passkeys if none is given.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		user, err := getUserByUsernameOrID(st.Storage, args[0])
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			if err := st.Passkeys.DeleteByUserID(user.ID); err != nil {
+				return err
+			}
+			fmt.Println("passkeys revoked successfully")
+			return nil
+		}
+
+		credential, err := st.Passkeys.Get(args[1])
+		if err != nil {
+			return err
+		}
+		if credential.UserID != user.ID {
+			return fberrors.ErrNotExist
+		}
+		if err := st.Passkeys.Delete(credential.ID); err != nil {
+			return err
+		}
+		fmt.Println("passkey revoked successfully")
+		return nil
+	}, storeOptions{}),
+}
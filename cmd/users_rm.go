@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/auth"
 )
 
 func init() {
@@ -16,15 +18,30 @@ var usersRmCmd = &cobra.Command{
 	Long:  `Delete a user by username or id`,
 	Args:  cobra.ExactArgs(1),
 	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
-		username, id := parseUsernameOrID(args[0])
-		var err error
+		user, err := getUserByUsernameOrID(st.Storage, args[0])
+		if err != nil {
+			return err
+		}
 
-		if username != "" {
-			err = st.Users.Delete(username)
-		} else {
-			err = st.Users.Delete(id)
+		err = st.Users.Delete(user.ID)
+		if err != nil {
+			return err
 		}
 
+		// Otherwise a user given the same ID would inherit them.
+		err = st.Passkeys.DeleteByUserID(user.ID)
+		if err != nil {
+			return err
+		}
+		err = st.Tokens.DeleteByUserID(user.ID)
+		if err != nil {
+			return err
+		}
+		err = st.Grants.DeleteByUserID(user.ID)
+		if err != nil {
+			return err
+		}
+		err = auth.RemoveUserSessions(user.ID, "")
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/tokens"
+)
+
+func init() {
+	usersCmd.AddCommand(usersTokensCmd)
+}
+
+var usersTokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "Manage the personal API tokens of users",
+	Long: `Manage the personal API tokens users automate File Browser with.
+They are given as "Authorization: Bearer <token>" headers.`,
+	Args: cobra.NoArgs,
+}
+
+func printTokens(list []*tokens.Token) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tPath\tAdmin\tExecute\tCreate\tRename\tModify\tDelete\tShare\tDownload\tExpires\tLast Used")
+
+	for _, t := range list {
+		lastUsed := "never"
+		if !t.LastUsedAt.IsZero() {
+			lastUsed = t.LastUsedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t%t\t%s\t%s\t\n",
+			t.ID,
+			t.Name,
+			t.Path,
+			t.Perm.Admin,
+			t.Perm.Execute,
+			t.Perm.Create,
+			t.Perm.Rename,
+			t.Perm.Modify,
+			t.Perm.Delete,
+			t.Perm.Share,
+			t.Perm.Download,
+			t.ExpiresAt.Format(time.RFC3339),
+			lastUsed,
+		)
+	}
+
+	w.Flush()
+}
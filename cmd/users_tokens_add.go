@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
+)
+
+func init() {
+	usersTokensCmd.AddCommand(usersTokensAddCmd)
+	flags := usersTokensAddCmd.Flags()
+	flags.Duration("expires", 90*24*time.Hour, "time until the token expires")
+	flags.String("path", "/", "path of the scope of the user the token is restricted to")
+	for _, perm := range []string{"admin", "execute", "create", "rename", "modify", "delete", "share", "download"} {
+		flags.Bool("perm."+perm, false, perm+" perm for the token (default that of the user)")
+	}
+}
+
+var usersTokensAddCmd = &cobra.Command{
+	Use:   "add <id|username> <name>",
+	Short: "Create a personal API token for a user",
+	Long: `Create a personal API token for a user, printing it. It is only
+ever shown then. Tokens have the permissions of their users
+unless restricted with the perm flags.`,
+	Args: cobra.ExactArgs(2),
+	RunE: withStore(func(cmd *cobra.Command, args []string, st *store) error {
+		flags := cmd.Flags()
+		user, err := getUserByUsernameOrID(st.Storage, args[0])
+		if err != nil {
+			return err
+		}
+
+		expires, err := flags.GetDuration("expires")
+		if err != nil {
+			return err
+		}
+		if expires <= 0 {
+			return errors.New("tokens must expire in the future")
+		}
+		path, err := flags.GetString("path")
+		if err != nil {
+			return err
+		}
+		defaults := settings.UserDefaults{Perm: user.Perm}
+		if err := getUserDefaults(flags, &defaults, false); err != nil {
+			return err
+		}
+
+		token, raw := tokens.New(user.ID, args[1], defaults.Perm, path, time.Now().Add(expires))
+		token.Perm = token.Restrict(user.Perm)
+		if err := st.Tokens.Save(token); err != nil {
+			return err
+		}
+
+		printTokens([]*tokens.Token{token})
+		fmt.Println()
+		fmt.Println(raw)
+		return nil
+	}, storeOptions{}),
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	usersTokensCmd.AddCommand(usersTokensLsCmd)
+}
+
+var usersTokensLsCmd = &cobra.Command{
+	Use:   "ls <id|username>",
+	Short: "List the personal API tokens of a user",
+	Long:  `List the personal API tokens of a user.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		user, err := getUserByUsernameOrID(st.Storage, args[0])
+		if err != nil {
+			return err
+		}
+
+		list, err := st.Tokens.FindByUserID(user.ID)
+		if err != nil {
+			return err
+		}
+		printTokens(list)
+		return nil
+	}, storeOptions{}),
+}
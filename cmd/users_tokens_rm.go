@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+func init() {
+	usersTokensCmd.AddCommand(usersTokensRmCmd)
+}
+
+var usersTokensRmCmd = &cobra.Command{
+	Use:   "rm <id|username> [token]",
+	Short: "Revoke personal API tokens of a user",
+	Long: `Revoke a personal API token of a user, given its ID as printed
+by 'users tokens ls', or all of their tokens if none is given.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		user, err := getUserByUsernameOrID(st.Storage, args[0])
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 1 {
+			if err := st.Tokens.DeleteByUserID(user.ID); err != nil {
+				return err
+			}
+			fmt.Println("tokens revoked successfully")
+			return nil
+		}
+
+		token, err := st.Tokens.Get(args[1])
+		if err != nil {
+			return err
+		}
+		if token.UserID != user.ID {
+			return fberrors.ErrNotExist
+		}
+		if err := st.Tokens.Delete(token.ID); err != nil {
+			return err
+		}
+		fmt.Println("token revoked successfully")
+		return nil
+	}, storeOptions{}),
+}
@@ -13,6 +13,7 @@ func init() {
 	usersUpdateCmd.Flags().StringP("password", "p", "", "new password")
 	usersUpdateCmd.Flags().StringP("username", "u", "", "new username")
 	addUserFlags(usersUpdateCmd.Flags())
+	usersUpdateCmd.Flags().StringSlice("groups", nil, "groups the user is in, which directories can be granted to")
 }
 
 var usersUpdateCmd = &cobra.Command{
@@ -60,6 +61,8 @@ options you want to change.`,
 			Perm:                  user.Perm,
 			Sorting:               user.Sorting,
 			Commands:              user.Commands,
+			Quota:                 user.Quota,
+			SecondFactor:          user.SecondFactor,
 		}
 
 		err = getUserDefaults(flags, &defaults, false)
@@ -75,6 +78,8 @@ options you want to change.`,
 		user.Perm = defaults.Perm
 		user.Commands = defaults.Commands
 		user.Sorting = defaults.Sorting
+		user.Quota = defaults.Quota
+		user.SecondFactor = defaults.SecondFactor
 		user.LockPassword, err = flags.GetBool("lockPassword")
 		if err != nil {
 			return err
@@ -90,6 +95,13 @@ options you want to change.`,
 			return err
 		}
 
+		if flags.Changed("groups") {
+			user.Groups, err = flags.GetStringSlice("groups")
+			if err != nil {
+				return err
+			}
+		}
+
 		if newUsername != "" {
 			user.Username = newUsername
 		}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+func init() {
+	rootCmd.AddCommand(webhooksCmd)
+}
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Webhooks management utility",
+	Long: `Webhooks management utility.
+
+The webhooks are posted the JSON payloads of the before and
+after events of the files they subscribed to, such as
+before_upload or after_delete. Their requests are signed
+with the HMAC-SHA256 of the payload, keyed with the secret
+of the webhook, in the X-Filebrowser-Signature header.
+
+A webhook failing to answer a before event with a 2xx status
+cancels the operation, while the after events are retried
+with backoff until posted.`,
+	Args: cobra.NoArgs,
+}
+
+func printWebhooks(hooks []settings.Webhook) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tURL\tEvents\tSigned")
+
+	for _, hook := range hooks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t\n",
+			hook.ID,
+			hook.URL,
+			strings.Join(hook.Events, ","),
+			hook.Secret != "",
+		)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+func init() {
+	webhooksCmd.AddCommand(webhooksAddCmd)
+	webhooksAddCmd.Flags().String("secret", "", "secret the payloads are signed with (default generated)")
+}
+
+var webhooksAddCmd = &cobra.Command{
+	Use:   "add <url> <event> [event...]",
+	Short: "Add a webhook subscribed to events",
+	Long: `Add a webhook subscribed to events, printing the secret its
+payloads are signed with. The events are those of the
+commands, prefixed with before_ or after_: ` + strings.Join(settings.WebhookEvents, ", ") + `.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: withStore(func(cmd *cobra.Command, args []string, st *store) error {
+		secret, err := cmd.Flags().GetString("secret")
+		if err != nil {
+			return err
+		}
+		if secret == "" {
+			secret = rand.Text()
+		}
+
+		hook := settings.Webhook{
+			ID:     strings.ToLower(rand.Text()[:12]),
+			URL:    args[0],
+			Secret: secret,
+			Events: args[1:],
+		}
+		if err := hook.Validate(); err != nil {
+			return err
+		}
+
+		s, err := st.Settings.Get()
+		if err != nil {
+			return err
+		}
+		s.Webhooks = append(s.Webhooks, hook)
+		if err := st.Settings.Save(s); err != nil {
+			return err
+		}
+
+		printWebhooks([]settings.Webhook{hook})
+		fmt.Println()
+		fmt.Println(secret)
+		return nil
+	}, storeOptions{}),
+}
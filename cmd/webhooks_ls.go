@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	webhooksCmd.AddCommand(webhooksLsCmd)
+	webhooksLsCmd.Flags().Bool("queue", false, "list the after events queued for the webhooks instead")
+}
+
+var webhooksLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the webhooks",
+	Long: `List the webhooks, or the after events queued for them until
+they are posted.`,
+	Args: cobra.NoArgs,
+	RunE: withStore(func(cmd *cobra.Command, _ []string, st *store) error {
+		queue, err := cmd.Flags().GetBool("queue")
+		if err != nil {
+			return err
+		}
+
+		if !queue {
+			s, err := st.Settings.Get()
+			if err != nil {
+				return err
+			}
+			printWebhooks(s.Webhooks)
+			return nil
+		}
+
+		deliveries, err := st.Webhooks.All()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tWebhook\tEvent\tAttempts\tNext\tError")
+		for _, d := range deliveries {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t\n",
+				d.ID,
+				d.Webhook,
+				d.Event,
+				d.Attempts,
+				d.Next.Format(time.RFC3339),
+				d.Error,
+			)
+		}
+		w.Flush()
+		return nil
+	}, storeOptions{}),
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+func init() {
+	webhooksCmd.AddCommand(webhooksRmCmd)
+}
+
+var webhooksRmCmd = &cobra.Command{
+	Use:   "rm <id>",
+	Short: "Remove a webhook",
+	Long: `Remove a webhook. The events still queued for it are dropped
+rather than posted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withStore(func(_ *cobra.Command, args []string, st *store) error {
+		s, err := st.Settings.Get()
+		if err != nil {
+			return err
+		}
+
+		n := len(s.Webhooks)
+		s.Webhooks = slices.DeleteFunc(s.Webhooks, func(hook settings.Webhook) bool {
+			return hook.ID == args[0]
+		})
+		if len(s.Webhooks) == n {
+			return fmt.Errorf("no webhook with the ID %q", args[0])
+		}
+
+		if err := st.Settings.Save(s); err != nil {
+			return err
+		}
+		printWebhooks(s.Webhooks)
+		return nil
+	}, storeOptions{}),
+}
@@ -24,6 +24,9 @@ var (
 	ErrRootUserDeletion         = errors.New("the sole admin can't be deleted")
 	ErrCurrentPasswordIncorrect = errors.New("the current password is incorrect")
 	ErrShareRequiresDownload    = errors.New("permission to share requires permission to download")
+	ErrQuotaExceeded            = errors.New("the storage quota is exceeded")
+	ErrInvalidOtp               = errors.New("the one-time password is invalid")
+	ErrOtpEnrollmentRequired    = errors.New("a one-time password authenticator must be enrolled first")
 )
 
 type ErrShortPassword struct {
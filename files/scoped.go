@@ -70,6 +70,13 @@ func (s *ScopedFs) RealPath(name string) (string, error) {
 	return s.base.RealPath(name)
 }
 
+// Guard returns os.ErrPermission if name's on-disk target resolves outside
+// the scope. It is meant for callers working on real paths, out of reach of
+// the checks done by the filesystem operations.
+func (s *ScopedFs) Guard(name string) error {
+	return s.guard(name)
+}
+
 // guard returns an error if name's on-disk target resolves outside the scope.
 func (s *ScopedFs) guard(name string) error {
 	ok, err := s.within(name)
@@ -0,0 +1,28 @@
+import { fetchURL, fetchJSON } from "./utils";
+
+// Lists the grants made by the user, or all of them for the admins.
+export async function list() {
+  return fetchJSON<Grant[]>(`/api/grants`);
+}
+
+// Grants another user, or the users of a group, access to a directory, which
+// they find under "Shared with me", named after it unless a name is given.
+export async function create(grant: {
+  path: string;
+  grantee?: string;
+  group?: string;
+  name?: string;
+  perm: Partial<Permissions>;
+}) {
+  const res = await fetchURL(`/api/grants`, {
+    method: "POST",
+    body: JSON.stringify(grant),
+  });
+  return (await res.json()) as Grant;
+}
+
+export async function remove(id: number) {
+  await fetchURL(`/api/grants/${id}`, {
+    method: "DELETE",
+  });
+}
@@ -5,5 +5,21 @@ import * as settings from "./settings";
 import * as pub from "./pub";
 import search from "./search";
 import commands from "./commands";
+import * as webauthn from "./webauthn";
+import * as tokens from "./tokens";
+import * as sessions from "./sessions";
+import * as grants from "./grants";
 
-export { files, share, users, settings, pub, commands, search };
+export {
+  files,
+  share,
+  users,
+  settings,
+  pub,
+  commands,
+  search,
+  webauthn,
+  tokens,
+  sessions,
+  grants,
+};
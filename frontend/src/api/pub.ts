@@ -32,6 +32,30 @@ export async function fetch(url: string, password: string = "") {
   return data;
 }
 
+export async function fetchRequest(hash: string, password: string = "") {
+  const res = await fetchURL(
+    `/api/public/upload/${hash}`,
+    {
+      headers: { "X-SHARE-PASSWORD": encodeURIComponent(password) },
+    },
+    false
+  );
+
+  return (await res.json()) as FileRequest;
+}
+
+export async function upload(hash: string, file: File, password: string = "") {
+  await fetchURL(
+    `/api/public/upload/${hash}/${encodeURIComponent(file.name)}`,
+    {
+      method: "POST",
+      body: file,
+      headers: { "X-SHARE-PASSWORD": encodeURIComponent(password) },
+    },
+    false
+  );
+}
+
 export function download(
   format: DownloadFormat,
   hash: string,
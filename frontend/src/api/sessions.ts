@@ -0,0 +1,18 @@
+import { fetchURL, fetchJSON } from "./utils";
+
+export async function list() {
+  return fetchJSON<Session[]>(`/api/sessions`);
+}
+
+export async function remove(id: string) {
+  await fetchURL(`/api/sessions/${id}`, {
+    method: "DELETE",
+  });
+}
+
+// Signs out every other session of the user.
+export async function removeOthers() {
+  await fetchURL(`/api/sessions`, {
+    method: "DELETE",
+  });
+}
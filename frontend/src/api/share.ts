@@ -9,6 +9,10 @@ export async function get(url: string) {
   return fetchJSON<Share>(`/api/share${url}`);
 }
 
+export async function accesses(hash: string) {
+  return fetchJSON<ShareAccess[]>(`/api/share/${hash}/access`);
+}
+
 export async function remove(hash: string) {
   await fetchURL(`/api/share/${hash}`, {
     method: "DELETE",
@@ -19,7 +23,8 @@ export async function create(
   url: string,
   password = "",
   expires = "",
-  unit = "hours"
+  unit = "hours",
+  options?: ShareOptions
 ) {
   url = removePrefix(url);
   url = `/api/share${url}`;
@@ -27,11 +32,12 @@ export async function create(
     url += `?expires=${expires}&unit=${unit}`;
   }
   let body = "{}";
-  if (password != "" || expires !== "" || unit !== "hours") {
+  if (password != "" || expires !== "" || unit !== "hours" || options) {
     body = JSON.stringify({
       password: password,
       expires: expires.toString(), // backend expects string not number
       unit: unit,
+      ...options,
     });
   }
   return fetchJSON(url, {
@@ -40,6 +46,13 @@ export async function create(
   });
 }
 
+export async function update(hash: string, changes: ShareChanges) {
+  return fetchJSON<Share>(`/api/share/${hash}`, {
+    method: "PATCH",
+    body: JSON.stringify(changes),
+  });
+}
+
 export function getShareURL(share: Share) {
   return createURL("share/" + share.hash, {});
 }
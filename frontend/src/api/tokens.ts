@@ -0,0 +1,26 @@
+import { fetchURL, fetchJSON } from "./utils";
+
+export async function list() {
+  return fetchJSON<ApiToken[]>(`/api/tokens`);
+}
+
+// Creates a token, returning it along with the token itself, which is only
+// ever shown then.
+export async function create(token: {
+  name: string;
+  path: string;
+  expires: string;
+  perm: Permissions;
+}) {
+  const res = await fetchURL(`/api/tokens`, {
+    method: "POST",
+    body: JSON.stringify(token),
+  });
+  return (await res.json()) as ApiToken & { token: string };
+}
+
+export async function remove(id: string) {
+  await fetchURL(`/api/tokens/${id}`, {
+    method: "DELETE",
+  });
+}
@@ -1,4 +1,5 @@
 import { fetchURL, fetchJSON, StatusError } from "./utils";
+import { baseURL } from "@/utils/constants";
 
 export async function getAll() {
   return fetchJSON<IUser[]>(`/api/users`, {});
@@ -29,7 +30,8 @@ export async function create(user: IUser, currentPassword: string) {
 export async function update(
   user: Partial<IUser>,
   which = ["all"],
-  currentPassword: string | null = null
+  currentPassword: string | null = null,
+  revokeSessions = false
 ) {
   await fetchURL(`/api/users/${user.id}`, {
     method: "PUT",
@@ -38,6 +40,7 @@ export async function update(
       which: which,
       ...(currentPassword != null ? { current_password: currentPassword } : {}),
       data: user,
+      revokeSessions,
     }),
   });
 }
@@ -53,3 +56,39 @@ export async function remove(
     }),
   });
 }
+
+export async function getOtp(id: number) {
+  return fetchJSON<OtpStatus>(`/api/users/${id}/otp`, {});
+}
+
+// Begins enrolling an authenticator, whose QR code is served at otpQRURL
+// until one of its codes is verified.
+export async function enrollOtp(id: number, currentPassword: string) {
+  return fetchJSON<{ uri: string; secret: string }>(`/api/users/${id}/otp`, {
+    method: "POST",
+    body: JSON.stringify({ current_password: currentPassword }),
+  });
+}
+
+export function otpQRURL(id: number) {
+  return `${baseURL}/api/users/${id}/otp/qr?t=${Date.now()}`;
+}
+
+// Completes enrolling the authenticator, returning the recovery codes.
+export async function verifyOtp(id: number, code: string) {
+  const res = await fetchJSON<{ recoveryCodes: string[] }>(
+    `/api/users/${id}/otp/verify`,
+    {
+      method: "POST",
+      body: JSON.stringify({ code }),
+    }
+  );
+  return res.recoveryCodes;
+}
+
+export async function removeOtp(id: number, currentPassword: string) {
+  await fetchURL(`/api/users/${id}/otp`, {
+    method: "DELETE",
+    body: JSON.stringify({ current_password: currentPassword }),
+  });
+}
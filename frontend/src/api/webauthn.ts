@@ -0,0 +1,122 @@
+import { fetchURL, fetchJSON } from "./utils";
+import { baseURL } from "@/utils/constants";
+
+interface Challenge {
+  options: { publicKey: any };
+  session: string;
+}
+
+function toBuffer(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+  const binary = atob(
+    base64.padEnd(base64.length + ((4 - (base64.length % 4)) % 4), "=")
+  );
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+}
+
+function fromBuffer(value: ArrayBuffer | null): string | undefined {
+  if (value === null) return undefined;
+  let binary = "";
+  for (const byte of new Uint8Array(value)) {
+    binary += String.fromCharCode(byte);
+  }
+  return btoa(binary)
+    .replace(/\+/g, "-")
+    .replace(/\//g, "_")
+    .replace(/=+$/, "");
+}
+
+function withBufferIDs(descriptors?: { id: string }[]) {
+  return descriptors?.map((d) => ({ ...d, id: toBuffer(d.id) }));
+}
+
+export const supported = () => window.PublicKeyCredential !== undefined;
+
+// Asserts a passkey for the server's login challenge, returning what is sent
+// along with the login.
+export async function assert() {
+  const res = await fetch(`${baseURL}/api/webauthn/login/begin`, {
+    method: "POST",
+  });
+  if (res.status !== 200) {
+    throw new Error(`${res.status} ${res.statusText}`);
+  }
+  const { options, session } = (await res.json()) as Challenge;
+
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...options.publicKey,
+      challenge: toBuffer(options.publicKey.challenge),
+      allowCredentials: withBufferIDs(options.publicKey.allowCredentials),
+    },
+  })) as PublicKeyCredential;
+  const response = credential.response as AuthenticatorAssertionResponse;
+
+  return {
+    session,
+    assertion: {
+      id: credential.id,
+      rawId: fromBuffer(credential.rawId),
+      type: credential.type,
+      response: {
+        clientDataJSON: fromBuffer(response.clientDataJSON),
+        authenticatorData: fromBuffer(response.authenticatorData),
+        signature: fromBuffer(response.signature),
+        userHandle: fromBuffer(response.userHandle),
+      },
+    },
+  };
+}
+
+export async function register(name: string) {
+  const { options, session } = await fetchJSON<Challenge>(
+    `/api/webauthn/register/begin`,
+    { method: "POST" }
+  );
+
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...options.publicKey,
+      challenge: toBuffer(options.publicKey.challenge),
+      user: {
+        ...options.publicKey.user,
+        id: toBuffer(options.publicKey.user.id),
+      },
+      excludeCredentials: withBufferIDs(options.publicKey.excludeCredentials),
+    },
+  })) as PublicKeyCredential;
+  const response = credential.response as AuthenticatorAttestationResponse;
+
+  const res = await fetchURL(`/api/webauthn/register/finish`, {
+    method: "POST",
+    body: JSON.stringify({
+      session,
+      name,
+      credential: {
+        id: credential.id,
+        rawId: fromBuffer(credential.rawId),
+        type: credential.type,
+        response: {
+          clientDataJSON: fromBuffer(response.clientDataJSON),
+          attestationObject: fromBuffer(response.attestationObject),
+          transports: response.getTransports?.() ?? [],
+        },
+      },
+    }),
+  });
+  return (await res.json()) as Passkey;
+}
+
+export async function list() {
+  return fetchJSON<Passkey[]>(`/api/webauthn/credentials`);
+}
+
+export async function remove(id: string) {
+  await fetchURL(`/api/webauthn/credentials/${id}`, {
+    method: "DELETE",
+  });
+}
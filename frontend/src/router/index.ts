@@ -14,8 +14,8 @@ import Errors from "@/views/Errors.vue";
 import { useAuthStore } from "@/stores/auth";
 import { baseURL, name } from "@/utils/constants";
 import i18n from "@/i18n";
-import { recaptcha, loginPage } from "@/utils/constants";
-import { login, validateLogin } from "@/utils/auth";
+import { recaptcha, loginPage, authMethod } from "@/utils/constants";
+import { login, oidcLogin, validateLogin } from "@/utils/auth";
 
 const titles = {
   Login: "sidebar.login",
@@ -156,6 +156,8 @@ const routes = [
 async function initAuth() {
   if (loginPage) {
     await validateLogin();
+  } else if (authMethod === "oidc") {
+    await oidcLogin();
   } else {
     await login("", "", "", "");
   }
@@ -210,6 +212,12 @@ router.beforeResolve(async (to, from, next) => {
       return;
     }
 
+    // Users must enroll an authenticator before anything else.
+    if (authStore.user?.enrollOtp && to.name !== "ProfileSettings") {
+      next({ name: "ProfileSettings" });
+      return;
+    }
+
     if (to.matched.some((record) => record.meta.requiresAdmin)) {
       if (authStore.user === null || !authStore.user.perm.admin) {
         next({ path: "/403" });
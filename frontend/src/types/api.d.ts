@@ -27,6 +27,62 @@ interface Share {
   userID?: number;
   hasPassword?: boolean;
   username?: string;
+  upload?: boolean;
+  maxFiles?: number;
+  maxBytes?: number;
+  extensions?: string[];
+  files?: number;
+  bytes?: number;
+  maxDownloads?: number;
+  maxVisits?: number;
+  downloads?: number;
+  visits?: number;
+  paths?: string[];
+  name?: string;
+}
+
+interface ShareOptions {
+  upload?: boolean;
+  maxFiles?: number;
+  maxBytes?: number;
+  extensions?: string[];
+  maxDownloads?: number;
+  maxVisits?: number;
+  paths?: string[];
+  name?: string;
+}
+
+interface ShareChanges {
+  expires?: string;
+  unit?: string;
+  password?: string;
+  maxDownloads?: number;
+  maxVisits?: number;
+  maxFiles?: number;
+  maxBytes?: number;
+  extensions?: string[];
+}
+
+interface ShareAccess {
+  id: number;
+  hash: string;
+  kind: "visit" | "download";
+  time: string;
+  ip: string;
+  userAgent: string;
+  file: string;
+  bytes: number;
+  status: number;
+}
+
+interface FileRequest {
+  name: string;
+  hasPassword: boolean;
+  maxFiles: number;
+  maxBytes: number;
+  extensions: string[] | null;
+  files: number;
+  bytes: number;
 }
 
 interface SearchParams {
@@ -9,6 +9,7 @@ interface ISettings {
   rules: any[];
   branding: SettingsBranding;
   tus: SettingsTus;
+  loginLimits: SettingsLoginLimits;
   shell: string[];
   commands: SettingsCommand;
 }
@@ -41,6 +42,14 @@ interface SettingsTus {
   retryCount: number;
 }
 
+interface SettingsLoginLimits {
+  attempts: number;
+  lockout: string;
+  maxLockout: string;
+  window: string;
+  trustedProxies: string[] | null;
+}
+
 interface SettingsCommand {
   after_copy?: string[];
   after_delete?: string[];
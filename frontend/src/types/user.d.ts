@@ -15,8 +15,14 @@ interface IUser {
   viewMode: ViewModeType;
   sorting?: Sorting;
   aceEditorTheme: string;
+  secondFactor: SecondFactor;
+  groups: string[];
+  // Set in the token of users who must enroll an authenticator first.
+  enrollOtp?: boolean;
 }
 
+type SecondFactor = "" | "totp" | "passkey" | "any";
+
 type ViewModeType = "list" | "mosaic" | "mosaic gallery";
 
 interface IUserForm {
@@ -27,12 +33,14 @@ interface IUserForm {
   locale?: string;
   perm?: Permissions;
   commands?: string[];
+  groups?: string[];
   rules?: IRule[];
   lockPassword?: boolean;
   hideDotfiles?: boolean;
   singleClick?: boolean;
   redirectAfterCopyMove?: boolean;
   dateFormat?: boolean;
+  secondFactor?: SecondFactor;
 }
 
 interface Permissions {
@@ -67,3 +75,51 @@ interface IRegexp {
 }
 
 type UserTheme = "light" | "dark" | "";
+
+interface Passkey {
+  id: string;
+  name: string;
+  created: string;
+  lastUsed: string;
+}
+
+interface OtpStatus {
+  enrolled: boolean;
+  pending: boolean;
+  required: boolean;
+  recoveryCodes: number;
+}
+
+interface ApiToken {
+  id: string;
+  name: string;
+  perm: Permissions;
+  path: string;
+  expires: string;
+  created: string;
+  lastUsed: string;
+}
+
+interface Grant {
+  id: number;
+  ownerID: number;
+  owner: string;
+  granteeID: number;
+  grantee: string;
+  group?: string;
+  path: string;
+  name: string;
+  perm: Permissions;
+  created: string;
+}
+
+interface Session {
+  id: string;
+  userID: number;
+  ip: string;
+  userAgent: string;
+  issuedAt: string;
+  lastSeen: string;
+  expiresAt: string;
+  current: boolean;
+}
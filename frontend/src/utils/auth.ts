@@ -2,10 +2,18 @@ import { useAuthStore } from "@/stores/auth";
 import router from "@/router";
 import type { JwtPayload } from "jwt-decode";
 import { jwtDecode } from "jwt-decode";
-import { authMethod, baseURL, noAuth, otpRequired, logoutPage } from "./constants";
+import { authMethod, baseURL, noAuth, logoutPage } from "./constants";
 import { StatusError } from "@/api/utils";
 import { setSafeTimeout } from "@/api/utils";
 
+// Thrown when the user must prove a one-time password to log in.
+export class OtpRequiredError extends StatusError {
+  constructor(message: any, status?: number) {
+    super(message, status);
+    this.name = "OtpRequiredError";
+  }
+}
+
 export function parseToken(token: string) {
   // falsy or malformed jwt will throw InvalidTokenError
   const data = jwtDecode<JwtPayload & { user: IUser }>(token);
@@ -60,20 +68,18 @@ export async function login(
   username: string,
   password: string,
   recaptcha: string,
-  otp: string
+  otp: string,
+  passkey?: { session: string; assertion: unknown }
 ) {
-  // Username and password are always required. OTP only required if backend indicates it's enabled.
-  if (!username || !password || (otpRequired && !otp)) {
-    const msg = otpRequired
-      ? "Username, password, and OTP are required"
-      : "Username and password are required";
-    throw new StatusError(msg, 400);
+  // Username and password are always required, unless a passkey is used
+  // instead. The backend tells when the user must prove an OTP too.
+  if (!passkey && (!username || !password)) {
+    throw new StatusError("Username and password are required", 400);
   }
   const hex_user = await ConvertStringToHex(username);
   const hex_pass = await ConvertStringToHex(password);
   const hex_recaptcha = await ConvertStringToHex(recaptcha);
-  const effectiveOtp = otpRequired ? otp : ""; // send empty if not required
-  const hex_otp = await ConvertStringToHex(effectiveOtp);
+  const hex_otp = await ConvertStringToHex(otp);
   // Preserve existing comma-separated encoding, append otp if provided
   const payload = btoa(
     hex_user + "," + hex_pass + "," + hex_recaptcha + "," + hex_otp
@@ -85,12 +91,36 @@ export async function login(
       "Content-Type": "application/json",
       Authorization: payload,
     },
+    ...(passkey ? { body: JSON.stringify({ passkey }) } : {}),
   });
 
   const body = await res.text();
 
   if (res.status === 200) {
     parseToken(body);
+  } else if (res.headers.get("X-Otp-Required") === "true") {
+    throw new OtpRequiredError(
+      body || `${res.status} ${res.statusText}`,
+      res.status
+    );
+  } else {
+    throw new StatusError(
+      body || `${res.status} ${res.statusText}`,
+      res.status
+    );
+  }
+}
+
+// Logs in with the session of the identity provider, signing in with it
+// first when there is none.
+export async function oidcLogin() {
+  const res = await fetch(`${baseURL}/api/login`, { method: "POST" });
+  const body = await res.text();
+
+  if (res.status === 200) {
+    parseToken(body);
+  } else if (res.status === 403) {
+    window.location.href = `${baseURL}/api/auth/oidc/login`;
   } else {
     throw new StatusError(
       body || `${res.status} ${res.statusText}`,
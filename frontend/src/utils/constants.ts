@@ -19,8 +19,6 @@ const enableExec: boolean = window.FileBrowser.EnableExec;
 const tusSettings = window.FileBrowser.TusSettings;
 const origin = window.location.origin;
 const tusEndpoint = `/api/tus`;
-// OTP required flag injected from backend static data (window.FileBrowser.Otp)
-const otpRequired: boolean = window.FileBrowser.Otp;
 const hideLoginButton = window.FileBrowser.HideLoginButton;
 
 export {
@@ -44,6 +42,5 @@ export {
   tusSettings,
   origin,
   tusEndpoint,
-  otpRequired,
   hideLoginButton,
 };
@@ -0,0 +1,63 @@
+// Package grants keeps the directories users grant other users access to,
+// which these see under the Root of their own files.
+package grants
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// Root is the virtual directory the grantees find the directories granted to
+// them in, each under its name.
+const Root = "/Shared with me"
+
+// Grant is the access a user, the owner, gave another, the grantee, or the
+// users of a group to a directory of their scope. The grantees have at most
+// Perm of the permissions of the owner within it.
+type Grant struct {
+	ID        uint              `json:"id" storm:"id,increment"`
+	OwnerID   uint              `json:"ownerID" storm:"index"`
+	GranteeID uint              `json:"granteeID" storm:"index"` // zero for a group
+	Group     string            `json:"group,omitempty" storm:"index"`
+	Path      string            `json:"path" storm:"index"`
+	Name      string            `json:"name"`
+	Perm      users.Permissions `json:"perm"`
+	Created   time.Time         `json:"created"`
+}
+
+// Restrict returns the permissions the grant gives of those of the owner and
+// the grantee. The grantees can never administer, execute commands or share
+// within the directories granted to them.
+func (g *Grant) Restrict(owner, grantee users.Permissions) users.Permissions {
+	return users.Permissions{
+		Create:   g.Perm.Create && owner.Create && grantee.Create,
+		Rename:   g.Perm.Rename && owner.Rename && grantee.Rename,
+		Modify:   g.Perm.Modify && owner.Modify && grantee.Modify,
+		Delete:   g.Perm.Delete && owner.Delete && grantee.Delete,
+		Download: g.Perm.Download && owner.Download && grantee.Download,
+	}
+}
+
+// Split returns the name of the grant p is within, and its path relative to
+// the directory granted. ok is false when p is not within Root, and the name
+// empty when it is Root itself.
+func Split(p string) (name, rest string, ok bool) {
+	p = path.Clean("/" + p)
+	if p == Root {
+		return "", "/", true
+	}
+	p, ok = strings.CutPrefix(p, Root+"/")
+	if !ok {
+		return "", "", false
+	}
+	name, rest, _ = strings.Cut(p, "/")
+	return name, "/" + rest, true
+}
+
+// within reports whether p is prefix or within it.
+func within(p, prefix string) bool {
+	return p == prefix || strings.HasPrefix(p, strings.TrimRight(prefix, "/")+"/")
+}
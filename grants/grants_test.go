@@ -0,0 +1,41 @@
+package grants
+
+import "testing"
+
+func TestSplit(t *testing.T) {
+	for p, want := range map[string]struct {
+		name, rest string
+		ok         bool
+	}{
+		"/Shared with me":                 {"", "/", true},
+		"/Shared with me/":                {"", "/", true},
+		"/Shared with me/docs":            {"docs", "/", true},
+		"/Shared with me/docs/a/b.txt":    {"docs", "/a/b.txt", true},
+		"/Shared with me/docs/../x":       {"x", "/", true},
+		"/Shared with me/../etc":          {"", "", false},
+		"/Shared with meadow/docs":        {"", "", false},
+		"/docs/Shared with me/docs/a.txt": {"", "", false},
+	} {
+		name, rest, ok := Split(p)
+		if name != want.name || rest != want.rest || ok != want.ok {
+			t.Errorf("Split(%q) = %q, %q, %t, want %q, %q, %t", p, name, rest, ok, want.name, want.rest, want.ok)
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	for _, c := range []struct {
+		p, prefix string
+		want      bool
+	}{
+		{"/docs", "/docs", true},
+		{"/docs/a", "/docs", true},
+		{"/docs/a", "/docs/", true},
+		{"/docs-old", "/docs", false},
+		{"/", "/docs", false},
+	} {
+		if got := within(c.p, c.prefix); got != c.want {
+			t.Errorf("within(%q, %q) = %t, want %t", c.p, c.prefix, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package grants
+
+import (
+	"errors"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// StorageBackend is the interface to implement for a grants storage.
+type StorageBackend interface {
+	All() ([]*Grant, error)
+	FindByOwner(id uint) ([]*Grant, error)
+	FindByGrantee(id uint) ([]*Grant, error)
+	FindByGroup(group string) ([]*Grant, error)
+	Get(id uint) (*Grant, error)
+	Save(g *Grant) error
+	Delete(id uint) error
+}
+
+// Storage is a storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a grants storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// All wraps a StorageBackend.All.
+func (s *Storage) All() ([]*Grant, error) {
+	return s.back.All()
+}
+
+// FindByOwner wraps a StorageBackend.FindByOwner.
+func (s *Storage) FindByOwner(id uint) ([]*Grant, error) {
+	return s.back.FindByOwner(id)
+}
+
+// FindByGrantee wraps a StorageBackend.FindByGrantee.
+func (s *Storage) FindByGrantee(id uint) ([]*Grant, error) {
+	return s.back.FindByGrantee(id)
+}
+
+// FindByGroup wraps a StorageBackend.FindByGroup.
+func (s *Storage) FindByGroup(group string) ([]*Grant, error) {
+	return s.back.FindByGroup(group)
+}
+
+// FindFor returns the grants the user was given, to them and then to their
+// groups, but for those they made themselves.
+func (s *Storage) FindFor(u *users.User) ([]*Grant, error) {
+	list, err := s.back.FindByGrantee(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range u.Groups {
+		if group == "" {
+			continue
+		}
+		given, err := s.back.FindByGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range given {
+			if g.OwnerID != u.ID && !slices.ContainsFunc(list, func(o *Grant) bool { return o.ID == g.ID }) {
+				list = append(list, g)
+			}
+		}
+	}
+	return list, nil
+}
+
+// Get wraps a StorageBackend.Get.
+func (s *Storage) Get(id uint) (*Grant, error) {
+	return s.back.Get(id)
+}
+
+// Save wraps a StorageBackend.Save.
+func (s *Storage) Save(g *Grant) error {
+	return s.back.Save(g)
+}
+
+// Delete wraps a StorageBackend.Delete.
+func (s *Storage) Delete(id uint) error {
+	return s.back.Delete(id)
+}
+
+// GetByName returns the grant of the name the user was given, if any. The
+// grants to the user come first, then those to their groups.
+func (s *Storage) GetByName(u *users.User, name string) (*Grant, bool, error) {
+	list, err := s.FindFor(u)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, g := range list {
+		if g.Name == name {
+			return g, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// GetByGroupName returns the grant of the name given to the group, if any.
+func (s *Storage) GetByGroupName(group, name string) (*Grant, bool, error) {
+	list, err := s.back.FindByGroup(group)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, g := range list {
+		if g.Name == name {
+			return g, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// DeleteByUserID deletes all the grants a user made or was given.
+func (s *Storage) DeleteByUserID(id uint) error {
+	owned, err := s.back.FindByOwner(id)
+	if err != nil {
+		return err
+	}
+	given, err := s.back.FindByGrantee(id)
+	if err != nil {
+		return err
+	}
+	for _, g := range append(owned, given...) {
+		err = errors.Join(err, s.back.Delete(g.ID))
+	}
+	return err
+}
+
+// DeleteWithPathPrefix deletes the grants the user made of the path or of the
+// directories within it.
+func (s *Storage) DeleteWithPathPrefix(p string, ownerID uint) error {
+	list, err := s.back.FindByOwner(ownerID)
+	if err != nil {
+		return err
+	}
+	for _, g := range list {
+		if within(g.Path, p) {
+			err = errors.Join(err, s.back.Delete(g.ID))
+		}
+	}
+	return err
+}
+
+// RenamePathPrefix moves the grants the user made of the old path or of the
+// directories within it to the new one.
+func (s *Storage) RenamePathPrefix(oldPath, newPath string, ownerID uint) error {
+	list, err := s.back.FindByOwner(ownerID)
+	if err != nil {
+		return err
+	}
+	for _, g := range list {
+		if within(g.Path, oldPath) {
+			rest := strings.TrimPrefix(g.Path, strings.TrimRight(oldPath, "/"))
+			g.Path = path.Join(newPath, rest)
+			err = errors.Join(err, s.back.Save(g))
+		}
+	}
+	return err
+}
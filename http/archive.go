@@ -0,0 +1,74 @@
+package fbhttp
+
+import (
+	"context"
+	"io"
+	"path"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+)
+
+// createArchive archives the file or directory at src into the file dst.
+func createArchive(ctx context.Context, d *data, format archiveFormat, src, dst string,
+	quotas *quota.Tracker, history *versions.History, report *jobs.Reporter) error {
+	if !d.user.Perm.Create {
+		return fberrors.ErrPermissionDenied
+	}
+
+	root := d.quotaRoot()
+	replaced := replacedUsage(d, quotas, src, dst)
+	err := quotas.Check(root, d.user.Quota, 0, 1-replaced.Files)
+	if err != nil {
+		return err
+	}
+
+	afs := &progressFs{Fs: d.user.Fs, ctx: ctx, report: report}
+	entries, err := getFiles(d, afs, src, path.Dir(src))
+	if err != nil {
+		return err
+	}
+
+	var bytes, files int64
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			bytes += entry.Size()
+			files++
+		}
+	}
+	report.SetTotal(bytes, files)
+
+	err = saveVersion(d, history, quotas, dst)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(format.Archive(ctx, pw, entries))
+	}()
+
+	// The size of the archive is only known once written, so it is limited
+	// to what is left of the quota as it is.
+	in, err := quotas.Limit(pr, root, d.user.Quota, replaced.Bytes)
+	if err == nil {
+		_, err = writeFile(d.user.Fs, dst, in, d.settings.FileMode, d.settings.DirMode)
+	}
+	pr.CloseWithError(err)
+	<-done
+
+	if err != nil {
+		if rmErr := d.user.Fs.Remove(dst); rmErr == nil {
+			quotas.Add(root, -replaced.Bytes, -replaced.Files)
+		}
+		return err
+	}
+
+	written := quotas.Measure(d.user.FullPath(dst))
+	quotas.Add(root, written.Bytes-replaced.Bytes, written.Files-replaced.Files)
+	return nil
+}
@@ -0,0 +1,58 @@
+package fbhttp
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+)
+
+// defaultAuditLimit is how many events are listed unless asked otherwise.
+const defaultAuditLimit = 100
+
+// auditGetHandler lists the events of the audit log the query selects, the
+// latest first.
+var auditGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if d.store.Audit == nil {
+		return http.StatusNotFound, nil
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		User:   query.Get("user"),
+		Action: query.Get("action"),
+		Path:   query.Get("path"),
+		Share:  query.Get("share"),
+		Limit:  defaultAuditLimit,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return http.StatusBadRequest, err
+		}
+		filter.Limit = n
+	}
+
+	now := time.Now()
+	for name, bound := range map[string]*time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := audit.ParseTime(value, now)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		*bound = t
+	}
+
+	events, err := d.store.Audit.Find(filter)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, events)
+})
@@ -0,0 +1,80 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestAuditLog(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scope, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Admin: true, Delete: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, key)
+	signed := signToken(t, perm, key)
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.Handle("/audit", handle(auditGetHandler, "", st, server)).Methods("GET")
+	router.PathPrefix("/resources").Handler(handle(resourceDeleteHandler(diskcache.NewNoOp(), nil, nil, nil, nil), "/resources", st, server)).Methods("DELETE")
+
+	do := func(method, url string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, url, http.NoBody)
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	list := func(url string) []audit.Event {
+		t.Helper()
+		var events []audit.Event
+		if err := json.NewDecoder(do(http.MethodGet, url, http.StatusOK).Body).Decode(&events); err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+
+	do(http.MethodDelete, "/resources/a.txt", http.StatusNoContent)
+	// Refused actions are recorded too.
+	do(http.MethodDelete, "/resources/", http.StatusForbidden)
+
+	events := list("/audit?action=delete")
+	if len(events) != 2 {
+		t.Fatalf("expected the two deletions, got %+v", events)
+	}
+	if e := events[1]; e.User != "u" || e.IP != "192.0.2.1" || e.Source != "/a.txt" || e.Status != http.StatusNoContent {
+		t.Errorf("expected who deleted the file to be recorded, got %+v", e)
+	}
+	if e := events[0]; e.Source != "/" || e.Status != http.StatusForbidden {
+		t.Errorf("expected the refused deletion to be recorded, got %+v", e)
+	}
+
+	if events := list("/audit?path=/a.txt&since=1h"); len(events) != 1 || events[0].Source != "/a.txt" {
+		t.Errorf("expected the events to be filtered by path, got %+v", events)
+	}
+	if events := list("/audit?user=someone-else"); len(events) != 0 {
+		t.Errorf("expected the events to be filtered by user, got %+v", events)
+	}
+	do(http.MethodGet, "/audit?since=yesterday", http.StatusBadRequest)
+
+	st.Audit = nil
+	do(http.MethodGet, "/audit", http.StatusNotFound)
+}
@@ -1,20 +1,25 @@
 package fbhttp
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/golang-jwt/jwt/v5/request"
+	"github.com/tomasen/realip"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
 	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
 	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
 	"github.com/thevickypedia/filebrowser/v2/users"
 )
 
@@ -37,6 +42,7 @@ type userInfo struct {
 	DateFormat            bool              `json:"dateFormat"`
 	Username              string            `json:"username"`
 	AceEditorTheme        string            `json:"aceEditorTheme"`
+	EnrollOtp             bool              `json:"enrollOtp"`
 }
 
 type authToken struct {
@@ -58,6 +64,9 @@ func contains(slice []string, item string) bool {
 
 func (e extractor) ExtractToken(r *http.Request) (string, error) {
 	token, _ := request.HeaderExtractor{"X-Auth"}.ExtractToken(r)
+	if token == "" {
+		token, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
 
 	// Checks if the token isn't empty and if it contains two dots.
 	// The former prevents incompatibility with URLs that previously
@@ -92,37 +101,132 @@ func renewableErr(err error, d *data) bool {
 	return true
 }
 
+// withUser serves the users logged in, except those who must enroll a
+// one-time password authenticator before anything else.
 func withUser(fn handleFunc) handleFunc {
+	return withLoggedIn(fn, false)
+}
+
+// withEnrollingUser serves the users logged in, including those who must
+// enroll a one-time password authenticator before anything else.
+func withEnrollingUser(fn handleFunc) handleFunc {
+	return withLoggedIn(fn, true)
+}
+
+func withLoggedIn(fn handleFunc, enrolling bool) handleFunc {
 	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-		keyFunc := func(_ *jwt.Token) (interface{}, error) {
-			return d.settings.Key, nil
+		var (
+			status int
+			err    error
+		)
+		if raw, ok := personalToken(r); ok {
+			status, err = authPersonalToken(d, raw)
+		} else {
+			status, err = authSession(w, r, d)
 		}
-
-		var tk authToken
-		p := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
-		token, err := request.ParseFromRequest(r, &extractor{}, keyFunc, request.WithClaims(&tk), request.WithParser(p))
-		if (err != nil || !token.Valid) && !renewableErr(err, d) {
-			return http.StatusUnauthorized, nil
+		if status != 0 {
+			return status, err
 		}
 
-		expiresSoon := tk.ExpiresAt != nil && time.Until(tk.ExpiresAt.Time) < time.Hour
-		updated := tk.IssuedAt != nil && tk.IssuedAt.Unix() < d.store.Users.LastUpdate(tk.User.ID)
-
-		if expiresSoon || updated {
-			w.Header().Add("X-Renew-Token", "true")
-		} else {
-			var allowedJWT = fbAuth.GetAllowedJWT()
-			if allowedJWT == nil || !contains(allowedJWT, token.Raw) {
-				return http.StatusUnauthorized, nil
-			}
+		if !enrolling && mustEnrollOtp(d, d.user) {
+			return http.StatusForbidden, fberrors.ErrOtpEnrollmentRequired
 		}
+		return fn(w, r, d)
+	}
+}
 
-		d.user, err = d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, tk.User.ID)
-		if err != nil {
-			return http.StatusInternalServerError, err
+// withSessionUser serves the users logged in, but not those authenticated
+// with personal API tokens, which can't be used to mint sessions or tokens
+// granting more than themselves.
+func withSessionUser(fn handleFunc) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if d.token != nil {
+			return http.StatusForbidden, nil
 		}
 		return fn(w, r, d)
+	})
+}
+
+// authSession authenticates the user of the JWT of a session.
+func authSession(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	keyFunc := func(_ *jwt.Token) (interface{}, error) {
+		return d.settings.Key, nil
 	}
+
+	var tk authToken
+	p := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	token, err := request.ParseFromRequest(r, &extractor{}, keyFunc, request.WithClaims(&tk), request.WithParser(p))
+	if (err != nil || !token.Valid) && !renewableErr(err, d) {
+		return http.StatusUnauthorized, nil
+	}
+
+	expiresSoon := tk.ExpiresAt != nil && time.Until(tk.ExpiresAt.Time) < time.Hour
+	updated := tk.IssuedAt != nil && tk.IssuedAt.Unix() < d.store.Users.LastUpdate(tk.User.ID)
+
+	if expiresSoon || updated {
+		w.Header().Add("X-Renew-Token", "true")
+	}
+
+	switch {
+	case tk.ID != "":
+		// All the JWTs of a session are refused once it is revoked.
+		session, ok := fbAuth.GetSession(tk.ID)
+		if !ok || session.UserID != tk.User.ID {
+			return http.StatusUnauthorized, nil
+		}
+		fbAuth.TouchSession(tk.ID)
+		d.session = tk.ID
+	case !expiresSoon && !updated:
+		var allowedJWT = fbAuth.GetAllowedJWT()
+		if allowedJWT == nil || !contains(allowedJWT, token.Raw) {
+			return http.StatusUnauthorized, nil
+		}
+	}
+
+	d.user, err = d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, tk.User.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+// personalToken returns the personal API token given as the bearer token of
+// a request, if any.
+func personalToken(r *http.Request) (string, bool) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(raw, tokens.Prefix) {
+		return "", false
+	}
+	return raw, true
+}
+
+// authPersonalToken authenticates the user of a personal API token, with the
+// permissions it grants them.
+func authPersonalToken(d *data, raw string) (int, error) {
+	tk, err := d.store.Tokens.Authenticate(raw)
+	switch {
+	case errors.Is(err, fberrors.ErrPermissionDenied):
+		return http.StatusUnauthorized, nil
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+
+	d.user, err = d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, tk.UserID)
+	switch {
+	case errors.Is(err, fberrors.ErrNotExist):
+		return http.StatusUnauthorized, nil
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+	d.user.Perm = tk.Restrict(d.user.Perm)
+	d.token = tk
+	return 0, nil
+}
+
+// mustEnrollOtp reports whether user must enroll a one-time password
+// authenticator, which only the json auther asks for.
+func mustEnrollOtp(d *data, user *users.User) bool {
+	return d.settings.AuthMethod == fbAuth.MethodJSONAuth && user.MustEnrollOtp()
 }
 
 var terminateHandler = withAdmin(func(_ http.ResponseWriter, _ *http.Request, d *data) (int, error) {
@@ -146,17 +250,32 @@ var terminateHandler = withAdmin(func(_ http.ResponseWriter, _ *http.Request, d
 	return http.StatusOK, nil
 })
 
-var logoutHandler = func(_ http.ResponseWriter, r *http.Request, _ *data) (int, error) {
+var logoutHandler = func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	token := r.Header.Get("X-Auth")
 	if token == "" {
 		log.Printf("Warning: Missing X-Auth header")
 		return http.StatusBadRequest, errors.New("missing auth token")
 	}
 
-	if err := fbAuth.RemoveAllowedJWT(token); err != nil {
+	// The whole session ends, not just the JWT it was last renewed with.
+	var tk authToken
+	_, err := jwt.ParseWithClaims(token, &tk, func(_ *jwt.Token) (interface{}, error) {
+		return d.settings.Key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation())
+	if err == nil && tk.ID != "" {
+		err = fbAuth.RemoveSession(tk.ID)
+	} else {
+		err = fbAuth.RemoveAllowedJWT(token)
+	}
+	if err != nil {
 		log.Printf("Error: Failed to remove allowed JWT: %v", err)
 		return http.StatusInternalServerError, err
 	}
+	// Otherwise the next login would be with the same identity provider
+	// session.
+	if d.settings.AuthMethod == fbAuth.MethodOIDCAuth {
+		http.SetCookie(w, expiredCookie(d, fbAuth.OIDCSessionCookie))
+	}
 	log.Printf("User logged out successfully, token invalidated")
 	return http.StatusOK, nil
 }
@@ -177,14 +296,35 @@ func loginHandler(tokenExpireTime time.Duration) handleFunc {
 			r.Body = http.MaxBytesReader(w, r.Body, maxAuthBodySize)
 		}
 
+		e := d.audit(audit.ActionLogin, "", "")
+		e.Detail = string(d.settings.AuthMethod)
+
 		auther, err := d.store.Auth.Get(d.settings.AuthMethod)
 		if err != nil {
 			log.Printf("Error: Failed to get auth method. %v", err)
 			return http.StatusInternalServerError, err
 		}
 
-		user, err := auther.Auth(r, d.store.Users, d.settings, d.server)
+		user, err := d.store.Limits.Login(fbAuth.ClientIP(r, d.settings.LoginLimits), d.settings.LoginLimits, func() (*users.User, error) {
+			return auther.Auth(r, d.store.Users, d.settings, d.server)
+		})
+		countLogin(err)
+		var (
+			lockout *fbAuth.LockoutError
+			refused *fbAuth.LoginError
+		)
+		switch {
+		case user != nil:
+			e.User = user.Username
+		case errors.As(err, &refused):
+			e.User = refused.Username
+		}
 		switch {
+		case errors.As(err, &lockout):
+			return lockedOut(w, lockout)
+		case errors.Is(err, fbAuth.ErrOtpRequired):
+			w.Header().Set("X-Otp-Required", "true")
+			return http.StatusForbidden, nil
 		case errors.Is(err, os.ErrPermission):
 			return http.StatusForbidden, nil
 		case err != nil:
@@ -196,6 +336,14 @@ func loginHandler(tokenExpireTime time.Duration) handleFunc {
 	}
 }
 
+// lockedOut tells clients who failed to log in too often when they can try
+// again.
+func lockedOut(w http.ResponseWriter, lockout *fbAuth.LockoutError) (int, error) {
+	retry := max(time.Until(lockout.Until).Round(time.Second), time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())))
+	return http.StatusTooManyRequests, nil
+}
+
 type signupBody struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -283,13 +431,28 @@ var signupHandler = func(w http.ResponseWriter, r *http.Request, d *data) (int,
 }
 
 func renewHandler(tokenExpireTime time.Duration) handleFunc {
-	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return withEnrollingUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		// Sessions have all the permissions of their users.
+		if d.token != nil {
+			return http.StatusForbidden, nil
+		}
 		w.Header().Set("X-Renew-Token", "false")
 		return printToken(w, r, d, d.user, tokenExpireTime)
 	})
 }
 
-func printToken(w http.ResponseWriter, _ *http.Request, d *data, user *users.User, tokenExpirationTime time.Duration) (int, error) {
+func printToken(w http.ResponseWriter, r *http.Request, d *data, user *users.User, tokenExpirationTime time.Duration) (int, error) {
+	now := time.Now()
+	// Renewed JWTs belong to the session they renew.
+	session, ok := fbAuth.GetSession(d.session)
+	if !ok {
+		session = fbAuth.Session{ID: strings.ToLower(rand.Text()), UserID: user.ID, IssuedAt: now}
+	}
+	session.IP = realip.FromRequest(r)
+	session.UserAgent = r.UserAgent()
+	session.LastSeen = now
+	session.ExpiresAt = now.Add(tokenExpirationTime)
+
 	claims := &authToken{
 		User: userInfo{
 			ID:                    user.ID,
@@ -304,10 +467,12 @@ func printToken(w http.ResponseWriter, _ *http.Request, d *data, user *users.Use
 			DateFormat:            user.DateFormat,
 			Username:              user.Username,
 			AceEditorTheme:        user.AceEditorTheme,
+			EnrollOtp:             mustEnrollOtp(d, user),
 		},
 		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExpirationTime)),
+			ID:        session.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
 			Issuer:    "File Browser",
 		},
 	}
@@ -317,7 +482,7 @@ func printToken(w http.ResponseWriter, _ *http.Request, d *data, user *users.Use
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	if err := fbAuth.PutAllowedJWT(signed); err != nil {
+	if err := fbAuth.PutSession(signed, session); err != nil {
 		return http.StatusInternalServerError, err
 	}
 
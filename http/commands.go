@@ -2,16 +2,18 @@ package fbhttp
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"io"
 	"log"
 	"net/http"
-	"os/exec"
 	"slices"
 	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	"github.com/thevickypedia/filebrowser/v2/runner"
 )
 
@@ -60,8 +62,16 @@ var commandsHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *d
 		}
 	}
 
-	// Fail fast
-	if !d.server.EnableExec || !d.user.Perm.Execute {
+	// The connection is hijacked, so the outcome of the command is recorded
+	// as the status it would have had.
+	e := d.audit(audit.ActionCommand, r.URL.Path, "")
+	e.Detail = raw
+	e.Status = http.StatusForbidden
+
+	// Fail fast. Commands aren't confined to the directory they are run in,
+	// so tokens restricted to a path can't run any.
+	if !d.server.EnableExec || !d.user.Perm.Execute || !d.Check(r.URL.Path) ||
+		(d.token != nil && d.token.Path != "/") {
 		if err := conn.WriteMessage(websocket.TextMessage, cmdNotAllowed); err != nil {
 			wsErr(conn, r, http.StatusInternalServerError, err)
 		}
@@ -69,8 +79,9 @@ var commandsHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *d
 		return 0, nil
 	}
 
-	command, name, err := runner.ParseCommand(d.settings, raw)
+	_, name, err := runner.ParseCommand(d.settings, raw)
 	if err != nil {
+		e.Status = http.StatusBadRequest
 		if err := conn.WriteMessage(websocket.TextMessage, []byte(err.Error())); err != nil {
 			wsErr(conn, r, http.StatusInternalServerError, err)
 		}
@@ -85,36 +96,75 @@ var commandsHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *d
 		return 0, nil
 	}
 
-	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Dir = d.user.FullPath(r.URL.Path)
+	// The command is killed once the connection is closed, the client
+	// sending nothing more until then.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		wsErr(conn, r, http.StatusInternalServerError, err)
+	command, err := runner.NewUserCommand(ctx, d.settings, raw)
+	if errors.Is(err, runner.ErrArgsNotAllowed) || errors.Is(err, runner.ErrShellNotAllowed) {
+		if err := conn.WriteMessage(websocket.TextMessage, cmdNotAllowed); err != nil {
+			wsErr(conn, r, http.StatusInternalServerError, err)
+		}
 		return 0, nil
 	}
-
-	stderr, err := cmd.StderrPipe()
+	e.Status = http.StatusInternalServerError
 	if err != nil {
 		wsErr(conn, r, http.StatusInternalServerError, err)
 		return 0, nil
 	}
+	if err := command.SetDir(d.user.FullPath("/"), d.user.FullPath(r.URL.Path)); err != nil {
+		e.Status = errToStatus(err)
+		wsErr(conn, r, e.Status, err)
+		return 0, nil
+	}
 
-	if err := cmd.Start(); err != nil {
+	// The standard output and error are written to the same pipe, so that
+	// their lines are sent in the order they were output.
+	pr, pw := io.Pipe()
+	if err := command.Start(nil, pw, pw); err != nil {
 		wsErr(conn, r, http.StatusInternalServerError, err)
 		return 0, nil
 	}
+	runningCommands.Inc()
+	defer runningCommands.Dec()
 
-	s := bufio.NewScanner(io.MultiReader(stdout, stderr))
+	done := make(chan error, 1)
+	go func() {
+		err := command.Wait()
+		_ = pw.Close()
+		done <- err
+	}()
+
+	s := bufio.NewScanner(pr)
 	for s.Scan() {
 		if err := conn.WriteMessage(websocket.TextMessage, s.Bytes()); err != nil {
 			log.Print(err)
+			cancel()
 		}
 	}
+	if s.Err() != nil {
+		cancel()
+		_, _ = io.Copy(io.Discard, pr)
+	}
 
-	if err := cmd.Wait(); err != nil {
+	if err := <-done; err != nil {
+		if errors.Is(err, runner.ErrTimeout) || errors.Is(err, runner.ErrOutputLimit) {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(err.Error()))
+		}
 		wsErr(conn, r, http.StatusInternalServerError, err)
+		return 0, nil
 	}
 
+	e.Status = http.StatusOK
+
 	return 0, nil
 })
@@ -8,10 +8,14 @@ import (
 
 	"github.com/tomasen/realip"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
+	"github.com/thevickypedia/filebrowser/v2/grants"
 	"github.com/thevickypedia/filebrowser/v2/rules"
 	"github.com/thevickypedia/filebrowser/v2/runner"
 	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/share"
 	"github.com/thevickypedia/filebrowser/v2/storage"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
 	"github.com/thevickypedia/filebrowser/v2/users"
 )
 
@@ -25,12 +29,72 @@ type data struct {
 	user     *users.User
 	raw      interface{}
 
+	// session is the ID of the session the user authenticated with, if any.
+	session string
+
+	// token is the personal API token the user authenticated with, if any.
+	// Its path restriction is enforced by Check.
+	token *tokens.Token
+
 	// checkerPrefix is prepended to every path before evaluating rules. It is
 	// set when the user's filesystem has been rebased onto a subdirectory (as
 	// done for public shares), so that rules — which are relative to the user's
 	// original scope — are still matched against the real path instead of the
 	// rebased one. Empty for regular requests.
 	checkerPrefix string
+
+	// scopeRoot is the real path of the scope of the user when their
+	// filesystem has been rebased onto a subdirectory of it, so that their
+	// quota is still charged for the whole scope. Empty for regular requests.
+	scopeRoot string
+
+	// fileRequest is the file request the files are uploaded to by whoever
+	// has its link, the user being its owner.
+	fileRequest *share.Link
+
+	// collection is the collection whose root is served, the directory
+	// listing its members.
+	collection *share.Link
+
+	// grant is the grant the files are served from, to grantee, the user
+	// being its owner.
+	grant   *grants.Grant
+	grantee *users.User
+
+	// event is what the request is recorded as in the audit log, if anything.
+	event *audit.Event
+}
+
+// audit records the request in the audit log as action on src, and dst for
+// the actions having one, once it is served. The event returned can be
+// completed until then.
+func (d *data) audit(action, src, dst string) *audit.Event {
+	d.event = &audit.Event{Action: action, Source: src, Destination: dst}
+	if d.user != nil {
+		d.event.User = d.user.Username
+	}
+	return d.event
+}
+
+// scopePath returns path, relative to the filesystem of the user, relative to
+// their original scope, where their shares and grants are.
+func (d *data) scopePath(path string) string {
+	return gopath.Join("/", d.checkerPrefix, path)
+}
+
+// quotaRoot returns the real path of the scope the quota of the user is
+// charged to, which is the root of their filesystem unless it was rebased.
+func (d *data) quotaRoot() string {
+	if d.scopeRoot != "" {
+		return d.scopeRoot
+	}
+	return d.user.FullPath("/")
+}
+
+// grantPath returns path, relative to the directory of the grant, as its
+// grantee sees it.
+func (d *data) grantPath(path string) string {
+	return gopath.Join(grants.Root, d.grant.Name, path)
 }
 
 // Check implements rules.Checker.
@@ -43,6 +107,10 @@ func (d *data) Check(path string) bool {
 		path = gopath.Join(d.checkerPrefix, path)
 	}
 
+	if d.token != nil && !d.token.Allows(path) {
+		return false
+	}
+
 	if d.user.HideDotfiles && rules.MatchHidden(path) {
 		return false
 	}
@@ -75,12 +143,29 @@ func handle(fn handleFunc, prefix string, store *storage.Storage, server *settin
 			return
 		}
 
-		status, err := fn(w, r, &data{
-			Runner:   &runner.Runner{Enabled: server.EnableExec, Settings: settings},
+		d := &data{
+			Runner:   &runner.Runner{Enabled: server.EnableExec, Settings: settings, Webhooks: store.Webhooks},
 			store:    store,
 			settings: settings,
 			server:   server,
-		})
+		}
+		status, err := fn(w, r, d)
+
+		if e := d.event; e != nil {
+			e.IP = realip.FromRequest(r)
+			if e.Status == 0 {
+				switch {
+				case status != 0:
+					e.Status = status
+				case err != nil:
+					e.Status = http.StatusInternalServerError
+				default:
+					// The response was written by the handler.
+					e.Status = http.StatusOK
+				}
+			}
+			store.Audit.Record(e)
+		}
 
 		if status >= 400 || err != nil {
 			clientIP := realip.FromRequest(r)
@@ -0,0 +1,230 @@
+package fbhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/mholt/archives"
+	"github.com/spf13/afero"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/search"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+)
+
+// parseArchiveFormat returns the format of the archive at name, given by the
+// algo query parameter or else guessed from its extension.
+func parseArchiveFormat(r *http.Request, name string) (archiveFormat, error) {
+	if r.URL.Query().Has("algo") {
+		_, format, err := parseQueryAlgorithm(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, fberrors.ErrInvalidRequestParams)
+		}
+		return format.(archiveFormat), nil
+	}
+
+	name = strings.ToLower(name)
+	for _, f := range archiveFormats {
+		if strings.HasSuffix(name, f.extension) {
+			return f.format, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown archive format: %w", fberrors.ErrInvalidRequestParams)
+}
+
+// startExtract extracts the archive at src into the directory dst as a job.
+func startExtract(w http.ResponseWriter, r *http.Request, d *data, src, dst string,
+	searchIndex *search.Index, quotas *quota.Tracker, history *versions.History, jobManager *jobs.Manager) (int, error) {
+	if !d.user.Perm.Create {
+		return http.StatusForbidden, nil
+	}
+
+	info, err := d.user.Fs.Stat(src)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if info.IsDir() {
+		return http.StatusBadRequest, fmt.Errorf("%s is not an archive: %w", src, fberrors.ErrInvalidRequestParams)
+	}
+
+	format, err := parseArchiveFormat(r, src)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	exists, err := afero.Exists(d.user.Fs, dst)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	return startJob(w, r, d, jobManager, "extract", src, dst, func(ctx context.Context, report *jobs.Reporter) error {
+		err := d.RunHook(func() error {
+			return extractArchive(ctx, d, format, src, dst, quotas, history, report)
+		}, "extract", src, dst, d.user)
+
+		// Leave nothing half extracted behind, unless it was extracted over
+		// an existing directory.
+		if err != nil && !exists {
+			root := d.quotaRoot()
+			removed := quotas.Measure(d.user.FullPath(dst))
+			if rmErr := d.user.Fs.RemoveAll(dst); rmErr == nil {
+				quotas.Add(root, -removed.Bytes, -removed.Files)
+			}
+		}
+
+		searchIndex.Update(d.user.FullPath(dst))
+		return err
+	})
+}
+
+func extractArchive(ctx context.Context, d *data, format archiveFormat, src, dst string,
+	quotas *quota.Tracker, history *versions.History, report *jobs.Reporter) error {
+	// A first pass measures the content of the archive, so that it is known
+	// to fit in the quota before anything is written.
+	var total quota.Usage
+	var dirs int64
+	err := walkArchive(ctx, d, format, src, func(_ string, entry archives.FileInfo) error {
+		switch {
+		case entry.IsDir():
+			dirs++
+		case entry.Mode().IsRegular():
+			total.Bytes += entry.Size()
+			total.Files++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = quotas.Check(d.quotaRoot(), d.user.Quota, total.Bytes, total.Files+dirs)
+	if err != nil {
+		return err
+	}
+	report.SetTotal(total.Bytes, total.Files)
+
+	if err := mkdirAll(d, quotas, dst); err != nil {
+		return err
+	}
+
+	return walkArchive(ctx, d, format, src, func(name string, entry archives.FileInfo) error {
+		return extractEntry(ctx, d, path.Join(dst, name), entry, quotas, history, report)
+	})
+}
+
+// walkArchive calls fn with every entry of the archive at src, and their
+// names sanitized the same way as when archives are created. The links are
+// refused if they point outside of the archive.
+func walkArchive(ctx context.Context, d *data, format archiveFormat, src string, fn func(name string, entry archives.FileInfo) error) error {
+	f, err := d.user.Fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return format.Extract(ctx, f, func(_ context.Context, entry archives.FileInfo) error {
+		name := strings.TrimPrefix(strings.TrimSuffix(entry.NameInArchive, "/"), "./")
+		if name == "" || name == "." {
+			return nil
+		}
+
+		name, err := sanitizeArchiveName(name)
+		if err != nil {
+			return err
+		}
+
+		if entry.LinkTarget != "" {
+			// Symbolic links are relative to their directory, hard links to
+			// the archive root.
+			target := entry.LinkTarget
+			if entry.Mode()&fs.ModeSymlink != 0 {
+				target = path.Join(path.Dir(name), target)
+			}
+			target = path.Clean(target)
+			if path.IsAbs(entry.LinkTarget) || target == ".." || strings.HasPrefix(target, "../") {
+				return fmt.Errorf("refusing archive entry %q linking outside of the archive", name)
+			}
+		}
+
+		return fn(name, entry)
+	})
+}
+
+// extractEntry writes an entry of an archive at target. Only directories and
+// regular files are extracted, links are never created.
+func extractEntry(ctx context.Context, d *data, target string, entry archives.FileInfo,
+	quotas *quota.Tracker, history *versions.History, report *jobs.Reporter) error {
+	if !d.Check(target) {
+		return nil
+	}
+
+	if entry.IsDir() {
+		return mkdirAll(d, quotas, target)
+	}
+	if !entry.Mode().IsRegular() {
+		return nil
+	}
+	if err := mkdirAll(d, quotas, path.Dir(target)); err != nil {
+		return err
+	}
+
+	replaced, existed := int64(0), int64(0)
+	if info, err := d.user.Fs.Stat(target); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("cannot extract %s over a directory: %w", target, fberrors.ErrExist)
+		}
+		if err := saveVersion(d, history, quotas, target); err != nil {
+			return err
+		}
+		replaced, existed = info.Size(), 1
+	}
+
+	in, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	root := d.quotaRoot()
+	body, err := quotas.Limit(in, root, d.user.Quota, replaced)
+	if err != nil {
+		return err
+	}
+
+	_, err = writeFile(d.user.Fs, target, &progressReader{ctx: ctx, r: body, report: report}, d.settings.FileMode, d.settings.DirMode)
+
+	// What was written is measured, in case the write failed midway.
+	written := quotas.Measure(d.user.FullPath(target))
+	quotas.Add(root, written.Bytes-replaced, written.Files-existed)
+	if err != nil {
+		return err
+	}
+
+	report.Add(0, 1)
+	return nil
+}
+
+// progressReader reports the bytes read from r, and stops reading once ctx
+// is canceled.
+type progressReader struct {
+	ctx    context.Context
+	r      io.Reader
+	report *jobs.Reporter
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := p.r.Read(b)
+	p.report.Add(int64(n), 0)
+	return n, err
+}
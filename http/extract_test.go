@@ -0,0 +1,174 @@
+package fbhttp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+type archiveEntry struct {
+	name, content, link string
+}
+
+func writeTarGz(t *testing.T, name string, entries []archiveEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, name string, entries []archiveEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResourceExtract(t *testing.T) {
+	root := t.TempDir()
+	userScope := filepath.Join(root, "user")
+	if err := os.MkdirAll(userScope, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeZip(t, filepath.Join(userScope, "docs.zip"), []archiveEntry{
+		{name: "docs/"},
+		{name: "docs/a.txt", content: "a"},
+		{name: "./docs/sub/b.txt", content: "bb"},
+	})
+	writeTarGz(t, filepath.Join(userScope, "docs.tar.gz"), []archiveEntry{
+		{name: "a.txt", content: "a"},
+		{name: "inside", link: "a.txt"},
+	})
+	writeZip(t, filepath.Join(userScope, "traversal.zip"), []archiveEntry{
+		{name: "ok.txt", content: "ok"},
+		{name: "../evil.txt", content: "evil"},
+	})
+	writeZip(t, filepath.Join(userScope, "absolute.zip"), []archiveEntry{
+		{name: "/evil.txt", content: "evil"},
+	})
+	writeTarGz(t, filepath.Join(userScope, "link.tar.gz"), []archiveEntry{
+		{name: "ok.txt", content: "ok"},
+		{name: "escape", link: "../../secret"},
+	})
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Create: true}
+	st := scopedUserStorage(t, userScope, perm, key)
+	signed := signToken(t, perm, key)
+	handler := handle(resourcePatchHandler(diskcache.NewNoOp(), nil, nil, nil, nil), "", st, &settings.Server{})
+
+	extract := func(src, dst string) jobs.Job {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPatch, src+"?action=extract&destination="+dst, http.NoBody)
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("extract %s: expected 202, got %d body=%q", src, rec.Code, rec.Body.String())
+		}
+
+		var job jobs.Job
+		if err := json.NewDecoder(rec.Body).Decode(&job); err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	read := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(userScope, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	job := extract("/docs.zip", "/out")
+	want := jobs.Progress{Bytes: 3, Files: 2, TotalBytes: 3, TotalFiles: 2}
+	if job.Status != jobs.StatusDone || job.Progress != want {
+		t.Fatalf("expected the job to be done with %+v, got %+v", want, job)
+	}
+	if read("out/docs/a.txt") != "a" || read("out/docs/sub/b.txt") != "bb" {
+		t.Error("expected the zip archive to be extracted")
+	}
+
+	// Links within the archive are allowed but not created.
+	if job := extract("/docs.tar.gz", "/tgz"); job.Status != jobs.StatusDone {
+		t.Fatalf("expected the job to be done, got %+v", job)
+	}
+	if read("tgz/a.txt") != "a" {
+		t.Error("expected the tar.gz archive to be extracted")
+	}
+	if _, err := os.Lstat(filepath.Join(userScope, "tgz", "inside")); !os.IsNotExist(err) {
+		t.Errorf("expected the link not to be created, got %v", err)
+	}
+
+	for _, src := range []string{"/traversal.zip", "/absolute.zip", "/link.tar.gz"} {
+		job := extract(src, "/unsafe")
+		if job.Status != jobs.StatusFailed {
+			t.Errorf("extract %s: expected the job to fail, got %+v", src, job)
+		}
+		if _, err := os.Stat(filepath.Join(userScope, "unsafe")); !os.IsNotExist(err) {
+			t.Errorf("extract %s: expected nothing to be left behind, got %v", src, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("VULNERABLE: an entry was extracted outside of the scope: %v", err)
+	}
+
+	// Existing destinations are only written to when overriding.
+	req, _ := http.NewRequest(http.MethodPatch, "/docs.zip?action=extract&destination=/out", http.NoBody)
+	req.Header.Set("X-Auth", signed)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", rec.Code)
+	}
+}
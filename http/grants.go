@@ -0,0 +1,423 @@
+package fbhttp
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/files"
+	"github.com/thevickypedia/filebrowser/v2/grants"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// grantResponse is a grant along with the names of its owner and grantee.
+type grantResponse struct {
+	*grants.Grant
+	Owner   string `json:"owner"`
+	Grantee string `json:"grantee"`
+}
+
+type grantRequest struct {
+	Path string `json:"path"`
+	// Grantee is the username of the user granted the path, unless it is
+	// granted to the users of Group.
+	Grantee string `json:"grantee"`
+	Group   string `json:"group"`
+	// Name is what the grantee sees the path as, its base name by default.
+	Name string            `json:"name"`
+	Perm users.Permissions `json:"perm"`
+}
+
+// withGrantUser serves the users logged in as withUser does, the paths under
+// grants.Root being those of the directories granted to them. These are
+// served as their owners, whose filesystems are rebased onto the directories
+// granted, with the permissions granted.
+func withGrantUser(fn handleFunc) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		r, status, err := resolveGrant(r, d)
+		if status != 0 || err != nil {
+			return status, err
+		}
+		if d.grant == nil {
+			return fn(w, r, d)
+		}
+
+		defer func(e *audit.Event) {
+			// The events are those of the grantees, with the paths they see.
+			if d.event == nil {
+				return
+			}
+			if d.event != e {
+				d.event.Source = d.grantPath(d.event.Source)
+				if d.event.Destination != "" {
+					d.event.Destination = d.grantPath(d.event.Destination)
+				}
+			}
+			d.event.User = d.grantee.Username
+		}(d.event)
+		return fn(w, r, d)
+	})
+}
+
+// resolveGrant has the request served from the grant its path is within, if
+// any, returning the request with its paths relative to the directory
+// granted. Nothing is resolved for the paths outside of grants.Root, which
+// the status is zero for, nor for grants.Root itself, which is only listed.
+func resolveGrant(r *http.Request, d *data) (*http.Request, int, error) {
+	vars := mux.Vars(r)
+	p, isVar := vars["path"]
+	if isVar {
+		p = "/" + p
+	} else {
+		p = r.URL.Path
+	}
+
+	query := r.URL.Query()
+	dst, err := url.QueryUnescape(query.Get("destination"))
+	if err != nil {
+		return r, http.StatusBadRequest, err
+	}
+	dstName, dstRest, dstInGrant := grants.Split(dst)
+
+	name, rest, ok := grants.Split(p)
+	if (ok || dstInGrant) && grantsShadowed(d) {
+		return r, 0, nil
+	}
+	switch {
+	case !ok && query.Has("destination") && dstInGrant:
+		// The files of the users are never moved or copied into grants, nor
+		// those of grants out of them, since the filesystems differ.
+		return r, http.StatusForbidden, nil
+	case !ok:
+		return r, 0, nil
+	case name == "":
+		if r.Method != http.MethodGet {
+			return r, http.StatusForbidden, nil
+		}
+		return r, 0, nil
+	case query.Has("destination") && (!dstInGrant || dstName != name):
+		return r, http.StatusForbidden, nil
+	}
+
+	// The tokens restricted to a path only ever access the files of their
+	// users.
+	if d.token != nil && d.token.Path != "/" {
+		return r, http.StatusForbidden, nil
+	}
+
+	grant, found, err := d.store.Grants.GetByName(d.user, name)
+	if err != nil {
+		return r, http.StatusInternalServerError, err
+	}
+	if !found {
+		return r, http.StatusNotFound, nil
+	}
+
+	owner, err := d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, grant.OwnerID)
+	if err != nil {
+		return r, errToStatus(err), err
+	}
+	info, err := owner.Fs.Stat(grant.Path)
+	if err != nil {
+		return r, errToStatus(err), err
+	}
+	if !info.IsDir() {
+		return r, http.StatusNotFound, nil
+	}
+
+	// Like the public shares, the grants are symlink-confined to the
+	// directories granted, the rules being those of the owners.
+	scopeRoot := owner.FullPath("/")
+	owner.Perm = grant.Restrict(owner.Perm, d.user.Perm)
+	owner.Fs = files.NewFs(owner.Fs, grant.Path, d.server.FollowExternalSymlinks)
+	owner.Sorting = d.user.Sorting
+	d.grantee = d.user
+	d.user = owner
+	d.grant = grant
+	d.checkerPrefix = grant.Path
+	d.scopeRoot = scopeRoot
+
+	if isVar {
+		vars["path"] = strings.TrimPrefix(rest, "/")
+		r = mux.SetURLVars(r, vars)
+	} else {
+		r.URL.Path = rest
+		r.URL.RawPath = ""
+	}
+	if query.Has("destination") {
+		query.Set("destination", url.QueryEscape(dstRest))
+		r.URL.RawQuery = query.Encode()
+	}
+	return r, 0, nil
+}
+
+// grantsShadowed reports whether the user has a file of their own at
+// grants.Root, which is then served as any other, the directories granted to
+// them being out of reach until it is renamed.
+func grantsShadowed(d *data) bool {
+	_, err := d.user.Fs.Stat(grants.Root)
+	return err == nil
+}
+
+// grantsRootInfo lists the directories granted to the user, as directories of
+// grants.Root named after the grants.
+func grantsRootInfo(d *data) (*files.FileInfo, error) {
+	list, err := d.store.Grants.FindFor(d.user)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := &files.FileInfo{
+		Listing: &files.Listing{Items: []*files.FileInfo{}, Sorting: d.user.Sorting},
+		Path:    grants.Root,
+		Name:    path.Base(grants.Root),
+		Mode:    fs.ModeDir | 0o755,
+		IsDir:   true,
+	}
+	for _, g := range list {
+		owner, err := d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, g.OwnerID)
+		if errors.Is(err, fberrors.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info, err := owner.Fs.Stat(g.Path)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		dir.Items = append(dir.Items, &files.FileInfo{
+			Path:    path.Join(grants.Root, g.Name),
+			Name:    g.Name,
+			ModTime: info.ModTime(),
+			Mode:    info.Mode(),
+			IsDir:   true,
+		})
+		dir.NumDirs++
+		if info.ModTime().After(dir.ModTime) {
+			dir.ModTime = info.ModTime()
+		}
+	}
+	dir.ApplySort()
+	return dir, nil
+}
+
+// listGrantsRoot lists grants.Root within the root directory of the user,
+// when they were granted any directory.
+func listGrantsRoot(d *data, dir *files.FileInfo) error {
+	if d.grant != nil || dir.Path != "/" {
+		return nil
+	}
+	// A file of the user of the same name is listed instead.
+	if slices.ContainsFunc(dir.Items, func(item *files.FileInfo) bool { return item.Path == grants.Root }) {
+		return nil
+	}
+
+	list, err := d.store.Grants.FindFor(d.user)
+	if err != nil || len(list) == 0 {
+		return err
+	}
+	dir.Items = append(dir.Items, &files.FileInfo{
+		Path:  grants.Root,
+		Name:  path.Base(grants.Root),
+		Mode:  fs.ModeDir | 0o755,
+		IsDir: true,
+	})
+	dir.NumDirs++
+	return nil
+}
+
+// renderResource renders a file info, with the paths its grantee sees when it
+// is within a grant.
+func renderResource(w http.ResponseWriter, r *http.Request, d *data, file *files.FileInfo) (int, error) {
+	if d.grant != nil {
+		file.Path = d.grantPath(file.Path)
+		if file.Listing != nil {
+			for _, item := range file.Items {
+				item.Path = d.grantPath(item.Path)
+			}
+		}
+	}
+	return renderJSON(w, r, file)
+}
+
+func newGrantResponse(d *data, g *grants.Grant) (*grantResponse, error) {
+	res := &grantResponse{Grant: g}
+	var err error
+	res.Owner, err = grantUsername(d, g.OwnerID)
+	if err != nil || g.Group != "" {
+		return res, err
+	}
+	res.Grantee, err = grantUsername(d, g.GranteeID)
+	return res, err
+}
+
+// grantUsername returns the username of the user of a grant, empty once they
+// are deleted.
+func grantUsername(d *data, id uint) (string, error) {
+	u, err := d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, id)
+	switch {
+	case errors.Is(err, fberrors.ErrNotExist):
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+	return u.Username, nil
+}
+
+// grantListHandler lists the grants made by the user, or all of them for the
+// admins.
+var grantListHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	var (
+		list []*grants.Grant
+		err  error
+	)
+	if d.user.Perm.Admin {
+		list, err = d.store.Grants.All()
+	} else {
+		list, err = d.store.Grants.FindByOwner(d.user.ID)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	res := make([]*grantResponse, 0, len(list))
+	for _, g := range list {
+		info, err := newGrantResponse(d, g)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		res = append(res, info)
+	}
+	return renderJSON(w, r, res)
+})
+
+// grantPostHandler grants another user access to a directory of the user,
+// with at most the permissions of the user.
+var grantPostHandler = withPermShare(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if r.Body == nil {
+		return http.StatusBadRequest, fberrors.ErrEmptyRequest
+	}
+
+	var req grantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	req.Path = path.Clean("/" + req.Path)
+	req.Group = strings.TrimSpace(req.Group)
+	e := d.audit(audit.ActionGrantCreate, req.Path, "")
+	e.Detail = cmp.Or(req.Grantee, req.Group)
+	if (req.Grantee == "") == (req.Group == "") {
+		// A grant is either to a user or to a group.
+		return http.StatusBadRequest, fberrors.ErrInvalidRequestParams
+	}
+
+	if req.Path == "/" || !d.Check(req.Path) {
+		return http.StatusForbidden, nil
+	}
+	info, err := d.user.Fs.Stat(req.Path)
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if !info.IsDir() {
+		return http.StatusBadRequest, fberrors.ErrInvalidRequestParams
+	}
+
+	var grantee *users.User
+	if req.Grantee != "" {
+		grantee, err = d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, req.Grantee)
+		if errors.Is(err, fberrors.ErrNotExist) || (err == nil && grantee.ID == d.user.ID) {
+			return http.StatusBadRequest, fberrors.ErrInvalidRequestParams
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = path.Base(req.Path)
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return http.StatusBadRequest, fberrors.ErrInvalidRequestParams
+	}
+	g := &grants.Grant{
+		OwnerID: d.user.ID,
+		Group:   req.Group,
+		Path:    req.Path,
+		Name:    name,
+		Perm:    req.Perm,
+		Created: time.Now(),
+	}
+	// The names are unique among the grants to the user, or to the group.
+	var found bool
+	if grantee != nil {
+		g.GranteeID = grantee.ID
+		_, found, err = d.store.Grants.GetByName(grantee, name)
+	} else {
+		_, found, err = d.store.Grants.GetByGroupName(g.Group, name)
+	}
+	if err != nil || found {
+		if found {
+			err = fberrors.ErrExist
+		}
+		return errToStatus(err), err
+	}
+
+	// Grants can't give more than their owners have, whatever they ask for.
+	g.Perm = g.Restrict(d.user.Perm, d.user.Perm)
+	if err := d.store.Grants.Save(g); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	res, err := newGrantResponse(d, g)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, res)
+})
+
+// grantDeleteHandler revokes a grant, which its grantee can also give up,
+// unless it was given to their group.
+var grantDeleteHandler = withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 0)
+	if err != nil {
+		return http.StatusNotFound, nil
+	}
+
+	e := d.audit(audit.ActionGrantDelete, "", "")
+	g, err := d.store.Grants.Get(uint(id))
+	if err != nil {
+		return errToStatus(err), err
+	}
+	// Others' grants aren't told apart from unknown ones.
+	if g.OwnerID != d.user.ID && g.GranteeID != d.user.ID && !d.user.Perm.Admin {
+		return http.StatusNotFound, nil
+	}
+	e.Source = g.Path
+	e.Detail = g.Group
+	if g.Group == "" {
+		e.Detail, _ = grantUsername(d, g.GranteeID)
+	}
+
+	if err := d.store.Grants.Delete(g.ID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+})
@@ -0,0 +1,238 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/asdine/storm/v3"
+	"github.com/gorilla/mux"
+
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/storage/bolt"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestGrants(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"alice/docs/a.txt":  "a",
+		"alice/notes.txt":   "n",
+		"alice/private.txt": "p",
+		"bob/mine.txt":      "m",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("test-signing-key")
+	if err := st.Settings.Save(&settings.Settings{Key: key}); err != nil {
+		t.Fatal(err)
+	}
+	alicePerm := users.Permissions{Create: true, Rename: true, Modify: true, Delete: true, Share: true, Download: true}
+	bobPerm := users.Permissions{Create: true, Rename: true, Modify: true, Delete: true, Download: true}
+	for _, u := range []*users.User{
+		{Username: "alice", Password: "pw", Scope: "/alice", Perm: alicePerm, Quota: users.Quota{Bytes: 4}},
+		{Username: "bob", Password: "pw", Scope: "/bob", Perm: bobPerm},
+		{Username: "carol", Password: "pw", Scope: "/carol", Perm: bobPerm, Groups: []string{"team"}},
+	} {
+		if err := st.Users.Save(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := signShareTestToken(t, 1, "alice", alicePerm, key)
+	bob := signShareTestToken(t, 2, "bob", bobPerm, key)
+	carol := signShareTestToken(t, 3, "carol", bobPerm, key)
+
+	server := &settings.Server{Root: root}
+	do := func(handler handleFunc, prefix, token, method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, prefix+target, strings.NewReader(body))
+		req.Header.Set("X-Auth", token)
+		rec := httptest.NewRecorder()
+		handle(handler, prefix, st, server).ServeHTTP(rec, req)
+		return rec
+	}
+	grant := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		return do(grantPostHandler, "", alice, http.MethodPost, "/api/grants", body)
+	}
+	listAs := func(token, p string) []string {
+		t.Helper()
+		rec := do(resourceGetHandler, "/api/resources", token, http.MethodGet, p, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 listing %s, got %d body=%q", p, rec.Code, rec.Body.String())
+		}
+		var dir struct {
+			Items []struct {
+				Path string `json:"path"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &dir); err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, item := range dir.Items {
+			paths = append(paths, item.Path)
+		}
+		sort.Strings(paths)
+		return paths
+	}
+	list := func(p string) []string {
+		t.Helper()
+		return listAs(bob, p)
+	}
+
+	if rec := grant(`{"path":"/notes.txt","grantee":"bob"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected granting a file to be refused with 400, got %d", rec.Code)
+	}
+	if rec := grant(`{"path":"/docs","grantee":"alice"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected granting oneself to be refused with 400, got %d", rec.Code)
+	}
+	// Admin and share are never granted, whatever is asked for.
+	rec := grant(`{"path":"/docs","grantee":"bob","perm":{"admin":true,"share":true,"create":true,"download":true}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%q", rec.Code, rec.Body.String())
+	}
+	var created grantResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "docs" || created.Grantee != "bob" || created.Perm != (users.Permissions{Create: true, Download: true}) {
+		t.Fatalf("unexpected grant %+v", created)
+	}
+	if rec := grant(`{"path":"/docs","grantee":"bob"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected a second grant of the same name to be refused with 409, got %d", rec.Code)
+	}
+
+	if got := strings.Join(list("/"), ","); got != "/Shared with me,/mine.txt" {
+		t.Fatalf("expected the grants to be listed within the root, got %s", got)
+	}
+	if got := strings.Join(list("/Shared%20with%20me"), ","); got != "/Shared with me/docs" {
+		t.Fatalf("expected the grants to be listed, got %s", got)
+	}
+	if got := strings.Join(list("/Shared%20with%20me/docs/"), ","); got != "/Shared with me/docs/a.txt" {
+		t.Fatalf("expected the directory granted to be listed, got %s", got)
+	}
+	if rec := do(rawHandler, "/api/raw", bob, http.MethodGet, "/Shared%20with%20me/docs/a.txt", ""); rec.Code != http.StatusOK || rec.Body.String() != "a" {
+		t.Fatalf("expected the file granted to be downloaded, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := do(rawHandler, "/api/raw", bob, http.MethodGet, "/Shared%20with%20me/docs/../../private.txt", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected the files outside of the grant to be out of reach, got %d", rec.Code)
+	}
+
+	// The uploads are charged to the whole scope of the owner, not to the
+	// directory granted.
+	quotaPost := resourcePostHandler(diskcache.NewNoOp(), nil, quota.NewTracker(), nil)
+	if rec := do(quotaPost, "/api/resources", bob, http.MethodPost, "/Shared%20with%20me/docs/big.txt", "bb"); rec.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected the quota of the owner to be exceeded with 507, got %d", rec.Code)
+	}
+
+	post := resourcePostHandler(diskcache.NewNoOp(), nil, nil, nil)
+	if rec := do(post, "/api/resources", bob, http.MethodPost, "/Shared%20with%20me/docs/b.txt", "b"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the grantee to create files, got %d", rec.Code)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "alice", "docs", "b.txt")); err != nil || string(b) != "b" {
+		t.Fatalf("expected the file to be created in the directory of the owner, got %q %v", b, err)
+	}
+	del := resourceDeleteHandler(diskcache.NewNoOp(), nil, nil, nil, nil)
+	if rec := do(del, "/api/resources", bob, http.MethodDelete, "/Shared%20with%20me/docs/a.txt", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the permissions not granted to be refused with 403, got %d", rec.Code)
+	}
+	patch := resourcePatchHandler(diskcache.NewNoOp(), nil, nil, nil, nil)
+	if rec := do(patch, "/api/resources", bob, http.MethodPatch, "/mine.txt?action=copy&destination=%2FShared%20with%20me%2Fdocs%2Fmine.txt", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected copying into a grant to be refused with 403, got %d", rec.Code)
+	}
+
+	// The grants to a group are given to its users.
+	if rec := grant(`{"path":"/docs","grantee":"bob","group":"team"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a grant to both a user and a group to be refused with 400, got %d", rec.Code)
+	}
+	rec = grant(`{"path":"/docs","group":"team","name":"team docs","perm":{"download":true}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%q", rec.Code, rec.Body.String())
+	}
+	var teamGrant grantResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &teamGrant); err != nil {
+		t.Fatal(err)
+	}
+	if teamGrant.Group != "team" || teamGrant.GranteeID != 0 || teamGrant.Grantee != "" {
+		t.Fatalf("unexpected grant %+v", teamGrant)
+	}
+	if got := strings.Join(listAs(carol, "/Shared%20with%20me/team%20docs/"), ","); got != "/Shared with me/team docs/a.txt,/Shared with me/team docs/b.txt" {
+		t.Fatalf("expected the directory granted to the group to be listed, got %s", got)
+	}
+	if got := strings.Join(list("/Shared%20with%20me"), ","); got != "/Shared with me/docs" {
+		t.Fatalf("expected the grants to the group to be hidden from the others, got %s", got)
+	}
+	delGrant := func(token string, id uint) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodDelete, "/api/grants/"+strconv.FormatUint(uint64(id), 10), http.NoBody)
+		req.Header.Set("X-Auth", token)
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.FormatUint(uint64(id), 10)})
+		rec := httptest.NewRecorder()
+		handle(grantDeleteHandler, "", st, server).ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := delGrant(carol, teamGrant.ID); code != http.StatusNotFound {
+		t.Fatalf("expected the users of the group not to revoke its grant, got %d", code)
+	}
+
+	// The files of the users named after the grants root are still theirs.
+	own := filepath.Join(root, "carol", "Shared with me")
+	if err := os.MkdirAll(own, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(own, "own.txt"), []byte("o"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(listAs(carol, "/Shared%20with%20me"), ","); got != "/Shared with me/own.txt" {
+		t.Fatalf("expected the directory of the user to be listed, got %s", got)
+	}
+	if rec := do(rawHandler, "/api/raw", carol, http.MethodGet, "/Shared%20with%20me/own.txt", ""); rec.Code != http.StatusOK || rec.Body.String() != "o" {
+		t.Fatalf("expected the file of the user to be downloaded, got %d %q", rec.Code, rec.Body.String())
+	}
+	if err := os.RemoveAll(own); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = do(grantListHandler, "", alice, http.MethodGet, "/api/grants", "")
+	var grants []grantResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &grants); err != nil || len(grants) != 2 || grants[0].Path != "/docs" {
+		t.Fatalf("expected the owner to list their grants, got %q %v", rec.Body.String(), err)
+	}
+
+	if rec := do(del, "/api/resources", alice, http.MethodDelete, "/docs", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if got := list("/Shared%20with%20me"); len(got) != 0 {
+		t.Fatalf("expected the grant to be removed with its directory, got %v", got)
+	}
+	if got := strings.Join(list("/"), ","); got != "/mine.txt" {
+		t.Fatalf("expected the root to be left alone without grants, got %s", got)
+	}
+	if got := listAs(carol, "/Shared%20with%20me"); len(got) != 0 {
+		t.Fatalf("expected the grant to the group to be removed with its directory, got %v", got)
+	}
+}
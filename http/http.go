@@ -6,8 +6,13 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/search"
 	"github.com/thevickypedia/filebrowser/v2/settings"
 	"github.com/thevickypedia/filebrowser/v2/storage"
+	"github.com/thevickypedia/filebrowser/v2/trash"
+	"github.com/thevickypedia/filebrowser/v2/versions"
 )
 
 type modifyRequest struct {
@@ -20,6 +25,11 @@ func NewHandler(
 	imgSvc ImgService,
 	fileCache FileCache,
 	uploadCache UploadCache,
+	searchIndex *search.Index,
+	quotas *quota.Tracker,
+	bin *trash.Bin,
+	history *versions.History,
+	jobManager *jobs.Manager,
 	store *storage.Storage,
 	server *settings.Server,
 	assetsFs fs.FS,
@@ -40,58 +50,123 @@ func NewHandler(
 	}
 
 	r.HandleFunc("/health", healthHandler)
+	if server.EnableMetrics {
+		r.Use(measureRequests)
+		r.Handle("/metrics", monkey(metricsHandler(newMetricsRegistry(imgSvc, uploadCache)), "")).Methods("GET")
+	}
 	r.PathPrefix("/static").Handler(static)
 	r.NotFoundHandler = index
 
+	if server.WebDAVPrefix != "" {
+		dav := monkey(webdavHandler(fileCache, searchIndex, quotas, bin, history), "")
+		r.Path(server.WebDAVPrefix).Handler(dav)
+		r.PathPrefix(server.WebDAVPrefix + "/").Handler(dav)
+	}
+
 	api := r.PathPrefix("/api").Subrouter()
 
 	tokenExpirationTime := server.GetTokenExpirationTime(DefaultTokenExpirationTime)
 	api.Handle("/version", monkey(versionHandler, ""))
 	api.Handle("/login", monkey(loginHandler(tokenExpirationTime), ""))
+	api.Handle("/auth/oidc/login", monkey(oidcLoginHandler, "")).Methods("GET")
+	api.Handle("/auth/oidc/callback", monkey(oidcCallbackHandler(tokenExpirationTime), "")).Methods("GET")
 	api.Handle("/terminate", monkey(terminateHandler, ""))
 	api.Handle("/logout", monkey(logoutHandler, ""))
 	api.Handle("/signup", monkey(signupHandler, ""))
 	api.Handle("/renew", monkey(renewHandler(tokenExpirationTime), ""))
 
+	webAuthn := api.PathPrefix("/webauthn").Subrouter()
+	webAuthn.Handle("/login/begin", monkey(webAuthnLoginBeginHandler, "")).Methods("POST")
+	webAuthn.Handle("/register/begin", monkey(webAuthnRegisterBeginHandler, "")).Methods("POST")
+	webAuthn.Handle("/register/finish", monkey(webAuthnRegisterFinishHandler, "")).Methods("POST")
+	webAuthn.Handle("/credentials", monkey(passkeyListHandler, "")).Methods("GET")
+	webAuthn.Handle("/credentials/{id}", monkey(passkeyDeleteHandler, "")).Methods("DELETE")
+
+	sessions := api.PathPrefix("/sessions").Subrouter()
+	sessions.Handle("", monkey(sessionListHandler, "")).Methods("GET")
+	sessions.Handle("", monkey(sessionsDeleteHandler, "")).Methods("DELETE")
+	sessions.Handle("/{id}", monkey(sessionDeleteHandler, "")).Methods("DELETE")
+
+	tokens := api.PathPrefix("/tokens").Subrouter()
+	tokens.Handle("", monkey(tokenListHandler, "")).Methods("GET")
+	tokens.Handle("", monkey(tokenPostHandler, "")).Methods("POST")
+	tokens.Handle("/{id}", monkey(tokenDeleteHandler, "")).Methods("DELETE")
+
 	users := api.PathPrefix("/users").Subrouter()
 	users.Handle("", monkey(usersGetHandler, "")).Methods("GET")
 	users.Handle("", monkey(userPostHandler, "")).Methods("POST")
 	users.Handle("/{id:[0-9]+}", monkey(userPutHandler, "")).Methods("PUT")
 	users.Handle("/{id:[0-9]+}", monkey(userGetHandler, "")).Methods("GET")
 	users.Handle("/{id:[0-9]+}", monkey(userDeleteHandler, "")).Methods("DELETE")
+	users.Handle("/{id:[0-9]+}/otp", monkey(otpGetHandler, "")).Methods("GET")
+	users.Handle("/{id:[0-9]+}/otp", monkey(otpEnrollHandler, "")).Methods("POST")
+	users.Handle("/{id:[0-9]+}/otp", monkey(otpDeleteHandler, "")).Methods("DELETE")
+	users.Handle("/{id:[0-9]+}/otp/qr", monkey(otpQRHandler, "")).Methods("GET")
+	users.Handle("/{id:[0-9]+}/otp/verify", monkey(otpVerifyHandler, "")).Methods("POST")
 
 	api.PathPrefix("/resources/recursive").Handler(monkey(resourceGetRecursiveHandler, "/api/resources/recursive")).Methods("GET")
 	api.PathPrefix("/resources").Handler(monkey(resourceGetHandler, "/api/resources")).Methods("GET")
-	api.PathPrefix("/resources").Handler(monkey(resourceDeleteHandler(fileCache), "/api/resources")).Methods("DELETE")
-	api.PathPrefix("/resources").Handler(monkey(resourcePostHandler(fileCache), "/api/resources")).Methods("POST")
-	api.PathPrefix("/resources").Handler(monkey(resourcePutHandler, "/api/resources")).Methods("PUT")
-	api.PathPrefix("/resources").Handler(monkey(resourcePatchHandler(fileCache), "/api/resources")).Methods("PATCH")
+	api.PathPrefix("/resources").Handler(monkey(resourceDeleteHandler(fileCache, searchIndex, quotas, bin, jobManager), "/api/resources")).Methods("DELETE")
+	api.PathPrefix("/resources").Handler(monkey(resourcePostHandler(fileCache, searchIndex, quotas, history), "/api/resources")).Methods("POST")
+	api.PathPrefix("/resources").Handler(monkey(resourcePutHandler(searchIndex, quotas, history), "/api/resources")).Methods("PUT")
+	api.PathPrefix("/resources").Handler(monkey(resourcePatchHandler(fileCache, searchIndex, quotas, history, jobManager), "/api/resources")).Methods("PATCH")
 
-	api.PathPrefix("/tus").Handler(monkey(tusPostHandler(uploadCache), "/api/tus")).Methods("POST")
+	api.PathPrefix("/tus").Handler(monkey(tusPostHandler(uploadCache, quotas, history), "/api/tus")).Methods("POST")
 	api.PathPrefix("/tus").Handler(monkey(tusHeadHandler(uploadCache), "/api/tus")).Methods("HEAD", "GET")
-	api.PathPrefix("/tus").Handler(monkey(tusPatchHandler(uploadCache), "/api/tus")).Methods("PATCH")
-	api.PathPrefix("/tus").Handler(monkey(tusDeleteHandler(uploadCache), "/api/tus")).Methods("DELETE")
+	api.PathPrefix("/tus").Handler(monkey(tusPatchHandler(uploadCache, searchIndex, quotas), "/api/tus")).Methods("PATCH")
+	api.PathPrefix("/tus").Handler(monkey(tusDeleteHandler(uploadCache, quotas), "/api/tus")).Methods("DELETE")
 
-	api.PathPrefix("/usage").Handler(monkey(diskUsage, "/api/usage")).Methods("GET")
+	trashRouter := api.PathPrefix("/trash").Subrouter()
+	trashRouter.Handle("", monkey(trashListHandler(bin), "")).Methods("GET")
+	trashRouter.Handle("", monkey(trashPurgeHandler(bin), "")).Methods("DELETE")
+	trashRouter.Handle("/{id}", monkey(trashPurgeHandler(bin), "")).Methods("DELETE")
+	trashRouter.Handle("/{id}/restore", monkey(trashRestoreHandler(bin, searchIndex, quotas), "")).Methods("POST")
+
+	api.Handle("/jobs", monkey(jobListHandler(jobManager), "")).Methods("GET")
+	api.Handle("/jobs/events", monkey(jobEventsHandler(jobManager), "")).Methods("GET")
+	api.Handle("/jobs/{id}", monkey(jobGetHandler(jobManager), "")).Methods("GET")
+	api.Handle("/jobs/{id}", monkey(jobCancelHandler(jobManager), "")).Methods("DELETE")
+
+	api.PathPrefix("/versions").Handler(monkey(versionsGetHandler(history), "/api/versions")).Methods("GET")
+	api.PathPrefix("/versions").Handler(monkey(versionsRestoreHandler(fileCache, searchIndex, quotas, history), "/api/versions")).Methods("POST")
+
+	api.PathPrefix("/usage").Handler(monkey(diskUsageHandler(quotas), "/api/usage")).Methods("GET")
 
 	api.Handle("/shares", monkey(shareListHandler, "")).Methods("GET")
+	api.Handle("/share/{hash}/access", monkey(shareAccessHandler, "/api/share")).Methods("GET")
 	api.PathPrefix("/share").Handler(monkey(shareGetsHandler, "/api/share")).Methods("GET")
 	api.PathPrefix("/share").Handler(monkey(sharePostHandler, "/api/share")).Methods("POST")
+	api.PathPrefix("/share").Handler(monkey(sharePatchHandler, "/api/share")).Methods("PATCH")
 	api.PathPrefix("/share").Handler(monkey(shareDeleteHandler, "/api/share")).Methods("DELETE")
 
+	grantsRouter := api.PathPrefix("/grants").Subrouter()
+	grantsRouter.Handle("", monkey(grantListHandler, "")).Methods("GET")
+	grantsRouter.Handle("", monkey(grantPostHandler, "")).Methods("POST")
+	grantsRouter.Handle("/{id:[0-9]+}", monkey(grantDeleteHandler, "")).Methods("DELETE")
+
 	api.Handle("/settings", monkey(settingsGetHandler, "")).Methods("GET")
 	api.Handle("/settings", monkey(settingsPutHandler, "")).Methods("PUT")
 
+	api.Handle("/limits", monkey(limitsGetHandler, "")).Methods("GET")
+	api.Handle("/limits/{key}", monkey(limitsDeleteHandler, "")).Methods("DELETE")
+
+	api.Handle("/audit", monkey(auditGetHandler, "")).Methods("GET")
+
 	api.PathPrefix("/raw").Handler(monkey(rawHandler, "/api/raw")).Methods("GET")
 	api.PathPrefix("/preview/{size}/{path:.*}").
 		Handler(monkey(previewHandler(imgSvc, fileCache, server.EnableThumbnails, server.ResizePreview), "/api/preview")).Methods("GET")
 	api.PathPrefix("/command").Handler(monkey(commandsHandler, "/api/command")).Methods("GET")
-	api.PathPrefix("/search").Handler(monkey(searchHandler, "/api/search")).Methods("GET")
+	api.PathPrefix("/search").Handler(monkey(searchHandler(searchIndex), "/api/search")).Methods("GET")
 	api.PathPrefix("/subtitle").Handler(monkey(subtitleHandler, "/api/subtitle")).Methods("GET")
 
 	public := api.PathPrefix("/public").Subrouter()
 	public.PathPrefix("/dl").Handler(monkey(publicDlHandler, "/api/public/dl/")).Methods("GET")
 	public.PathPrefix("/share").Handler(monkey(publicShareHandler, "/api/public/share/")).Methods("GET")
+	public.PathPrefix("/upload").Handler(monkey(publicUploadInfoHandler, "/api/public/upload/")).Methods("GET")
+	public.PathPrefix("/upload").Handler(monkey(publicUploadHandler(fileCache, searchIndex, quotas, history), "/api/public/upload/")).Methods("POST")
+	public.PathPrefix("/tus").Handler(monkey(publicTusPostHandler(uploadCache, quotas, history), "/api/public/tus/")).Methods("POST")
+	public.PathPrefix("/tus").Handler(monkey(publicTusHeadHandler(uploadCache), "/api/public/tus/")).Methods("HEAD", "GET")
+	public.PathPrefix("/tus").Handler(monkey(publicTusPatchHandler(uploadCache, searchIndex, quotas), "/api/public/tus/")).Methods("PATCH")
 
 	return stripPrefix(server.BaseURL, r), nil
 }
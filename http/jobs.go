@@ -0,0 +1,199 @@
+package fbhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/afero"
+
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+)
+
+// jobKeepAlive is how often a comment is sent on an idle stream of job
+// events, so that proxies don't close it.
+const jobKeepAlive = 30 * time.Second
+
+// wantsAsync tells whether the client asked for an operation to be run as a
+// job rather than waiting for it.
+func wantsAsync(r *http.Request) bool {
+	return r.URL.Query().Get("async") == "true"
+}
+
+// startJob runs task as a job and responds with it, as accepted.
+func startJob(w http.ResponseWriter, r *http.Request, d *data, jobManager *jobs.Manager,
+	action, src, dst string, task jobs.Task) (int, error) {
+	userID := d.user.ID
+	if d.grantee != nil {
+		// The jobs run within grants are those of the grantees.
+		userID = d.grantee.ID
+		src = d.grantPath(src)
+		if dst != "" {
+			dst = d.grantPath(dst)
+		}
+	}
+	job, err := jobManager.Start(userID, action, src, dst, task)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Location", d.server.BaseURL+"/api/jobs/"+job.ID)
+	return renderJSONStatus(w, r, http.StatusAccepted, job)
+}
+
+// reportTotal reports the bytes and regular files in the tree at name as the
+// total of a job. Nothing is measured without a job to report to.
+func reportTotal(report *jobs.Reporter, afs afero.Fs, name string) {
+	if report == nil {
+		return
+	}
+
+	var bytes, files int64
+	_ = afero.Walk(afs, name, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			bytes += info.Size()
+			files++
+		}
+		return nil
+	})
+	report.SetTotal(bytes, files)
+}
+
+// progressFs reports the bytes read from the files it opens, and a file once
+// it is read to the end. Reading fails once ctx is canceled.
+type progressFs struct {
+	afero.Fs
+	ctx    context.Context
+	report *jobs.Reporter
+}
+
+func (p *progressFs) Open(name string) (afero.File, error) {
+	f, err := p.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &progressFile{File: f, ctx: p.ctx, report: p.report}, nil
+}
+
+type progressFile struct {
+	afero.File
+	ctx    context.Context
+	report *jobs.Reporter
+	read   bool
+}
+
+func (p *progressFile) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := p.File.Read(b)
+	p.report.Add(int64(n), 0)
+	if errors.Is(err, io.EOF) && !p.read {
+		p.read = true
+		p.report.Add(0, 1)
+	}
+	return n, err
+}
+
+func jobListHandler(jobManager *jobs.Manager) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		list, err := jobManager.List(d.user.ID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return renderJSON(w, r, list)
+	})
+}
+
+// jobEventsHandler streams the jobs of the user as server-sent events: their
+// current state first, then each of their updates.
+func jobEventsHandler(jobManager *jobs.Manager) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return http.StatusInternalServerError, errors.New("streaming is not supported")
+		}
+
+		// Subscribe first so that no update is missed between the listing
+		// and the stream.
+		updates, unsubscribe := jobManager.Subscribe(d.user.ID)
+		defer unsubscribe()
+
+		list, err := jobManager.List(d.user.ID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		send := func(job *jobs.Job) error {
+			b, err := json.Marshal(job)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+
+		for _, job := range list {
+			if err := send(job); err != nil {
+				return 0, nil
+			}
+		}
+
+		ticker := time.NewTicker(jobKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return 0, nil
+			case job, ok := <-updates:
+				if !ok {
+					return 0, nil
+				}
+				if err := send(&job); err != nil {
+					return 0, nil
+				}
+			case <-ticker.C:
+				if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+					return 0, nil
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+func jobGetHandler(jobManager *jobs.Manager) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		job, err := jobManager.Get(d.user.ID, mux.Vars(r)["id"])
+		if err != nil {
+			return errToStatus(err), err
+		}
+		return renderJSON(w, r, job)
+	})
+}
+
+func jobCancelHandler(jobManager *jobs.Manager) handleFunc {
+	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		err := jobManager.Cancel(d.user.ID, mux.Vars(r)["id"])
+		if err != nil {
+			return errToStatus(err), err
+		}
+		return http.StatusNoContent, nil
+	})
+}
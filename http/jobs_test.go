@@ -0,0 +1,174 @@
+package fbhttp
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestResourceJobs(t *testing.T) {
+	userScope := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(userScope, "docs", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"docs/a.txt": "a", "docs/sub/b.txt": "bb"} {
+		if err := os.WriteFile(filepath.Join(userScope, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Create: true, Delete: true, Rename: true}
+	st := scopedUserStorage(t, userScope, perm, key)
+	signed := signToken(t, perm, key)
+
+	jobManager, err := jobs.NewManager(st.Jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jobManager.Close()
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.PathPrefix("/resources").Handler(handle(resourcePatchHandler(diskcache.NewNoOp(), nil, nil, nil, jobManager), "/resources", st, server)).Methods("PATCH")
+	router.PathPrefix("/resources").Handler(handle(resourceDeleteHandler(diskcache.NewNoOp(), nil, nil, nil, jobManager), "/resources", st, server)).Methods("DELETE")
+	router.Handle("/jobs", handle(jobListHandler(jobManager), "", st, server)).Methods("GET")
+	router.Handle("/jobs/events", handle(jobEventsHandler(jobManager), "", st, server)).Methods("GET")
+	router.Handle("/jobs/{id}", handle(jobGetHandler(jobManager), "", st, server)).Methods("GET")
+
+	do := func(method, url string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, http.NoBody)
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	start := func(method, url string) jobs.Job {
+		t.Helper()
+		rec := do(method, url, http.StatusAccepted)
+		var job jobs.Job
+		if err := json.NewDecoder(rec.Body).Decode(&job); err != nil {
+			t.Fatal(err)
+		}
+		if location := rec.Header().Get("Location"); location != "/api/jobs/"+job.ID {
+			t.Errorf("expected the location of the job, got %q", location)
+		}
+		if contentType := rec.Result().Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+			t.Errorf("expected the job to be rendered as JSON, got %q", contentType)
+		}
+
+		for range 100 {
+			if err := json.NewDecoder(do(http.MethodGet, "/jobs/"+job.ID, http.StatusOK).Body).Decode(&job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != jobs.StatusRunning {
+				return job
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("job %s still running", job.ID)
+		return job
+	}
+
+	// The current state of the jobs is sent first on the stream of events.
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/jobs/events", http.NoBody)
+	req.Header.Set("X-Auth", signed)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+	events := bufio.NewScanner(res.Body)
+
+	job := start(http.MethodPatch, "/resources/docs?action=copy&destination=/copy&async=true")
+	want := jobs.Progress{Bytes: 3, Files: 2, TotalBytes: 3, TotalFiles: 2}
+	if job.Status != jobs.StatusDone || job.Progress != want {
+		t.Fatalf("expected the copy to be done with %+v, got %+v", want, job)
+	}
+	if content, err := os.ReadFile(filepath.Join(userScope, "copy", "sub", "b.txt")); err != nil || string(content) != "bb" {
+		t.Errorf("expected the directory to be copied, got %q %v", content, err)
+	}
+
+	for events.Scan() {
+		data, ok := strings.CutPrefix(events.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event jobs.Job
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.ID == job.ID && event.Status == jobs.StatusDone {
+			break
+		}
+	}
+	if err := events.Err(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// Archives are created in the background or while waiting.
+	job = start(http.MethodPatch, "/resources/docs?action=archive&destination=/docs.zip&async=true")
+	if job.Status != jobs.StatusDone || job.Progress != want {
+		t.Fatalf("expected the archive to be done with %+v, got %+v", want, job)
+	}
+	zr, err := zip.OpenReader(filepath.Join(userScope, "docs.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	zr.Close()
+	if got := strings.Join(names, ","); !strings.Contains(got, "docs/a.txt") || !strings.Contains(got, "docs/sub/b.txt") {
+		t.Errorf("expected the directory to be archived, got %s", got)
+	}
+	do(http.MethodPatch, "/resources/docs/a.txt?action=archive&destination=/a.tar.gz", http.StatusOK)
+	if _, err := os.Stat(filepath.Join(userScope, "a.tar.gz")); err != nil {
+		t.Errorf("expected the file to be archived: %v", err)
+	}
+	do(http.MethodPatch, "/resources/docs?action=archive&destination=/docs.rar", http.StatusBadRequest)
+
+	job = start(http.MethodDelete, "/resources/copy?async=true")
+	if job.Status != jobs.StatusDone {
+		t.Fatalf("expected the deletion to be done, got %+v", job)
+	}
+	if _, err := os.Stat(filepath.Join(userScope, "copy")); !os.IsNotExist(err) {
+		t.Errorf("expected the directory to be deleted, got %v", err)
+	}
+
+	var list []jobs.Job
+	if err := json.NewDecoder(do(http.MethodGet, "/jobs", http.StatusOK).Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Action != "delete" || list[2].Action != "copy" {
+		t.Errorf("expected the 3 jobs, most recent first, got %+v", list)
+	}
+}
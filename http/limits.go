@@ -0,0 +1,44 @@
+package fbhttp
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+// limitsGetHandler lists the clients and users who failed to log in lately,
+// those locked out first.
+var limitsGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if d.store.Limits == nil {
+		return http.StatusNotFound, nil
+	}
+
+	limits, err := d.store.Limits.List()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, limits)
+})
+
+// limitsDeleteHandler unblocks a client or user, forgetting their failed
+// logins.
+var limitsDeleteHandler = withAdmin(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if d.store.Limits == nil {
+		return http.StatusNotFound, nil
+	}
+
+	key := mux.Vars(r)["key"]
+	d.audit(audit.ActionUnblock, "", "").Detail = key
+	err := d.store.Limits.Unblock(key)
+	switch {
+	case errors.Is(err, fberrors.ErrNotExist):
+		return http.StatusNotFound, nil
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+})
@@ -0,0 +1,130 @@
+package fbhttp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestLoginLimits(t *testing.T) {
+	// The limits are kept in the auth database, opened in the working
+	// directory.
+	t.Chdir(t.TempDir())
+	fbAuth.DataBase()
+
+	key := []byte("test-signing-key")
+	st := scopedUserStorage(t, t.TempDir(), users.Permissions{Admin: true}, key)
+	admin := signToken(t, users.Permissions{Admin: true}, key)
+
+	user, err := st.Users.Get("", false, uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password, err = users.HashPwd("pw"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Users.Update(user, "Password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Auth.Save(&fbAuth.JSONAuth{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Settings.Save(&settings.Settings{
+		Key:         key,
+		AuthMethod:  fbAuth.MethodJSONAuth,
+		LoginLimits: settings.LoginLimits{Attempts: 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	back, err := fbAuth.NewLimitsBackend("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Limits = fbAuth.NewLimiter(back)
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.Handle("/login", handle(loginHandler(time.Hour), "", st, server))
+	router.Handle("/limits", handle(limitsGetHandler, "", st, server)).Methods("GET")
+	router.Handle("/limits/{key}", handle(limitsDeleteHandler, "", st, server)).Methods("DELETE")
+
+	// The clients are told apart by the address of their connection, whatever
+	// they forward.
+	forwarded := 0
+	login := func(username, password string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		encode := func(s string) string {
+			var b strings.Builder
+			for _, r := range s {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+			return b.String()
+		}
+		req := httptest.NewRequest(http.MethodPost, "/login", http.NoBody)
+		req.Header.Set("Authorization", base64.StdEncoding.EncodeToString([]byte(encode(username)+","+encode(password)+",,")))
+		forwarded++
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", forwarded))
+		req.Header.Set("X-Real-Ip", fmt.Sprintf("198.51.100.%d", forwarded))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("login of %q with %q: expected %d, got %d body=%q", username, password, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	do := func(method, url string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, url, http.NoBody)
+		req.Header.Set("X-Auth", admin)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	login("u", "wrong", http.StatusForbidden)
+	login("u", "wrong", http.StatusForbidden)
+	// Locked out clients aren't let in, even with the right password.
+	if rec := login("u", "pw", http.StatusTooManyRequests); rec.Header().Get("Retry-After") == "" {
+		t.Error("expected to be told when to retry")
+	}
+
+	var limits []fbAuth.LoginLimit
+	if err := json.NewDecoder(do(http.MethodGet, "/limits", http.StatusOK).Body).Decode(&limits); err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 2 || limits[0].Failures != 2 || !limits[0].Blocked(time.Now()) {
+		t.Fatalf("expected the client and user to be locked out, got %+v", limits)
+	}
+
+	for _, l := range limits {
+		do(http.MethodDelete, "/limits/"+url.PathEscape(l.Key), http.StatusNoContent)
+	}
+	do(http.MethodDelete, "/limits/"+url.PathEscape(limits[0].Key), http.StatusNotFound)
+	login("u", "pw", http.StatusOK)
+
+	login("a", "wrong", http.StatusForbidden)
+	login("b", "wrong", http.StatusForbidden)
+	login("u", "pw", http.StatusTooManyRequests)
+	if err := json.NewDecoder(do(http.MethodGet, "/limits", http.StatusOK).Body).Decode(&limits); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(limits, func(l fbAuth.LoginLimit) bool { return l.Key == fbAuth.LimitIPKey("192.0.2.1") }) {
+		t.Errorf("expected the client to be locked out by its connection, got %+v", limits)
+	}
+}
@@ -0,0 +1,250 @@
+package fbhttp
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+)
+
+const metricsNamespace = "filebrowser"
+
+// The metrics are counted whether they are served or not, which costs
+// nothing worth sparing.
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve the HTTP requests, by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	transferredBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "transferred_bytes_total",
+		Help:      "Bytes of files uploaded and downloaded, by direction and API.",
+	}, []string{"direction", "api"})
+
+	previewCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "preview_cache_lookups_total",
+		Help:      "Lookups of resized previews in the file cache, by result.",
+	}, []string{"result"})
+
+	searchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "search_duration_seconds",
+		Help:      "Time taken by the searches, by whether they used the index or walked the files.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	runningCommands = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "running_commands",
+		Help:      "Commands of the command runner currently running.",
+	})
+
+	failedLogins = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "failed_logins_total",
+		Help:      "Logins refused because of their credentials.",
+	})
+
+	loginLockouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "login_lockouts_total",
+		Help:      "Logins refused because their client or user was locked out.",
+	})
+)
+
+// The values of the labels of the metrics.
+const (
+	directionUpload   = "upload"
+	directionDownload = "download"
+
+	apiResources = "resources"
+	apiRaw       = "raw"
+	apiTus       = "tus"
+	apiPublicDl  = "public_dl"
+)
+
+// newMetricsRegistry returns the registry of the metrics served, along with
+// those read from the upload cache and image service of the handler.
+func newMetricsRegistry(imgSvc ImgService, uploadCache UploadCache) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		transferredBytes,
+		previewCacheLookups,
+		searchDuration,
+		runningCommands,
+		failedLogins,
+		loginLockouts,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_uploads",
+			Help:      "Chunked uploads started and not yet complete.",
+		}, func() float64 {
+			return float64(uploadCache.Active())
+		}),
+	)
+
+	if queue, ok := imgSvc.(interface{ Waiting() int }); ok {
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "image_resize_queue",
+			Help:      "Images waiting for a processor to be resized.",
+		}, func() float64 {
+			return float64(queue.Waiting())
+		}))
+	}
+	return registry
+}
+
+// metricsHandler serves the metrics to the admins, and to the scrapers given
+// the token of the server as a bearer token.
+func metricsHandler(registry *prometheus.Registry) handleFunc {
+	metrics := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && d.server.MetricsToken != "" &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(d.server.MetricsToken)) == 1 {
+			metrics.ServeHTTP(w, r)
+			return 0, nil
+		}
+
+		return withAdmin(func(w http.ResponseWriter, r *http.Request, _ *data) (int, error) {
+			metrics.ServeHTTP(w, r)
+			return 0, nil
+		})(w, r, d)
+	}
+}
+
+// measureRequests counts the requests served by each route and how long they
+// take.
+func measureRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Routes are labeled by their template, so that paths don't make up
+		// countless series.
+		route := "other"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := strconv.Itoa(rec.Status())
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder remembers the status of a response, while still letting the
+// handlers flush it and hijack its connection.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// Status returns the status of the response, 200 when it was left implicit.
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	_ = http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err == nil && s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// countingWriter counts the bytes of the files written to a response.
+type countingWriter struct {
+	http.ResponseWriter
+	counter prometheus.Counter
+}
+
+// countDownload counts the bytes of the files downloaded through api.
+func countDownload(w http.ResponseWriter, api string) http.ResponseWriter {
+	return &countingWriter{ResponseWriter: w, counter: transferredBytes.WithLabelValues(directionDownload, api)}
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.counter.Add(float64(n))
+	return n, err
+}
+
+func (c *countingWriter) Flush() {
+	_ = http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// countUpload counts the bytes of the files uploaded through api.
+func countUpload(api string, n int64) {
+	if n > 0 {
+		transferredBytes.WithLabelValues(directionUpload, api).Add(float64(n))
+	}
+}
+
+// countLogin counts the logins refused because of their credentials or a
+// lockout, as told by the error of the limiter.
+func countLogin(err error) {
+	var (
+		lockout *fbAuth.LockoutError
+		refused *fbAuth.LoginError
+	)
+	switch {
+	case errors.As(err, &lockout):
+		loginLockouts.Inc()
+	case errors.As(err, &refused):
+		failedLogins.Inc()
+	}
+}
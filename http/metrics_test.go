@@ -0,0 +1,76 @@
+package fbhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestMetrics(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scope, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Admin: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, key)
+	admin := signToken(t, perm, key)
+
+	uploads := newMemoryUploadCache()
+	defer uploads.Close()
+	server := &settings.Server{EnableMetrics: true, MetricsToken: "scraper-token"}
+	handler, err := NewHandler(nil, diskcache.NewNoOp(), uploads, nil, nil, nil, nil, nil, st, server, fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(url string, header http.Header, want int) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, url, http.NoBody)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("GET %s: expected %d, got %d body=%q", url, want, rec.Code, rec.Body.String())
+		}
+		body, _ := io.ReadAll(rec.Body)
+		return string(body)
+	}
+
+	downloaded := transferredBytes.WithLabelValues(directionDownload, apiRaw)
+	before := testutil.ToFloat64(downloaded)
+	if body := do("/api/raw/a.txt", http.Header{"X-Auth": {admin}}, http.StatusOK); body != "hello" {
+		t.Fatalf("expected the file, got %q", body)
+	}
+	if got := testutil.ToFloat64(downloaded) - before; got != 5 {
+		t.Errorf("expected the bytes downloaded to be counted, got %v", got)
+	}
+
+	// Only admins and scrapers given the token are served the metrics.
+	do("/metrics", http.Header{}, http.StatusUnauthorized)
+	do("/metrics", http.Header{"Authorization": {"Bearer wrong"}}, http.StatusUnauthorized)
+	do("/metrics", http.Header{"X-Auth": {admin}}, http.StatusOK)
+	body := do("/metrics", http.Header{"Authorization": {"Bearer scraper-token"}}, http.StatusOK)
+
+	for _, want := range []string{
+		`filebrowser_http_requests_total{method="GET",route="/api/raw",status="200"}`,
+		`filebrowser_transferred_bytes_total{api="raw",direction="download"}`,
+		`filebrowser_active_uploads 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the metrics to contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package fbhttp
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+)
+
+func withOIDC(fn func(w http.ResponseWriter, r *http.Request, d *data, auther *fbAuth.OIDCAuth) (int, error)) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if d.settings.AuthMethod != fbAuth.MethodOIDCAuth {
+			return http.StatusNotFound, nil
+		}
+
+		auther, err := d.store.Auth.Get(d.settings.AuthMethod)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return fn(w, r, d, auther.(*fbAuth.OIDCAuth))
+	}
+}
+
+// oidcLoginHandler redirects to the identity provider to sign in.
+var oidcLoginHandler = withOIDC(func(w http.ResponseWriter, r *http.Request, d *data, auther *fbAuth.OIDCAuth) (int, error) {
+	url, cookie, err := auther.AuthCodeURL(r, d.settings, d.server)
+	if err != nil {
+		log.Printf("Error: Failed to sign in with OIDC: %v", err)
+		return http.StatusInternalServerError, err
+	}
+
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, url, http.StatusFound)
+	return 0, nil
+})
+
+// oidcCallbackHandler is where the identity provider redirects back to once
+// signed in. The session it leaves is exchanged for a token on login.
+func oidcCallbackHandler(tokenExpireTime time.Duration) handleFunc {
+	return withOIDC(func(w http.ResponseWriter, r *http.Request, d *data, auther *fbAuth.OIDCAuth) (int, error) {
+		e := d.audit(audit.ActionLogin, "", "")
+		e.Detail = string(fbAuth.MethodOIDCAuth)
+
+		// The users aren't known until signed in, so only the clients are
+		// locked out.
+		ip := fbAuth.LimitIPKey(fbAuth.ClientIP(r, d.settings.LoginLimits))
+		var lockout *fbAuth.LockoutError
+		if err := d.store.Limits.Check(ip); errors.As(err, &lockout) {
+			loginLockouts.Inc()
+			return lockedOut(w, lockout)
+		}
+
+		cookie, err := auther.Exchange(r, d.settings, d.server, tokenExpireTime)
+		http.SetCookie(w, expiredCookie(d, fbAuth.OIDCStateCookie))
+		switch {
+		case errors.Is(err, os.ErrPermission):
+			log.Printf("Warning: Refused OIDC sign in: %v", err)
+			failedLogins.Inc()
+			if err := d.store.Limits.Fail(d.settings.LoginLimits, ip); err != nil {
+				log.Printf("Warning: Failed to count the failed login of %s: %v", ip, err)
+			}
+			return http.StatusForbidden, nil
+		case err != nil:
+			log.Printf("Error: Failed to sign in with OIDC: %v", err)
+			return http.StatusInternalServerError, err
+		}
+
+		http.SetCookie(w, cookie)
+		http.Redirect(w, r, d.server.BaseURL+"/", http.StatusFound)
+		e.Status = http.StatusFound
+		return 0, nil
+	})
+}
+
+func expiredCookie(d *data, name string) *http.Cookie {
+	return &http.Cookie{Name: name, Path: d.server.BaseURL + "/", MaxAge: -1, HttpOnly: true}
+}
@@ -0,0 +1,174 @@
+package fbhttp
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"net/http"
+
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+const otpQRSize = 256
+
+type otpStatus struct {
+	Enrolled      bool `json:"enrolled"`
+	Pending       bool `json:"pending"`
+	Required      bool `json:"required"`
+	RecoveryCodes int  `json:"recoveryCodes"`
+}
+
+type otpEnrollment struct {
+	URI    string `json:"uri"`
+	Secret string `json:"secret"`
+}
+
+type otpRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
+
+// withOtpUser serves the user of the route to themselves, even when they must
+// enroll an authenticator first, and to admins if admin is set. The user is
+// given as d.raw. Personal API tokens can't be used to manage authenticators.
+func withOtpUser(admin bool, fn handleFunc) handleFunc {
+	return withEnrollingUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if d.settings.AuthMethod != fbAuth.MethodJSONAuth {
+			return http.StatusNotFound, nil
+		}
+		if d.token != nil {
+			return http.StatusForbidden, nil
+		}
+
+		id, err := getUserID(r)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if d.user.ID == id {
+			d.raw = d.user
+			return fn(w, r, d)
+		}
+
+		if !admin || !d.user.Perm.Admin || mustEnrollOtp(d, d.user) {
+			return http.StatusForbidden, nil
+		}
+		user, err := d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, id)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		d.raw = user
+		return fn(w, r, d)
+	})
+}
+
+func decodeOtpRequest(w http.ResponseWriter, r *http.Request) (*otpRequest, error) {
+	if r.Body == nil {
+		return nil, fberrors.ErrEmptyRequest
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAuthBodySize)
+
+	var req otpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+var otpGetHandler = withOtpUser(true, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	user := d.raw.(*users.User)
+	return renderJSON(w, r, otpStatus{
+		Enrolled:      user.TOTP.Enrolled(),
+		Pending:       user.TOTP.Pending != "",
+		Required:      user.SecondFactor == users.SecondFactorTOTP,
+		RecoveryCodes: len(user.TOTP.RecoveryCodes),
+	})
+})
+
+// otpEnrollHandler begins enrolling a new authenticator, which is only used
+// once one of its codes is verified.
+var otpEnrollHandler = withOtpUser(false, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	req, err := decodeOtpRequest(w, r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if !users.CheckPwd(req.CurrentPassword, d.user.Password) {
+		return http.StatusBadRequest, fberrors.ErrCurrentPasswordIncorrect
+	}
+
+	key, err := d.user.EnrollOtp(cmp.Or(d.settings.Branding.Name, "File Browser"))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := d.store.Users.Update(d.user, "TOTP"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	return renderJSON(w, r, otpEnrollment{URI: key.URL(), Secret: key.Secret()})
+})
+
+// otpQRHandler renders the authenticator being enrolled as a QR code.
+var otpQRHandler = withOtpUser(false, func(w http.ResponseWriter, _ *http.Request, d *data) (int, error) {
+	key, err := d.user.PendingOtp()
+	if err != nil {
+		return errToStatus(err), err
+	}
+	img, err := key.Image(otpQRSize, otpQRSize)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := png.Encode(w, img); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+})
+
+// otpVerifyHandler completes enrolling an authenticator with one of its codes,
+// responding with the recovery codes of the user. They are only ever shown
+// then.
+var otpVerifyHandler = withOtpUser(false, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	req, err := decodeOtpRequest(w, r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	codes, err := d.user.VerifyOtp(req.Code)
+	switch {
+	case errors.Is(err, fberrors.ErrInvalidOtp):
+		return http.StatusBadRequest, err
+	case err != nil:
+		return errToStatus(err), err
+	}
+	if err := d.store.Users.Update(d.user, "TOTP"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	return renderJSON(w, r, map[string][]string{"recoveryCodes": codes})
+})
+
+// otpDeleteHandler removes the authenticator of a user, so that admins can let
+// in those who lost theirs. Users required to prove one-time passwords enroll
+// a new one on their next login.
+var otpDeleteHandler = withOtpUser(true, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	req, err := decodeOtpRequest(w, r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if !users.CheckPwd(req.CurrentPassword, d.user.Password) {
+		return http.StatusBadRequest, fberrors.ErrCurrentPasswordIncorrect
+	}
+
+	user := d.raw.(*users.User)
+	user.TOTP = users.TOTP{}
+	if err := d.store.Users.Update(user, "TOTP"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+})
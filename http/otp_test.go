@@ -0,0 +1,132 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pquerna/otp/totp"
+
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestOtpHandlers(t *testing.T) {
+	key := []byte("test-signing-key")
+	st := scopedUserStorage(t, t.TempDir(), users.Permissions{}, key)
+	signed := signToken(t, users.Permissions{}, key)
+
+	s, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AuthMethod = fbAuth.MethodJSONAuth
+	if err := st.Settings.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	u, err := st.Users.Get("", false, uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Password, err = users.HashPwd("password"); err != nil {
+		t.Fatal(err)
+	}
+	u.SecondFactor = users.SecondFactorTOTP
+	if err := st.Users.Update(u, "Password", "SecondFactor"); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.Handle("/credentials", handle(passkeyListHandler, "", st, server)).Methods("GET")
+	router.Handle("/{id:[0-9]+}/otp", handle(otpGetHandler, "", st, server)).Methods("GET")
+	router.Handle("/{id:[0-9]+}/otp", handle(otpEnrollHandler, "", st, server)).Methods("POST")
+	router.Handle("/{id:[0-9]+}/otp", handle(otpDeleteHandler, "", st, server)).Methods("DELETE")
+	router.Handle("/{id:[0-9]+}/otp/qr", handle(otpQRHandler, "", st, server)).Methods("GET")
+	router.Handle("/{id:[0-9]+}/otp/verify", handle(otpVerifyHandler, "", st, server)).Methods("POST")
+
+	do := func(method, url, body string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		var r io.Reader = http.NoBody
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, url, r)
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	status := func() otpStatus {
+		t.Helper()
+		var s otpStatus
+		if err := json.NewDecoder(do(http.MethodGet, "/1/otp", "", http.StatusOK).Body).Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// Until they enroll an authenticator, users can't do anything else.
+	do(http.MethodGet, "/credentials", "", http.StatusForbidden)
+	if s := status(); !s.Required || s.Enrolled || s.Pending {
+		t.Errorf("expected an authenticator to be required, got %+v", s)
+	}
+	do(http.MethodGet, "/2/otp", "", http.StatusForbidden)
+	do(http.MethodGet, "/1/otp/qr", "", http.StatusNotFound)
+
+	do(http.MethodPost, "/1/otp", `{"current_password":"wrong"}`, http.StatusBadRequest)
+	var enrollment otpEnrollment
+	if err := json.NewDecoder(do(http.MethodPost, "/1/otp", `{"current_password":"password"}`, http.StatusOK).Body).Decode(&enrollment); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || enrollment.Secret == "" {
+		t.Errorf("unexpected enrollment %+v", enrollment)
+	}
+	if s := status(); !s.Pending || s.Enrolled {
+		t.Errorf("expected the authenticator to be pending, got %+v", s)
+	}
+
+	rec := do(http.MethodGet, "/1/otp/qr", "", http.StatusOK)
+	if rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("expected a png, got %q", rec.Header().Get("Content-Type"))
+	}
+	if img, err := png.Decode(rec.Body); err != nil || img.Bounds().Dx() != otpQRSize {
+		t.Errorf("expected a QR code, got %v", err)
+	}
+
+	do(http.MethodPost, "/1/otp/verify", `{"code":"000000"}`, http.StatusBadRequest)
+	code, err := totp.GenerateCode(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verified struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	if err := json.NewDecoder(do(http.MethodPost, "/1/otp/verify", `{"code":"`+code+`"}`, http.StatusOK).Body).Decode(&verified); err != nil {
+		t.Fatal(err)
+	}
+	if len(verified.RecoveryCodes) == 0 {
+		t.Error("expected recovery codes")
+	}
+	if s := status(); !s.Enrolled || s.Pending || s.RecoveryCodes != len(verified.RecoveryCodes) {
+		t.Errorf("expected the authenticator to be enrolled, got %+v", s)
+	}
+	do(http.MethodGet, "/credentials", "", http.StatusOK)
+
+	do(http.MethodDelete, "/1/otp", `{"current_password":"wrong"}`, http.StatusBadRequest)
+	do(http.MethodDelete, "/1/otp", `{"current_password":"password"}`, http.StatusNoContent)
+	if s := status(); s.Enrolled || s.RecoveryCodes != 0 {
+		t.Errorf("expected the authenticator to be removed, got %+v", s)
+	}
+	do(http.MethodGet, "/credentials", "", http.StatusForbidden)
+}
@@ -35,7 +35,7 @@ type FileCache interface {
 }
 
 func previewHandler(imgSvc ImgService, fileCache FileCache, enableThumbnails, resizePreview bool) handleFunc {
-	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		if !d.user.Perm.Download {
 			return http.StatusAccepted, nil
 		}
@@ -97,7 +97,10 @@ func handleImagePreview(
 	if err != nil {
 		return errToStatus(err), err
 	}
-	if !ok {
+	if ok {
+		previewCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		previewCacheLookups.WithLabelValues("miss").Inc()
 		resizedImage, err = createPreview(imgSvc, fileCache, file, previewSize)
 		if err != nil {
 			return errToStatus(err), err
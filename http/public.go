@@ -3,24 +3,42 @@ package fbhttp
 import (
 	"crypto/subtle"
 	"errors"
+	"io/fs"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/mholt/archives"
+	"github.com/spf13/afero"
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	"github.com/thevickypedia/filebrowser/v2/files"
 	"github.com/thevickypedia/filebrowser/v2/share"
+	"github.com/tomasen/realip"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var withHashFile = func(fn handleFunc) handleFunc {
+var withHashFile = func(action string, fn handleFunc) handleFunc {
 	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		id, ifPath := ifPathWithName(r)
 		link, err := d.store.Share.GetByHash(id)
 		if err != nil {
 			return errToStatus(err), err
 		}
+		// The files of file requests are never shown to those uploading them.
+		if link.Upload {
+			return http.StatusNotFound, nil
+		}
+
+		// Recorded before the owner of the share is set as the user, since
+		// whoever has the link accesses it.
+		e := d.audit(action, link.Path, "")
+		e.Share = link.Hash
 
 		status, err := authenticateShareRequest(r, link)
 		if status != 0 || err != nil {
@@ -38,9 +56,32 @@ var withHashFile = func(fn handleFunc) handleFunc {
 
 		d.user = user
 
+		// The members of collections are served as if each was shared on its
+		// own, under its name, the root of the collection only listing them.
+		sharedPath := link.Path
+		if link.IsCollection() {
+			name, rest, _ := strings.Cut(strings.TrimPrefix(ifPath, "/"), "/")
+			if name == "" {
+				file, err := collectionInfo(d, link)
+				if err != nil {
+					return errToStatus(err), err
+				}
+				d.raw = file
+				d.collection = link
+				return serveShareAccess(w, r, d, link, action, e.Source, fn)
+			}
+
+			member, ok := link.Member(name)
+			if !ok {
+				return http.StatusNotFound, nil
+			}
+			sharedPath, ifPath = member, "/"+rest
+			e.Source = member
+		}
+
 		file, err := files.NewFileInfo(&files.FileOptions{
 			Fs:         d.user.Fs,
-			Path:       link.Path,
+			Path:       sharedPath,
 			Modify:     d.user.Perm.Modify,
 			Expand:     false,
 			ReadHeader: d.server.TypeDetectionByHeader,
@@ -53,14 +94,15 @@ var withHashFile = func(fn handleFunc) handleFunc {
 		}
 
 		// share base path
-		basePath := link.Path
+		basePath := sharedPath
 
 		// file relative path
 		filePath := ""
 
 		if file.IsDir {
-			basePath = filepath.Clean(link.Path)
+			basePath = filepath.Clean(sharedPath)
 			filePath = ifPath
+			e.Source = path.Join(basePath, filePath)
 		}
 
 		// set fs root to the shared file/folder. Unless external symlinks are
@@ -89,15 +131,252 @@ var withHashFile = func(fn handleFunc) handleFunc {
 
 		if file.IsDir {
 			// extract name from the last directory in the path
-			name := filepath.Base(strings.TrimRight(link.Path, string(filepath.Separator)))
+			name := filepath.Base(strings.TrimRight(sharedPath, string(filepath.Separator)))
 			file.Name = name
 		}
 
 		d.raw = file
-		return fn(w, r, d)
+		return serveShareAccess(w, r, d, link, action, e.Source, fn)
 	}
 }
 
+// collectionInfo returns the directory a collection is presented as, listing
+// its members by their names. The members the rules deny, or removed since,
+// are left out.
+func collectionInfo(d *data, link *share.Link) (*files.FileInfo, error) {
+	dir := &files.FileInfo{
+		Listing: &files.Listing{Items: []*files.FileInfo{}},
+		Fs:      d.user.Fs,
+		Path:    "/",
+		Name:    link.Name,
+		Mode:    fs.ModeDir | 0o755,
+		IsDir:   true,
+		Token:   link.Token,
+	}
+
+	for _, member := range link.Paths {
+		md, afs := collectionMember(d, member)
+		opts := &files.FileOptions{
+			Fs:         afs,
+			Path:       "/",
+			Modify:     d.user.Perm.Modify,
+			ReadHeader: d.server.TypeDetectionByHeader,
+			Checker:    md,
+			Token:      link.Token,
+		}
+		item, err := files.NewFileInfo(opts)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if item.IsDir {
+			dir.NumDirs++
+		} else {
+			// The type of the files is detected as in the listings.
+			opts.Expand = true
+			if item, err = files.NewFileInfo(opts); err != nil {
+				return nil, err
+			}
+			dir.NumFiles++
+		}
+		item.Name = path.Base(member)
+		item.Path = "/" + item.Name
+		dir.Items = append(dir.Items, item)
+		if item.ModTime.After(dir.ModTime) {
+			dir.ModTime = item.ModTime
+		}
+	}
+	return dir, nil
+}
+
+// collectionMember returns the data and the filesystem a member of a
+// collection is served with, confined to the member like a share of its own
+// so that the symbolic links within it don't reach out of it.
+func collectionMember(d *data, member string) (*data, afero.Fs) {
+	md := *d
+	md.checkerPrefix = d.scopePath(member)
+	return &md, files.NewFs(d.user.Fs, member, d.server.FollowExternalSymlinks)
+}
+
+// sharesMu serializes the updates of the counters of the shares, so that
+// their limits hold under concurrent requests.
+var sharesMu sync.Mutex
+
+// updateShare updates the share as it is stored.
+func updateShare(d *data, hash string, fn func(l *share.Link) error) error {
+	sharesMu.Lock()
+	defer sharesMu.Unlock()
+
+	link, err := d.store.Share.GetByHash(hash)
+	if err != nil {
+		return err
+	}
+	if err := fn(link); err != nil {
+		return err
+	}
+	return d.store.Share.Save(link)
+}
+
+// serveShareAccess has fn serve the file of the share, counting the access
+// against the limits of the share and recording it in its access log. Only
+// the visits of the root of the share count, and the downloads but for those
+// resuming one: the partial contents not starting at the first byte. The
+// downloads are counted once their response is known, before it is written.
+func serveShareAccess(w http.ResponseWriter, r *http.Request, d *data, link *share.Link, action, file string, fn handleFunc) (int, error) {
+	kind := share.AccessVisit
+	if action == audit.ActionShareDownload {
+		kind = share.AccessDownload
+	}
+
+	// count counts the access, returning the status refusing it if it can't
+	// be counted.
+	count := func() (int, error) {
+		err := updateShare(d, link.Hash, func(l *share.Link) error {
+			return l.Count(kind)
+		})
+		if errors.Is(err, share.ErrUsedUp) {
+			// Used up shares are revoked, as expired ones are.
+			if err := d.store.Share.Delete(link.Hash); err != nil {
+				return errToStatus(err), err
+			}
+			return http.StatusNotFound, nil
+		}
+		if err != nil {
+			return errToStatus(err), err
+		}
+		return 0, nil
+	}
+
+	counted := false
+	aw := &accessWriter{ResponseWriter: w}
+	switch {
+	case kind == share.AccessDownload:
+		aw.admit = func(status int) (int, error) {
+			if status >= 400 || (status == http.StatusPartialContent && resumed(aw.Header())) {
+				return 0, nil
+			}
+			refused, err := count()
+			counted = refused == 0 && err == nil
+			return refused, err
+		}
+	case file == path.Clean(link.Path):
+		if status, err := count(); status != 0 || err != nil {
+			return status, err
+		}
+		counted = true
+	}
+
+	status, err := fn(aw, r, d)
+	if aw.refused != 0 {
+		// The refusal was written instead of the response, and isn't an
+		// access, like the visits refused.
+		if d.event != nil {
+			d.event.Status = aw.refused
+		}
+		return 0, aw.refusedErr
+	}
+	failed := status >= 400 || err != nil
+	if counted && failed {
+		uncountErr := updateShare(d, link.Hash, func(l *share.Link) error {
+			l.Uncount(kind)
+			return nil
+		})
+		if uncountErr != nil {
+			log.Printf("Warning: Failed to uncount a %s of the share %s: %v", kind, link.Hash, uncountErr)
+		}
+	}
+
+	access := &share.Access{
+		Hash:      link.Hash,
+		UserID:    link.UserID,
+		Kind:      kind,
+		Time:      time.Now(),
+		IP:        realip.FromRequest(r),
+		UserAgent: r.UserAgent(),
+		File:      file,
+		Bytes:     aw.bytes,
+		Status:    status,
+	}
+	switch {
+	case status != 0:
+	case err != nil:
+		access.Status = http.StatusInternalServerError
+	case aw.status != 0:
+		access.Status = aw.status
+	default:
+		access.Status = http.StatusOK
+	}
+	if err := d.store.Share.SaveAccess(access); err != nil {
+		log.Printf("Warning: Failed to record a %s of the share %s: %v", kind, link.Hash, err)
+	}
+	return status, err
+}
+
+// resumed reports whether the partial content with the header resumes a
+// download, not starting at its first byte. The contents of several ranges
+// have none in their header and are never taken for resumed ones.
+func resumed(header http.Header) bool {
+	rng := header.Get("Content-Range")
+	return rng != "" && !strings.HasPrefix(rng, "bytes 0-")
+}
+
+// errAccessRefused is returned when writing a response that was refused.
+var errAccessRefused = errors.New("the access was refused")
+
+// accessWriter keeps track of the status and the bytes of a response. If
+// admit is set, it is given the status of the response before it is written
+// and may refuse it with another status, which is written instead.
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+
+	admit      func(status int) (int, error)
+	refused    int
+	refusedErr error
+}
+
+func (a *accessWriter) WriteHeader(status int) {
+	if a.status != 0 {
+		if a.refused == 0 {
+			a.ResponseWriter.WriteHeader(status)
+		}
+		return
+	}
+	a.status = status
+
+	if a.admit != nil {
+		a.refused, a.refusedErr = a.admit(status)
+	}
+	if a.refused != 0 {
+		for _, key := range []string{"Content-Range", "Content-Disposition", "Etag", "Last-Modified"} {
+			a.Header().Del(key)
+		}
+		http.Error(a.ResponseWriter, strconv.Itoa(a.refused)+" "+http.StatusText(a.refused), a.refused)
+		return
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *accessWriter) Write(p []byte) (int, error) {
+	if a.status == 0 {
+		a.WriteHeader(http.StatusOK)
+	}
+	if a.refused != 0 {
+		return 0, errAccessRefused
+	}
+	n, err := a.ResponseWriter.Write(p)
+	a.bytes += int64(n)
+	return n, err
+}
+
+func (a *accessWriter) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
 // ref to https://github.com/thevickypedia/filebrowser/pull/727
 // `/api/public/dl/MEEuZK-v/file-name.txt` for old browsers to save file with correct name
 func ifPathWithName(r *http.Request) (id, filePath string) {
@@ -113,7 +392,7 @@ func ifPathWithName(r *http.Request) (id, filePath string) {
 	}
 }
 
-var publicShareHandler = withHashFile(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+var publicShareHandler = withHashFile(audit.ActionShareView, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	file := d.raw.(*files.FileInfo)
 
 	if file.IsDir {
@@ -125,8 +404,12 @@ var publicShareHandler = withHashFile(func(w http.ResponseWriter, r *http.Reques
 	return renderJSON(w, r, file)
 })
 
-var publicDlHandler = withHashFile(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+var publicDlHandler = withHashFile(audit.ActionShareDownload, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	file := d.raw.(*files.FileInfo)
+	w = countDownload(w, apiPublicDl)
+	if d.collection != nil {
+		return collectionDirHandler(w, r, d, file)
+	}
 	if !file.IsDir {
 		return rawFileHandler(w, r, file)
 	}
@@ -165,3 +448,80 @@ func healthHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(`{"status":"OK"}`))
 }
+
+// collectionDirHandler downloads the members of the collection the files
+// query parameter names, or all of them, as an archive named after the
+// collection, or after the member when only one is.
+func collectionDirHandler(w http.ResponseWriter, r *http.Request, d *data, file *files.FileInfo) (int, error) {
+	filenames, err := parseQueryFiles(r, file, d.user)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	extension, archiver, err := parseQueryAlgorithm(r)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	var members []string
+	for _, name := range filenames {
+		if name == "/" {
+			members = d.collection.Paths
+			break
+		}
+		if member, ok := d.collection.Member(strings.TrimPrefix(name, "/")); ok {
+			members = append(members, member)
+		}
+	}
+
+	var allFiles []archives.FileInfo
+	for _, member := range members {
+		archiveFiles, err := getMemberFiles(d, member)
+		if err != nil {
+			log.Printf("Failed to get files from %s: %v", member, err)
+			continue
+		}
+		allFiles = append(allFiles, archiveFiles...)
+	}
+
+	name := file.Name
+	if len(members) == 1 {
+		name = path.Base(members[0])
+	}
+	return writeArchive(w, r, name+extension, archiver, allFiles)
+}
+
+// getMemberFiles returns the files of a member of a collection, archived under
+// the name of the member as it is listed.
+func getMemberFiles(d *data, member string) ([]archives.FileInfo, error) {
+	md, afs := collectionMember(d, member)
+	if !md.Check("/") {
+		return nil, nil
+	}
+
+	info, err := afs.Stat("/")
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(member)
+	archiveFiles := []archives.FileInfo{{
+		FileInfo:      info,
+		NameInArchive: name,
+		Open: func() (fs.File, error) {
+			return afs.Open("/")
+		},
+	}}
+	if !info.IsDir() {
+		return archiveFiles, nil
+	}
+
+	within, err := getFiles(md, afs, "/", "/")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range within {
+		f.NameInArchive = name + "/" + f.NameInArchive
+		archiveFiles = append(archiveFiles, f)
+	}
+	return archiveFiles, nil
+}
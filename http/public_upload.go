@@ -0,0 +1,174 @@
+package fbhttp
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+	"github.com/thevickypedia/filebrowser/v2/files"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/search"
+	"github.com/thevickypedia/filebrowser/v2/share"
+	"github.com/thevickypedia/filebrowser/v2/users"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+)
+
+// fileRequestResponse is what whoever has the link of a file request is told
+// about it, nothing of what it holds.
+type fileRequestResponse struct {
+	Name        string   `json:"name"`
+	HasPassword bool     `json:"hasPassword"`
+	MaxFiles    uint     `json:"maxFiles"`
+	MaxBytes    int64    `json:"maxBytes"`
+	Extensions  []string `json:"extensions"`
+	Files       uint     `json:"files"`
+	Bytes       int64    `json:"bytes"`
+}
+
+// withFileRequest serves the uploads to a file request on behalf of its owner,
+// whose filesystem is rebased onto the directory shared. The path of the
+// request becomes the name of the file uploaded, within that directory.
+func withFileRequest(action string, fn handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		id, name := ifPathWithName(r)
+		link, err := d.store.Share.GetByHash(id)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		// The other shares are not told apart from those that don't exist.
+		if !link.Upload {
+			return http.StatusNotFound, nil
+		}
+
+		if action != "" {
+			d.audit(action, link.Path, "")
+		}
+		defer func(e *audit.Event) {
+			// The events are those of whoever has the link, not of the
+			// owner, with the paths of the owner.
+			if d.event == nil {
+				return
+			}
+			if d.event != e {
+				d.event.Source = path.Join(link.Path, d.event.Source)
+			}
+			d.event.User = ""
+			d.event.Share = link.Hash
+		}(d.event)
+
+		status, err := authenticateShareRequest(r, link)
+		if status != 0 || err != nil {
+			return status, err
+		}
+
+		user, err := d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, link.UserID)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		if !user.Perm.Share || !user.Perm.Create {
+			return http.StatusForbidden, nil
+		}
+
+		info, err := user.Fs.Stat(link.Path)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		if !info.IsDir() {
+			return http.StatusNotFound, nil
+		}
+
+		// Whoever has the link can only add files, never replace any, and
+		// they are charged to the whole scope of the owner.
+		d.scopeRoot = user.FullPath("/")
+		user.Perm = users.Permissions{Create: true}
+		user.Fs = files.NewFs(user.Fs, link.Path, d.server.FollowExternalSymlinks)
+		d.user = user
+		d.checkerPrefix = link.Path
+		d.fileRequest = link
+
+		r.URL.Path = path.Join("/", path.Base(name))
+		r.URL.RawPath = ""
+		return fn(w, r, d)
+	}
+}
+
+// uploadToFileRequest reserves a file of the size in the file request, then
+// has fn upload it under a name no other file has. The size is unknown when
+// negative, which only file requests limiting no bytes accept.
+func uploadToFileRequest(w http.ResponseWriter, r *http.Request, d *data, size int64, fn handleFunc) (int, error) {
+	link := d.fileRequest
+	if r.URL.Path == "/" || !link.AllowsName(r.URL.Path) {
+		return http.StatusForbidden, nil
+	}
+	if size < 0 {
+		if link.MaxBytes != 0 {
+			return http.StatusLengthRequired, nil
+		}
+		size = 0
+	}
+
+	err := updateShare(d, link.Hash, func(l *share.Link) error {
+		return l.Reserve(size)
+	})
+	if errors.Is(err, share.ErrRequestFull) {
+		return http.StatusRequestEntityTooLarge, err
+	}
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	r.URL.Path = addVersionSuffix(r.URL.Path, d.user.Fs)
+	status, err := fn(w, r, d)
+	if status >= 400 || err != nil {
+		releaseErr := updateShare(d, link.Hash, func(l *share.Link) error {
+			l.Release(size)
+			return nil
+		})
+		if releaseErr != nil {
+			log.Printf("Warning: Failed to release an upload to the file request %s: %v", link.Hash, releaseErr)
+		}
+	}
+	return status, err
+}
+
+var publicUploadInfoHandler = withFileRequest("", func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	link := d.fileRequest
+	return renderJSON(w, r, &fileRequestResponse{
+		Name:        path.Base(link.Path),
+		HasPassword: link.PasswordHash != "",
+		MaxFiles:    link.MaxFiles,
+		MaxBytes:    link.MaxBytes,
+		Extensions:  link.Extensions,
+		Files:       link.Files,
+		Bytes:       link.Bytes,
+	})
+})
+
+func publicUploadHandler(fileCache FileCache, searchIndex *search.Index, quotas *quota.Tracker, history *versions.History) handleFunc {
+	post := resourcePost(fileCache, searchIndex, quotas, history)
+	return withFileRequest(audit.ActionUpload, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		return uploadToFileRequest(w, r, d, r.ContentLength, post)
+	})
+}
+
+func publicTusPostHandler(cache UploadCache, quotas *quota.Tracker, history *versions.History) handleFunc {
+	post := tusPost(cache, quotas, history)
+	// The upload is recorded once complete, as those of the users.
+	return withFileRequest("", func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		uploadLength, err := getUploadLength(r)
+		if err != nil || uploadLength < 0 {
+			return http.StatusBadRequest, err
+		}
+		return uploadToFileRequest(w, r, d, uploadLength, post)
+	})
+}
+
+func publicTusHeadHandler(cache UploadCache) handleFunc {
+	return withFileRequest("", tusHead(cache))
+}
+
+func publicTusPatchHandler(cache UploadCache, searchIndex *search.Index, quotas *quota.Tracker) handleFunc {
+	return withFileRequest("", tusPatch(cache, searchIndex, quotas))
+}
@@ -0,0 +1,180 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/share"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestFileRequest(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(scope, "inbox"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(scope, "inbox", "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	perm := users.Permissions{Create: true, Share: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, []byte("test-signing-key"))
+	link := &share.Link{
+		Hash:       "request",
+		Path:       "/inbox",
+		UserID:     1,
+		Upload:     true,
+		MaxFiles:   2,
+		MaxBytes:   10,
+		Extensions: []string{".txt"},
+	}
+	if err := st.Share.Save(link); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &settings.Server{}
+	upload := handle(publicUploadHandler(diskcache.NewNoOp(), nil, nil, nil), "/api/public/upload/", st, server)
+	post := func(name, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/public/upload/request/"+name, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		upload.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post("a.exe", "a"); code != http.StatusForbidden {
+		t.Fatalf("expected the extension to be refused with 403, got %d", code)
+	}
+	if code := post("secret.txt", "new"); code != http.StatusOK {
+		t.Fatalf("expected the upload to succeed, got %d", code)
+	}
+	if content, _ := os.ReadFile(filepath.Join(scope, "inbox", "secret.txt")); string(content) != "secret" {
+		t.Fatalf("expected the file of the same name to be left as it was, got %q", content)
+	}
+	if content, _ := os.ReadFile(filepath.Join(scope, "inbox", "secret(1).txt")); string(content) != "new" {
+		t.Fatalf("expected the upload to be renamed, got %q", content)
+	}
+	if code := post("../escape.txt", "b"); code != http.StatusOK {
+		t.Fatalf("expected the upload to succeed, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(scope, "inbox", "escape.txt")); err != nil {
+		t.Fatalf("expected the upload to be kept in the directory requested: %v", err)
+	}
+	if code := post("c.txt", "c"); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the third file to be refused with 413, got %d", code)
+	}
+
+	link, err := st.Share.GetByHash("request")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Files != 2 || link.Bytes != 4 {
+		t.Fatalf("expected 2 files of 4 bytes to be counted, got %d files of %d bytes", link.Files, link.Bytes)
+	}
+
+	// The files are never listed nor downloaded through the link.
+	for _, h := range []handleFunc{publicShareHandler, publicDlHandler} {
+		rec := httptest.NewRecorder()
+		handle(h, "/api/public/share/", st, server).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/public/share/request/secret.txt", http.NoBody))
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected the file request not to be shared, got %d", rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handle(publicUploadInfoHandler, "/api/public/upload/", st, server).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/public/upload/request", http.NoBody))
+	var info fileRequestResponse
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "inbox" || info.Files != 2 || info.MaxFiles != 2 {
+		t.Fatalf("unexpected file request %+v", info)
+	}
+}
+
+func TestFileRequestQuota(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(scope, "inbox"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(scope, "kept.txt"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	perm := users.Permissions{Create: true, Share: true}
+	st := scopedUserStorage(t, scope, perm, []byte("test-signing-key"))
+	user, err := st.Users.Get("", false, uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Quota = users.Quota{Bytes: 6}
+	if err := st.Users.Update(user, "Quota"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Share.Save(&share.Link{Hash: "request", Path: "/inbox", UserID: 1, Upload: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The uploads are charged to the whole scope of the owner, not to the
+	// directory requested.
+	upload := handle(publicUploadHandler(diskcache.NewNoOp(), nil, quota.NewTracker(), nil), "/api/public/upload/", st, &settings.Server{})
+	rec := httptest.NewRecorder()
+	upload.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/public/upload/request/a.txt", strings.NewReader("ab")))
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected the quota of the owner to be exceeded with 507, got %d", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(scope, "inbox", "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be uploaded, got %v", err)
+	}
+}
+
+func TestFileRequestTus(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(scope, "inbox"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	perm := users.Permissions{Create: true, Share: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, []byte("test-signing-key"))
+	if err := st.Share.Save(&share.Link{Hash: "request", Path: "/inbox", UserID: 1, Upload: true, MaxBytes: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &settings.Server{}
+	cache := newMemoryUploadCache()
+	create := func(length string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/public/tus/request/a.bin", http.NoBody)
+		req.Header.Set("Upload-Length", length)
+		rec := httptest.NewRecorder()
+		handle(publicTusPostHandler(cache, nil, nil), "/api/public/tus/", st, server).ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := create("6"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected the upload past the bytes requested to be refused, got %d", rec.Code)
+	}
+	rec := create("5")
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/api/public/tus/request/a.bin" {
+		t.Fatalf("expected the upload to be created, got %d at %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/public/tus/request/a.bin", strings.NewReader("hello, too long"))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "0")
+	rec = httptest.NewRecorder()
+	handle(publicTusPatchHandler(cache, nil, nil), "/api/public/tus/", st, server).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the chunk to be written, got %d", rec.Code)
+	}
+	if content, _ := os.ReadFile(filepath.Join(scope, "inbox", "a.bin")); string(content) != "hello" {
+		t.Fatalf("expected the upload to stop at its length, got %q", content)
+	}
+}
@@ -0,0 +1,103 @@
+package fbhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestResourceQuota(t *testing.T) {
+	userScope := t.TempDir()
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Create: true, Modify: true, Rename: true}
+	st := scopedUserStorage(t, userScope, perm, key)
+	signed := signToken(t, perm, key)
+
+	user, err := st.Users.Get("", false, uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Quota = users.Quota{Bytes: 10, Files: 3}
+	if user.Password, err = users.HashPwd("pw"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Users.Update(user, "Quota", "Password"); err != nil {
+		t.Fatal(err)
+	}
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.AuthMethod = auth.MethodJSONAuth
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Auth.Save(&auth.JSONAuth{}); err != nil {
+		t.Fatal(err)
+	}
+
+	quotas := quota.NewTracker()
+	server := &settings.Server{WebDAVPrefix: "/dav"}
+	post := handle(resourcePostHandler(diskcache.NewNoOp(), nil, quotas, nil), "", st, server)
+	patch := handle(resourcePatchHandler(diskcache.NewNoOp(), nil, quotas, nil, nil), "", st, server)
+	tusPost := handle(tusPostHandler(newMemoryUploadCache(), quotas, nil), "", st, server)
+	dav := handle(webdavHandler(diskcache.NewNoOp(), nil, quotas, nil, nil), "", st, server)
+
+	steps := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		url     string
+		body    string
+		header  map[string]string
+		want    int
+	}{
+		{"upload", post, http.MethodPost, "/a.txt", "12345", nil, http.StatusOK},
+		{"upload beyond bytes", post, http.MethodPost, "/b.txt", "123456", nil, http.StatusInsufficientStorage},
+		{"override within bytes", post, http.MethodPost, "/a.txt?override=true", "1234567", nil, http.StatusOK},
+		{"copy beyond bytes", patch, http.MethodPatch, "/a.txt?action=copy&destination=/c.txt", "", nil, http.StatusInsufficientStorage},
+		{"rename", patch, http.MethodPatch, "/a.txt?action=rename&destination=/d.txt", "", nil, http.StatusOK},
+		{"empty upload", post, http.MethodPost, "/e.txt", "", nil, http.StatusOK},
+		{"webdav mkdir", dav, "MKCOL", "/dav/g", "", nil, http.StatusCreated},
+		{"upload beyond files", post, http.MethodPost, "/f.txt", "", nil, http.StatusInsufficientStorage},
+		{"mkdir beyond files", post, http.MethodPost, "/h/", "", nil, http.StatusInsufficientStorage},
+		{"webdav mkdir beyond files", dav, "MKCOL", "/dav/h", "", nil, http.StatusMethodNotAllowed},
+		{"tus into a new directory", tusPost, http.MethodPost, "/h/i.txt?override=true", "", map[string]string{"Upload-Length": "0"}, http.StatusInsufficientStorage},
+		{"tus beyond bytes", tusPost, http.MethodPost, "/d.txt?override=true", "", map[string]string{"Upload-Length": "11"}, http.StatusInsufficientStorage},
+		{"tus within bytes", tusPost, http.MethodPost, "/d.txt?override=true", "", map[string]string{"Upload-Length": "10"}, http.StatusCreated},
+	}
+
+	for _, step := range steps {
+		req, _ := http.NewRequest(step.method, step.url, strings.NewReader(step.body))
+		req.Header.Set("X-Auth", signed)
+		req.SetBasicAuth("u", "pw")
+		for k, v := range step.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		step.handler.ServeHTTP(rec, req)
+
+		if rec.Code != step.want {
+			t.Fatalf("%s: expected %d, got %d body=%q", step.name, step.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(userScope, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected the upload beyond the quota not to be kept, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(userScope, "h")); !os.IsNotExist(err) {
+		t.Errorf("expected no directory to be made beyond the quota, got %v", err)
+	}
+	if u, _ := quotas.Usage(userScope); u != (quota.Usage{Bytes: 0, Files: 3}) {
+		t.Errorf("expected the usage to be tracked, got %+v", u)
+	}
+}
@@ -11,10 +11,12 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	"github.com/thevickypedia/filebrowser/v2/files"
 	"github.com/thevickypedia/filebrowser/v2/fileutils"
 	"github.com/thevickypedia/filebrowser/v2/users"
 	"github.com/mholt/archives"
+	"github.com/spf13/afero"
 )
 
 func slashClean(name string) string {
@@ -45,29 +47,65 @@ func parseQueryFiles(r *http.Request, f *files.FileInfo, _ *users.User) ([]strin
 	return fileSlice, nil
 }
 
+// archiveFormat is a format directories can be downloaded in and archives
+// extracted from.
+type archiveFormat interface {
+	archives.Archival
+	archives.Extractor
+}
+
+// archiveFormats are the archive formats by algo query parameter.
+var archiveFormats = []struct {
+	algo      string
+	extension string
+	format    archiveFormat
+}{
+	{"zip", ".zip", archives.Zip{}},
+	{"tar", ".tar", archives.Tar{}},
+	{"targz", ".tar.gz", compressedTar(archives.Gz{})},
+	{"tarbz2", ".tar.bz2", compressedTar(archives.Bz2{})},
+	{"tarxz", ".tar.xz", compressedTar(archives.Xz{})},
+	{"tarlz4", ".tar.lz4", compressedTar(archives.Lz4{})},
+	{"tarsz", ".tar.sz", compressedTar(archives.Sz{})},
+	{"tarbr", ".tar.br", compressedTar(archives.Brotli{})},
+	{"tarzst", ".tar.zst", compressedTar(archives.Zstd{})},
+}
+
+func compressedTar(compression archives.Compression) archives.CompressedArchive {
+	return archives.CompressedArchive{Compression: compression, Archival: archives.Tar{}, Extraction: archives.Tar{}}
+}
+
 func parseQueryAlgorithm(r *http.Request) (string, archives.Archival, error) {
-	switch r.URL.Query().Get("algo") {
-	case "zip", "true", "":
-		return ".zip", archives.Zip{}, nil
-	case "tar":
-		return ".tar", archives.Tar{}, nil
-	case "targz":
-		return ".tar.gz", archives.CompressedArchive{Compression: archives.Gz{}, Archival: archives.Tar{}}, nil
-	case "tarbz2":
-		return ".tar.bz2", archives.CompressedArchive{Compression: archives.Bz2{}, Archival: archives.Tar{}}, nil
-	case "tarxz":
-		return ".tar.xz", archives.CompressedArchive{Compression: archives.Xz{}, Archival: archives.Tar{}}, nil
-	case "tarlz4":
-		return ".tar.lz4", archives.CompressedArchive{Compression: archives.Lz4{}, Archival: archives.Tar{}}, nil
-	case "tarsz":
-		return ".tar.sz", archives.CompressedArchive{Compression: archives.Sz{}, Archival: archives.Tar{}}, nil
-	case "tarbr":
-		return ".tar.br", archives.CompressedArchive{Compression: archives.Brotli{}, Archival: archives.Tar{}}, nil
-	case "tarzst":
-		return ".tar.zst", archives.CompressedArchive{Compression: archives.Zstd{}, Archival: archives.Tar{}}, nil
-	default:
-		return "", nil, errors.New("format not implemented")
+	algo := r.URL.Query().Get("algo")
+	if algo == "true" || algo == "" {
+		algo = "zip"
+	}
+
+	for _, f := range archiveFormats {
+		if f.algo == algo {
+			return f.extension, f.format, nil
+		}
+	}
+	return "", nil, errors.New("format not implemented")
+}
+
+// sanitizeArchiveName returns the name of an archive entry, relative to the
+// archive root, refusing the names that would escape it.
+func sanitizeArchiveName(name string) (string, error) {
+	// A backslash is a legal filename character on POSIX hosts, so it can
+	// reach here verbatim. Rewriting it to the path separator "/" would
+	// manufacture a traversal sequence (e.g. "..\..\x" -> "../../x") that
+	// escapes the extraction directory on the victim's machine, while
+	// leaving it as "\" lets Windows extractors treat it as a separator.
+	// Neutralize it to an inert character instead of turning it into one.
+	name = strings.ReplaceAll(name, "\\", "_")
+
+	// Defense in depth: never emit an archive entry whose path escapes the
+	// archive root, regardless of how the name was produced.
+	if cleaned := gopath.Clean("/" + name); cleaned != "/"+name {
+		return "", fmt.Errorf("refusing unsafe archive entry name: %q", name)
 	}
+	return name, nil
 }
 
 func setContentDisposition(w http.ResponseWriter, r *http.Request, file *files.FileInfo) {
@@ -81,10 +119,12 @@ func setContentDisposition(w http.ResponseWriter, r *http.Request, file *files.F
 	}
 }
 
-var rawHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+var rawHandler = withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	d.audit(audit.ActionDownload, r.URL.Path, "")
 	if !d.user.Perm.Download {
 		return http.StatusAccepted, nil
 	}
+	w = countDownload(w, apiRaw)
 
 	file, err := files.NewFileInfo(&files.FileOptions{
 		Fs:         d.user.Fs,
@@ -110,12 +150,12 @@ var rawHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data)
 	return rawDirHandler(w, r, d, file)
 })
 
-func getFiles(d *data, path, commonPath string) ([]archives.FileInfo, error) {
+func getFiles(d *data, afs afero.Fs, path, commonPath string) ([]archives.FileInfo, error) {
 	if !d.Check(path) {
 		return nil, nil
 	}
 
-	info, err := d.user.Fs.Stat(path)
+	info, err := afs.Stat(path)
 	if err != nil {
 		return nil, err
 	}
@@ -126,31 +166,22 @@ func getFiles(d *data, path, commonPath string) ([]archives.FileInfo, error) {
 		nameInArchive := strings.TrimPrefix(path, commonPath)
 		nameInArchive = strings.TrimPrefix(nameInArchive, string(filepath.Separator))
 		nameInArchive = filepath.ToSlash(nameInArchive)
-		// A backslash is a legal filename character on POSIX hosts, so it can
-		// reach here verbatim. Rewriting it to the path separator "/" would
-		// manufacture a traversal sequence (e.g. "..\..\x" -> "../../x") that
-		// escapes the extraction directory on the victim's machine, while
-		// leaving it as "\" lets Windows extractors treat it as a separator.
-		// Neutralize it to an inert character instead of turning it into one.
-		nameInArchive = strings.ReplaceAll(nameInArchive, "\\", "_")
-
-		// Defense in depth: never emit an archive entry whose path escapes the
-		// archive root, regardless of how the name was produced.
-		if cleaned := gopath.Clean("/" + nameInArchive); cleaned != "/"+nameInArchive {
-			return nil, fmt.Errorf("refusing unsafe archive entry name: %q", nameInArchive)
+		nameInArchive, err = sanitizeArchiveName(nameInArchive)
+		if err != nil {
+			return nil, err
 		}
 
 		archiveFiles = append(archiveFiles, archives.FileInfo{
 			FileInfo:      info,
 			NameInArchive: nameInArchive,
 			Open: func() (fs.File, error) {
-				return d.user.Fs.Open(path)
+				return afs.Open(path)
 			},
 		})
 	}
 
 	if info.IsDir() {
-		f, err := d.user.Fs.Open(path)
+		f, err := afs.Open(path)
 		if err != nil {
 			return nil, err
 		}
@@ -163,7 +194,7 @@ func getFiles(d *data, path, commonPath string) ([]archives.FileInfo, error) {
 
 		for _, name := range names {
 			fPath := filepath.Join(path, name)
-			subFiles, err := getFiles(d, fPath, commonPath)
+			subFiles, err := getFiles(d, afs, fPath, commonPath)
 			if err != nil {
 				log.Printf("Failed to get files from %s: %v", fPath, err)
 				continue
@@ -190,7 +221,7 @@ func rawDirHandler(w http.ResponseWriter, r *http.Request, d *data, file *files.
 
 	var allFiles []archives.FileInfo
 	for _, fname := range filenames {
-		archiveFiles, err := getFiles(d, fname, commonDir)
+		archiveFiles, err := getFiles(d, d.user.Fs, fname, commonDir)
 		if err != nil {
 			log.Printf("Failed to get files from %s: %v", fname, err)
 			continue
@@ -213,7 +244,11 @@ func rawDirHandler(w http.ResponseWriter, r *http.Request, d *data, file *files.
 	if len(filenames) > 1 {
 		name = "_" + name
 	}
-	name += extension
+	return writeArchive(w, r, name+extension, archiver, allFiles)
+}
+
+// writeArchive writes the files as an archive of the name.
+func writeArchive(w http.ResponseWriter, r *http.Request, name string, archiver archives.Archival, allFiles []archives.FileInfo) (int, error) {
 	w.Header().Set("Content-Disposition", "attachment; filename*=utf-8''"+url.PathEscape(name))
 
 	if err := archiver.Archive(r.Context(), w, allFiles); err != nil {
@@ -17,12 +17,30 @@ import (
 
 	"github.com/shirou/gopsutil/v4/disk"
 	"github.com/spf13/afero"
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
 	"github.com/thevickypedia/filebrowser/v2/files"
 	"github.com/thevickypedia/filebrowser/v2/fileutils"
+	"github.com/thevickypedia/filebrowser/v2/grants"
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/search"
+	"github.com/thevickypedia/filebrowser/v2/trash"
+	"github.com/thevickypedia/filebrowser/v2/users"
+	"github.com/thevickypedia/filebrowser/v2/versions"
 )
 
-var resourceGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+var resourceGetHandler = withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	d.audit(audit.ActionRead, r.URL.Path, "")
+
+	if name, _, ok := grants.Split(r.URL.Path); ok && name == "" && d.grant == nil && !grantsShadowed(d) {
+		file, err := grantsRootInfo(d)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return renderJSON(w, r, file)
+	}
+
 	file, err := files.NewFileInfo(&files.FileOptions{
 		Fs:         d.user.Fs,
 		Path:       r.URL.Path,
@@ -38,15 +56,18 @@ var resourceGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d
 
 	encoding := r.Header.Get("X-Encoding")
 	if file.IsDir {
+		if err := listGrantsRoot(d, file); err != nil {
+			return http.StatusInternalServerError, err
+		}
 		file.Sorting = d.user.Sorting
 		file.ApplySort()
-		return renderJSON(w, r, file)
+		return renderResource(w, r, d, file)
 	} else if encoding == "true" {
 		if !d.user.Perm.Download {
 			return http.StatusAccepted, nil
 		}
 		if file.Type != "text" {
-			return renderJSON(w, r, file)
+			return renderResource(w, r, d, file)
 		}
 
 		f, err := d.user.Fs.Open(r.URL.Path)
@@ -78,11 +99,12 @@ var resourceGetHandler = withUser(func(w http.ResponseWriter, r *http.Request, d
 		file.Content = ""
 	}
 
-	return renderJSON(w, r, file)
+	return renderResource(w, r, d, file)
 })
 
-func resourceDeleteHandler(fileCache FileCache) handleFunc {
-	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+func resourceDeleteHandler(fileCache FileCache, searchIndex *search.Index, quotas *quota.Tracker, bin *trash.Bin, jobManager *jobs.Manager) handleFunc {
+	return withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		d.audit(audit.ActionDelete, r.URL.Path, "")
 		if r.URL.Path == "/" || !d.user.Perm.Delete {
 			return http.StatusForbidden, nil
 		}
@@ -99,10 +121,14 @@ func resourceDeleteHandler(fileCache FileCache) handleFunc {
 			return errToStatus(err), err
 		}
 
-		err = d.store.Share.DeleteWithPathPrefix(file.Path, d.user.ID)
+		err = d.store.Share.DeleteWithPathPrefix(d.scopePath(file.Path), d.user.ID)
 		if err != nil {
 			log.Printf("WARNING: Error(s) occurred while deleting associated shares with file: %s", err)
 		}
+		err = d.store.Grants.DeleteWithPathPrefix(d.scopePath(file.Path), d.user.ID)
+		if err != nil {
+			log.Printf("WARNING: Error(s) occurred while deleting associated grants with file: %s", err)
+		}
 
 		// delete thumbnails
 		err = delThumbs(r.Context(), fileCache, file)
@@ -110,27 +136,51 @@ func resourceDeleteHandler(fileCache FileCache) handleFunc {
 			return errToStatus(err), err
 		}
 
-		err = d.RunHook(func() error {
-			return d.user.Fs.RemoveAll(r.URL.Path)
-		}, "delete", r.URL.Path, "", d.user)
+		name := r.URL.Path
+		task := func(_ context.Context, report *jobs.Reporter) error {
+			reportTotal(report, d.user.Fs, name)
+
+			removed := quotas.Measure(file.RealPath())
+			err := removeAll(d, bin, name)
+			if err != nil {
+				return err
+			}
+
+			searchIndex.Remove(file.RealPath())
+			quotas.Add(d.quotaRoot(), -removed.Bytes, -removed.Files)
+			return nil
+		}
+		if wantsAsync(r) {
+			return startJob(w, r, d, jobManager, "delete", name, "", task)
+		}
 
+		err = task(r.Context(), nil)
 		if err != nil {
 			return errToStatus(err), err
 		}
-
 		return http.StatusNoContent, nil
 	})
 }
 
-func resourcePostHandler(fileCache FileCache) handleFunc {
-	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+func resourcePostHandler(fileCache FileCache, searchIndex *search.Index, quotas *quota.Tracker, history *versions.History) handleFunc {
+	return withGrantUser(resourcePost(fileCache, searchIndex, quotas, history))
+}
+
+// resourcePost writes the file uploaded to the path of the request, by the
+// user or by whoever uploads to their file request.
+func resourcePost(fileCache FileCache, searchIndex *search.Index, quotas *quota.Tracker, history *versions.History) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		d.audit(audit.ActionCreate, r.URL.Path, "")
 		if !d.user.Perm.Create || !d.Check(r.URL.Path) {
 			return http.StatusForbidden, nil
 		}
 
 		// Directories creation on POST.
 		if strings.HasSuffix(r.URL.Path, "/") {
-			err := d.user.Fs.MkdirAll(r.URL.Path, d.settings.DirMode)
+			err := mkdirAll(d, quotas, r.URL.Path)
+			if err == nil {
+				searchIndex.Update(d.user.FullPath(r.URL.Path))
+			}
 			return errToStatus(err), err
 		}
 
@@ -142,6 +192,8 @@ func resourcePostHandler(fileCache FileCache) handleFunc {
 			ReadHeader: d.server.TypeDetectionByHeader,
 			Checker:    d,
 		})
+		// The missing parents of the file are created along with it.
+		replaced, newFiles := int64(0), 1+missingDirs(d.user.Fs, path.Dir(r.URL.Path))
 		if err == nil {
 			if r.URL.Query().Get("override") != "true" {
 				return http.StatusConflict, nil
@@ -156,67 +208,128 @@ func resourcePostHandler(fileCache FileCache) handleFunc {
 			if err != nil {
 				return errToStatus(err), err
 			}
+
+			replaced, newFiles = file.Size, 0
+		}
+
+		root := d.quotaRoot()
+		err = quotas.Check(root, d.user.Quota, max(r.ContentLength, 0)-replaced, newFiles)
+		if err != nil {
+			return errToStatus(err), err
 		}
 
-		err = d.RunHook(func() error {
-			info, writeErr := writeFile(d.user.Fs, r.URL.Path, r.Body, d.settings.FileMode, d.settings.DirMode)
-			if writeErr != nil {
-				return writeErr
+		// Nothing is touched, nor any version kept, until the hooks allow
+		// the upload.
+		err = d.RunBeforeHook("upload", r.URL.Path, "", d.user)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		if newFiles == 0 {
+			err = saveVersion(d, history, quotas, r.URL.Path)
+			if err != nil {
+				return errToStatus(err), err
 			}
+		}
+		body, err := quotas.Limit(r.Body, root, d.user.Quota, replaced)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		var written int64
+		info, err := writeFile(d.user.Fs, r.URL.Path, body, d.settings.FileMode, d.settings.DirMode)
+		if err == nil {
+			written = info.Size()
 
 			etag := fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
 			w.Header().Set("ETag", etag)
-			return nil
-		}, "upload", r.URL.Path, "", d.user)
+			err = d.RunAfterHook("upload", r.URL.Path, "", d.user)
+		}
 
 		if err != nil {
 			_ = d.user.Fs.RemoveAll(r.URL.Path)
+			quotas.Add(root, -replaced, newFiles-1)
+		} else {
+			searchIndex.Update(d.user.FullPath(r.URL.Path))
+			quotas.Add(root, written-replaced, newFiles)
+			countUpload(apiResources, written)
 		}
 
 		return errToStatus(err), err
-	})
+	}
 }
 
-var resourcePutHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-	if !d.user.Perm.Modify || !d.Check(r.URL.Path) {
-		return http.StatusForbidden, nil
-	}
+func resourcePutHandler(searchIndex *search.Index, quotas *quota.Tracker, history *versions.History) handleFunc {
+	return withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		d.audit(audit.ActionWrite, r.URL.Path, "")
+		if !d.user.Perm.Modify || !d.Check(r.URL.Path) {
+			return http.StatusForbidden, nil
+		}
 
-	// Only allow PUT for files.
-	if strings.HasSuffix(r.URL.Path, "/") {
-		return http.StatusMethodNotAllowed, nil
-	}
+		// Only allow PUT for files.
+		if strings.HasSuffix(r.URL.Path, "/") {
+			return http.StatusMethodNotAllowed, nil
+		}
 
-	exists, err := afero.Exists(d.user.Fs, r.URL.Path)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-	if !exists {
-		return http.StatusNotFound, nil
-	}
+		exists, err := afero.Exists(d.user.Fs, r.URL.Path)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !exists {
+			return http.StatusNotFound, nil
+		}
 
-	err = d.RunHook(func() error {
-		info, writeErr := writeFile(d.user.Fs, r.URL.Path, r.Body, d.settings.FileMode, d.settings.DirMode)
-		if writeErr != nil {
-			return writeErr
+		root := d.quotaRoot()
+		replaced := quotas.Measure(d.user.FullPath(r.URL.Path)).Bytes
+		err = quotas.Check(root, d.user.Quota, max(r.ContentLength, 0)-replaced, 0)
+		if err != nil {
+			return errToStatus(err), err
 		}
 
-		etag := fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
-		w.Header().Set("ETag", etag)
-		return nil
-	}, "save", r.URL.Path, "", d.user)
+		err = d.RunBeforeHook("save", r.URL.Path, "", d.user)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		err = saveVersion(d, history, quotas, r.URL.Path)
+		if err != nil {
+			return errToStatus(err), err
+		}
+		body, err := quotas.Limit(r.Body, root, d.user.Quota, replaced)
+		if err != nil {
+			return errToStatus(err), err
+		}
 
-	return errToStatus(err), err
-})
+		var written int64
+		info, err := writeFile(d.user.Fs, r.URL.Path, body, d.settings.FileMode, d.settings.DirMode)
+		if err == nil {
+			written = info.Size()
 
-func resourcePatchHandler(fileCache FileCache) handleFunc {
-	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+			etag := fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
+			w.Header().Set("ETag", etag)
+			err = d.RunAfterHook("save", r.URL.Path, "", d.user)
+		}
+
+		// The file is truncated even when the write fails, what is left of it
+		// is measured again either way.
+		quotas.Add(root, quotas.Measure(d.user.FullPath(r.URL.Path)).Bytes-replaced, 0)
+		if err == nil {
+			searchIndex.Update(d.user.FullPath(r.URL.Path))
+			countUpload(apiResources, written)
+		}
+
+		return errToStatus(err), err
+	})
+}
+
+func resourcePatchHandler(fileCache FileCache, searchIndex *search.Index, quotas *quota.Tracker, history *versions.History, jobManager *jobs.Manager) handleFunc {
+	return withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		src := r.URL.Path
 		dst := r.URL.Query().Get("destination")
 		action := r.URL.Query().Get("action")
 		dst, err := url.QueryUnescape(dst)
 		dst = path.Clean("/" + dst)
 		src = path.Clean("/" + src)
+		// The actions are recorded under the name they are requested with.
+		d.audit(action, src, dst)
 		if !d.Check(src) || !d.Check(dst) {
 			return http.StatusForbidden, nil
 		}
@@ -253,10 +366,44 @@ func resourcePatchHandler(fileCache FileCache) handleFunc {
 			}
 		}
 
-		err = d.RunHook(func() error {
-			return patchAction(r.Context(), action, src, dst, d, fileCache)
-		}, action, src, dst, d.user)
+		var format archiveFormat
+		switch action {
+		case "extract":
+			return startExtract(w, r, d, src, dst, searchIndex, quotas, history, jobManager)
+		case "archive":
+			format, err = parseArchiveFormat(r, dst)
+			if err != nil {
+				return errToStatus(err), err
+			}
+		}
+
+		task := func(ctx context.Context, report *jobs.Reporter) error {
+			err := d.RunHook(func() error {
+				if action == "archive" {
+					return createArchive(ctx, d, format, src, dst, quotas, history, report)
+				}
+				return patchAction(ctx, action, src, dst, d, fileCache, quotas, history, report)
+			}, action, src, dst, d.user)
+
+			if err == nil {
+				if action == "rename" {
+					searchIndex.Remove(d.user.FullPath(src))
+					if err := d.store.Share.RenamePathPrefix(d.scopePath(src), d.scopePath(dst), d.user.ID); err != nil {
+						log.Printf("WARNING: Error(s) occurred while moving the collections sharing file: %s", err)
+					}
+					if err := d.store.Grants.RenamePathPrefix(d.scopePath(src), d.scopePath(dst), d.user.ID); err != nil {
+						log.Printf("WARNING: Error(s) occurred while moving the grants of file: %s", err)
+					}
+				}
+				searchIndex.Update(d.user.FullPath(dst))
+			}
+			return err
+		}
+		if wantsAsync(r) {
+			return startJob(w, r, d, jobManager, action, src, dst, task)
+		}
 
+		err = task(r.Context(), nil)
 		return errToStatus(err), err
 	})
 }
@@ -293,6 +440,33 @@ func addVersionSuffix(source string, afs afero.Fs) string {
 	return source
 }
 
+// missingDirs returns how many directories are missing for the one at p to
+// exist.
+func missingDirs(afs afero.Fs, p string) int64 {
+	var n int64
+	for p = path.Clean("/" + p); p != "/"; p = path.Dir(p) {
+		if _, err := afs.Stat(p); err == nil {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// mkdirAll creates the directory at p along with its missing parents, which
+// are all charged to the files quota of the user.
+func mkdirAll(d *data, quotas *quota.Tracker, p string) error {
+	root, dirs := d.quotaRoot(), missingDirs(d.user.Fs, p)
+	if err := quotas.Check(root, d.user.Quota, 0, dirs); err != nil {
+		return err
+	}
+	if err := d.user.Fs.MkdirAll(p, d.settings.DirMode); err != nil {
+		return err
+	}
+	quotas.Add(root, 0, dirs)
+	return nil
+}
+
 func writeFile(afs afero.Fs, dst string, in io.Reader, fileMode, dirMode fs.FileMode) (os.FileInfo, error) {
 	dir, _ := path.Split(dst)
 	err := afs.MkdirAll(dir, dirMode)
@@ -337,14 +511,36 @@ func delThumbs(ctx context.Context, fileCache FileCache, file *files.FileInfo) e
 	return nil
 }
 
-func patchAction(ctx context.Context, action, src, dst string, d *data, fileCache FileCache) error {
+func patchAction(ctx context.Context, action, src, dst string, d *data, fileCache FileCache, quotas *quota.Tracker,
+	history *versions.History, report *jobs.Reporter) error {
+	root := d.quotaRoot()
+	replaced := replacedUsage(d, quotas, src, dst)
+	afs := &progressFs{Fs: d.user.Fs, ctx: ctx, report: report}
+
 	switch action {
 	case "copy":
 		if !d.user.Perm.Create {
 			return fberrors.ErrPermissionDenied
 		}
 
-		return fileutils.Copy(d.user.Fs, src, dst, d.settings.FileMode, d.settings.DirMode)
+		copied := quotas.Measure(d.user.FullPath(src))
+		err := quotas.Check(root, d.user.Quota, copied.Bytes-replaced.Bytes, copied.Files-replaced.Files)
+		if err != nil {
+			return err
+		}
+
+		err = saveVersion(d, history, quotas, dst)
+		if err != nil {
+			return err
+		}
+
+		reportTotal(report, d.user.Fs, src)
+		err = fileutils.Copy(afs, src, dst, d.settings.FileMode, d.settings.DirMode)
+
+		// Measure what was actually copied, in case the copy failed midway.
+		copied = quotas.Measure(d.user.FullPath(dst))
+		quotas.Add(root, copied.Bytes-replaced.Bytes, copied.Files-replaced.Files)
+		return err
 	case "rename":
 		if !d.user.Perm.Rename {
 			return fberrors.ErrPermissionDenied
@@ -370,12 +566,48 @@ func patchAction(ctx context.Context, action, src, dst string, d *data, fileCach
 			return err
 		}
 
-		return fileutils.MoveFile(d.user.Fs, src, dst, d.settings.FileMode, d.settings.DirMode)
+		// The file replaced at dst gets a version of its own, then the
+		// versions of src follow it to dst.
+		err = saveVersion(d, history, quotas, dst)
+		if err != nil {
+			return err
+		}
+		realSrc, err := realPath(d, src)
+		if err != nil {
+			return err
+		}
+
+		// Moving within a filesystem is a rename, and only reports progress
+		// when falling back to copying.
+		reportTotal(report, d.user.Fs, src)
+		err = fileutils.MoveFile(afs, src, dst, d.settings.FileMode, d.settings.DirMode)
+		if err != nil {
+			return err
+		}
+		quotas.Add(root, -replaced.Bytes, -replaced.Files)
+		return moveVersions(d, history, realSrc, dst)
 	default:
 		return fmt.Errorf("unsupported action %s: %w", action, fberrors.ErrInvalidRequestParams)
 	}
 }
 
+// replacedUsage returns the usage of what is at dst, which is replaced when
+// copying or moving src there.
+func replacedUsage(d *data, quotas *quota.Tracker, src, dst string) quota.Usage {
+	dstInfo, err := d.user.Fs.Stat(dst)
+	if err != nil {
+		return quota.Usage{}
+	}
+
+	// Renaming a file to a name only differing by its case on a case
+	// insensitive filesystem replaces nothing.
+	if srcInfo, err := d.user.Fs.Stat(src); err == nil && os.SameFile(srcInfo, dstInfo) {
+		return quota.Usage{}
+	}
+
+	return quotas.Measure(d.user.FullPath(dst))
+}
+
 // RecursiveEntry is a single file/directory entry returned by the recursive listing endpoint.
 type RecursiveEntry struct {
 	Path    string    `json:"path"`
@@ -388,7 +620,7 @@ type RecursiveEntry struct {
 // resourceGetRecursiveHandler returns a flat list of every file and directory
 // under the requested path, walking the tree recursively on the server side
 // so the client only needs a single HTTP call.
-var resourceGetRecursiveHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+var resourceGetRecursiveHandler = withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	rootPath := r.URL.Path
 	if rootPath == "" {
 		rootPath = "/"
@@ -439,6 +671,11 @@ var resourceGetRecursiveHandler = withUser(func(w http.ResponseWriter, r *http.R
 		return http.StatusInternalServerError, err
 	}
 
+	if d.grant != nil {
+		for i := range entries {
+			entries[i].Path = d.grantPath(entries[i].Path)
+		}
+	}
 	return renderJSON(w, r, entries)
 })
 
@@ -468,12 +705,34 @@ func resolveToSymlinkRoot(p string) (string, error) {
 }
 
 type DiskUsageResponse struct {
-	Path  string `json:"path"`
-	Total uint64 `json:"total"`
-	Used  uint64 `json:"used"`
+	Path  string      `json:"path"`
+	Total uint64      `json:"total"`
+	Used  uint64      `json:"used"`
+	Quota *QuotaUsage `json:"quota,omitempty"`
+}
+
+// QuotaUsage reports the usage of a user's scope against their quota.
+type QuotaUsage struct {
+	Limit users.Quota `json:"limit"`
+	Used  quota.Usage `json:"used"`
+}
+
+func diskUsageHandler(quotas *quota.Tracker) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		var quotaUsage *QuotaUsage
+		if !d.user.Quota.Unlimited() {
+			used, err := quotas.Usage(d.quotaRoot())
+			if err != nil {
+				return errToStatus(err), err
+			}
+			quotaUsage = &QuotaUsage{Limit: d.user.Quota, Used: used}
+		}
+
+		return diskUsage(w, r, d, quotaUsage)
+	})
 }
 
-var diskUsage = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+func diskUsage(w http.ResponseWriter, r *http.Request, d *data, quotaUsage *QuotaUsage) (int, error) {
 	file, err := files.NewFileInfo(&files.FileOptions{
 		Fs:         d.user.Fs,
 		Path:       r.URL.Path,
@@ -492,6 +751,7 @@ var diskUsage = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (
 			Path:  fPath,
 			Total: 0,
 			Used:  0,
+			Quota: quotaUsage,
 		})
 	}
 
@@ -509,5 +769,6 @@ var diskUsage = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (
 		Path:  fPath,
 		Total: usage.Total,
 		Used:  usage.Used,
+		Quota: quotaUsage,
 	})
-})
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
@@ -14,69 +13,91 @@ import (
 
 const searchPingInterval = 5
 
-var searchHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
-	response := make(chan map[string]interface{})
-	ctx, cancel := context.WithCancelCause(r.Context())
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		// Avoid connection timeout
-		timeout := time.NewTimer(searchPingInterval * time.Second)
-		defer timeout.Stop()
-		for {
-			var err error
-			var infoBytes []byte
-			select {
-			case info := <-response:
-				if info == nil {
+func searchHandler(searchIndex *search.Index) handleFunc {
+	return withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		response := make(chan map[string]interface{})
+		ctx, cancel := context.WithCancelCause(r.Context())
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Avoid connection timeout
+			timeout := time.NewTimer(searchPingInterval * time.Second)
+			defer timeout.Stop()
+			for {
+				var err error
+				var infoBytes []byte
+				select {
+				case info := <-response:
+					if info == nil {
+						return
+					}
+					infoBytes, err = json.Marshal(info)
+				case <-timeout.C:
+					// Send a heartbeat packet
+					infoBytes = nil
+				case <-ctx.Done():
 					return
 				}
-				infoBytes, err = json.Marshal(info)
-			case <-timeout.C:
-				// Send a heartbeat packet
-				infoBytes = nil
-			case <-ctx.Done():
-				return
-			}
-			if err != nil {
-				cancel(err)
-				return
+				if err != nil {
+					cancel(err)
+					return
+				}
+				_, err = w.Write(infoBytes)
+				if err == nil {
+					_, err = w.Write([]byte("\n"))
+				}
+				if err != nil {
+					cancel(err)
+					return
+				}
+				if flusher, ok := w.(http.Flusher); ok {
+					flusher.Flush()
+				}
 			}
-			_, err = w.Write(infoBytes)
-			if err == nil {
-				_, err = w.Write([]byte("\n"))
+		}()
+		query := r.URL.Query().Get("query")
+
+		found := func(result search.Result) error {
+			info := map[string]interface{}{
+				"dir":  result.Dir,
+				"path": result.Path,
 			}
-			if err != nil {
-				cancel(err)
-				return
+			if result.Line > 0 {
+				info["line"] = result.Line
+				info["excerpt"] = result.Excerpt
 			}
-			if flusher, ok := w.(http.Flusher); ok {
-				flusher.Flush()
+
+			select {
+			case <-ctx.Done():
+			case response <- info:
 			}
+			return context.Cause(ctx)
 		}
-	}()
-	query := r.URL.Query().Get("query")
 
-	err := search.Search(ctx, d.user.Fs, r.URL.Path, query, d, func(path string, f os.FileInfo) error {
-		select {
-		case <-ctx.Done():
-		case response <- map[string]interface{}{
-			"dir":  f.IsDir(),
-			"path": path,
-		}:
+		var err error
+		start := time.Now()
+		if searchIndex != nil {
+			err = searchIndex.Search(ctx, d.user.Fs, d.user.FullPath("/"), r.URL.Path, query, d, found)
+			searchDuration.WithLabelValues("index").Observe(time.Since(start).Seconds())
+		} else {
+			err = search.Search(ctx, d.user.Fs, r.URL.Path, query, d, found)
+			searchDuration.WithLabelValues("walk").Observe(time.Since(start).Seconds())
+		}
+		close(response)
+		wg.Wait()
+		if err == nil {
+			err = context.Cause(ctx)
+		}
+		var syntaxErr *search.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return http.StatusBadRequest, err
+		}
+		// ignore cancellation errors from user aborts
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return http.StatusInternalServerError, err
 		}
-		return context.Cause(ctx)
-	})
-	close(response)
-	wg.Wait()
-	if err == nil {
-		err = context.Cause(ctx)
-	}
-	// ignore cancellation errors from user aborts
-	if err != nil && !errors.Is(err, context.Canceled) {
-		return http.StatusInternalServerError, err
-	}
 
-	return 0, nil
-})
+		return 0, nil
+	})
+}
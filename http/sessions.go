@@ -0,0 +1,82 @@
+package fbhttp
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+type sessionEntry struct {
+	fbAuth.Session
+	Current bool `json:"current"`
+}
+
+// sessionsUserID returns the ID of the user whose sessions are managed: that
+// of the user query parameter, which only admins can give for others, or
+// else that of the user.
+func sessionsUserID(r *http.Request, d *data) (uint, int, error) {
+	param := r.URL.Query().Get("user")
+	if param == "" {
+		return d.user.ID, 0, nil
+	}
+
+	id, err := strconv.ParseUint(param, 10, 0)
+	if err != nil {
+		return 0, http.StatusBadRequest, fberrors.ErrInvalidRequestParams
+	}
+	if uint(id) != d.user.ID && !d.user.Perm.Admin {
+		return 0, http.StatusForbidden, nil
+	}
+	return uint(id), 0, nil
+}
+
+var sessionListHandler = withSessionUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	id, status, err := sessionsUserID(r, d)
+	if status != 0 {
+		return status, err
+	}
+
+	sessions, err := fbAuth.GetSessions(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	infos := make([]sessionEntry, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, sessionEntry{Session: s, Current: s.ID == d.session})
+	}
+	return renderJSON(w, r, infos)
+})
+
+// sessionDeleteHandler revokes a session of the user, or of anyone for
+// admins.
+var sessionDeleteHandler = withSessionUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	session, ok := fbAuth.GetSession(mux.Vars(r)["id"])
+	// Others' sessions aren't told apart from unknown ones.
+	if !ok || (session.UserID != d.user.ID && !d.user.Perm.Admin) {
+		return http.StatusNotFound, nil
+	}
+
+	if err := fbAuth.RemoveSession(session.ID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+})
+
+// sessionsDeleteHandler revokes all the sessions of a user but the current
+// one.
+var sessionsDeleteHandler = withSessionUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	id, status, err := sessionsUserID(r, d)
+	if status != 0 {
+		return status, err
+	}
+
+	if err := fbAuth.RemoveUserSessions(id, d.session); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+})
@@ -0,0 +1,106 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	_ "github.com/mattn/go-sqlite3"
+
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestSessions(t *testing.T) {
+	// The auth database is opened in the working directory.
+	t.Chdir(t.TempDir())
+	fbAuth.DataBase()
+
+	key := []byte("test-signing-key")
+	st := scopedUserStorage(t, t.TempDir(), users.Permissions{}, key)
+	signed := signToken(t, users.Permissions{}, key)
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.Handle("/renew", handle(renewHandler(time.Hour), "", st, server)).Methods("POST")
+	router.Handle("/sessions", handle(sessionListHandler, "", st, server)).Methods("GET")
+	router.Handle("/sessions", handle(sessionsDeleteHandler, "", st, server)).Methods("DELETE")
+	router.Handle("/sessions/{id}", handle(sessionDeleteHandler, "", st, server)).Methods("DELETE")
+	router.Handle("/users/{id:[0-9]+}", handle(userPutHandler, "", st, server)).Methods("PUT")
+
+	do := func(method, url, auth, body string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		var r io.Reader = http.NoBody
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, url, r)
+		req.Header.Set("X-Auth", auth)
+		req.Header.Set("User-Agent", "tests")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	login := func() string {
+		t.Helper()
+		return do(http.MethodPost, "/renew", signed, "", http.StatusOK).Body.String()
+	}
+	list := func(auth string) []sessionEntry {
+		t.Helper()
+		var sessions []sessionEntry
+		if err := json.NewDecoder(do(http.MethodGet, "/sessions", auth, "", http.StatusOK).Body).Decode(&sessions); err != nil {
+			t.Fatal(err)
+		}
+		return sessions
+	}
+
+	first, second := login(), login()
+	sessions := list(first)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+	current := sessions[0]
+	if !current.Current {
+		current = sessions[1]
+	}
+	if !current.Current || current.UserAgent != "tests" || current.IP == "" || current.IssuedAt.IsZero() {
+		t.Errorf("expected the current session to be recorded, got %+v", sessions)
+	}
+
+	// Renewed JWTs belong to the same session.
+	renewed := do(http.MethodPost, "/renew", first, "", http.StatusOK).Body.String()
+	if sessions := list(renewed); len(sessions) != 2 {
+		t.Errorf("expected the renewal not to add a session, got %+v", sessions)
+	}
+
+	// Only admins manage the sessions of others.
+	do(http.MethodGet, "/sessions?user=2", renewed, "", http.StatusForbidden)
+	do(http.MethodDelete, "/sessions?user=2", renewed, "", http.StatusForbidden)
+	do(http.MethodDelete, "/sessions/unknown", renewed, "", http.StatusNotFound)
+
+	do(http.MethodDelete, "/sessions", renewed, "", http.StatusNoContent)
+	do(http.MethodGet, "/sessions", second, "", http.StatusUnauthorized)
+	do(http.MethodDelete, "/sessions/"+current.ID, renewed, "", http.StatusNoContent)
+	do(http.MethodGet, "/sessions", renewed, "", http.StatusUnauthorized)
+	do(http.MethodGet, "/sessions", first, "", http.StatusUnauthorized)
+
+	// Changing a password can sign out the other sessions.
+	kept, revoked := login(), login()
+	body := `{"what":"user","which":["password"],"data":{"id":1,"password":"a-new-password-123"}`
+	do(http.MethodPut, "/users/1", kept, body+`}`, http.StatusOK)
+	list(revoked)
+	do(http.MethodPut, "/users/1", kept, body+`,"revokeSessions":true}`, http.StatusOK)
+	do(http.MethodGet, "/sessions", revoked, "", http.StatusUnauthorized)
+	if sessions := list(kept); len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("expected only the current session to be kept, got %+v", sessions)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	"github.com/thevickypedia/filebrowser/v2/rules"
 	"github.com/thevickypedia/filebrowser/v2/settings"
 	"github.com/thevickypedia/filebrowser/v2/version"
@@ -22,6 +23,8 @@ type settingsData struct {
 	Tus                   settings.Tus          `json:"tus"`
 	Shell                 []string              `json:"shell"`
 	Commands              map[string][]string   `json:"commands"`
+	Versions              uint                  `json:"versions"`
+	LoginLimits           settings.LoginLimits  `json:"loginLimits"`
 }
 
 func versionHandler(w http.ResponseWriter, _ *http.Request, _ *data) (int, error) {
@@ -46,17 +49,24 @@ var settingsGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request,
 		Tus:                   d.settings.Tus,
 		Shell:                 d.settings.Shell,
 		Commands:              d.settings.Commands,
+		Versions:              d.settings.Versions,
+		LoginLimits:           d.settings.LoginLimits,
 	}
 
 	return renderJSON(w, r, data)
 })
 
 var settingsPutHandler = withAdmin(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	d.audit(audit.ActionSettings, "", "")
+
 	req := &settingsData{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
+	if err := req.LoginLimits.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
 
 	d.settings.Signup = req.Signup
 	d.settings.CreateUserDir = req.CreateUserDir
@@ -69,6 +79,8 @@ var settingsPutHandler = withAdmin(func(_ http.ResponseWriter, r *http.Request,
 	d.settings.Shell = req.Shell
 	d.settings.Commands = req.Commands
 	d.settings.HideLoginButton = req.HideLoginButton
+	d.settings.Versions = req.Versions
+	d.settings.LoginLimits = req.LoginLimits
 
 	err = d.store.Settings.Save(d.settings)
 	return errToStatus(err), err
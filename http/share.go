@@ -7,16 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"path"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
 	"github.com/thevickypedia/filebrowser/v2/share"
 	"github.com/thevickypedia/filebrowser/v2/users"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // shareResponse is the client-facing representation of a share. It deliberately
@@ -29,6 +29,21 @@ type shareResponse struct {
 	UserID      uint   `json:"userID"`
 	Expire      int64  `json:"expire"`
 	HasPassword bool   `json:"hasPassword"`
+	// The limits of a file request and what was uploaded to it.
+	Upload     bool     `json:"upload,omitempty"`
+	MaxFiles   uint     `json:"maxFiles,omitempty"`
+	MaxBytes   int64    `json:"maxBytes,omitempty"`
+	Extensions []string `json:"extensions,omitempty"`
+	Files      uint     `json:"files,omitempty"`
+	Bytes      int64    `json:"bytes,omitempty"`
+	// The limits of the accesses to the share and how many were made.
+	MaxDownloads uint `json:"maxDownloads,omitempty"`
+	MaxVisits    uint `json:"maxVisits,omitempty"`
+	Downloads    uint `json:"downloads"`
+	Visits       uint `json:"visits"`
+	// The members of a collection and its name.
+	Paths []string `json:"paths,omitempty"`
+	Name  string   `json:"name,omitempty"`
 }
 
 func toShareResponse(l *share.Link) *shareResponse {
@@ -38,6 +53,19 @@ func toShareResponse(l *share.Link) *shareResponse {
 		UserID:      l.UserID,
 		Expire:      l.Expire,
 		HasPassword: l.PasswordHash != "",
+		Upload:      l.Upload,
+		MaxFiles:    l.MaxFiles,
+		MaxBytes:    l.MaxBytes,
+		Extensions:  l.Extensions,
+		Files:       l.Files,
+		Bytes:       l.Bytes,
+
+		MaxDownloads: l.MaxDownloads,
+		MaxVisits:    l.MaxVisits,
+		Downloads:    l.Downloads,
+		Visits:       l.Visits,
+		Paths:        l.Paths,
+		Name:         l.Name,
 	}
 }
 
@@ -87,7 +115,10 @@ var shareListHandler = withPermShare(func(w http.ResponseWriter, r *http.Request
 	return renderJSON(w, r, toShareResponses(s))
 })
 
-var shareGetsHandler = withPermShare(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+var shareGetsHandler = withPermShare(shareGets)
+
+// shareGets returns the shares of the path of the request.
+func shareGets(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	var (
 		s   []*share.Link
 		err error
@@ -106,6 +137,38 @@ var shareGetsHandler = withPermShare(func(w http.ResponseWriter, r *http.Request
 	}
 
 	return renderJSON(w, r, toShareResponses(s))
+}
+
+// shareAccessHandler returns the accesses to a share to its owner, even once
+// it was revoked. The paths of the shares of the user, to which its route
+// also matches, are told apart by their hash being unknown.
+var shareAccessHandler = withPermShare(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/access")
+
+	var owner uint
+	link, err := d.store.Share.GetByHash(hash)
+	switch {
+	case err == nil:
+		owner = link.UserID
+	case !errors.Is(err, fberrors.ErrNotExist):
+		return errToStatus(err), err
+	}
+
+	accesses, err := d.store.Share.Accesses(hash)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if link == nil {
+		if len(accesses) == 0 {
+			return shareGets(w, r, d)
+		}
+		owner = accesses[0].UserID
+	}
+
+	if owner != d.user.ID && !d.user.Perm.Admin {
+		return http.StatusForbidden, nil
+	}
+	return renderJSON(w, r, accesses)
 })
 
 func getSharesForAdminPath(d *data, path string) ([]*share.Link, error) {
@@ -142,10 +205,13 @@ var shareDeleteHandler = withPermShare(func(_ http.ResponseWriter, r *http.Reque
 		return http.StatusBadRequest, nil
 	}
 
+	e := d.audit(audit.ActionShareDelete, "", "")
+	e.Share = hash
 	link, err := d.store.Share.GetByHash(hash)
 	if err != nil {
 		return errToStatus(err), err
 	}
+	e.Source = link.Path
 
 	if link.UserID != d.user.ID && !d.user.Perm.Admin {
 		return http.StatusForbidden, nil
@@ -155,6 +221,42 @@ var shareDeleteHandler = withPermShare(func(_ http.ResponseWriter, r *http.Reque
 	return errToStatus(err), err
 })
 
+var sharePatchHandler = withPermShare(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	hash := strings.TrimSuffix(r.URL.Path, "/")
+	hash = strings.TrimPrefix(hash, "/")
+
+	if hash == "" {
+		return http.StatusBadRequest, nil
+	}
+
+	e := d.audit(audit.ActionShareUpdate, "", "")
+	e.Share = hash
+
+	var body share.UpdateBody
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("failed to decode body: %w", err)
+		}
+		defer r.Body.Close()
+	}
+
+	// The hash stays the same, so that the link sent out keeps working.
+	var updated *share.Link
+	err := updateShare(d, hash, func(l *share.Link) error {
+		e.Source = l.Path
+		if l.UserID != d.user.ID && !d.user.Perm.Admin {
+			return fberrors.ErrPermissionDenied
+		}
+		updated = l
+		return l.Update(&body, time.Now())
+	})
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	return renderJSON(w, r, toShareResponse(updated))
+})
+
 var sharePostHandler = withPermShare(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	// Only allow sharing paths that currently exist. Otherwise a share could be
 	// created for a non-existent path and would silently start exposing
@@ -163,7 +265,12 @@ var sharePostHandler = withPermShare(func(w http.ResponseWriter, r *http.Request
 	// d.user.Fs is scoped, so Stat also refuses to follow a symlink whose target
 	// escapes the user's scope: that returns a permission error here and so
 	// blocks creating a share that points out of scope.
-	if _, err := d.user.Fs.Stat(r.URL.Path); err != nil {
+	e := d.audit(audit.ActionShareCreate, r.URL.Path, "")
+	if !d.Check(r.URL.Path) {
+		return http.StatusForbidden, nil
+	}
+	info, err := d.user.Fs.Stat(r.URL.Path)
+	if err != nil {
 		return errToStatus(err), err
 	}
 
@@ -176,49 +283,43 @@ var sharePostHandler = withPermShare(func(w http.ResponseWriter, r *http.Request
 		defer r.Body.Close()
 	}
 
-	bytes := make([]byte, 6)
-	_, err := rand.Read(bytes)
-	if err != nil {
-		return http.StatusInternalServerError, err
+	// File requests are only made of directories, to which their owners can
+	// upload.
+	if body.Upload && (!info.IsDir() || !d.user.Perm.Create) {
+		return http.StatusBadRequest, fmt.Errorf("%w: file requests can only be made of directories the user can upload to", fberrors.ErrInvalidRequestParams)
 	}
 
-	str := base64.URLEncoding.EncodeToString(bytes)
-
-	var expire int64 = 0
-
-	if body.Expires != "" {
-		num, err := strconv.Atoi(body.Expires)
-		if err != nil {
-			return http.StatusInternalServerError, err
+	// The members of collections are relative to the path shared, and must
+	// exist just as the paths of the other shares.
+	var members []string
+	if len(body.Paths) > 0 {
+		if body.Upload {
+			return http.StatusBadRequest, fmt.Errorf("%w: file requests can't be collections", fberrors.ErrInvalidRequestParams)
 		}
-
-		var add time.Duration
-		switch body.Unit {
-		case "seconds":
-			add = time.Second * time.Duration(num)
-		case "minutes":
-			add = time.Minute * time.Duration(num)
-		case "days":
-			add = time.Hour * 24 * time.Duration(num)
-		default:
-			add = time.Hour * time.Duration(num)
+		for _, p := range body.Paths {
+			member := path.Join(r.URL.Path, p)
+			if !d.Check(member) {
+				return http.StatusForbidden, nil
+			}
+			if _, err := d.user.Fs.Stat(member); err != nil {
+				return errToStatus(err), err
+			}
+			members = append(members, member)
 		}
-
-		expire = time.Now().Add(add).Unix()
 	}
 
-	hash, status, err := getSharePasswordHash(body)
+	bytes := make([]byte, 6)
+	_, err = rand.Read(bytes)
 	if err != nil {
-		return status, err
+		return http.StatusInternalServerError, err
 	}
 
-	var token string
-	if len(hash) > 0 {
-		tokenBuffer := make([]byte, 96)
-		if _, err := rand.Read(tokenBuffer); err != nil {
-			return http.StatusInternalServerError, err
-		}
-		token = base64.URLEncoding.EncodeToString(tokenBuffer)
+	str := base64.URLEncoding.EncodeToString(bytes)
+	e.Share = str
+
+	expire, err := share.Expiry(body.Expires, body.Unit, time.Now())
+	if err != nil {
+		return errToStatus(err), err
 	}
 
 	s = &share.Link{
@@ -226,26 +327,37 @@ var sharePostHandler = withPermShare(func(w http.ResponseWriter, r *http.Request
 		Hash:         str,
 		Expire:       expire,
 		UserID:       d.user.ID,
-		PasswordHash: string(hash),
-		Token:        token,
+		MaxDownloads: body.MaxDownloads,
+		MaxVisits:    body.MaxVisits,
 	}
-
-	if err := d.store.Share.Save(s); err != nil {
+	if err := s.SetPassword(body.Password); err != nil {
 		return http.StatusInternalServerError, err
 	}
-
-	return renderJSON(w, r, toShareResponse(s))
-})
-
-func getSharePasswordHash(body share.CreateBody) (data []byte, statuscode int, err error) {
-	if body.Password == "" {
-		return nil, 0, nil
+	if body.Upload {
+		s.Upload = true
+		s.MaxFiles = body.MaxFiles
+		s.MaxBytes = max(body.MaxBytes, 0)
+		s.Extensions = share.NormalizeExtensions(body.Extensions)
+	}
+	if members != nil {
+		if err := s.SetMembers(members); err != nil {
+			return errToStatus(err), err
+		}
+		s.Name = body.Name
+		if s.Name == "" && s.Path != "/" {
+			s.Name = path.Base(s.Path)
+		}
+		if s.Name == "" {
+			s.Name = str
+		}
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	err = d.RunHook(func() error {
+		return d.store.Share.Save(s)
+	}, "share", r.URL.Path, "", d.user)
 	if err != nil {
-		return nil, http.StatusInternalServerError, fmt.Errorf("failed to hash password: %w", err)
+		return errToStatus(err), err
 	}
 
-	return hash, 0, nil
-}
+	return renderJSON(w, r, toShareResponse(s))
+})
@@ -1,11 +1,14 @@
 package fbhttp
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +16,7 @@ import (
 	"github.com/asdine/storm/v3"
 	"github.com/golang-jwt/jwt/v5"
 
+	"github.com/thevickypedia/filebrowser/v2/rules"
 	"github.com/thevickypedia/filebrowser/v2/settings"
 	"github.com/thevickypedia/filebrowser/v2/share"
 	"github.com/thevickypedia/filebrowser/v2/storage/bolt"
@@ -162,3 +166,342 @@ func signShareTestToken(t *testing.T, id uint, username string, perm users.Permi
 	}
 	return signed
 }
+
+func TestShareDownloadLimit(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scope, "delivery.txt"), []byte("delivery"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Share: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, key)
+	if err := st.Share.Save(&share.Link{Hash: "h", Path: "/delivery.txt", UserID: 1, MaxDownloads: 1, MaxVisits: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &settings.Server{}
+	get := func(handler handleFunc, prefix string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, prefix+"h/delivery.txt", http.NoBody)
+		req.Header.Set("User-Agent", "customer")
+		rec := httptest.NewRecorder()
+		handle(handler, prefix, st, server).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := get(publicShareHandler, "/api/public/share/"); code != http.StatusOK {
+		t.Fatalf("expected the visit to succeed, got %d", code)
+	}
+	if code := get(publicDlHandler, "/api/public/dl/"); code != http.StatusOK {
+		t.Fatalf("expected the download to succeed, got %d", code)
+	}
+
+	link, err := st.Share.GetByHash("h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Visits != 1 || link.Downloads != 1 {
+		t.Fatalf("expected 1 visit and 1 download to be counted, got %d and %d", link.Visits, link.Downloads)
+	}
+
+	if code := get(publicDlHandler, "/api/public/dl/"); code != http.StatusNotFound {
+		t.Fatalf("expected the second download to be refused with 404, got %d", code)
+	}
+	if _, err := st.Share.GetByHash("h"); err == nil {
+		t.Fatal("expected the share to be revoked once used up")
+	}
+
+	// The accesses outlive the share, for its owner only.
+	access := func(id uint, username string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/share/h/access", http.NoBody)
+		req.Header.Set("X-Auth", signShareTestToken(t, id, username, perm, key))
+		rec := httptest.NewRecorder()
+		handle(shareAccessHandler, "/api/share", st, server).ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := access(1, "u")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%q", rec.Code, rec.Body.String())
+	}
+	var accesses []*share.Access
+	if err := json.Unmarshal(rec.Body.Bytes(), &accesses); err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 2 {
+		t.Fatalf("expected the 2 accesses served to be recorded, got %d", len(accesses))
+	}
+	dl := accesses[1]
+	if dl.Kind != share.AccessDownload || dl.File != "/delivery.txt" || dl.Bytes != int64(len("delivery")) || dl.UserAgent != "customer" || dl.Status != http.StatusOK {
+		t.Fatalf("unexpected download recorded: %+v", dl)
+	}
+
+	if err := st.Users.Save(&users.User{Username: "other", Password: "pw", Perm: perm}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := access(2, "other"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the accesses to be refused to other users with 403, got %d", rec.Code)
+	}
+}
+
+func TestShareDownloadResume(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(scope, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"delivery.txt", "dir/a.txt"} {
+		if err := os.WriteFile(filepath.Join(scope, name), []byte("delivery"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	perm := users.Permissions{Share: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, []byte("test-signing-key"))
+	for _, link := range []*share.Link{
+		{Hash: "file", Path: "/delivery.txt", UserID: 1, MaxDownloads: 2},
+		{Hash: "dir", Path: "/dir", UserID: 1, MaxDownloads: 1},
+	} {
+		if err := st.Share.Save(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := &settings.Server{}
+	get := func(target, rng string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/public/dl/"+target, http.NoBody)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		rec := httptest.NewRecorder()
+		handle(publicDlHandler, "/api/public/dl/", st, server).ServeHTTP(rec, req)
+		return rec.Code
+	}
+	downloads := func(hash string) uint {
+		t.Helper()
+		link, err := st.Share.GetByHash(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return link.Downloads
+	}
+
+	// Only the partial contents not starting at the first byte resume a
+	// download.
+	for _, c := range []struct {
+		rng  string
+		want uint
+	}{
+		{"bytes=0-3", 1},
+		{"bytes=4-", 1},
+		{"bytes=-8", 2},
+		{"bytes=-4", 2},
+	} {
+		if code := get("file/delivery.txt", c.rng); code != http.StatusPartialContent {
+			t.Fatalf("%s: expected 206, got %d", c.rng, code)
+		}
+		if got := downloads("file"); got != c.want {
+			t.Fatalf("%s: expected %d downloads counted, got %d", c.rng, c.want, got)
+		}
+	}
+	if code := get("file/delivery.txt", ""); code != http.StatusNotFound {
+		t.Fatalf("expected the full download past the limit to be refused with 404, got %d", code)
+	}
+
+	// The archives ignore the ranges, and are always counted.
+	if code := get("dir/?algo=zip", "bytes=4-"); code != http.StatusOK {
+		t.Fatalf("expected the archive to be downloaded, got %d", code)
+	}
+	if code := get("dir/?algo=zip", "bytes=4-"); code != http.StatusNotFound {
+		t.Fatalf("expected the second archive to be refused with 404, got %d", code)
+	}
+}
+
+func TestSharePatchHandler(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scope, "file.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Share: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, key)
+	link := &share.Link{Hash: "h", Path: "/file.txt", UserID: 1, Expire: time.Now().Add(time.Hour).Unix()}
+	if err := link.SetPassword("old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Share.Save(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Users.Save(&users.User{Username: "other", Password: "pw", Perm: perm}); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(id uint, username, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPatch, "/api/share/h", strings.NewReader(body))
+		req.Header.Set("X-Auth", signShareTestToken(t, id, username, perm, key))
+		rec := httptest.NewRecorder()
+		handle(sharePatchHandler, "/api/share", st, &settings.Server{}).ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := patch(2, "other", `{"expires":""}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the share of another user to be refused with 403, got %d", rec.Code)
+	}
+	if rec := patch(1, "u", `{"maxFiles":1}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected the limits of file requests to be refused with 400, got %d", rec.Code)
+	}
+
+	rec := patch(1, "u", `{"expires":"","password":"","maxDownloads":3}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%q", rec.Code, rec.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["hash"] != "h" || resp["expire"] != float64(0) || resp["hasPassword"] != false || resp["maxDownloads"] != float64(3) {
+		t.Fatalf("unexpected share updated: %s", rec.Body.String())
+	}
+
+	stored, err := st.Share.GetByHash("h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PasswordHash != "" || stored.Token != "" {
+		t.Fatalf("expected the password and its token to be removed, got %q and %q", stored.PasswordHash, stored.Token)
+	}
+
+	if rec := patch(1, "u", `{"password":"new"}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	stored, err = st.Share.GetByHash("h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Token == "" || stored.Token == link.Token || stored.MaxDownloads != 3 {
+		t.Fatalf("expected a new token with the other options kept, got %+v", stored)
+	}
+}
+
+func TestShareCollection(t *testing.T) {
+	scope := t.TempDir()
+	for name, content := range map[string]string{
+		"docs/a.txt":        "a",
+		"docs/b.txt":        "b",
+		"photos/p.txt":      "p",
+		"photos/hidden.txt": "hidden",
+		"private/x.txt":     "x",
+	} {
+		if err := os.MkdirAll(filepath.Join(scope, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(scope, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The links within the members don't reach out of them.
+	if err := os.Symlink(filepath.Join("..", "docs", "b.txt"), filepath.Join(scope, "photos", "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Share: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, key)
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Rules = []rules.Rule{{Path: "/private"}, {Path: "/photos/hidden.txt"}}
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &settings.Server{}
+	create := func(body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/share/", strings.NewReader(body))
+		req.Header.Set("X-Auth", signToken(t, perm, key))
+		rec := httptest.NewRecorder()
+		handle(sharePostHandler, "/api/share", st, server).ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := create(`{"paths":["docs/a.txt","private/x.txt"]}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a member denied by the rules to be refused with 403, got %d", rec.Code)
+	}
+	if rec := create(`{"paths":["docs/a.txt","photos/a.txt"]}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing member to be refused with 404, got %d", rec.Code)
+	}
+	rec := create(`{"paths":["docs/a.txt","photos"],"name":"delivery"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%q", rec.Code, rec.Body.String())
+	}
+	var created shareResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(handler handleFunc, prefix, p string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, prefix+created.Hash+p, http.NoBody)
+		rec := httptest.NewRecorder()
+		handle(handler, prefix, st, server).ServeHTTP(rec, req)
+		return rec
+	}
+	names := func(rec *httptest.ResponseRecorder) []string {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d body=%q", rec.Code, rec.Body.String())
+		}
+		var dir struct {
+			Name  string `json:"name"`
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &dir); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, item := range dir.Items {
+			names = append(names, item.Name)
+		}
+		sort.Strings(names)
+		return append([]string{dir.Name}, names...)
+	}
+
+	if got := strings.Join(names(get(publicShareHandler, "/api/public/share/", "")), ","); got != "delivery,a.txt,photos" {
+		t.Fatalf("expected the collection to list its members, got %s", got)
+	}
+	if got := strings.Join(names(get(publicShareHandler, "/api/public/share/", "/photos")), ","); got != "photos,p.txt" {
+		t.Fatalf("expected the rules to apply within the members, got %s", got)
+	}
+	if rec := get(publicShareHandler, "/api/public/share/", "/b.txt"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected the siblings of the members to be hidden with 404, got %d", rec.Code)
+	}
+	if rec := get(publicDlHandler, "/api/public/dl/", "/a.txt"); rec.Code != http.StatusOK || rec.Body.String() != "a" {
+		t.Fatalf("expected the member to be downloaded, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = get(publicDlHandler, "/api/public/dl/", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for _, f := range archive.File {
+		entries = append(entries, f.Name)
+	}
+	sort.Strings(entries)
+	if got := strings.Join(entries, ","); got != "a.txt,photos/,photos/p.txt" {
+		t.Fatalf("expected the members to be archived under their names, got %s", got)
+	}
+}
@@ -29,8 +29,6 @@ func handleWithStaticData(w http.ResponseWriter, _ *http.Request, d *data, fSys
 		return http.StatusInternalServerError, err
 	}
 
-	// Otp indicates whether OTP field should be shown on login page.
-	// Exposed to the frontend via window.FileBrowser.Otp
 	data := map[string]interface{}{
 		"Name":                  d.settings.Branding.Name,
 		"DisableExternal":       d.settings.Branding.DisableExternal,
@@ -46,7 +44,6 @@ func handleWithStaticData(w http.ResponseWriter, _ *http.Request, d *data, fSys
 		"LoginPage":             auther.LoginPage(),
 		"CSS":                   false,
 		"ReCaptcha":             false,
-		"Otp":                   false,
 		"Theme":                 d.settings.Branding.Theme,
 		"EnableThumbs":          d.server.EnableThumbnails,
 		"ResizePreview":         d.server.ResizePreview,
@@ -81,10 +78,6 @@ func handleWithStaticData(w http.ResponseWriter, _ *http.Request, d *data, fSys
 			data["ReCaptchaHost"] = auther.ReCaptcha.Host
 			data["ReCaptchaKey"] = auther.ReCaptcha.Key
 		}
-
-		if auther.AuthenticatorToken != "" {
-			data["Otp"] = true
-		}
 	}
 
 	b, err := json.Marshal(data)
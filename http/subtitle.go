@@ -14,7 +14,7 @@ import (
 
 var srtLineBreakTag = regexp.MustCompile(`(?i)<br(?:\s+[^>]*)?\s*/?>`)
 
-var subtitleHandler = withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+var subtitleHandler = withGrantUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	if !d.user.Perm.Download {
 		return http.StatusAccepted, nil
 	}
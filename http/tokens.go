@@ -0,0 +1,115 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// tokenInfo is what users see of their tokens, leaving their hashes out.
+type tokenInfo struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Perm       users.Permissions `json:"perm"`
+	Path       string            `json:"path"`
+	ExpiresAt  time.Time         `json:"expires"`
+	CreatedAt  time.Time         `json:"created"`
+	LastUsedAt time.Time         `json:"lastUsed"`
+}
+
+func newTokenInfo(t *tokens.Token) tokenInfo {
+	return tokenInfo{
+		ID:         t.ID,
+		Name:       t.Name,
+		Perm:       t.Perm,
+		Path:       t.Path,
+		ExpiresAt:  t.ExpiresAt,
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
+
+type tokenRequest struct {
+	Name      string            `json:"name"`
+	Perm      users.Permissions `json:"perm"`
+	Path      string            `json:"path"`
+	ExpiresAt time.Time         `json:"expires"`
+}
+
+var tokenListHandler = withSessionUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	list, err := d.store.Tokens.FindByUserID(d.user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	infos := make([]tokenInfo, 0, len(list))
+	for _, t := range list {
+		infos = append(infos, newTokenInfo(t))
+	}
+	return renderJSON(w, r, infos)
+})
+
+// tokenPostHandler creates a token of the user, responding with the token
+// itself. It is only ever shown then.
+var tokenPostHandler = withSessionUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if r.Body == nil {
+		return http.StatusBadRequest, fberrors.ErrEmptyRequest
+	}
+
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || !req.ExpiresAt.After(time.Now()) {
+		return http.StatusBadRequest, fberrors.ErrInvalidRequestParams
+	}
+	if req.Perm.Share && !req.Perm.Download {
+		return http.StatusBadRequest, fberrors.ErrShareRequiresDownload
+	}
+
+	// Tokens can't grant more than their users have, whatever they ask for.
+	t, raw := tokens.New(d.user.ID, req.Name, req.Perm, req.Path, req.ExpiresAt)
+	t.Perm = t.Restrict(d.user.Perm)
+	if err := d.store.Tokens.Save(t); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(struct {
+		tokenInfo
+		Token string `json:"token"`
+	}{newTokenInfo(t), raw}); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+})
+
+var tokenDeleteHandler = withSessionUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	t, err := d.store.Tokens.Get(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, fberrors.ErrNotExist):
+		return http.StatusNotFound, nil
+	case err != nil:
+		return http.StatusInternalServerError, err
+	}
+	// Others' tokens aren't told apart from unknown ones.
+	if t.UserID != d.user.ID {
+		return http.StatusNotFound, nil
+	}
+
+	if err := d.store.Tokens.Delete(t.ID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+})
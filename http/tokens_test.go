@@ -0,0 +1,188 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestPersonalTokens(t *testing.T) {
+	scope := t.TempDir()
+	for _, dir := range []string{"backups", "private"} {
+		if err := os.MkdirAll(filepath.Join(scope, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Create: true, Delete: true, Share: true, Download: true}
+	st := scopedUserStorage(t, scope, perm, key)
+	signed := signToken(t, perm, key)
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.Handle("/tokens", handle(tokenListHandler, "", st, server)).Methods("GET")
+	router.Handle("/tokens", handle(tokenPostHandler, "", st, server)).Methods("POST")
+	router.Handle("/tokens/{id}", handle(tokenDeleteHandler, "", st, server)).Methods("DELETE")
+	router.Handle("/renew", handle(renewHandler(time.Hour), "", st, server)).Methods("POST")
+	router.PathPrefix("/resources").Handler(handle(resourceGetHandler, "/resources", st, server)).Methods("GET")
+	router.PathPrefix("/share").Handler(handle(sharePostHandler, "/share", st, server)).Methods("POST")
+
+	do := func(method, url, auth, body string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		var r io.Reader = http.NoBody
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, url, r)
+		if strings.HasPrefix(auth, tokens.Prefix) {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		} else {
+			req.Header.Set("X-Auth", auth)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+	do(http.MethodPost, "/tokens", signed, `{"name":"","expires":"`+expires+`"}`, http.StatusBadRequest)
+	do(http.MethodPost, "/tokens", signed, `{"name":"ci","expires":"2001-01-01T00:00:00Z"}`, http.StatusBadRequest)
+
+	var created struct {
+		tokenInfo
+		Token string `json:"token"`
+	}
+	body := `{"name":"ci","path":"backups","expires":"` + expires + `","perm":{"admin":true,"download":true}}`
+	if err := json.NewDecoder(do(http.MethodPost, "/tokens", signed, body, http.StatusCreated).Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Token, tokens.Prefix) || created.Path != "/backups" {
+		t.Fatalf("unexpected token %+v", created)
+	}
+	// Tokens don't grant what their users don't have.
+	if created.Perm != (users.Permissions{Download: true}) {
+		t.Errorf("expected the permissions to be restricted, got %+v", created.Perm)
+	}
+	stored, err := st.Tokens.Get(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(created.Token, stored.Hash) {
+		t.Error("expected the token to be stored hashed")
+	}
+
+	// Tokens are restricted to their path.
+	do(http.MethodGet, "/resources/backups/", created.Token, "", http.StatusOK)
+	do(http.MethodGet, "/resources/private/", created.Token, "", http.StatusForbidden)
+	do(http.MethodGet, "/resources/", created.Token, "", http.StatusForbidden)
+	do(http.MethodGet, "/resources/backups/", created.Token+"x", "", http.StatusUnauthorized)
+	if stored, err := st.Tokens.Get(created.ID); err != nil || stored.LastUsedAt.IsZero() {
+		t.Errorf("expected the token to be marked as used, got %+v %v", stored, err)
+	}
+
+	// Tokens can't mint sessions or other tokens.
+	do(http.MethodPost, "/renew", created.Token, "", http.StatusForbidden)
+	do(http.MethodGet, "/tokens", created.Token, "", http.StatusForbidden)
+	do(http.MethodPost, "/tokens", created.Token, body, http.StatusForbidden)
+
+	var list []map[string]interface{}
+	if err := json.NewDecoder(do(http.MethodGet, "/tokens", signed, "", http.StatusOK).Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0]["id"] != created.ID || list[0]["hash"] != nil || list[0]["token"] != nil {
+		t.Errorf("expected the token without its secret, got %v", list)
+	}
+
+	// Tokens can't share what's outside of their path.
+	sharing, rawSharing := tokens.New(1, "share", perm, "/backups", time.Now().Add(time.Hour))
+	if err := st.Tokens.Save(sharing); err != nil {
+		t.Fatal(err)
+	}
+	do(http.MethodPost, "/share/private", rawSharing, "{}", http.StatusForbidden)
+	do(http.MethodPost, "/share/", rawSharing, "{}", http.StatusForbidden)
+	do(http.MethodPost, "/share/backups", rawSharing, "{}", http.StatusOK)
+
+	expired, raw := tokens.New(1, "old", perm, "/", time.Now().Add(-time.Minute))
+	if err := st.Tokens.Save(expired); err != nil {
+		t.Fatal(err)
+	}
+	do(http.MethodGet, "/resources/backups/", raw, "", http.StatusUnauthorized)
+
+	theirs, _ := tokens.New(2, "theirs", perm, "/", time.Now().Add(time.Hour))
+	if err := st.Tokens.Save(theirs); err != nil {
+		t.Fatal(err)
+	}
+	do(http.MethodDelete, "/tokens/"+theirs.ID, signed, "", http.StatusNotFound)
+	do(http.MethodDelete, "/tokens/"+created.ID, signed, "", http.StatusNoContent)
+	do(http.MethodGet, "/resources/backups/", created.Token, "", http.StatusUnauthorized)
+}
+
+func TestPersonalTokenCommands(t *testing.T) {
+	scope := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(scope, "backups"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Execute: true}
+	st := scopedUserStorage(t, scope, perm, key)
+	user, err := st.Users.Get("", false, uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Commands = []string{"echo"}
+	if err := st.Users.Save(user); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(handle(commandsHandler, "/command", st, &settings.Server{EnableExec: true}))
+	defer server.Close()
+
+	run := func(scope string) string {
+		t.Helper()
+		token, raw := tokens.New(1, scope, perm, scope, time.Now().Add(time.Hour))
+		if err := st.Tokens.Save(token); err != nil {
+			t.Fatal(err)
+		}
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/command/backups"
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + raw}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("echo hi")); err != nil {
+			t.Fatal(err)
+		}
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(msg)
+	}
+
+	// Commands aren't confined to a path, so restricted tokens can't run any,
+	// even within their path.
+	if got := run("/"); got != "hi" {
+		t.Errorf("expected the command to run, got %q", got)
+	}
+	if got := run("/backups"); got != string(cmdNotAllowed) {
+		t.Errorf("expected the command to be refused, got %q", got)
+	}
+}
@@ -0,0 +1,167 @@
+package fbhttp
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+
+	"github.com/thevickypedia/filebrowser/v2/files"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/search"
+	"github.com/thevickypedia/filebrowser/v2/trash"
+)
+
+// realPath returns the real path of name within the user's scope, with the
+// symbolic links of its parent directories resolved, refusing the paths that
+// escape the scope through them.
+func realPath(d *data, name string) (string, error) {
+	if scoped, ok := d.user.Fs.(*files.ScopedFs); ok {
+		if err := scoped.Guard(name); err != nil {
+			return "", err
+		}
+	}
+
+	fullPath := d.user.FullPath(name)
+	parent, err := filepath.EvalSymlinks(filepath.Dir(fullPath))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, filepath.Base(fullPath)), nil
+}
+
+// removeAll removes name, or moves it to the trash when it is enabled. The
+// delete hooks run either way, the trash ones only around the move to the
+// trash.
+func removeAll(d *data, bin *trash.Bin, name string) error {
+	return d.RunHook(func() error {
+		if bin == nil {
+			return d.user.Fs.RemoveAll(name)
+		}
+
+		return d.RunHook(func() error {
+			name := path.Clean("/" + name)
+			real, err := realPath(d, name)
+			if err != nil {
+				return err
+			}
+
+			// The files deleted from grants are restored by their owners.
+			deletedBy := d.user.Username
+			if d.grantee != nil {
+				deletedBy = d.grantee.Username
+			}
+			_, err = bin.Put(d.user.ID, d.scopePath(name), real, deletedBy)
+			return err
+		}, "trash", name, "", d.user)
+	}, "delete", name, "", d.user)
+}
+
+func withTrash(bin *trash.Bin, fn handleFunc) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if bin == nil {
+			return http.StatusNotFound, nil
+		}
+		return fn(w, r, d)
+	})
+}
+
+func trashListHandler(bin *trash.Bin) handleFunc {
+	return withTrash(bin, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		items, err := bin.List(d.user.ID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		// The rules may have changed since the items were deleted.
+		visible := make([]*trash.Item, 0, len(items))
+		for _, item := range items {
+			if d.Check(item.Path) {
+				visible = append(visible, item)
+			}
+		}
+
+		return renderJSON(w, r, visible)
+	})
+}
+
+func trashRestoreHandler(bin *trash.Bin, searchIndex *search.Index, quotas *quota.Tracker) handleFunc {
+	return withTrash(bin, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		item, err := bin.Get(d.user.ID, mux.Vars(r)["id"])
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		if !d.user.Perm.Create || !d.Check(item.Path) {
+			return http.StatusForbidden, nil
+		}
+
+		// Something may have been created at the same path since the item was
+		// deleted, it is kept and the item restored next to it.
+		dst := addVersionSuffix(item.Path, d.user.Fs)
+		if err := d.user.Fs.MkdirAll(path.Dir(dst), d.settings.DirMode); err != nil {
+			return errToStatus(err), err
+		}
+
+		root := d.quotaRoot()
+		restored := quotas.Measure(bin.Path(item))
+		if err := quotas.Check(root, d.user.Quota, restored.Bytes, restored.Files); err != nil {
+			return errToStatus(err), err
+		}
+
+		real, err := realPath(d, dst)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		err = d.RunHook(func() error {
+			return bin.Restore(item, real)
+		}, "restore", dst, "", d.user)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		quotas.Add(root, restored.Bytes, restored.Files)
+		searchIndex.Update(real)
+
+		item.Path = dst
+		return renderJSON(w, r, item)
+	})
+}
+
+// trashPurgeHandler deletes an item for good, or every item of the user when
+// no item is given.
+func trashPurgeHandler(bin *trash.Bin) handleFunc {
+	return withTrash(bin, func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if !d.user.Perm.Delete {
+			return http.StatusForbidden, nil
+		}
+
+		var items []*trash.Item
+		if id, ok := mux.Vars(r)["id"]; ok {
+			item, err := bin.Get(d.user.ID, id)
+			if err != nil {
+				return errToStatus(err), err
+			}
+			items = append(items, item)
+		} else {
+			var err error
+			items, err = bin.List(d.user.ID)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+
+		var err error
+		for _, item := range items {
+			err = errors.Join(err, bin.Purge(item))
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		return http.StatusNoContent, nil
+	})
+}
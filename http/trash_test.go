@@ -0,0 +1,104 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/trash"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestTrash(t *testing.T) {
+	userScope := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(userScope, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(userScope, "docs", "notes.txt"), []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Create: true, Delete: true}
+	st := scopedUserStorage(t, userScope, perm, key)
+	signed := signToken(t, perm, key)
+
+	bin, err := trash.NewBin(t.TempDir(), 0, st.Trash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.PathPrefix("/resources").Handler(handle(resourceDeleteHandler(diskcache.NewNoOp(), nil, nil, bin, nil), "/resources", st, server)).Methods("DELETE")
+	router.Handle("/trash", handle(trashListHandler(bin), "", st, server)).Methods("GET")
+	router.Handle("/trash/{id}", handle(trashPurgeHandler(bin), "", st, server)).Methods("DELETE")
+	router.Handle("/trash/{id}/restore", handle(trashRestoreHandler(bin, nil, nil), "", st, server)).Methods("POST")
+
+	do := func(method, url string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, nil)
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+	list := func() []trash.Item {
+		t.Helper()
+		var items []trash.Item
+		if err := json.NewDecoder(do(http.MethodGet, "/trash", http.StatusOK).Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		return items
+	}
+
+	do(http.MethodDelete, "/resources/docs/", http.StatusNoContent)
+	if _, err := os.Stat(filepath.Join(userScope, "docs")); !os.IsNotExist(err) {
+		t.Fatalf("expected the directory to be gone from the scope, got %v", err)
+	}
+
+	items := list()
+	if len(items) != 1 || items[0].Path != "/docs" || !items[0].IsDir || items[0].Size != 7 || items[0].DeletedBy != "u" {
+		t.Fatalf("expected the directory to be in the trash, got %+v", items)
+	}
+
+	// Something was created at the same path in the meantime.
+	if err := os.MkdirAll(filepath.Join(userScope, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var restored trash.Item
+	if err := json.NewDecoder(do(http.MethodPost, "/trash/"+items[0].ID+"/restore", http.StatusOK).Body).Decode(&restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Path != "/docs(1)" {
+		t.Errorf("expected the restored directory to be renamed, got %s", restored.Path)
+	}
+	if data, err := os.ReadFile(filepath.Join(userScope, "docs(1)", "notes.txt")); err != nil || string(data) != "keep me" {
+		t.Errorf("expected the content to be restored, got %q (%v)", data, err)
+	}
+	if items := list(); len(items) != 0 {
+		t.Errorf("expected the trash to be empty, got %+v", items)
+	}
+
+	do(http.MethodDelete, "/resources/docs(1)/notes.txt", http.StatusNoContent)
+	items = list()
+	if len(items) != 1 {
+		t.Fatalf("expected one item in the trash, got %+v", items)
+	}
+	do(http.MethodDelete, "/trash/"+items[0].ID, http.StatusNoContent)
+	if _, err := os.Stat(bin.Path(&items[0])); !os.IsNotExist(err) {
+		t.Errorf("expected the purged file to be gone, got %v", err)
+	}
+	do(http.MethodPost, "/trash/"+items[0].ID+"/restore", http.StatusNotFound)
+}
@@ -5,13 +5,20 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
 	"github.com/thevickypedia/filebrowser/v2/files"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/search"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+	"github.com/thevickypedia/filebrowser/v2/webhooks"
 	"github.com/spf13/afero"
 )
 
@@ -38,8 +45,14 @@ func keepUploadActive(cache UploadCache, filePath string) func() {
 	}
 }
 
-func tusPostHandler(cache UploadCache) handleFunc {
-	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+func tusPostHandler(cache UploadCache, quotas *quota.Tracker, history *versions.History) handleFunc {
+	return withGrantUser(tusPost(cache, quotas, history))
+}
+
+// tusPost starts a chunked upload to the path of the request, by the user or
+// by whoever uploads to their file request.
+func tusPost(cache UploadCache, quotas *quota.Tracker, history *versions.History) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		if !d.user.Perm.Create || !d.Check(r.URL.Path) {
 			return http.StatusForbidden, nil
 		}
@@ -52,18 +65,20 @@ func tusPostHandler(cache UploadCache) handleFunc {
 			ReadHeader: d.server.TypeDetectionByHeader,
 			Checker:    d,
 		})
+		replaced, newFiles := int64(0), int64(1)
 		switch {
 		case errors.Is(err, afero.ErrFileNotFound):
-			dirPath := filepath.Dir(r.URL.Path)
-			if _, statErr := d.user.Fs.Stat(dirPath); os.IsNotExist(statErr) {
-				if mkdirErr := d.user.Fs.MkdirAll(dirPath, d.settings.DirMode); mkdirErr != nil {
-					return http.StatusInternalServerError, err
-				}
-			}
+			// The missing parents of the file are created along with it.
+			newFiles += missingDirs(d.user.Fs, filepath.Dir(r.URL.Path))
 		case err != nil:
 			return errToStatus(err), err
 		}
 
+		uploadLength, err := getUploadLength(r)
+		if err != nil || uploadLength < 0 {
+			return http.StatusBadRequest, fmt.Errorf("invalid upload length: %w", err)
+		}
+
 		fileFlags := os.O_CREATE | os.O_WRONLY
 
 		// if file exists
@@ -83,6 +98,22 @@ func tusPostHandler(cache UploadCache) handleFunc {
 			}
 
 			fileFlags |= os.O_TRUNC
+			replaced, newFiles = file.Size, 0
+		}
+
+		// The whole upload must fit in the quota before it starts.
+		root := d.quotaRoot()
+		err = quotas.Check(root, d.user.Quota, uploadLength-replaced, newFiles)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		if fileFlags&os.O_TRUNC != 0 {
+			if err := saveVersion(d, history, quotas, r.URL.Path); err != nil {
+				return errToStatus(err), err
+			}
+		} else if err := d.user.Fs.MkdirAll(filepath.Dir(r.URL.Path), d.settings.DirMode); err != nil {
+			return http.StatusInternalServerError, err
 		}
 
 		openFile, err := d.user.Fs.OpenFile(r.URL.Path, fileFlags, d.settings.FileMode)
@@ -90,6 +121,7 @@ func tusPostHandler(cache UploadCache) handleFunc {
 			return errToStatus(err), err
 		}
 		defer openFile.Close()
+		quotas.Add(root, -replaced, newFiles)
 
 		file, err = files.NewFileInfo(&files.FileOptions{
 			Fs:         d.user.Fs,
@@ -104,11 +136,6 @@ func tusPostHandler(cache UploadCache) handleFunc {
 			return errToStatus(err), err
 		}
 
-		uploadLength, err := getUploadLength(r)
-		if err != nil || uploadLength < 0 {
-			return http.StatusBadRequest, fmt.Errorf("invalid upload length: %w", err)
-		}
-
 		// Enables the user to utilize the PATCH endpoint for uploading file data
 		cache.Register(file.RealPath(), uploadLength)
 
@@ -117,13 +144,25 @@ func tusPostHandler(cache UploadCache) handleFunc {
 			basePath = ""
 		}
 
-		w.Header().Set("Location", basePath+"/api/tus"+r.URL.EscapedPath())
+		location := "/api/tus" + r.URL.EscapedPath()
+		switch {
+		case d.fileRequest != nil:
+			location = "/api/public/tus/" + d.fileRequest.Hash + r.URL.EscapedPath()
+		case d.grant != nil:
+			location = "/api/tus" + (&url.URL{Path: d.grantPath(r.URL.Path)}).EscapedPath()
+		}
+		w.Header().Set("Location", basePath+location)
 		return http.StatusCreated, nil
-	})
+	}
 }
 
 func tusHeadHandler(cache UploadCache) handleFunc {
-	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	return withGrantUser(tusHead(cache))
+}
+
+// tusHead tells how much of a chunked upload was received.
+func tusHead(cache UploadCache) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		w.Header().Set("Cache-Control", "no-store")
 		if !d.user.Perm.Create || !d.Check(r.URL.Path) {
 			return http.StatusForbidden, nil
@@ -150,11 +189,16 @@ func tusHeadHandler(cache UploadCache) handleFunc {
 		w.Header().Set("Upload-Length", strconv.FormatInt(uploadLength, 10))
 
 		return http.StatusOK, nil
-	})
+	}
+}
+
+func tusPatchHandler(cache UploadCache, searchIndex *search.Index, quotas *quota.Tracker) handleFunc {
+	return withGrantUser(tusPatch(cache, searchIndex, quotas))
 }
 
-func tusPatchHandler(cache UploadCache) handleFunc {
-	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+// tusPatch writes a chunk of an upload.
+func tusPatch(cache UploadCache, searchIndex *search.Index, quotas *quota.Tracker) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		if !d.user.Perm.Create || !d.Check(r.URL.Path) {
 			return http.StatusForbidden, nil
 		}
@@ -214,8 +258,21 @@ func tusPatchHandler(cache UploadCache) handleFunc {
 			return http.StatusInternalServerError, fmt.Errorf("could not seek file: %w", err)
 		}
 
+		root := d.quotaRoot()
+		body, err := quotas.Limit(r.Body, root, d.user.Quota, 0)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
 		defer r.Body.Close()
-		bytesWritten, err := io.Copy(openFile, r.Body)
+		// The upload can't grow past the length it was started with, which
+		// the file requests count.
+		bytesWritten, err := io.Copy(openFile, io.LimitReader(body, uploadLength-uploadOffset))
+		quotas.Add(root, bytesWritten, 0)
+		countUpload(apiTus, bytesWritten)
+		if errors.Is(err, fberrors.ErrQuotaExceeded) {
+			return errToStatus(err), err
+		}
 		if err != nil {
 			return http.StatusInternalServerError, fmt.Errorf("could not write to file: %w", err)
 		}
@@ -230,16 +287,26 @@ func tusPatchHandler(cache UploadCache) handleFunc {
 		w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
 
 		if newOffset >= uploadLength {
+			// Uploads are only recorded once complete, not chunk by chunk.
+			d.audit(audit.ActionUpload, r.URL.Path, "")
 			cache.Complete(file.RealPath())
-			_ = d.RunHook(func() error { return nil }, "upload", r.URL.Path, "", d.user)
+			// The upload can only be refused by the webhooks once complete,
+			// removing it then.
+			err = d.RunHook(func() error { return nil }, "upload", r.URL.Path, "", d.user)
+			if errors.Is(err, webhooks.ErrVetoed) {
+				_ = d.user.Fs.RemoveAll(r.URL.Path)
+				quotas.Add(root, -newOffset, -1)
+				return http.StatusForbidden, err
+			}
+			searchIndex.Update(file.RealPath())
 		}
 
 		return http.StatusNoContent, nil
-	})
+	}
 }
 
-func tusDeleteHandler(cache UploadCache) handleFunc {
-	return withUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+func tusDeleteHandler(cache UploadCache, quotas *quota.Tracker) handleFunc {
+	return withGrantUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
 		if r.URL.Path == "/" || !d.user.Perm.Delete {
 			return http.StatusForbidden, nil
 		}
@@ -267,6 +334,7 @@ func tusDeleteHandler(cache UploadCache) handleFunc {
 		}
 
 		cache.Complete(file.RealPath())
+		quotas.Add(d.quotaRoot(), -file.Size, -1)
 
 		return http.StatusNoContent, nil
 	})
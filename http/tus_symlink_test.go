@@ -82,12 +82,12 @@ func TestTusHandlersRejectSymlinkScopeEscape(t *testing.T) {
 	}{
 		"POST create through symlinked dir": {
 			method:  http.MethodPost,
-			handler: tusPostHandler(newMemoryUploadCache()),
+			handler: tusPostHandler(newMemoryUploadCache(), nil, nil),
 			headers: map[string]string{"Upload-Length": "20"},
 		},
 		"PATCH write through symlinked dir": {
 			method:  http.MethodPatch,
-			handler: tusPatchHandler(newMemoryUploadCache()),
+			handler: tusPatchHandler(newMemoryUploadCache(), nil, nil),
 			headers: map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"},
 		},
 	}
@@ -27,6 +27,9 @@ type UploadCache interface {
 	// Touch refreshes the TTL for an active upload
 	Touch(filePath string)
 
+	// Active returns how many uploads are active
+	Active() int
+
 	// Close cleans up any resources
 	Close()
 }
@@ -69,6 +72,10 @@ func (c *memoryUploadCache) Touch(filePath string) {
 	c.cache.Touch(filePath)
 }
 
+func (c *memoryUploadCache) Active() int {
+	return c.cache.Len()
+}
+
 func (c *memoryUploadCache) Close() {
 	c.cache.Stop()
 }
@@ -79,6 +79,19 @@ func (c *redisUploadCache) Touch(filePath string) {
 	}
 }
 
+func (c *redisUploadCache) Active() int {
+	ctx := context.Background()
+	active := 0
+	iter := c.client.Scan(ctx, 0, c.filePathKey("*"), 0).Iterator()
+	for iter.Next(ctx) {
+		active++
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("failed to count uploads in redis cache: %v", err)
+	}
+	return active
+}
+
 func (c *redisUploadCache) Close() {
 	c.client.Close()
 }
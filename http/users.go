@@ -13,18 +13,22 @@ import (
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	"github.com/thevickypedia/filebrowser/v2/auth"
 	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
 	"github.com/thevickypedia/filebrowser/v2/users"
 )
 
 var (
-	NonModifiableFieldsForNonAdmin = []string{"Username", "Scope", "LockPassword", "Perm", "Commands", "Rules"}
+	NonModifiableFieldsForNonAdmin = []string{"Username", "Scope", "LockPassword", "Perm", "Commands", "Rules", "Quota", "SecondFactor", "Groups"}
 )
 
 type modifyUserRequest struct {
 	modifyRequest
 	Data *users.User `json:"data"`
+	// RevokeSessions asks for the other sessions of the user to be revoked
+	// when their password is changed.
+	RevokeSessions bool `json:"revokeSessions"`
 }
 
 func getUserID(r *http.Request) (uint, error) {
@@ -70,6 +74,12 @@ func withSelfOrAdmin(fn handleFunc) handleFunc {
 	})
 }
 
+// redactUser leaves the secrets of a user out.
+func redactUser(u *users.User) {
+	u.Password = ""
+	u.TOTP = users.TOTP{}
+}
+
 var usersGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
 	users, err := d.store.Users.Gets(d.server.Root, d.server.FollowExternalSymlinks)
 	if err != nil {
@@ -77,7 +87,7 @@ var usersGetHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *
 	}
 
 	for _, u := range users {
-		u.Password = ""
+		redactUser(u)
 	}
 
 	sort.Slice(users, func(i, j int) bool {
@@ -97,7 +107,7 @@ var userGetHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request
 		return http.StatusInternalServerError, err
 	}
 
-	u.Password = ""
+	redactUser(u)
 	if !d.user.Perm.Admin {
 		u.Scope = ""
 	}
@@ -105,6 +115,11 @@ var userGetHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request
 })
 
 var userDeleteHandler = withSelfOrAdmin(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	e := d.audit(audit.ActionUserDelete, "", "")
+	if u, err := d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, d.raw.(uint)); err == nil {
+		e.Detail = u.Username
+	}
+
 	if r.Body == nil {
 		return http.StatusBadRequest, fberrors.ErrEmptyRequest
 	}
@@ -128,14 +143,30 @@ var userDeleteHandler = withSelfOrAdmin(func(_ http.ResponseWriter, r *http.Requ
 		return errToStatus(err), err
 	}
 
+	// Otherwise a user given the same ID would inherit them.
+	if err := d.store.Passkeys.DeleteByUserID(d.raw.(uint)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := d.store.Tokens.DeleteByUserID(d.raw.(uint)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := d.store.Grants.DeleteByUserID(d.raw.(uint)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := auth.RemoveUserSessions(d.raw.(uint), ""); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
 	return http.StatusOK, nil
 })
 
 var userPostHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	e := d.audit(audit.ActionUserCreate, "", "")
 	req, err := getUser(w, r)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
+	e.Detail = req.Data.Username
 
 	if d.settings.AuthMethod == auth.MethodJSONAuth {
 		if !users.CheckPwd(req.CurrentPassword, d.user.Password) {
@@ -160,6 +191,11 @@ var userPostHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *
 		return http.StatusBadRequest, fberrors.ErrShareRequiresDownload
 	}
 
+	// Authenticators are only enrolled by their users, and identities only
+	// linked by OpenID Connect auth.
+	req.Data.TOTP = users.TOTP{}
+	req.Data.OIDCSubject = ""
+
 	userHome, err := d.settings.MakeUserDir(req.Data.Username, req.Data.Scope, d.server.Root)
 	if err != nil {
 		log.Printf("create user: failed to mkdir user home dir: [%s]", userHome)
@@ -178,10 +214,13 @@ var userPostHandler = withAdmin(func(w http.ResponseWriter, r *http.Request, d *
 })
 
 var userPutHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	e := d.audit(audit.ActionUserUpdate, "", "")
 	req, err := getUser(w, r)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
+	// The fields changed are told along with the user.
+	e.Detail = req.Data.Username + " (" + strings.Join(req.Which, ", ") + ")"
 
 	if d.settings.AuthMethod == auth.MethodJSONAuth {
 		var sensibleFields = map[string]struct{}{
@@ -192,6 +231,7 @@ var userPutHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request
 			"lockPassword": {},
 			"commands":     {},
 			"perm":         {},
+			"secondfactor": {},
 		}
 
 		for _, field := range req.Which {
@@ -216,22 +256,29 @@ var userPutHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	passwordChanged := false
 	if len(req.Which) == 0 || (len(req.Which) == 1 && req.Which[0] == "all") {
 		if !d.user.Perm.Admin {
 			return http.StatusForbidden, nil
 		}
 
+		var suser *users.User
+		suser, err = d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, d.raw.(uint))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		// Authenticators are only enrolled by their users, and identities
+		// only linked by OpenID Connect auth.
+		req.Data.TOTP = suser.TOTP
+		req.Data.OIDCSubject = suser.OIDCSubject
+
 		if req.Data.Password != "" {
+			passwordChanged = true
 			req.Data.Password, err = users.ValidateAndHashPwd(req.Data.Password, d.settings.MinimumPasswordLength)
 			if err != nil {
 				return http.StatusBadRequest, err
 			}
 		} else {
-			var suser *users.User
-			suser, err = d.store.Users.Get(d.server.Root, d.server.FollowExternalSymlinks, d.raw.(uint))
-			if err != nil {
-				return http.StatusInternalServerError, err
-			}
 			req.Data.Password = suser.Password
 		}
 
@@ -242,10 +289,15 @@ var userPutHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request
 		v = cases.Title(language.English, cases.NoLower).String(v)
 		req.Which[k] = v
 
+		if strings.EqualFold(v, "TOTP") || strings.EqualFold(v, "OIDCSubject") {
+			return http.StatusForbidden, nil
+		}
+
 		if v == "Password" {
 			if !d.user.Perm.Admin && d.user.LockPassword {
 				return http.StatusForbidden, nil
 			}
+			passwordChanged = true
 
 			req.Data.Password, err = users.ValidateAndHashPwd(req.Data.Password, d.settings.MinimumPasswordLength)
 			if err != nil {
@@ -265,5 +317,11 @@ var userPutHandler = withSelfOrAdmin(func(w http.ResponseWriter, r *http.Request
 		return http.StatusInternalServerError, err
 	}
 
+	if passwordChanged && req.RevokeSessions {
+		if err := auth.RemoveUserSessions(req.Data.ID, d.session); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
 	return http.StatusOK, nil
 })
@@ -10,9 +10,16 @@ import (
 
 	libErrors "github.com/thevickypedia/filebrowser/v2/errors"
 	imgErrors "github.com/thevickypedia/filebrowser/v2/img"
+	"github.com/thevickypedia/filebrowser/v2/webhooks"
 )
 
-func renderJSON(w http.ResponseWriter, _ *http.Request, data interface{}) (int, error) {
+func renderJSON(w http.ResponseWriter, r *http.Request, data interface{}) (int, error) {
+	return renderJSONStatus(w, r, 0, data)
+}
+
+// renderJSONStatus renders data with the status, written once data is known
+// to be marshaled. A zero status is the default one.
+func renderJSONStatus(w http.ResponseWriter, _ *http.Request, status int, data interface{}) (int, error) {
 	marsh, err := json.Marshal(data)
 
 	if err != nil {
@@ -20,6 +27,9 @@ func renderJSON(w http.ResponseWriter, _ *http.Request, data interface{}) (int,
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if status != 0 {
+		w.WriteHeader(status)
+	}
 	if _, err := w.Write(marsh); err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -43,8 +53,12 @@ func errToStatus(err error) int {
 		return http.StatusBadRequest
 	case errors.Is(err, libErrors.ErrRootUserDeletion):
 		return http.StatusForbidden
+	case errors.Is(err, libErrors.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
 	case errors.Is(err, imgErrors.ErrImageTooLarge):
 		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, webhooks.ErrVetoed):
+		return http.StatusForbidden
 	default:
 		return http.StatusInternalServerError
 	}
@@ -0,0 +1,328 @@
+package fbhttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/afero"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/files"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/search"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+)
+
+// maxDiffSize is the size above which files are not diffed, the same as the
+// one above which they are not considered text.
+const maxDiffSize = 10 * 1024 * 1024
+
+// saveVersion keeps the current content of name before it is overwritten.
+// The versions are charged to the quota of the scope of the file, the version
+// being refused with fberrors.ErrQuotaExceeded when there is no room for it.
+func saveVersion(d *data, history *versions.History, quotas *quota.Tracker, name string) error {
+	if history == nil || d.settings.Versions == 0 {
+		return nil
+	}
+
+	real, err := realPath(d, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	info, err := d.user.Fs.Stat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		// Only files have versions.
+		return nil
+	}
+
+	root := d.quotaRoot()
+	err = quotas.Check(root, d.user.Quota, info.Size(), 0)
+	if err != nil {
+		return err
+	}
+
+	before, err := history.Size(real)
+	if err != nil {
+		return err
+	}
+	err = history.Save(d.user.Fs, name, real, d.settings.Versions)
+
+	// The oldest versions may have been forgotten in the meantime.
+	after, sizeErr := history.Size(real)
+	if sizeErr == nil {
+		quotas.Add(root, after-before, 0)
+	}
+	return errors.Join(err, sizeErr)
+}
+
+// moveVersions makes the versions of what was at realSrc the versions of what
+// is now at dst.
+func moveVersions(d *data, history *versions.History, realSrc, dst string) error {
+	if history == nil {
+		return nil
+	}
+
+	realDst, err := realPath(d, dst)
+	if err != nil {
+		return err
+	}
+	return history.Move(realSrc, realDst)
+}
+
+func withVersions(history *versions.History, fn handleFunc) handleFunc {
+	return withUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if history == nil {
+			return http.StatusNotFound, nil
+		}
+
+		r.URL.Path = path.Clean("/" + r.URL.Path)
+		if r.URL.Path == "/" || !d.Check(r.URL.Path) {
+			return http.StatusForbidden, nil
+		}
+		return fn(w, r, d)
+	})
+}
+
+// getVersion returns the version of the file at name given by the query
+// parameter key.
+func getVersion(r *http.Request, d *data, history *versions.History, name, key string) (*versions.Version, error) {
+	id := r.URL.Query().Get(key)
+	if id == "" {
+		return nil, fberrors.ErrInvalidRequestParams
+	}
+
+	real, err := realPath(d, name)
+	if err != nil {
+		return nil, err
+	}
+	return history.Get(real, id)
+}
+
+// versionsGetHandler lists the versions of a file, or downloads one of them
+// with ?version=ID, or diffs one of them with ?diff=ID against the current
+// content, or against another version with &to=ID.
+func versionsGetHandler(history *versions.History) handleFunc {
+	return withVersions(history, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		switch {
+		case r.URL.Query().Has("version"):
+			return versionDownload(w, r, d, history)
+		case r.URL.Query().Has("diff"):
+			return versionDiff(w, r, d, history)
+		}
+
+		real, err := realPath(d, r.URL.Path)
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		list, err := history.List(real)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		// The real path is none of the user's business.
+		for _, v := range list {
+			v.Path = r.URL.Path
+		}
+		return renderJSON(w, r, list)
+	})
+}
+
+func versionDownload(w http.ResponseWriter, r *http.Request, d *data, history *versions.History) (int, error) {
+	if !d.user.Perm.Download {
+		return http.StatusAccepted, nil
+	}
+
+	v, err := getVersion(r, d, history, r.URL.Path, "version")
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	return rawFileHandler(w, r, &files.FileInfo{
+		Fs:      afero.NewOsFs(),
+		Path:    history.Path(v),
+		Name:    path.Base(r.URL.Path),
+		ModTime: v.ModTime,
+	})
+}
+
+func versionDiff(w http.ResponseWriter, r *http.Request, d *data, history *versions.History) (int, error) {
+	name := path.Base(r.URL.Path)
+	from, err := getVersion(r, d, history, r.URL.Path, "diff")
+	if err != nil {
+		return errToStatus(err), err
+	}
+	fromText, err := readText(afero.NewOsFs(), history.Path(from))
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	toName := name
+	toFs, toPath := d.user.Fs, r.URL.Path
+	if r.URL.Query().Has("to") {
+		to, err := getVersion(r, d, history, r.URL.Path, "to")
+		if err != nil {
+			return errToStatus(err), err
+		}
+		toName = name + "@" + to.ID
+		toFs, toPath = afero.NewOsFs(), history.Path(to)
+	}
+	toText, err := readText(toFs, toPath)
+	if err != nil {
+		return errToStatus(err), err
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(fromText),
+		B:        difflib.SplitLines(toText),
+		FromFile: name + "@" + from.ID,
+		ToFile:   toName,
+		Context:  3,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := io.WriteString(w, diff); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return 0, nil
+}
+
+// readText reads a file which must be text, like the ones the editor opens.
+func readText(afs afero.Fs, name string) (string, error) {
+	f, err := afs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, maxDiffSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(content) > maxDiffSize || bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+		return "", fmt.Errorf("%s is not a text file: %w", path.Base(name), fberrors.ErrInvalidRequestParams)
+	}
+	return string(content), nil
+}
+
+// versionsRestoreHandler puts a version of a file back in place, the content
+// it replaces becoming a version in turn.
+func versionsRestoreHandler(fileCache FileCache, searchIndex *search.Index, quotas *quota.Tracker, history *versions.History) handleFunc {
+	return withVersions(history, func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if !d.user.Perm.Modify {
+			return http.StatusForbidden, nil
+		}
+
+		v, err := getVersion(r, d, history, r.URL.Path, "version")
+		if err != nil {
+			return errToStatus(err), err
+		}
+
+		replaced := int64(0)
+		file, err := files.NewFileInfo(&files.FileOptions{
+			Fs:      d.user.Fs,
+			Path:    r.URL.Path,
+			Modify:  d.user.Perm.Modify,
+			Checker: d,
+		})
+		switch {
+		case err == nil:
+			if file.IsDir {
+				return http.StatusConflict, nil
+			}
+			if err := delThumbs(r.Context(), fileCache, file); err != nil {
+				return errToStatus(err), err
+			}
+			replaced = file.Size
+		case errors.Is(err, os.ErrNotExist):
+			if !d.user.Perm.Create {
+				return http.StatusForbidden, nil
+			}
+		default:
+			return errToStatus(err), err
+		}
+
+		root := d.quotaRoot()
+		newFiles := int64(0)
+		if file == nil {
+			newFiles = 1
+		}
+		if err := quotas.Check(root, d.user.Quota, v.Size-replaced, newFiles); err != nil {
+			return errToStatus(err), err
+		}
+
+		// One more version is kept for the time of the restore, so that the
+		// version being restored isn't the one forgotten to make room for the
+		// current content.
+		if keep := d.settings.Versions; file != nil && keep > 0 {
+			real, err := realPath(d, r.URL.Path)
+			if err != nil {
+				return errToStatus(err), err
+			}
+			// The content replaced is charged as a version, like any other.
+			if err := quotas.Check(root, d.user.Quota, v.Size, 0); err != nil {
+				return errToStatus(err), err
+			}
+			before, err := history.Size(real)
+			if err != nil {
+				return errToStatus(err), err
+			}
+			if err := history.Save(d.user.Fs, r.URL.Path, real, keep+1); err != nil {
+				return errToStatus(err), err
+			}
+			defer func() {
+				if err := history.Prune(real, keep); err != nil {
+					log.Printf("versions: could not prune %s: %v", real, err)
+				}
+				if after, err := history.Size(real); err == nil {
+					quotas.Add(root, after-before, 0)
+				}
+			}()
+		}
+
+		content, err := os.Open(history.Path(v))
+		if err != nil {
+			return errToStatus(err), err
+		}
+		defer content.Close()
+
+		var written int64
+		err = d.RunHook(func() error {
+			info, writeErr := writeFile(d.user.Fs, r.URL.Path, content, d.settings.FileMode, d.settings.DirMode)
+			if writeErr != nil {
+				return writeErr
+			}
+			written = info.Size()
+
+			etag := fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
+			w.Header().Set("ETag", etag)
+			return nil
+		}, "save", r.URL.Path, "", d.user)
+
+		// The file is truncated even when the write fails, what is left of it
+		// is measured again in that case.
+		if err != nil {
+			written = quotas.Measure(d.user.FullPath(r.URL.Path)).Bytes
+		}
+		quotas.Add(root, written-replaced, newFiles)
+		if err == nil {
+			searchIndex.Update(d.user.FullPath(r.URL.Path))
+		}
+
+		return errToStatus(err), err
+	})
+}
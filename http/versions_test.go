@@ -0,0 +1,202 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+)
+
+func TestVersions(t *testing.T) {
+	userScope := t.TempDir()
+	if err := os.WriteFile(filepath.Join(userScope, "notes.txt"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Create: true, Modify: true, Rename: true, Download: true}
+	st := scopedUserStorage(t, userScope, perm, key)
+	signed := signToken(t, perm, key)
+	if err := st.Settings.Save(&settings.Settings{Key: key, Versions: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := versions.NewHistory(t.TempDir(), st.Versions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.PathPrefix("/resources").Handler(handle(resourcePutHandler(nil, nil, history), "/resources", st, server)).Methods("PUT")
+	router.PathPrefix("/resources").Handler(handle(resourcePatchHandler(diskcache.NewNoOp(), nil, nil, history, nil), "/resources", st, server)).Methods("PATCH")
+	router.PathPrefix("/versions").Handler(handle(versionsGetHandler(history), "/versions", st, server)).Methods("GET")
+	router.PathPrefix("/versions").Handler(handle(versionsRestoreHandler(diskcache.NewNoOp(), nil, nil, history), "/versions", st, server)).Methods("POST")
+
+	do := func(method, url, body string, want int) string {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+	list := func(name string) []versions.Version {
+		t.Helper()
+		var list []versions.Version
+		if err := json.NewDecoder(strings.NewReader(do(http.MethodGet, "/versions"+name, "", http.StatusOK))).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	current := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(userScope, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	do(http.MethodPut, "/resources/notes.txt", "two\n", http.StatusOK)
+	do(http.MethodPut, "/resources/notes.txt", "three\n", http.StatusOK)
+
+	// The history moves along with the file.
+	do(http.MethodPatch, "/resources/notes.txt?action=rename&destination=/renamed.txt", "", http.StatusOK)
+	if got := list("/notes.txt"); len(got) != 0 {
+		t.Fatalf("expected no version left at the old path, got %+v", got)
+	}
+	got := list("/renamed.txt")
+	if len(got) != 2 || got[0].Path != "/renamed.txt" {
+		t.Fatalf("expected 2 versions of the renamed file, got %+v", got)
+	}
+	latest, oldest := got[0], got[1]
+
+	if content := do(http.MethodGet, "/versions/renamed.txt?version="+oldest.ID, "", http.StatusOK); content != "one\n" {
+		t.Errorf("expected the oldest version to be downloaded, got %q", content)
+	}
+
+	diff := do(http.MethodGet, "/versions/renamed.txt?diff="+latest.ID, "", http.StatusOK)
+	if !strings.Contains(diff, "-two\n") || !strings.Contains(diff, "+three\n") {
+		t.Errorf("expected a diff against the current content, got %q", diff)
+	}
+	diff = do(http.MethodGet, "/versions/renamed.txt?diff="+oldest.ID+"&to="+latest.ID, "", http.StatusOK)
+	if !strings.Contains(diff, "-one\n") || !strings.Contains(diff, "+two\n") {
+		t.Errorf("expected a diff between the versions, got %q", diff)
+	}
+
+	// Restoring keeps the replaced content as the most recent version, without
+	// forgetting the restored one to make room for it.
+	do(http.MethodPost, "/versions/renamed.txt?version="+oldest.ID, "", http.StatusOK)
+	if content := current("renamed.txt"); content != "one\n" {
+		t.Errorf("expected the version to be restored, got %q", content)
+	}
+	got = list("/renamed.txt")
+	if len(got) != 2 || got[1].ID != latest.ID {
+		t.Fatalf("expected the 2 most recent versions, got %+v", got)
+	}
+	content, err := os.Open(history.Path(&got[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	if b, _ := io.ReadAll(content); string(b) != "three\n" {
+		t.Errorf("expected the replaced content to be kept, got %q", b)
+	}
+
+	do(http.MethodGet, "/versions/renamed.txt?version=unknown", "", http.StatusNotFound)
+}
+
+func TestVersionsKeptOnceAllowed(t *testing.T) {
+	userScope := t.TempDir()
+	if err := os.WriteFile(filepath.Join(userScope, "notes.txt"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Modify: true}
+	st := scopedUserStorage(t, userScope, perm, key)
+	signed := signToken(t, perm, key)
+	set := &settings.Settings{Key: key, Versions: 2, Commands: map[string][]string{"before_save": {"false"}}}
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := versions.NewHistory(t.TempDir(), st.Versions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quotas := quota.NewTracker()
+	quotas.Charge(history.Size)
+
+	server := &settings.Server{EnableExec: true}
+	put := func(body string, want int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/resources/notes.txt", strings.NewReader(body))
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		handle(resourcePutHandler(nil, quotas, history), "/resources", st, server).ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("expected %d, got %d body=%q", want, rec.Code, rec.Body.String())
+		}
+	}
+	kept := func() int {
+		t.Helper()
+		list, err := history.List(filepath.Join(userScope, "notes.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(list)
+	}
+
+	put("two\n", http.StatusInternalServerError)
+	if n := kept(); n != 0 {
+		t.Fatalf("expected no version of a save refused by a hook, got %d", n)
+	}
+
+	set.Commands = nil
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+	u, err := st.Users.Get("", false, uint(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Quota = users.Quota{Bytes: 6}
+	if err := st.Users.Update(u, "Quota"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The version takes as much room as the content it was taken from.
+	put("two\n", http.StatusInsufficientStorage)
+	if n := kept(); n != 0 {
+		t.Fatalf("expected no version beyond the quota, got %d", n)
+	}
+
+	u.Quota = users.Quota{Bytes: 8}
+	if err := st.Users.Update(u, "Quota"); err != nil {
+		t.Fatal(err)
+	}
+	put("two\n", http.StatusOK)
+	if n := kept(); n != 1 {
+		t.Fatalf("expected the version to be kept, got %d", n)
+	}
+	if usage, _ := quotas.Usage(userScope); usage.Bytes != 8 {
+		t.Errorf("expected the version to be charged to the scope, got %+v", usage)
+	}
+}
@@ -0,0 +1,130 @@
+package fbhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
+)
+
+// passkeyInfo is what is shown of a passkey, leaving its key out.
+type passkeyInfo struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created"`
+	LastUsedAt time.Time `json:"lastUsed"`
+}
+
+func newPasskeyInfo(c *passkeys.Credential) passkeyInfo {
+	return passkeyInfo{ID: c.ID, Name: c.Name, CreatedAt: c.CreatedAt, LastUsedAt: c.LastUsedAt}
+}
+
+type passkeyRegistration struct {
+	Session    string          `json:"session"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// withPasskeys only serves when users log in with a password, which passkeys
+// are used besides or instead of.
+func withPasskeys(fn handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		if d.settings.AuthMethod != fbAuth.MethodJSONAuth {
+			return http.StatusNotFound, nil
+		}
+		return fn(w, r, d)
+	}
+}
+
+// webAuthnLoginBeginHandler challenges the browser to assert a passkey. The
+// answer is sent along with the login.
+var webAuthnLoginBeginHandler = withPasskeys(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	challenge, err := fbAuth.BeginPasskeyLogin(r, d.settings)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, challenge)
+})
+
+var webAuthnRegisterBeginHandler = withPasskeys(withSessionUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	credentials, err := d.store.Passkeys.FindByUserID(d.user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	challenge, err := fbAuth.BeginPasskeyRegistration(r, d.user, credentials, d.settings)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, challenge)
+}))
+
+var webAuthnRegisterFinishHandler = withPasskeys(withSessionUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	if r.Body == nil {
+		return http.StatusBadRequest, fberrors.ErrEmptyRequest
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAuthBodySize)
+
+	var body passkeyRegistration
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	credentials, err := d.store.Passkeys.FindByUserID(d.user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	credential, err := fbAuth.FinishPasskeyRegistration(r, d.user, credentials, d.settings,
+		body.Session, body.Name, bytes.NewReader(body.Credential))
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		log.Printf("Warning: Refused passkey of [%s]: %v", d.user.Username, err)
+		return http.StatusForbidden, nil
+	case err != nil:
+		return errToStatus(err), err
+	}
+
+	if err := d.store.Passkeys.Save(credential); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return renderJSONStatus(w, r, http.StatusCreated, newPasskeyInfo(credential))
+}))
+
+var passkeyListHandler = withPasskeys(withSessionUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	credentials, err := d.store.Passkeys.FindByUserID(d.user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	list := make([]passkeyInfo, 0, len(credentials))
+	for _, c := range credentials {
+		list = append(list, newPasskeyInfo(c))
+	}
+	return renderJSON(w, r, list)
+}))
+
+var passkeyDeleteHandler = withPasskeys(withSessionUser(func(_ http.ResponseWriter, r *http.Request, d *data) (int, error) {
+	credential, err := d.store.Passkeys.Get(mux.Vars(r)["id"])
+	if errors.Is(err, fberrors.ErrNotExist) || (err == nil && credential.UserID != d.user.ID) {
+		return http.StatusNotFound, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err := d.store.Passkeys.Delete(credential.ID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}))
@@ -0,0 +1,88 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gorilla/mux"
+
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestPasskeyHandlers(t *testing.T) {
+	key := []byte("test-signing-key")
+	st := scopedUserStorage(t, t.TempDir(), users.Permissions{}, key)
+	signed := signToken(t, users.Permissions{}, key)
+
+	for _, c := range []*passkeys.Credential{
+		passkeys.New(1, "Laptop", &webauthn.Credential{ID: []byte("mine")}),
+		passkeys.New(2, "Phone", &webauthn.Credential{ID: []byte("theirs")}),
+	} {
+		if err := st.Passkeys.Save(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := &settings.Server{}
+	router := mux.NewRouter()
+	router.Handle("/login/begin", handle(webAuthnLoginBeginHandler, "", st, server)).Methods("POST")
+	router.Handle("/credentials", handle(passkeyListHandler, "", st, server)).Methods("GET")
+	router.Handle("/credentials/{id}", handle(passkeyDeleteHandler, "", st, server)).Methods("DELETE")
+
+	do := func(method, url string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, url, http.NoBody)
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected %d, got %d body=%q", method, url, want, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	// Passkeys are only used along with passwords.
+	do(http.MethodPost, "/login/begin", http.StatusNotFound)
+	s, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AuthMethod = fbAuth.MethodJSONAuth
+	if err := st.Settings.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	var challenge fbAuth.WebAuthnChallenge
+	if err := json.NewDecoder(do(http.MethodPost, "/login/begin", http.StatusOK).Body).Decode(&challenge); err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Session == "" || challenge.Options == nil {
+		t.Errorf("expected a login challenge, got %+v", challenge)
+	}
+
+	// Only the passkeys of the user are listed, without their keys.
+	rec := do(http.MethodGet, "/credentials", http.StatusOK)
+	var list []map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	mine, theirs := passkeys.EncodeID([]byte("mine")), passkeys.EncodeID([]byte("theirs"))
+	if len(list) != 1 || list[0]["id"] != mine || list[0]["name"] != "Laptop" || list[0]["credential"] != nil {
+		t.Errorf("expected the passkey of the user, got %v", list)
+	}
+
+	do(http.MethodDelete, "/credentials/"+theirs, http.StatusNotFound)
+	do(http.MethodDelete, "/credentials/"+mine, http.StatusNoContent)
+	if c, err := st.Passkeys.FindByUserID(1); err != nil || len(c) != 0 {
+		t.Errorf("expected the passkey to be revoked, got %v %v", c, err)
+	}
+	if c, err := st.Passkeys.FindByUserID(2); err != nil || len(c) != 1 {
+		t.Errorf("expected the passkey of someone else to be kept, got %v %v", c, err)
+	}
+}
@@ -0,0 +1,488 @@
+package fbhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+	fbAuth "github.com/thevickypedia/filebrowser/v2/auth"
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/files"
+	"github.com/thevickypedia/filebrowser/v2/fileutils"
+	"github.com/thevickypedia/filebrowser/v2/quota"
+	"github.com/thevickypedia/filebrowser/v2/search"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
+	"github.com/thevickypedia/filebrowser/v2/trash"
+	"github.com/thevickypedia/filebrowser/v2/users"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+)
+
+const webdavRealm = `Basic realm="File Browser"`
+
+// webdavLocks keeps one lock system per user so that locks taken by a user
+// only ever apply to paths within their own scope.
+type webdavLocks struct {
+	mu      sync.Mutex
+	systems map[uint]webdav.LockSystem
+}
+
+func (l *webdavLocks) get(id uint) webdav.LockSystem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ls, ok := l.systems[id]
+	if !ok {
+		ls = webdav.NewMemLS()
+		l.systems[id] = ls
+	}
+	return ls
+}
+
+// withDAVUser authenticates WebDAV requests. WebDAV clients can't go through
+// the login page, so authers that verify passwords are fed the HTTP Basic
+// credentials while the others (proxy, none) authenticate the request as is.
+// Personal API tokens are accepted as bearer tokens, or as the password of
+// their user for clients that only speak HTTP Basic.
+func withDAVUser(fn handleFunc) handleFunc {
+	return func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		raw, ok := personalToken(r)
+		username, password, basic := r.BasicAuth()
+		if basic && strings.HasPrefix(password, tokens.Prefix) {
+			raw, ok = password, true
+		}
+		if ok {
+			status, err := authPersonalToken(d, raw)
+			if status == 0 && basic && d.user.Username != username {
+				status = http.StatusUnauthorized
+			}
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", webdavRealm)
+			}
+			if status != 0 {
+				return status, err
+			}
+			if mustEnrollOtp(d, d.user) {
+				return http.StatusForbidden, fberrors.ErrOtpEnrollmentRequired
+			}
+			return fn(w, r, d)
+		}
+
+		auther, err := d.store.Auth.Get(d.settings.AuthMethod)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		pa, ok := auther.(fbAuth.PasswordAuther)
+		if ok && !basic {
+			w.Header().Set("WWW-Authenticate", webdavRealm)
+			return http.StatusUnauthorized, nil
+		}
+		d.user, err = d.store.Limits.Login(fbAuth.ClientIP(r, d.settings.LoginLimits), d.settings.LoginLimits, func() (*users.User, error) {
+			if ok {
+				return pa.AuthPassword(r, username, password, d.store.Users, d.settings, d.server)
+			}
+			return auther.Auth(r, d.store.Users, d.settings, d.server)
+		})
+		countLogin(err)
+
+		var lockout *fbAuth.LockoutError
+		switch {
+		case errors.As(err, &lockout):
+			return lockedOut(w, lockout)
+		case errors.Is(err, os.ErrPermission), errors.Is(err, fberrors.ErrNotExist):
+			w.Header().Set("WWW-Authenticate", webdavRealm)
+			return http.StatusUnauthorized, nil
+		case err != nil:
+			return http.StatusInternalServerError, err
+		}
+
+		return fn(w, r, d)
+	}
+}
+
+func webdavHandler(fileCache FileCache, searchIndex *search.Index, quotas *quota.Tracker, bin *trash.Bin, history *versions.History) handleFunc {
+	locks := &webdavLocks{systems: map[uint]webdav.LockSystem{}}
+
+	return withDAVUser(func(w http.ResponseWriter, r *http.Request, d *data) (int, error) {
+		handler := &webdav.Handler{
+			// The handler needs the full prefix, as seen by the client, to
+			// build the hrefs of its responses and to resolve the Destination
+			// header of COPY and MOVE requests.
+			Prefix:     d.server.BaseURL + d.server.WebDAVPrefix,
+			FileSystem: &webdavFs{d: d, fileCache: fileCache, searchIndex: searchIndex, quotas: quotas, bin: bin, history: history},
+			LockSystem: locks.get(d.user.ID),
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					log.Printf("webdav: %s %s: %v", r.Method, r.URL.Path, err)
+				}
+				auditDAV(d, r, err)
+			},
+		}
+
+		r.URL.Path = d.server.BaseURL + r.URL.Path
+		r.URL.RawPath = ""
+		handler.ServeHTTP(w, r)
+		return 0, nil
+	})
+}
+
+// webdavActions are the audit actions of the WebDAV methods recorded, the
+// others only reading metadata or locking.
+var webdavActions = map[string]string{
+	http.MethodGet:    audit.ActionDownload,
+	http.MethodPut:    audit.ActionWrite,
+	http.MethodDelete: audit.ActionDelete,
+	"MKCOL":           audit.ActionCreate,
+	"COPY":            audit.ActionCopy,
+	"MOVE":            audit.ActionRename,
+}
+
+// auditDAV records a WebDAV request served with err in the audit log.
+func auditDAV(d *data, r *http.Request, err error) {
+	action, ok := webdavActions[r.Method]
+	if !ok {
+		return
+	}
+
+	prefix := d.server.BaseURL + d.server.WebDAVPrefix
+	dst := ""
+	if u, err := url.Parse(r.Header.Get("Destination")); err == nil && u.Path != "" {
+		dst = path.Clean("/" + strings.TrimPrefix(u.Path, prefix))
+	}
+	e := d.audit(action, path.Clean("/"+strings.TrimPrefix(r.URL.Path, prefix)), dst)
+	e.Detail = "webdav"
+	e.Status = errToStatus(err)
+}
+
+// webdavFs implements webdav.FileSystem on top of the user's scoped
+// filesystem, enforcing the same permissions, rules and hooks as the
+// resources API.
+type webdavFs struct {
+	d           *data
+	fileCache   FileCache
+	searchIndex *search.Index
+	quotas      *quota.Tracker
+	bin         *trash.Bin
+	history     *versions.History
+}
+
+func (fs *webdavFs) Mkdir(_ context.Context, name string, _ os.FileMode) error {
+	if !fs.d.user.Perm.Create || !fs.d.Check(name) {
+		return os.ErrPermission
+	}
+
+	root := fs.d.quotaRoot()
+	if err := fs.quotas.Check(root, fs.d.user.Quota, 0, 1); err != nil {
+		return err
+	}
+
+	err := fs.d.user.Fs.Mkdir(name, fs.d.settings.DirMode)
+	if err == nil {
+		fs.quotas.Add(root, 0, 1)
+		fs.searchIndex.Update(fs.d.user.FullPath(name))
+	}
+	return err
+}
+
+func (fs *webdavFs) OpenFile(ctx context.Context, name string, flag int, _ os.FileMode) (webdav.File, error) {
+	if !fs.d.Check(name) {
+		return nil, os.ErrNotExist
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		info, err := fs.d.user.Fs.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() && !fs.d.user.Perm.Download {
+			return nil, os.ErrPermission
+		}
+
+		f, err := fs.d.user.Fs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &webdavFile{File: f, fs: fs, name: name}, nil
+	}
+
+	if name == "/" {
+		return nil, os.ErrPermission
+	}
+
+	event := "upload"
+	size, newFiles := int64(0), int64(1)
+	file, err := files.NewFileInfo(&files.FileOptions{
+		Fs:      fs.d.user.Fs,
+		Path:    name,
+		Modify:  fs.d.user.Perm.Modify,
+		Checker: fs.d,
+	})
+	switch {
+	case err == nil:
+		if !fs.d.user.Perm.Modify {
+			return nil, os.ErrPermission
+		}
+		if err := delThumbs(ctx, fs.fileCache, file); err != nil {
+			return nil, err
+		}
+		event = "save"
+		size, newFiles = file.Size, 0
+	case errors.Is(err, os.ErrNotExist):
+		if !fs.d.user.Perm.Create {
+			return nil, os.ErrPermission
+		}
+	default:
+		return nil, err
+	}
+
+	root := fs.d.quotaRoot()
+	if err := fs.quotas.Check(root, fs.d.user.Quota, 0, newFiles); err != nil {
+		return nil, err
+	}
+	remaining, err := fs.quotas.Remaining(root, fs.d.user.Quota)
+	if err != nil {
+		return nil, err
+	}
+
+	// As with the resources API, the before hooks can refuse the write ahead
+	// of it, the after ones being run once the file is closed.
+	if err := fs.d.RunBeforeHook(event, name, "", fs.d.user); err != nil {
+		return nil, err
+	}
+
+	if newFiles == 0 && flag&os.O_TRUNC != 0 {
+		if err := saveVersion(fs.d, fs.history, fs.quotas, name); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := fs.d.user.Fs.OpenFile(name, flag, fs.d.settings.FileMode)
+	if err != nil {
+		return nil, err
+	}
+	if flag&os.O_TRUNC != 0 {
+		fs.quotas.Add(root, -size, 0)
+		size = 0
+	}
+	fs.quotas.Add(root, 0, newFiles)
+
+	// The file can grow up to what is left in the quota.
+	limit := int64(-1)
+	if remaining >= 0 {
+		limit = size + remaining
+	}
+	return &webdavFile{File: f, fs: fs, name: name, event: event, size: size, limit: limit}, nil
+}
+
+func (fs *webdavFs) RemoveAll(ctx context.Context, name string) error {
+	if name == "/" || !fs.d.user.Perm.Delete {
+		return os.ErrPermission
+	}
+
+	file, err := files.NewFileInfo(&files.FileOptions{
+		Fs:      fs.d.user.Fs,
+		Path:    name,
+		Modify:  fs.d.user.Perm.Modify,
+		Checker: fs.d,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = fs.d.store.Share.DeleteWithPathPrefix(file.Path, fs.d.user.ID)
+	if err != nil {
+		log.Printf("WARNING: Error(s) occurred while deleting associated shares with file: %s", err)
+	}
+	err = fs.d.store.Grants.DeleteWithPathPrefix(file.Path, fs.d.user.ID)
+	if err != nil {
+		log.Printf("WARNING: Error(s) occurred while deleting associated grants with file: %s", err)
+	}
+
+	if err := delThumbs(ctx, fs.fileCache, file); err != nil {
+		return err
+	}
+
+	removed := fs.quotas.Measure(file.RealPath())
+	err = removeAll(fs.d, fs.bin, name)
+	if err == nil {
+		fs.searchIndex.Remove(file.RealPath())
+		fs.quotas.Add(fs.d.quotaRoot(), -removed.Bytes, -removed.Files)
+	}
+	return err
+}
+
+func (fs *webdavFs) Rename(ctx context.Context, oldName, newName string) error {
+	if !fs.d.user.Perm.Rename || !fs.d.Check(oldName) || !fs.d.Check(newName) {
+		return os.ErrPermission
+	}
+	if oldName == "/" || newName == "/" {
+		return os.ErrPermission
+	}
+
+	if err := checkParent(oldName, newName); err != nil {
+		return err
+	}
+
+	file, err := files.NewFileInfo(&files.FileOptions{
+		Fs:      fs.d.user.Fs,
+		Path:    oldName,
+		Modify:  fs.d.user.Perm.Modify,
+		Checker: fs.d,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := delThumbs(ctx, fs.fileCache, file); err != nil {
+		return err
+	}
+
+	if err := saveVersion(fs.d, fs.history, fs.quotas, newName); err != nil {
+		return err
+	}
+
+	realOld, err := realPath(fs.d, oldName)
+	if err != nil {
+		return err
+	}
+
+	replaced := replacedUsage(fs.d, fs.quotas, oldName, newName)
+	err = fs.d.RunHook(func() error {
+		return fileutils.MoveFile(fs.d.user.Fs, oldName, newName, fs.d.settings.FileMode, fs.d.settings.DirMode)
+	}, "rename", oldName, newName, fs.d.user)
+	if err != nil {
+		return err
+	}
+
+	if err := fs.d.store.Share.RenamePathPrefix(oldName, newName, fs.d.user.ID); err != nil {
+		log.Printf("WARNING: Error(s) occurred while moving the collections sharing file: %s", err)
+	}
+	if err := fs.d.store.Grants.RenamePathPrefix(oldName, newName, fs.d.user.ID); err != nil {
+		log.Printf("WARNING: Error(s) occurred while moving the grants of file: %s", err)
+	}
+
+	fs.searchIndex.Remove(file.RealPath())
+	fs.searchIndex.Update(fs.d.user.FullPath(newName))
+	fs.quotas.Add(fs.d.quotaRoot(), -replaced.Bytes, -replaced.Files)
+	return moveVersions(fs.d, fs.history, realOld, newName)
+}
+
+func (fs *webdavFs) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	if !fs.d.Check(name) {
+		return nil, os.ErrNotExist
+	}
+
+	info, err := fs.d.user.Fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return webdavFileInfo{info}, nil
+}
+
+// webdavFile filters directory listings through the user's rules and runs
+// the after upload or save hooks once a written file is closed. Written files
+// can't grow beyond limit, unless it is negative.
+type webdavFile struct {
+	webdav.File
+	fs    *webdavFs
+	name  string
+	event string
+	size  int64
+	limit int64
+}
+
+func (f *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	dir, err := f.File.Readdir(count)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(dir))
+	for _, info := range dir {
+		fPath := path.Join(f.name, info.Name())
+		if !f.fs.d.Check(fPath) {
+			continue
+		}
+
+		if files.IsSymlink(info.Mode()) {
+			// Follow the link like the listing does, leaving out the
+			// ones escaping the scope.
+			target, err := f.fs.d.user.Fs.Stat(fPath)
+			switch {
+			case err == nil:
+				info = target
+			case errors.Is(err, os.ErrPermission):
+				continue
+			}
+		}
+
+		infos = append(infos, webdavFileInfo{info})
+	}
+
+	return infos, nil
+}
+
+func (f *webdavFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return webdavFileInfo{info}, nil
+}
+
+func (f *webdavFile) Write(p []byte) (int, error) {
+	if f.limit >= 0 {
+		offset, err := f.File.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		if offset+int64(len(p)) > f.limit {
+			return 0, fberrors.ErrQuotaExceeded
+		}
+	}
+
+	n, err := f.File.Write(p)
+	if offset, seekErr := f.File.Seek(0, io.SeekCurrent); seekErr == nil && offset > f.size {
+		f.fs.quotas.Add(f.fs.d.quotaRoot(), offset-f.size, 0)
+		f.size = offset
+	}
+	return n, err
+}
+
+func (f *webdavFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+
+	if f.event != "" {
+		f.fs.searchIndex.Update(f.fs.d.user.FullPath(f.name))
+		return f.fs.d.RunAfterHook(f.event, f.name, "", f.fs.d.user)
+	}
+
+	return nil
+}
+
+// webdavFileInfo reports the content type from the file extension, so that
+// listing a directory never requires reading the files in it.
+type webdavFileInfo struct {
+	os.FileInfo
+}
+
+func (fi webdavFileInfo) ContentType(_ context.Context) (string, error) {
+	if mimetype := mime.TypeByExtension(filepath.Ext(fi.Name())); mimetype != "" {
+		return mimetype, nil
+	}
+	return "application/octet-stream", nil
+}
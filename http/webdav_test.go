@@ -0,0 +1,167 @@
+package fbhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asdine/storm/v3"
+	"github.com/spf13/afero"
+
+	"github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/rules"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/storage/bolt"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestWebDAVHandler(t *testing.T) {
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatalf("failed to get storage: %v", err)
+	}
+
+	pwd, err := users.HashPwd("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Users.Save(&users.User{
+		Username: "dav",
+		Password: pwd,
+		Perm:     users.Permissions{Download: true, Modify: true},
+		Rules:    []rules.Rule{{Path: "/secret.txt"}},
+	}); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	if err := st.Settings.Save(&settings.Settings{Key: []byte("key"), AuthMethod: auth.MethodJSONAuth}); err != nil {
+		t.Fatalf("failed to save settings: %v", err)
+	}
+	if err := st.Auth.Save(&auth.JSONAuth{}); err != nil {
+		t.Fatalf("failed to save auther: %v", err)
+	}
+
+	fs := afero.NewMemMapFs()
+	for _, name := range []string{"/a.txt", "/secret.txt"} {
+		if err := afero.WriteFile(fs, name, []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st.Users = &customFSUser{Store: st.Users, fs: fs}
+
+	server := &settings.Server{WebDAVPrefix: "/dav"}
+	serve := func(method, target string, body string, withAuth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if withAuth {
+			req.SetBasicAuth("dav", "password")
+		}
+		if method == "PROPFIND" {
+			req.Header.Set("Depth", "1")
+		}
+		rec := httptest.NewRecorder()
+		handle(webdavHandler(diskcache.NewNoOp(), nil, nil, nil, nil), "", st, server).ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("requires credentials", func(t *testing.T) {
+		rec := serve("PROPFIND", "/dav/", "", false)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", rec.Code)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Error("expected a WWW-Authenticate header")
+		}
+	})
+
+	t.Run("listing applies rules", func(t *testing.T) {
+		rec := serve("PROPFIND", "/dav/", "", true)
+		if rec.Code != http.StatusMultiStatus {
+			t.Fatalf("expected 207, got %d", rec.Code)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, "<D:href>/dav/a.txt</D:href>") {
+			t.Errorf("expected a.txt in listing, got %s", body)
+		}
+		if strings.Contains(body, "secret.txt") {
+			t.Errorf("secret.txt must not be listed, got %s", body)
+		}
+	})
+
+	t.Run("download of denied file", func(t *testing.T) {
+		rec := serve(http.MethodGet, "/dav/secret.txt", "", true)
+		if rec.Code == http.StatusOK {
+			t.Fatalf("expected denied file to be unavailable, got %d", rec.Code)
+		}
+	})
+
+	t.Run("overwrite with modify permission", func(t *testing.T) {
+		rec := serve(http.MethodPut, "/dav/a.txt", "updated", true)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d", rec.Code)
+		}
+		data, err := afero.ReadFile(fs, "/a.txt")
+		if err != nil || string(data) != "updated" {
+			t.Errorf("expected updated content, got %q (%v)", data, err)
+		}
+	})
+
+	t.Run("hooks around the overwrite", func(t *testing.T) {
+		set, err := st.Settings.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.EnableExec = true
+		t.Cleanup(func() {
+			server.EnableExec = false
+			set.Commands = nil
+			_ = st.Settings.Save(set)
+		})
+
+		set.Commands = map[string][]string{"before_save": {"false"}}
+		if err := st.Settings.Save(set); err != nil {
+			t.Fatal(err)
+		}
+		if rec := serve(http.MethodPut, "/dav/a.txt", "refused", true); rec.Code == http.StatusCreated {
+			t.Fatal("expected the before hook to refuse the overwrite")
+		}
+		if data, _ := afero.ReadFile(fs, "/a.txt"); string(data) != "updated" {
+			t.Errorf("expected the refused overwrite not to be written, got %q", data)
+		}
+
+		set.Commands = map[string][]string{"after_save": {"false"}}
+		if err := st.Settings.Save(set); err != nil {
+			t.Fatal(err)
+		}
+		if rec := serve(http.MethodPut, "/dav/a.txt", "hooked", true); rec.Code == http.StatusCreated {
+			t.Fatal("expected the failure of the after hook to be reported")
+		}
+	})
+
+	t.Run("create without create permission", func(t *testing.T) {
+		rec := serve(http.MethodPut, "/dav/new.txt", "new", true)
+		if rec.Code == http.StatusCreated {
+			t.Fatal("expected upload to be refused")
+		}
+		if exists, _ := afero.Exists(fs, "/new.txt"); exists {
+			t.Error("new.txt must not be created")
+		}
+	})
+
+	t.Run("delete without delete permission", func(t *testing.T) {
+		rec := serve("DELETE", "/dav/a.txt", "", true)
+		if rec.Code == http.StatusNoContent {
+			t.Fatal("expected delete to be refused")
+		}
+		if exists, _ := afero.Exists(fs, "/a.txt"); !exists {
+			t.Error("a.txt must not be deleted")
+		}
+	})
+}
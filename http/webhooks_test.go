@@ -0,0 +1,164 @@
+package fbhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asdine/storm/v3"
+	"github.com/spf13/afero"
+
+	"github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/diskcache"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+	"github.com/thevickypedia/filebrowser/v2/storage/bolt"
+	"github.com/thevickypedia/filebrowser/v2/users"
+	"github.com/thevickypedia/filebrowser/v2/webhooks"
+)
+
+func TestWebhooksVetoUpload(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhooks.Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.User != "u" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if p.Event == "before_upload" && strings.HasSuffix(p.Path, ".exe") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer hook.Close()
+
+	scope := t.TempDir()
+	key := []byte("test-signing-key")
+	perm := users.Permissions{Create: true, Modify: true}
+	st := scopedUserStorage(t, scope, perm, key)
+	signed := signToken(t, perm, key)
+
+	set, err := st.Settings.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Webhooks = []settings.Webhook{{
+		ID:     "a",
+		URL:    hook.URL,
+		Secret: "secret",
+		Events: []string{"before_upload", "after_upload"},
+	}}
+	if err := st.Settings.Save(set); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(path string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("hello"))
+		req.Header.Set("X-Auth", signed)
+		rec := httptest.NewRecorder()
+		handle(resourcePostHandler(diskcache.NewNoOp(), nil, nil, nil), "", st, &settings.Server{}).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := upload("/a.exe"); code != http.StatusForbidden {
+		t.Fatalf("expected the upload to be vetoed with 403, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(scope, "a.exe")); !os.IsNotExist(err) {
+		t.Fatalf("expected the vetoed upload not to be written, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(scope, "b.exe"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := upload("/b.exe?override=true"); code != http.StatusForbidden {
+		t.Fatalf("expected the overwrite to be vetoed with 403, got %d", code)
+	}
+	if content, err := os.ReadFile(filepath.Join(scope, "b.exe")); err != nil || string(content) != "b" {
+		t.Fatalf("expected the vetoed overwrite to leave the file as it was, got %q, %v", content, err)
+	}
+
+	if code := upload("/a.txt"); code != http.StatusOK {
+		t.Fatalf("expected the upload to be allowed, got %d", code)
+	}
+	queued, err := st.Webhooks.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].Event != "after_upload" {
+		t.Fatalf("expected the after_upload event to be queued, got %+v", queued)
+	}
+
+	var p webhooks.Payload
+	if err := json.Unmarshal(queued[0].Body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Path != "/a.txt" || p.Size != int64(len("hello")) {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+}
+
+func TestWebhooksVetoWebDAVUpload(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhooks.Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err == nil && p.Event == "before_upload" && strings.HasSuffix(p.Path, ".exe") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer hook.Close()
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	st, err := bolt.NewStorage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pwd, err := users.HashPwd("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Users.Save(&users.User{Username: "dav", Password: pwd, Perm: users.Permissions{Create: true}}); err != nil {
+		t.Fatal(err)
+	}
+	err = st.Settings.Save(&settings.Settings{
+		Key:        []byte("key"),
+		AuthMethod: auth.MethodJSONAuth,
+		Webhooks: []settings.Webhook{{
+			ID:     "a",
+			URL:    hook.URL,
+			Secret: "secret",
+			Events: []string{"before_upload"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Auth.Save(&auth.JSONAuth{}); err != nil {
+		t.Fatal(err)
+	}
+	scope := t.TempDir()
+	st.Users = &customFSUser{Store: st.Users, fs: afero.NewBasePathFs(afero.NewOsFs(), scope)}
+
+	put := func(name string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/dav/"+name, strings.NewReader("hello"))
+		req.SetBasicAuth("dav", "password")
+		rec := httptest.NewRecorder()
+		handle(webdavHandler(diskcache.NewNoOp(), nil, nil, nil, nil), "", st, &settings.Server{WebDAVPrefix: "/dav"}).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := put("a.exe"); code == http.StatusCreated {
+		t.Fatal("expected the upload to be vetoed")
+	}
+	if _, err := os.Stat(filepath.Join(scope, "a.exe")); !os.IsNotExist(err) {
+		t.Fatalf("expected the vetoed upload not to be written, got %v", err)
+	}
+	if code := put("a.txt"); code != http.StatusCreated {
+		t.Fatalf("expected the upload to be allowed, got %d", code)
+	}
+}
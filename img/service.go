@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"image"
 	"io"
+	"sync/atomic"
 
 	"github.com/disintegration/imaging"
 	"github.com/dsoprea/go-exif/v3"
@@ -31,6 +32,8 @@ const (
 // Service
 type Service struct {
 	sem semaphore.Semaphore
+	// waiting is how many images wait for a processor.
+	waiting atomic.Int64
 }
 
 func New(workers int) *Service {
@@ -144,8 +147,16 @@ func WithQuality(quality Quality) Option {
 	}
 }
 
+// Waiting returns how many images wait for a processor to be resized.
+func (s *Service) Waiting() int {
+	return int(s.waiting.Load())
+}
+
 func (s *Service) Resize(ctx context.Context, in io.Reader, width, height int, out io.Writer, options ...Option) error {
-	if err := s.sem.Acquire(ctx, 1); err != nil {
+	s.waiting.Add(1)
+	err := s.sem.Acquire(ctx, 1)
+	s.waiting.Add(-1)
+	if err != nil {
 		return err
 	}
 	defer s.sem.Release(1)
@@ -0,0 +1,403 @@
+// Package jobs runs long file operations in the background, keeping track of
+// their progress so that users can follow them, even after reconnecting, and
+// cancel them.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+const (
+	// keepFinished is how long finished jobs are remembered for.
+	keepFinished = 24 * time.Hour
+
+	// progressInterval is how often the progress of a running job is saved
+	// and sent to the subscribers.
+	progressInterval = time.Second
+)
+
+// errInterrupted is the error of the jobs that were running when the server
+// stopped.
+var errInterrupted = errors.New("interrupted by a restart of the server")
+
+// Status is the state of a job.
+type Status string
+
+const (
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+)
+
+// Progress is how far a job went. The totals are zero when unknown.
+type Progress struct {
+	Bytes      int64 `json:"bytes"`
+	Files      int64 `json:"files"`
+	TotalBytes int64 `json:"totalBytes"`
+	TotalFiles int64 `json:"totalFiles"`
+}
+
+// Job is a file operation run in the background for a user.
+type Job struct {
+	ID         string    `json:"id" storm:"id"`
+	UserID     uint      `json:"userID" storm:"index"`
+	Action     string    `json:"action"`
+	Src        string    `json:"src"`
+	Dst        string    `json:"dst"`
+	Status     Status    `json:"status"`
+	Progress   Progress  `json:"progress"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+// Task is the work of a job, which reports its progress to r and stops when
+// ctx is canceled.
+type Task func(ctx context.Context, r *Reporter) error
+
+// Reporter updates the progress of a job. A nil Reporter discards it.
+type Reporter struct {
+	m  *Manager
+	id string
+
+	// progress is only used when there is no manager.
+	progress Progress
+}
+
+// SetTotal sets how many bytes and files the job is about.
+func (r *Reporter) SetTotal(bytes, files int64) {
+	r.update(func(p *Progress) {
+		p.TotalBytes, p.TotalFiles = bytes, files
+	})
+}
+
+// Add counts bytes and files as done.
+func (r *Reporter) Add(bytes, files int64) {
+	r.update(func(p *Progress) {
+		p.Bytes += bytes
+		p.Files += files
+	})
+}
+
+func (r *Reporter) update(fn func(p *Progress)) {
+	if r == nil {
+		return
+	}
+	if r.m == nil {
+		fn(&r.progress)
+		return
+	}
+
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	e, ok := r.m.running[r.id]
+	if !ok {
+		return
+	}
+
+	fn(&e.job.Progress)
+	if time.Since(e.published) >= progressInterval {
+		e.published = time.Now()
+		if err := r.m.store.Save(&e.job); err != nil {
+			log.Printf("jobs: could not save %s: %v", r.id, err)
+		}
+		r.m.publish(e.job)
+	}
+}
+
+type entry struct {
+	job       Job
+	cancel    context.CancelFunc
+	published time.Time
+}
+
+// Manager runs the jobs and keeps track of them in the storage. A nil Manager
+// runs them right away, in the caller's goroutine, and keeps no track of them.
+type Manager struct {
+	store *Storage
+	ctx   context.Context
+	stop  context.CancelFunc
+	wg    sync.WaitGroup
+
+	mu          sync.Mutex
+	running     map[string]*entry
+	subscribers map[chan Job]uint
+}
+
+// NewManager returns a manager keeping track of the jobs in store, where the
+// jobs that were still running when the server stopped are marked as failed.
+func NewManager(store *Storage) (*Manager, error) {
+	all, err := store.All()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range all {
+		if job.Status != StatusRunning {
+			continue
+		}
+		finish(context.Background(), job, errInterrupted)
+		if err := store.Save(job); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	return &Manager{
+		store:       store,
+		ctx:         ctx,
+		stop:        stop,
+		running:     map[string]*entry{},
+		subscribers: map[chan Job]uint{},
+	}, nil
+}
+
+// Start runs task as a job of a user and returns it as it is at the start,
+// or as it ended when m is nil.
+func (m *Manager) Start(userID uint, action, src, dst string, task Task) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := Job{
+		ID:        id,
+		UserID:    userID,
+		Action:    action,
+		Src:       src,
+		Dst:       dst,
+		Status:    StatusRunning,
+		CreatedAt: time.Now(),
+	}
+
+	if m == nil {
+		r := &Reporter{}
+		err := task(context.Background(), r)
+		job.Progress = r.progress
+		finish(context.Background(), &job, err)
+		return job, nil
+	}
+
+	m.expire(userID, job.CreatedAt)
+	if err := m.store.Save(&job); err != nil {
+		return Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.mu.Lock()
+	m.running[id] = &entry{job: job, cancel: cancel, published: job.CreatedAt}
+	m.publish(job)
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+
+		err := task(ctx, &Reporter{m: m, id: id})
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		e := m.running[id]
+		delete(m.running, id)
+
+		finish(ctx, &e.job, err)
+		if err := m.store.Save(&e.job); err != nil {
+			log.Printf("jobs: could not save %s: %v", id, err)
+		}
+		m.publish(e.job)
+	}()
+
+	return job, nil
+}
+
+// List returns the jobs of a user, most recent first.
+func (m *Manager) List(userID uint) ([]*Job, error) {
+	if m == nil {
+		return []*Job{}, nil
+	}
+
+	list, err := m.store.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The progress of the running jobs is more recent than the saved one.
+	m.mu.Lock()
+	for i, job := range list {
+		if e, ok := m.running[job.ID]; ok {
+			running := e.job
+			list[i] = &running
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// Get returns a job of a user.
+func (m *Manager) Get(userID uint, id string) (Job, error) {
+	if m == nil {
+		return Job{}, fberrors.ErrNotExist
+	}
+
+	m.mu.Lock()
+	e, ok := m.running[id]
+	var running Job
+	if ok {
+		running = e.job
+	}
+	m.mu.Unlock()
+	if ok && running.UserID == userID {
+		return running, nil
+	}
+
+	job, err := m.store.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.UserID != userID {
+		return Job{}, fberrors.ErrNotExist
+	}
+	return *job, nil
+}
+
+// Cancel stops a running job of a user, or forgets it once it is finished.
+func (m *Manager) Cancel(userID uint, id string) error {
+	if m == nil {
+		return fberrors.ErrNotExist
+	}
+
+	m.mu.Lock()
+	e, ok := m.running[id]
+	m.mu.Unlock()
+	if ok && e.job.UserID == userID {
+		e.cancel()
+		return nil
+	}
+
+	job, err := m.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.UserID != userID {
+		return fberrors.ErrNotExist
+	}
+	return m.store.Delete(id)
+}
+
+// Subscribe returns a channel receiving the jobs of a user as they start,
+// progress and finish, until unsubscribe is called or m is closed. Updates
+// are dropped when they aren't received fast enough.
+func (m *Manager) Subscribe(userID uint) (updates <-chan Job, unsubscribe func()) {
+	ch := make(chan Job, 16)
+	if m == nil {
+		close(ch)
+		return ch, func() {}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx.Err() != nil {
+		close(ch)
+		return ch, func() {}
+	}
+	m.subscribers[ch] = userID
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.subscribers[ch]; ok {
+			delete(m.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close cancels the running jobs, waits for them to stop and ends the
+// subscriptions.
+func (m *Manager) Close() {
+	if m == nil {
+		return
+	}
+
+	m.stop()
+	m.wg.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subscribers {
+		delete(m.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends a job to the subscribers of its user. m.mu must be held.
+func (m *Manager) publish(job Job) {
+	for ch, userID := range m.subscribers {
+		if userID != job.UserID {
+			continue
+		}
+		select {
+		case ch <- job:
+		default:
+		}
+	}
+}
+
+// expire forgets the jobs of a user finished for longer than keepFinished.
+func (m *Manager) expire(userID uint, now time.Time) {
+	list, err := m.store.FindByUserID(userID)
+	if err != nil {
+		log.Printf("jobs: could not list the jobs of user %d: %v", userID, err)
+		return
+	}
+
+	for _, job := range list {
+		if job.Status == StatusRunning || now.Sub(job.FinishedAt) < keepFinished {
+			continue
+		}
+		if err := m.store.Delete(job.ID); err != nil {
+			log.Printf("jobs: could not delete %s: %v", job.ID, err)
+		}
+	}
+}
+
+func finish(ctx context.Context, job *Job, err error) {
+	job.FinishedAt = time.Now()
+	switch {
+	case err == nil:
+		// Some work, like renaming a directory, is done at once.
+		job.Status = StatusDone
+		job.Progress.Bytes = max(job.Progress.Bytes, job.Progress.TotalBytes)
+		job.Progress.Files = max(job.Progress.Files, job.Progress.TotalFiles)
+	case ctx.Err() != nil:
+		// The task may fail in other ways when stopped halfway.
+		job.Status = StatusCanceled
+		job.Error = err.Error()
+	default:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,216 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+type memoryBackend struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{jobs: map[string]Job{}}
+}
+
+func (m *memoryBackend) All() ([]*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []*Job
+	for _, j := range m.jobs {
+		jobs = append(jobs, &j)
+	}
+	return jobs, nil
+}
+
+func (m *memoryBackend) FindByUserID(id uint) ([]*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []*Job
+	for _, j := range m.jobs {
+		if j.UserID == id {
+			jobs = append(jobs, &j)
+		}
+	}
+	return jobs, nil
+}
+
+func (m *memoryBackend) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j, ok := m.jobs[id]; ok {
+		return &j, nil
+	}
+	return nil, fberrors.ErrNotExist
+}
+
+func (m *memoryBackend) Save(j *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[j.ID] = *j
+	return nil
+}
+
+func (m *memoryBackend) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+	return nil
+}
+
+func newManager(t *testing.T, back StorageBackend) *Manager {
+	t.Helper()
+	m, err := NewManager(NewStorage(back))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+func wait(t *testing.T, m *Manager, userID uint, id string) Job {
+	t.Helper()
+	for range 100 {
+		job, err := m.Get(userID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != StatusRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s still running", id)
+	return Job{}
+}
+
+func TestManager(t *testing.T) {
+	m := newManager(t, newMemoryBackend())
+
+	job, err := m.Start(1, "copy", "/a", "/b", func(_ context.Context, r *Reporter) error {
+		r.SetTotal(10, 2)
+		r.Add(4, 1)
+		r.Add(6, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Get(2, job.ID); err == nil {
+		t.Error("expected the job of another user not to be found")
+	}
+
+	job = wait(t, m, 1, job.ID)
+	want := Progress{Bytes: 10, Files: 2, TotalBytes: 10, TotalFiles: 2}
+	if job.Status != StatusDone || job.Progress != want {
+		t.Errorf("expected the job to be done with %+v, got %+v", want, job)
+	}
+
+	started := make(chan struct{})
+	job, err = m.Start(1, "copy", "/a", "/b", func(ctx context.Context, _ *Reporter) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	if err := m.Cancel(2, job.ID); err == nil {
+		t.Error("expected the job of another user not to be canceled")
+	}
+	if err := m.Cancel(1, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job = wait(t, m, 1, job.ID); job.Status != StatusCanceled {
+		t.Errorf("expected the job to be canceled, got %+v", job)
+	}
+
+	job, err = m.Start(1, "copy", "/a", "/b", func(context.Context, *Reporter) error {
+		return errors.New("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job = wait(t, m, 1, job.ID); job.Status != StatusFailed || job.Error != "boom" {
+		t.Errorf("expected the job to fail, got %+v", job)
+	}
+}
+
+func TestManagerRestart(t *testing.T) {
+	back := newMemoryBackend()
+	if err := back.Save(&Job{ID: "old", UserID: 1, Status: StatusRunning, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := back.Save(&Job{ID: "expired", UserID: 1, Status: StatusDone, FinishedAt: time.Now().Add(-2 * keepFinished)}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newManager(t, back)
+	job, err := m.Get(1, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusFailed || job.Error != errInterrupted.Error() {
+		t.Errorf("expected the interrupted job to have failed, got %+v", job)
+	}
+
+	updates, unsubscribe := m.Subscribe(1)
+	defer unsubscribe()
+	others, unsubscribeOthers := m.Subscribe(2)
+	defer unsubscribeOthers()
+
+	job, err = m.Start(1, "delete", "/a", "", func(context.Context, *Reporter) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, m, 1, job.ID)
+
+	for _, want := range []Status{StatusRunning, StatusDone} {
+		select {
+		case got := <-updates:
+			if got.ID != job.ID || got.Status != want {
+				t.Errorf("expected the job to be %s, got %+v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected the job to be %s", want)
+		}
+	}
+	select {
+	case got := <-others:
+		t.Errorf("expected no update of the jobs of another user, got %+v", got)
+	default:
+	}
+
+	// Starting a job forgets the ones of the user which finished long ago.
+	list, err := m.List(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != job.ID || list[1].ID != "old" {
+		t.Errorf("expected the new and the interrupted jobs, got %+v", list)
+	}
+
+	// Finished jobs are forgotten when canceled.
+	if err := m.Cancel(1, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(1, "old"); !errors.Is(err, fberrors.ErrNotExist) {
+		t.Errorf("expected the job to be forgotten, got %v", err)
+	}
+
+	m.Close()
+	if _, ok := <-updates; ok {
+		t.Error("expected the subscription to end when closing")
+	}
+}
@@ -0,0 +1,36 @@
+// Package passkeys keeps the WebAuthn credentials users registered to log in
+// with.
+package passkeys
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Credential is a passkey registered by a user.
+type Credential struct {
+	ID         string              `json:"id" storm:"id"` // base64url of the credential ID
+	UserID     uint                `json:"userID" storm:"index"`
+	Name       string              `json:"name"`
+	Credential webauthn.Credential `json:"credential"`
+	CreatedAt  time.Time           `json:"created"`
+	LastUsedAt time.Time           `json:"lastUsed"`
+}
+
+// New returns the passkey of a user for a credential they registered.
+func New(userID uint, name string, credential *webauthn.Credential) *Credential {
+	return &Credential{
+		ID:         EncodeID(credential.ID),
+		UserID:     userID,
+		Name:       name,
+		Credential: *credential,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// EncodeID returns the ID passkeys are stored by for a credential ID.
+func EncodeID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
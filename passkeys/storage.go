@@ -0,0 +1,53 @@
+package passkeys
+
+// StorageBackend is the interface to implement for a passkeys storage.
+type StorageBackend interface {
+	FindByUserID(id uint) ([]*Credential, error)
+	Get(id string) (*Credential, error)
+	Save(c *Credential) error
+	Delete(id string) error
+}
+
+// Storage is a storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a passkeys storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// FindByUserID wraps a StorageBackend.FindByUserID.
+func (s *Storage) FindByUserID(id uint) ([]*Credential, error) {
+	return s.back.FindByUserID(id)
+}
+
+// Get wraps a StorageBackend.Get.
+func (s *Storage) Get(id string) (*Credential, error) {
+	return s.back.Get(id)
+}
+
+// Save wraps a StorageBackend.Save.
+func (s *Storage) Save(c *Credential) error {
+	return s.back.Save(c)
+}
+
+// Delete wraps a StorageBackend.Delete.
+func (s *Storage) Delete(id string) error {
+	return s.back.Delete(id)
+}
+
+// DeleteByUserID deletes all the credentials of a user.
+func (s *Storage) DeleteByUserID(id uint) error {
+	credentials, err := s.back.FindByUserID(id)
+	if err != nil {
+		return err
+	}
+	for _, c := range credentials {
+		if err := s.back.Delete(c.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
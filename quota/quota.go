@@ -0,0 +1,286 @@
+// Package quota keeps track of the storage used within the users' scopes so
+// that their quotas can be enforced without walking the scope on every write.
+package quota
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// ReconcileInterval is how often the tracked usage is compared with what is
+// actually found on disk, correcting what was changed outside of File
+// Browser and the drift of concurrent writes.
+const ReconcileInterval = time.Hour
+
+// Usage is the storage used within a scope. Directories are counted as files,
+// but for the scope itself.
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// Tracker tracks the usage of the scopes, keyed by their real path. The
+// usage of a scope is measured the first time it is needed and kept current
+// by the write paths reporting what they change. A nil Tracker enforces
+// nothing.
+type Tracker struct {
+	mu    sync.Mutex
+	usage map[string]*Usage
+
+	// charged returns the bytes kept outside of a scope that are charged to
+	// it, like the versions of its files.
+	charged func(root string) (int64, error)
+}
+
+// NewTracker returns an empty tracker.
+func NewTracker() *Tracker {
+	return &Tracker{usage: map[string]*Usage{}}
+}
+
+// Charge makes the bytes returned by fn for a scope part of its usage, once
+// it is measured again.
+func (t *Tracker) Charge(fn func(root string) (int64, error)) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.charged = fn
+}
+
+// Usage returns the usage of the scope at root.
+func (t *Tracker) Usage(root string) (Usage, error) {
+	if t == nil {
+		return Usage{}, nil
+	}
+
+	u, err := t.get(root)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return *u, nil
+}
+
+// Check returns fberrors.ErrQuotaExceeded if adding bytes and files to the
+// scope at root would exceed the quota.
+func (t *Tracker) Check(root string, q users.Quota, bytes, files int64) error {
+	if t == nil || q.Unlimited() {
+		return nil
+	}
+
+	u, err := t.get(root)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q.Bytes > 0 && bytes > 0 && u.Bytes+bytes > q.Bytes {
+		return fberrors.ErrQuotaExceeded
+	}
+	if q.Files > 0 && files > 0 && u.Files+files > q.Files {
+		return fberrors.ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Add records bytes and files, which may be negative, as added to the scope
+// at root. Scopes whose usage wasn't measured yet are left alone since the
+// change will be part of the measure.
+func (t *Tracker) Add(root string, bytes, files int64) {
+	if t == nil || (bytes == 0 && files == 0) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u, ok := t.usage[root]; ok {
+		u.Bytes = max(u.Bytes+bytes, 0)
+		u.Files = max(u.Files+files, 0)
+	}
+}
+
+// Remaining returns the number of bytes that can still be added to the scope
+// at root, or -1 if the quota doesn't limit them.
+func (t *Tracker) Remaining(root string, q users.Quota) (int64, error) {
+	if t == nil || q.Bytes <= 0 {
+		return -1, nil
+	}
+
+	u, err := t.Usage(root)
+	if err != nil {
+		return 0, err
+	}
+	return max(q.Bytes-u.Bytes, 0), nil
+}
+
+// Limit returns a reader failing with fberrors.ErrQuotaExceeded once more
+// than the bytes left in the scope at root are read from r. replaced is the
+// size of what the data read replaces, which is given back.
+func (t *Tracker) Limit(r io.Reader, root string, q users.Quota, replaced int64) (io.Reader, error) {
+	remaining, err := t.Remaining(root, q)
+	if err != nil || remaining < 0 {
+		return r, err
+	}
+	return &limitedReader{r: r, n: remaining + replaced}, nil
+}
+
+// Measure returns the usage of the tree at path, to be given to Add once it
+// is removed or after it was copied. It measures nothing on a nil Tracker.
+func (t *Tracker) Measure(path string) Usage {
+	if t == nil {
+		return Usage{}
+	}
+
+	// A tree that can't be measured doesn't exist as far as quotas are
+	// concerned.
+	u, _ := measure(path)
+	return u
+}
+
+// Run reconciles the tracked usage every ReconcileInterval until ctx is
+// canceled.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Reconcile(ctx)
+		}
+	}
+}
+
+// Reconcile measures again the usage of the scopes tracked so far.
+func (t *Tracker) Reconcile(ctx context.Context) {
+	t.mu.Lock()
+	roots := make([]string, 0, len(t.usage))
+	for root := range t.usage {
+		roots = append(roots, root)
+	}
+	t.mu.Unlock()
+
+	for _, root := range roots {
+		if ctx.Err() != nil {
+			return
+		}
+
+		u, err := t.measure(root)
+		if err != nil {
+			log.Printf("quota: could not measure %s: %v", root, err)
+			continue
+		}
+
+		t.mu.Lock()
+		t.usage[root] = &u
+		t.mu.Unlock()
+	}
+}
+
+func (t *Tracker) get(root string) (*Usage, error) {
+	t.mu.Lock()
+	u, ok := t.usage[root]
+	t.mu.Unlock()
+	if ok {
+		return u, nil
+	}
+
+	// The scope is measured without holding the lock, if two requests race
+	// to measure it the first one wins.
+	measured, err := t.measure(root)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u, ok := t.usage[root]; ok {
+		return u, nil
+	}
+	t.usage[root] = &measured
+	return &measured, nil
+}
+
+// measure returns the usage of the scope at root, with what is charged to it.
+func (t *Tracker) measure(root string) (Usage, error) {
+	u, err := measure(root)
+	if err != nil {
+		return u, err
+	}
+	// The scope itself isn't counted.
+	u.Files = max(u.Files-1, 0)
+
+	t.mu.Lock()
+	charged := t.charged
+	t.mu.Unlock()
+	if charged == nil {
+		return u, nil
+	}
+
+	bytes, err := charged(root)
+	u.Bytes += bytes
+	return u, err
+}
+
+// measure walks the tree at root, which may be a single file, and returns
+// its usage, root included. Symbolic links aren't followed.
+func measure(root string) (Usage, error) {
+	var u Usage
+	err := filepath.WalkDir(root, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Entries that can't be read are skipped, like they are when
+			// listing them.
+			return nil
+		}
+		u.Files++
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		u.Bytes += info.Size()
+		return nil
+	})
+	return u, err
+}
+
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, fberrors.ErrQuotaExceeded
+	}
+
+	// Read one byte more than allowed to find out whether the data goes
+	// beyond the limit.
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), fberrors.ErrQuotaExceeded
+	}
+	return n, err
+}
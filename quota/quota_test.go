@@ -0,0 +1,85 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestTracker(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "12345", "dir/b.txt": "123"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tracker := NewTracker()
+	q := users.Quota{Bytes: 10, Files: 4}
+
+	// The directories are counted as files, but for the scope.
+	if u, err := tracker.Usage(root); err != nil || u != (Usage{Bytes: 8, Files: 3}) {
+		t.Fatalf("expected the scope to be measured, got %+v (%v)", u, err)
+	}
+
+	if err := tracker.Check(root, q, 2, 1); err != nil {
+		t.Errorf("expected what fits in the quota to be allowed, got %v", err)
+	}
+	if err := tracker.Check(root, q, 3, 0); !errors.Is(err, fberrors.ErrQuotaExceeded) {
+		t.Errorf("expected the bytes quota to be exceeded, got %v", err)
+	}
+	if err := tracker.Check(root, q, 0, 2); !errors.Is(err, fberrors.ErrQuotaExceeded) {
+		t.Errorf("expected the files quota to be exceeded, got %v", err)
+	}
+	if err := tracker.Check(root, users.Quota{}, 1<<40, 1<<20); err != nil {
+		t.Errorf("expected an empty quota to allow anything, got %v", err)
+	}
+
+	tracker.Add(root, -3, -1)
+	if u, _ := tracker.Usage(root); u != (Usage{Bytes: 5, Files: 2}) {
+		t.Errorf("expected the usage to be updated, got %+v", u)
+	}
+
+	r, err := tracker.Limit(strings.NewReader("1234567"), root, q, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(r); !errors.Is(err, fberrors.ErrQuotaExceeded) || len(data) != 5 {
+		t.Errorf("expected reading to stop at the quota, got %q (%v)", data, err)
+	}
+
+	r, _ = tracker.Limit(strings.NewReader("1234567"), root, q, 2)
+	if data, err := io.ReadAll(r); err != nil || string(data) != "1234567" {
+		t.Errorf("expected replaced bytes to be given back, got %q (%v)", data, err)
+	}
+
+	tracker.Reconcile(context.Background())
+	if u, _ := tracker.Usage(root); u != (Usage{Bytes: 8, Files: 3}) {
+		t.Errorf("expected reconciling to measure the scope again, got %+v", u)
+	}
+
+	tracker.Charge(func(string) (int64, error) { return 4, nil })
+	tracker.Reconcile(context.Background())
+	if u, _ := tracker.Usage(root); u != (Usage{Bytes: 12, Files: 3}) {
+		t.Errorf("expected the bytes charged to be part of the usage, got %+v", u)
+	}
+
+	if u := tracker.Measure(filepath.Join(root, "dir")); u != (Usage{Bytes: 3, Files: 2}) {
+		t.Errorf("expected the tree to be measured with its root, got %+v", u)
+	}
+
+	var nilTracker *Tracker
+	if err := nilTracker.Check(root, q, 1<<40, 0); err != nil {
+		t.Errorf("expected a nil tracker to enforce nothing, got %v", err)
+	}
+}
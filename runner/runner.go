@@ -1,27 +1,55 @@
 package runner
 
 import (
-	"fmt"
+	"context"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/thevickypedia/filebrowser/v2/settings"
 	"github.com/thevickypedia/filebrowser/v2/users"
+	"github.com/thevickypedia/filebrowser/v2/webhooks"
 )
 
 // Runner is a commands runner.
 type Runner struct {
 	Enabled bool
 	*settings.Settings
+	// Webhooks queues the after events for the webhooks. The webhooks are
+	// left out when it is nil, but not the commands.
+	Webhooks *webhooks.Storage
 }
 
-// RunHook runs the hooks for the before and after event.
+// RunHook runs the hooks for the before and after event around fn. The
+// webhooks are notified whether the commands are enabled or not: before the
+// event, the first of them refusing it cancels it, and after it, they are
+// queued.
 func (r *Runner) RunHook(fn func() error, evt, path, dst string, user *users.User) error {
+	if err := r.RunBeforeHook(evt, path, dst, user); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return r.RunAfterHook(evt, path, dst, user)
+}
+
+// RunBeforeHook runs the hooks for the before event, for the operations that
+// can't be wrapped by RunHook. An error cancels the event.
+func (r *Runner) RunBeforeHook(evt, path, dst string, user *users.User) error {
+	relPath, relDst := path, dst
 	path = user.FullPath(path)
 	dst = user.FullPath(dst)
 
+	if r.Webhooks != nil && len(r.Settings.Webhooks) > 0 {
+		err := webhooks.Before(r.Settings.Webhooks, r.payload("before_"+evt, relPath, relDst, path, user))
+		if err != nil {
+			return err
+		}
+	}
+
 	if r.Enabled {
 		if val, ok := r.Commands["before_"+evt]; ok {
 			for _, command := range val {
@@ -32,10 +60,26 @@ func (r *Runner) RunHook(fn func() error, evt, path, dst string, user *users.Use
 			}
 		}
 	}
+	return nil
+}
 
-	err := fn()
-	if err != nil {
-		return err
+// RunAfterHook runs the hooks for the after event, once the operation whose
+// before event was run is done.
+func (r *Runner) RunAfterHook(evt, path, dst string, user *users.User) error {
+	relPath, relDst := path, dst
+	path = user.FullPath(path)
+	dst = user.FullPath(dst)
+
+	if r.Webhooks != nil && len(r.Settings.Webhooks) > 0 {
+		// The file is found at its destination once copied or renamed.
+		stat := path
+		if relDst != "" {
+			stat = dst
+		}
+		err := r.Webhooks.Enqueue(r.Settings.Webhooks, r.payload("after_"+evt, relPath, relDst, stat, user))
+		if err != nil {
+			log.Printf("Warning: Failed to queue the after_%s webhooks of %q: %v", evt, relPath, err)
+		}
 	}
 
 	if r.Enabled {
@@ -52,6 +96,22 @@ func (r *Runner) RunHook(fn func() error, evt, path, dst string, user *users.Use
 	return nil
 }
 
+// payload returns the payload of an event for the webhooks, sized after the
+// file at the full path if it exists.
+func (r *Runner) payload(evt, path, dst, fullPath string, user *users.User) *webhooks.Payload {
+	p := &webhooks.Payload{
+		Event:       evt,
+		User:        user.Username,
+		Path:        path,
+		Destination: dst,
+		Timestamp:   time.Now(),
+	}
+	if info, err := os.Stat(fullPath); err == nil && !info.IsDir() {
+		p.Size = info.Size()
+	}
+	return p
+}
+
 func (r *Runner) exec(raw, evt, path, dst string, user *users.User) error {
 	blocking := true
 
@@ -60,59 +120,41 @@ func (r *Runner) exec(raw, evt, path, dst string, user *users.User) error {
 		raw = strings.TrimSpace(strings.TrimSuffix(raw, "&"))
 	}
 
-	command, _, err := ParseCommand(r.Settings, raw)
+	command, err := NewCommand(context.Background(), r.Settings, raw, map[string]string{
+		"FILE":        path,
+		"SCOPE":       user.Scope,
+		"TRIGGER":     evt,
+		"USERNAME":    user.Username,
+		"DESTINATION": dst,
+	})
 	if err != nil {
 		return err
 	}
 
-	envMapping := func(key string) string {
-		switch key {
-		case "FILE":
-			return path
-		case "SCOPE":
-			return user.Scope
-		case "TRIGGER":
-			return evt
-		case "USERNAME":
-			return user.Username
-		case "DESTINATION":
-			return dst
-		default:
-			return os.Getenv(key)
+	var stdin io.Reader = os.Stdin
+	if command.Policy != nil {
+		// The hooks under a policy are run from the scope of the user rather
+		// than from the directory of the server, and without its input.
+		stdin = nil
+		scope := user.FullPath("/")
+		if err := command.SetDir(scope, scope); err != nil {
+			return err
 		}
 	}
-	for i, arg := range command {
-		if i == 0 {
-			continue
-		}
-
-		command[i] = os.Expand(arg, envMapping)
-	}
-
-	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Env = append(os.Environ(), fmt.Sprintf("FILE=%s", path))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("SCOPE=%s", user.Scope))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TRIGGER=%s", evt))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("USERNAME=%s", user.Username))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("DESTINATION=%s", dst))
-
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
 
 	if !blocking {
-		log.Printf("[INFO] Nonblocking Command: \"%s\"", strings.Join(command, " "))
-		defer func() {
-			go func() {
-				err := cmd.Wait()
-				if err != nil {
-					log.Printf("[INFO] Nonblocking Command \"%s\" failed: %s", strings.Join(command, " "), err)
-				}
-			}()
+		log.Printf("[INFO] Nonblocking Command: \"%s\"", command)
+		if err := command.Start(stdin, os.Stdout, os.Stderr); err != nil {
+			return err
+		}
+		go func() {
+			if err := command.Wait(); err != nil {
+				log.Printf("[INFO] Nonblocking Command \"%s\" failed: %s", command, err)
+			}
 		}()
-		return cmd.Start()
+		return nil
 	}
 
-	log.Printf("[INFO] Blocking Command: \"%s\"", strings.Join(command, " "))
-	return cmd.Run()
+	log.Printf("[INFO] Blocking Command: \"%s\"", command)
+	return command.Run(stdin, os.Stdout, os.Stderr)
 }
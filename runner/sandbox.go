@@ -0,0 +1,239 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+// The reasons the commands are refused or killed under their policies.
+var (
+	ErrArgsNotAllowed  = errors.New("arguments not allowed")
+	ErrShellNotAllowed = errors.New("shell metacharacters not allowed")
+	ErrTimeout         = errors.New("the command timed out")
+	ErrOutputLimit     = errors.New("the command output too much")
+)
+
+// Command is a command run under the policy of its name, if it has one.
+type Command struct {
+	Name   string
+	Policy *settings.CommandPolicy
+
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stop   context.CancelFunc
+}
+
+// NewCommand parses a raw command like ParseCommand and checks it against the
+// policy of its name. The arguments are expanded with vars, if any, falling
+// back to the environment the command is run with, to which vars are added.
+// The command is killed once the context is done.
+func NewCommand(ctx context.Context, s *settings.Settings, raw string, vars map[string]string) (*Command, error) {
+	name, args, err := SplitCommandAndArgs(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Command{Name: name, stop: func() {}}
+	var command []string
+	if policy, ok := s.CommandPolicies[name]; ok {
+		c.Policy = &policy
+		command = append([]string{name}, args...)
+	} else {
+		command, _, err = ParseCommand(s, raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	env := c.environ(vars)
+	if vars != nil {
+		lookup := func(key string) string {
+			if v, ok := vars[key]; ok {
+				return v
+			}
+			for _, kv := range env {
+				if k, v, _ := strings.Cut(kv, "="); k == key {
+					return v
+				}
+			}
+			return ""
+		}
+		for i := 1; i < len(command); i++ {
+			command[i] = os.Expand(command[i], lookup)
+		}
+	}
+
+	if c.Policy != nil {
+		if !c.Policy.AllowsArgs(command[1:]) {
+			return nil, fmt.Errorf("%w: %s", ErrArgsNotAllowed, raw)
+		}
+		if timeout := c.Policy.GetTimeout(); timeout > 0 {
+			ctx, c.stop = context.WithTimeoutCause(ctx, timeout, ErrTimeout)
+		}
+	}
+	c.ctx, c.cancel = context.WithCancelCause(ctx)
+
+	c.cmd = exec.CommandContext(c.ctx, command[0], command[1:]...)
+	c.cmd.Env = env
+	// The output of the children left behind once killed is not waited for.
+	c.cmd.WaitDelay = time.Second
+	isolate(c.cmd, c.Policy)
+	return c, nil
+}
+
+// shellMetacharacters are those making the shell run more than the command
+// named first, or with arguments other than those written.
+const shellMetacharacters = ";&|<>()$`\r\n"
+
+// NewUserCommand is NewCommand for the commands the users issue, who may only
+// run the commands they are allowed by name. The commands without a policy
+// being run through the shell, if any, those with shell metacharacters are
+// refused with ErrShellNotAllowed.
+func NewUserCommand(ctx context.Context, s *settings.Settings, raw string) (*Command, error) {
+	name, _, err := SplitCommandAndArgs(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	_, hasPolicy := s.CommandPolicies[name]
+	hasShell := len(s.Shell) > 0 && s.Shell[0] != ""
+	if !hasPolicy && hasShell && strings.ContainsAny(raw, shellMetacharacters) {
+		return nil, fmt.Errorf("%w: %s", ErrShellNotAllowed, raw)
+	}
+	return NewCommand(ctx, s, raw, nil)
+}
+
+// environ returns the environment of the command, that of the server kept by
+// its policy along with vars.
+func (c *Command) environ(vars map[string]string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if c.Policy == nil || c.Policy.KeepsEnv(key) {
+			env = append(env, kv)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(vars)) {
+		env = append(env, key+"="+vars[key])
+	}
+	return env
+}
+
+// String returns the command as it is run.
+func (c *Command) String() string {
+	return strings.Join(c.cmd.Args, " ")
+}
+
+// SetDir sets the directory the command is run in, which must resolve to the
+// scope or a directory within it.
+func (c *Command) SetDir(scope, dir string) error {
+	root, err := filepath.EvalSymlinks(scope)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s is outside of the scope", fberrors.ErrPermissionDenied, dir)
+	}
+	c.cmd.Dir = resolved
+	return nil
+}
+
+// Start starts the command, writing its output to stdout and stderr, which
+// may be the same writer.
+func (c *Command) Start(stdin io.Reader, stdout, stderr io.Writer) error {
+	if c.Policy != nil && c.Policy.MaxOutput > 0 {
+		output := &outputLimit{left: c.Policy.MaxOutput, cancel: c.cancel}
+		same := stdout == stderr
+		if stdout != nil {
+			stdout = &limitedWriter{w: stdout, limit: output}
+		}
+		if same {
+			stderr = stdout
+		} else if stderr != nil {
+			stderr = &limitedWriter{w: stderr, limit: output}
+		}
+	}
+	c.cmd.Stdin = stdin
+	c.cmd.Stdout = stdout
+	c.cmd.Stderr = stderr
+	if c.Policy != nil && c.cmd.Err == nil {
+		limit(c.cmd, c.Policy)
+	}
+
+	if err := c.cmd.Start(); err != nil {
+		c.release()
+		return err
+	}
+	return nil
+}
+
+// Wait waits for the command to exit, failing with ErrTimeout or
+// ErrOutputLimit when it was killed for them.
+func (c *Command) Wait() error {
+	err := c.cmd.Wait()
+	if cause := context.Cause(c.ctx); err != nil && cause != nil {
+		err = cause
+	}
+	c.release()
+	return err
+}
+
+func (c *Command) release() {
+	c.cancel(nil)
+	c.stop()
+}
+
+// Run starts the command and waits for it.
+func (c *Command) Run(stdin io.Reader, stdout, stderr io.Writer) error {
+	if err := c.Start(stdin, stdout, stderr); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// outputLimit kills the command once it output more than allowed, on its
+// standard output and error together.
+type outputLimit struct {
+	mu     sync.Mutex
+	left   int64
+	cancel context.CancelCauseFunc
+}
+
+type limitedWriter struct {
+	w     io.Writer
+	limit *outputLimit
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	l.limit.mu.Lock()
+	defer l.limit.mu.Unlock()
+
+	if int64(len(p)) > l.limit.left {
+		n, _ := l.w.Write(p[:l.limit.left])
+		l.limit.left = 0
+		l.limit.cancel(ErrOutputLimit)
+		return n, ErrOutputLimit
+	}
+	l.limit.left -= int64(len(p))
+	return l.w.Write(p)
+}
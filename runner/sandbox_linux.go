@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+var cloneFlags = map[string]uintptr{
+	"user":  syscall.CLONE_NEWUSER,
+	"mount": syscall.CLONE_NEWNS,
+	"pid":   syscall.CLONE_NEWPID,
+	"net":   syscall.CLONE_NEWNET,
+	"ipc":   syscall.CLONE_NEWIPC,
+	"uts":   syscall.CLONE_NEWUTS,
+}
+
+// isolate runs the command in a process group of its own, killed as a whole
+// with the command, and in the namespaces of its policy.
+func isolate(cmd *exec.Cmd, policy *settings.CommandPolicy) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	if policy == nil {
+		return
+	}
+
+	for _, ns := range policy.Namespaces {
+		cmd.SysProcAttr.Cloneflags |= cloneFlags[ns]
+	}
+	if cmd.SysProcAttr.Cloneflags&syscall.CLONE_NEWUSER != 0 {
+		// The command keeps the IDs of the server, its files being owned
+		// by them.
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	}
+}
+
+// limitsEnv passes the resource limits of a command to the server
+// re-executed to run it, as comma separated resource=value pairs.
+const limitsEnv = "FILEBROWSER_SANDBOX_LIMITS"
+
+// The server re-executed by limit sets the resource limits it was given to
+// itself before anything else, and then executes the command in its place.
+// The limits so hold from the first instruction of the command, and for
+// everything it starts.
+func init() {
+	limits, ok := os.LookupEnv(limitsEnv)
+	if !ok {
+		return
+	}
+
+	env := slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		return strings.HasPrefix(kv, limitsEnv+"=")
+	})
+	for _, pair := range strings.Split(limits, ",") {
+		var resource int
+		var value uint64
+		if _, err := fmt.Sscanf(pair, "%d=%d", &resource, &value); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid resource limit %q: %v\n", pair, err)
+			os.Exit(126)
+		}
+		if err := unix.Setrlimit(resource, &unix.Rlimit{Cur: value, Max: value}); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to limit resource %d: %v\n", resource, err)
+			os.Exit(126)
+		}
+	}
+
+	err := syscall.Exec(os.Args[0], os.Args[1:], env)
+	fmt.Fprintf(os.Stderr, "failed to execute %s: %v\n", os.Args[0], err)
+	os.Exit(126)
+}
+
+// limit makes the command set the resource limits of the policy before it is
+// executed, by having the server re-execute itself to set them and then
+// execute it.
+func limit(cmd *exec.Cmd, policy *settings.CommandPolicy) {
+	// The CPU time is rounded up, less than a second being no limit at all.
+	limits := map[int]uint64{
+		unix.RLIMIT_AS:     policy.MaxMemory,
+		unix.RLIMIT_CPU:    uint64(math.Ceil(policy.GetMaxCPUTime().Seconds())),
+		unix.RLIMIT_FSIZE:  policy.MaxFileSize,
+		unix.RLIMIT_NOFILE: policy.MaxOpenFiles,
+	}
+	var pairs []string
+	for _, resource := range slices.Sorted(maps.Keys(limits)) {
+		if value := limits[resource]; value != 0 {
+			pairs = append(pairs, fmt.Sprintf("%d=%d", resource, value))
+		}
+	}
+	if len(pairs) == 0 {
+		return
+	}
+
+	cmd.Env = append(cmd.Env, limitsEnv+"="+strings.Join(pairs, ","))
+	cmd.Args = append([]string{cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package runner
+
+import (
+	"os/exec"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+// isolate does nothing, the namespaces being only supported on Linux.
+func isolate(*exec.Cmd, *settings.CommandPolicy) {}
+
+// limit does nothing, the resource limits being only enforced on Linux.
+func limit(*exec.Cmd, *settings.CommandPolicy) {}
@@ -0,0 +1,191 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+func TestCommandPolicy(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("the commands run are those of Unix")
+	}
+	t.Setenv("FB_SANDBOX_KEPT", "kept")
+	t.Setenv("FB_SANDBOX_CLEARED", "cleared")
+
+	s := &settings.Settings{
+		Shell: []string{"sh", "-c"},
+		CommandPolicies: map[string]settings.CommandPolicy{
+			"echo":  {Args: []string{"[a-z]+"}},
+			"sleep": {Timeout: "50ms"},
+			"seq":   {MaxOutput: 10},
+			"env":   {ClearEnv: true, Env: []string{"FB_SANDBOX_KEPT"}},
+		},
+	}
+	run := func(raw string, vars map[string]string) (string, error) {
+		t.Helper()
+		c, err := NewCommand(context.Background(), s, raw, vars)
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		err = c.Run(nil, &out, &out)
+		return out.String(), err
+	}
+
+	if out, err := run("echo hello; rm -rf /", nil); !errors.Is(err, ErrArgsNotAllowed) {
+		t.Fatalf("expected the arguments to be refused, got %q, %v", out, err)
+	}
+	// Commands with a policy are not run through the shell.
+	if out, err := run("echo hello", nil); err != nil || out != "hello\n" {
+		t.Fatalf("expected hello, got %q, %v", out, err)
+	}
+	if _, err := run("echo $NAME", map[string]string{"NAME": "world"}); err != nil {
+		t.Fatalf("expected the expanded argument to be allowed, got %v", err)
+	}
+	if _, err := run("sleep 5", nil); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected the command to time out, got %v", err)
+	}
+	if out, err := run("seq 1000", nil); !errors.Is(err, ErrOutputLimit) || len(out) != 10 {
+		t.Fatalf("expected the output to be cut at 10 bytes, got %q, %v", out, err)
+	}
+
+	out, err := run("env", map[string]string{"FILE": "/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "FB_SANDBOX_KEPT=kept") || !strings.Contains(out, "FILE=/a") || strings.Contains(out, "FB_SANDBOX_CLEARED") {
+		t.Fatalf("expected the environment to be cleared but for the variables kept, got %q", out)
+	}
+
+	// The commands without a policy are still run through the shell.
+	if out, err := run("printf a; printf b", nil); err != nil || out != "ab" {
+		t.Fatalf("expected ab, got %q, %v", out, err)
+	}
+}
+
+func TestUserCommand(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("the commands run are those of Unix")
+	}
+
+	s := &settings.Settings{
+		Shell:           []string{"sh", "-c"},
+		CommandPolicies: map[string]settings.CommandPolicy{"echo": {}},
+	}
+	out := filepath.Join(t.TempDir(), "injected")
+	for _, raw := range []string{
+		"printf a; touch " + out,
+		"printf a && touch " + out,
+		"printf a | touch " + out,
+		"printf a > " + out,
+		"printf $(touch " + out + ")",
+		"printf a\ntouch " + out,
+	} {
+		if _, err := NewUserCommand(context.Background(), s, raw); !errors.Is(err, ErrShellNotAllowed) {
+			t.Errorf("%q: expected the shell to be refused, got %v", raw, err)
+		}
+	}
+
+	run := func(raw string) (string, error) {
+		t.Helper()
+		c, err := NewUserCommand(context.Background(), s, raw)
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		err = c.Run(nil, &out, &out)
+		return out.String(), err
+	}
+	if got, err := run("printf 'a b'"); err != nil || got != "a b" {
+		t.Errorf("expected the plain commands to be run, got %q, %v", got, err)
+	}
+	// The commands under a policy are not run through the shell, where the
+	// metacharacters are mere arguments.
+	if got, err := run("echo a; touch " + out); err != nil || got != "a; touch "+out+"\n" {
+		t.Errorf("expected the metacharacters to be echoed, got %q, %v", got, err)
+	}
+	if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected nothing to be injected, got %v", err)
+	}
+
+	// Without a shell, nothing is interpreted.
+	s.Shell = nil
+	if got, err := run("printf a;b"); err != nil || got != "a;b" {
+		t.Errorf("expected the metacharacters to be printed, got %q, %v", got, err)
+	}
+}
+
+func TestCommandLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the resource limits are only enforced on Linux")
+	}
+
+	s := &settings.Settings{
+		CommandPolicies: map[string]settings.CommandPolicy{
+			"sh": {MaxOpenFiles: 16, MaxCPUTime: "500ms"},
+		},
+	}
+	c, err := NewCommand(context.Background(), s, `sh -c "ulimit -n; ulimit -t; sh -c 'ulimit -n'; echo ${FILEBROWSER_SANDBOX_LIMITS:-unset}"`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := c.Run(nil, &out, &out); err != nil {
+		t.Fatalf("%v: %s", err, out.String())
+	}
+	// The limits hold from the start, for the command and its children, which
+	// aren't told about them. The CPU time is limited to a second at least.
+	if out.String() != "16\n1\n16\nunset\n" {
+		t.Errorf("expected the resources to be limited, got %q", out.String())
+	}
+}
+
+func TestCommandKilledWithContext(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("the commands run are those of Unix")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := NewCommand(ctx, &settings.Settings{}, "sleep 5", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := c.Wait(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the command to be killed, got %v", err)
+	}
+}
+
+func TestCommandSetDir(t *testing.T) {
+	root := t.TempDir()
+	scope := filepath.Join(root, "scope")
+	if err := os.MkdirAll(filepath.Join(scope, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(scope, "escape")); err != nil {
+		t.Skipf("cannot create symlink: %v", err)
+	}
+
+	c, err := NewCommand(context.Background(), &settings.Settings{}, "true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetDir(scope, filepath.Join(scope, "dir")); err != nil {
+		t.Fatalf("expected a directory within the scope to be allowed, got %v", err)
+	}
+	if err := c.SetDir(scope, filepath.Join(scope, "escape")); !errors.Is(err, fberrors.ErrPermissionDenied) {
+		t.Fatalf("expected a directory out of the scope to be refused, got %v", err)
+	}
+}
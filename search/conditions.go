@@ -1,102 +1,278 @@
 package search
 
 import (
+	"bytes"
+	"fmt"
 	"mime"
+	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
-var (
-	typeRegexp = regexp.MustCompile(`type:(\w+)`)
-)
+// candidate is a file being matched against a search.
+type candidate struct {
+	path          string // path within the searched filesystem
+	relPath       string // path relative to the searched directory
+	info          os.FileInfo
+	content       []byte // indexed content, if any
+	caseSensitive bool
 
-type condition func(path string) bool
+	lowerName    string
+	lowerContent []byte
+	lowered      bool
+}
 
-func extensionCondition(extension string) condition {
-	return func(path string) bool {
-		return filepath.Ext(path) == "."+extension
+func (c *candidate) name() string {
+	_, name := path.Split(c.path)
+	if c.caseSensitive {
+		return name
 	}
+	c.lower()
+	return c.lowerName
 }
 
-func imageCondition(path string) bool {
-	extension := filepath.Ext(path)
-	mimetype := mime.TypeByExtension(extension)
+func (c *candidate) text() []byte {
+	if c.caseSensitive {
+		return c.content
+	}
+	c.lower()
+	return c.lowerContent
+}
 
-	return strings.HasPrefix(mimetype, "image")
+func (c *candidate) lower() {
+	if c.lowered {
+		return
+	}
+	_, name := path.Split(c.path)
+	c.lowerName = strings.ToLower(name)
+	if c.content != nil {
+		c.lowerContent = bytes.ToLower(c.content)
+	}
+	c.lowered = true
 }
 
-func audioCondition(path string) bool {
-	extension := filepath.Ext(path)
-	mimetype := mime.TypeByExtension(extension)
+type condition func(c *candidate) bool
 
-	return strings.HasPrefix(mimetype, "audio")
+func extensionCondition(extension string) condition {
+	return func(c *candidate) bool {
+		return filepath.Ext(c.path) == "."+extension
+	}
 }
 
-func videoCondition(path string) bool {
-	extension := filepath.Ext(path)
-	mimetype := mime.TypeByExtension(extension)
+func mimeCondition(prefix string) condition {
+	return func(c *candidate) bool {
+		extension := filepath.Ext(c.path)
+		mimetype := mime.TypeByExtension(extension)
 
-	return strings.HasPrefix(mimetype, "video")
+		return strings.HasPrefix(mimetype, prefix)
+	}
 }
 
-func parseSearch(value string) *searchOptions {
-	opts := &searchOptions{
-		CaseSensitive: strings.Contains(value, "case:sensitive"),
-		Conditions:    []condition{},
-		Terms:         []string{},
+func typeCondition(value string) condition {
+	switch value {
+	case "image":
+		return mimeCondition("image")
+	case "audio", "music":
+		return mimeCondition("audio")
+	case "video":
+		return mimeCondition("video")
+	default:
+		return extensionCondition(value)
 	}
+}
 
-	// removes the options from the value
-	value = strings.ReplaceAll(value, "case:insensitive", "")
-	value = strings.ReplaceAll(value, "case:sensitive", "")
-	value = strings.TrimSpace(value)
+func extCondition(value string) condition {
+	extension := strings.TrimPrefix(value, ".")
+	return func(c *candidate) bool {
+		return strings.EqualFold(filepath.Ext(c.path), "."+extension)
+	}
+}
 
-	types := typeRegexp.FindAllStringSubmatch(value, -1)
-	for _, t := range types {
-		if len(t) == 1 {
-			continue
+func pathCondition(value string) condition {
+	return func(c *candidate) bool {
+		if c.caseSensitive {
+			return strings.Contains(c.relPath, value)
 		}
+		return strings.Contains(strings.ToLower(c.relPath), value)
+	}
+}
+
+func regexCondition(value string, caseSensitive bool) (condition, error) {
+	if !caseSensitive {
+		value = "(?i)" + value
+	}
+
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, err
+	}
 
-		switch t[1] {
-		case "image":
-			opts.Conditions = append(opts.Conditions, imageCondition)
-		case "audio", "music":
-			opts.Conditions = append(opts.Conditions, audioCondition)
-		case "video":
-			opts.Conditions = append(opts.Conditions, videoCondition)
-		default:
-			opts.Conditions = append(opts.Conditions, extensionCondition(t[1]))
+	return func(c *candidate) bool {
+		_, name := path.Split(c.path)
+		return re.MatchString(name)
+	}, nil
+}
+
+// comparison splits the comparison operator off a size or date value.
+func comparison(value string) (op, rest string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, op) {
+			return op, value[len(op):]
 		}
 	}
+	return "=", value
+}
 
-	if len(types) > 0 {
-		// Remove the fields from the search value.
-		value = typeRegexp.ReplaceAllString(value, "")
+func compare[T int64 | int](op string, a, b T) bool {
+	switch op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	default:
+		return a == b
 	}
+}
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
 
-	// If it's case insensitive, put everything in lowercase.
-	if !opts.CaseSensitive {
-		value = strings.ToLower(value)
+// parseSize parses sizes such as 512, 10MB or 1.5g. Units are binary
+// multiples, the way sizes are displayed in the listings.
+func parseSize(value string) (int64, error) {
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(value)
 	}
 
-	// Remove the spaces from the search value.
-	value = strings.TrimSpace(value)
+	number, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(value[i:])]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q", value[i:])
+	}
+
+	return int64(number * float64(unit)), nil
+}
+
+func sizeCondition(value string) (condition, error) {
+	op, value := comparison(value)
+	size, err := parseSize(value)
+	if err != nil {
+		return nil, err
+	}
 
+	return func(c *candidate) bool {
+		if c.info == nil || c.info.IsDir() {
+			return false
+		}
+		return compare(op, c.info.Size(), size)
+	}, nil
+}
+
+var durationUnits = map[byte]time.Duration{
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+}
+
+// modifiedCondition handles two forms of values. A date, optionally prefixed
+// with a comparison operator, compares the modification time to that date,
+// with a plain date matching the whole day. An age like 7d matches what was
+// modified within that time, and >7d what is older than that.
+func modifiedCondition(value string, now time.Time) (condition, error) {
+	op, value := comparison(value)
 	if value == "" {
-		return opts
+		return nil, fmt.Errorf("missing date")
+	}
+
+	if unit, ok := durationUnits[value[len(value)-1]]; ok {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err == nil && n >= 0 {
+			since := now.Add(-time.Duration(n) * unit).UnixNano()
+			switch op {
+			case ">", ">=":
+				op = "<"
+			default:
+				op = ">="
+			}
+			return modTimeCondition(func(t int64) bool { return compare(op, t, since) }), nil
+		}
 	}
 
-	// if the value starts with " and finishes what that character, we will
-	// only search for that term
-	if value[0] == '"' && value[len(value)-1] == '"' {
-		unique := strings.TrimPrefix(value, "\"")
-		unique = strings.TrimSuffix(unique, "\"")
+	for _, layout := range dateLayouts {
+		date, err := time.ParseInLocation(layout, value, now.Location())
+		if err != nil {
+			continue
+		}
+
+		// A date without a time covers the whole day, anything more precise
+		// covers a single second.
+		end := date.Add(time.Second)
+		if layout == dateLayouts[0] {
+			end = date.AddDate(0, 0, 1)
+		}
+		start, stop := date.UnixNano(), end.UnixNano()
 
-		opts.Terms = []string{unique}
-		return opts
+		return modTimeCondition(func(t int64) bool {
+			switch op {
+			case ">":
+				return t >= stop
+			case ">=":
+				return t >= start
+			case "<":
+				return t < start
+			case "<=":
+				return t < stop
+			default:
+				return t >= start && t < stop
+			}
+		}), nil
 	}
 
-	opts.Terms = strings.Split(value, " ")
-	return opts
+	return nil, fmt.Errorf("invalid date %q", value)
+}
+
+func modTimeCondition(fn func(t int64) bool) condition {
+	return func(c *candidate) bool {
+		if c.info == nil {
+			return false
+		}
+		return fn(c.info.ModTime().UnixNano())
+	}
 }
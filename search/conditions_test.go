@@ -0,0 +1,137 @@
+package search
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+type fakeInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (f fakeInfo) Name() string       { return f.name }
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) ModTime() time.Time { return f.modTime }
+func (f fakeInfo) IsDir() bool        { return f.dir }
+func (f fakeInfo) Sys() interface{}   { return nil }
+func (f fakeInfo) Mode() os.FileMode {
+	if f.dir {
+		return os.ModeDir
+	}
+	return 0
+}
+
+func TestParseSearchMatches(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	files := map[string]fakeInfo{
+		"/docs/Report.PDF":        {size: 20 << 20, modTime: now.Add(-2 * day)},
+		"/docs/notes.txt":         {size: 2 << 10, modTime: time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local)},
+		"/music/song.mp3":         {size: 5 << 20, modTime: now.Add(-30 * day)},
+		"/photos/cat.jpg":         {size: 3 << 20, modTime: now.Add(-10 * day)},
+		"/photos/backup(1).jpg":   {size: 1 << 10, modTime: now},
+		"/photos":                 {dir: true, modTime: now},
+		"/src/main_test.go":       {size: 100, modTime: time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local)},
+		"/src/Makefile":           {size: 50, modTime: time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)},
+		"/video/holiday 2023.mp4": {size: 700 << 20, modTime: time.Date(2023, 8, 1, 0, 0, 0, 0, time.Local)},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"/docs/Report.PDF", "/docs/notes.txt", "/music/song.mp3", "/photos/cat.jpg",
+			"/photos/backup(1).jpg", "/photos", "/src/main_test.go", "/src/Makefile", "/video/holiday 2023.mp4"}},
+		{"report", []string{"/docs/Report.PDF"}},
+		{"report case:sensitive", nil},
+		{"Report case:sensitive", []string{"/docs/Report.PDF"}},
+		{"cat song", []string{"/music/song.mp3", "/photos/cat.jpg"}},
+		{`"holiday 2023"`, []string{"/video/holiday 2023.mp4"}},
+		{"backup(1)", []string{"/photos/backup(1).jpg"}},
+		{"type:image", []string{"/photos/cat.jpg", "/photos/backup(1).jpg"}},
+		{"type:image type:audio", []string{"/music/song.mp3", "/photos/cat.jpg", "/photos/backup(1).jpg"}},
+		{"type:image cat", []string{"/photos/cat.jpg"}},
+		{"ext:pdf", []string{"/docs/Report.PDF"}},
+		{"ext:.go", []string{"/src/main_test.go"}},
+		{"size:>10MB", []string{"/docs/Report.PDF", "/video/holiday 2023.mp4"}},
+		{"size:<=2k", []string{"/docs/notes.txt", "/photos/backup(1).jpg", "/src/main_test.go", "/src/Makefile"}},
+		{"size:100", []string{"/src/main_test.go"}},
+		{"modified:7d", []string{"/docs/Report.PDF", "/photos/backup(1).jpg", "/photos"}},
+		{"modified:>1y", []string{"/docs/notes.txt", "/src/main_test.go", "/src/Makefile", "/video/holiday 2023.mp4"}},
+		{"modified:<2024-01-01", []string{"/docs/notes.txt", "/video/holiday 2023.mp4"}},
+		{"modified:2024-01-01", []string{"/src/main_test.go"}},
+		{"modified:>2024-01-01 path:src", []string{"/src/Makefile"}},
+		{"regex:^main_.*\\.go$", []string{"/src/main_test.go"}},
+		{`regex:"^holiday \d+"`, []string{"/video/holiday 2023.mp4"}},
+		{"path:photos/", []string{"/photos/cat.jpg", "/photos/backup(1).jpg"}},
+		{"type:image -cat", []string{"/photos/backup(1).jpg"}},
+		{"-path:photos -size:>1k", []string{"/src/main_test.go", "/src/Makefile"}},
+		{"cat OR ext:go", []string{"/photos/cat.jpg", "/src/main_test.go"}},
+		{"path:src AND make", []string{"/src/Makefile"}},
+		{"(ext:mp3 OR ext:mp4) size:>100MB", []string{"/video/holiday 2023.mp4"}},
+		{"-(type:image OR type:audio) size:>1MB", []string{"/docs/Report.PDF", "/video/holiday 2023.mp4"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			search, err := parseSearch(tc.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := map[string]bool{}
+			for _, p := range tc.want {
+				want[p] = true
+			}
+
+			for p, info := range files {
+				got := search.matches(&candidate{path: p, relPath: p[1:], info: info})
+				if got != want[p] {
+					t.Errorf("%s: expected match to be %v, got %v", p, want[p], got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"size:", 1},
+		{"foo size:>10XB", 10},
+		{"modified:yesterday", 10},
+		{"regex:[a-", 7},
+		{`foo "bar`, 5},
+		{"(foo", 1},
+		{"foo)", 4},
+		{"foo OR", 7},
+		{"AND foo", 1},
+		{"foo ()", 5},
+		{"case:maybe", 1},
+		{"-case:sensitive foo", 1},
+		{"-content:foo", 1},
+		{"content:foo content:bar", 13},
+		{"(content:foo ext:go)", 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			_, err := parseSearch(tc.query)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("expected a syntax error, got %v", err)
+			}
+			if syntaxErr.Pos != tc.pos {
+				t.Errorf("expected error at position %d, got %d (%v)", tc.pos, syntaxErr.Pos, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/thevickypedia/filebrowser/v2/files"
+)
+
+const (
+	// grepWorkers is the number of files searched at the same time by a
+	// content search.
+	grepWorkers = 4
+
+	// maxGrepFileSize is the size above which files are skipped by content
+	// searches.
+	maxGrepFileSize = 10 * 1024 * 1024 // 10 MB
+
+	// maxGrepLineSize is the length above which the rest of a file is skipped.
+	maxGrepLineSize = 1 << 20 // 1 MiB
+
+	// maxGrepMatches is the number of matching lines reported per file.
+	maxGrepMatches = 100
+
+	// excerptSize is the number of characters of a line reported around the
+	// match.
+	excerptSize = 160
+)
+
+// Result is a search result. Line and Excerpt are only set by content
+// searches, which report every matching line of a file as its own result.
+type Result struct {
+	Path    string
+	Dir     bool
+	Line    int
+	Excerpt string
+}
+
+// grepper searches the lines of the files added to it, a bounded number of
+// files at a time.
+type grepper struct {
+	ctx    context.Context
+	group  *errgroup.Group
+	fs     afero.Fs
+	search *searchOptions
+
+	mu    sync.Mutex
+	found func(r Result) error
+}
+
+func newGrepper(ctx context.Context, fs afero.Fs, search *searchOptions, found func(r Result) error) *grepper {
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(grepWorkers)
+
+	return &grepper{ctx: ctx, group: group, fs: fs, search: search, found: found}
+}
+
+// add queues the file at fPath, blocking while all the workers are busy.
+// Content that was indexed for the file, if any, lets it be skipped without
+// reading it when the file is small enough to be indexed entirely.
+func (g *grepper) add(fPath, relPath string, info os.FileInfo, indexed []byte) error {
+	if err := g.ctx.Err(); err != nil {
+		return context.Cause(g.ctx)
+	}
+	if info == nil || !info.Mode().IsRegular() || info.Size() > maxGrepFileSize {
+		return nil
+	}
+
+	if indexed != nil && info.Size() <= maxIndexedContent {
+		if !g.search.CaseSensitive {
+			indexed = bytes.ToLower(indexed)
+		}
+		if !bytes.Contains(indexed, []byte(g.search.Content)) {
+			return nil
+		}
+	}
+
+	g.group.Go(func() error {
+		return g.grep(fPath, relPath)
+	})
+	return nil
+}
+
+// wait waits for the queued files to be searched.
+func (g *grepper) wait() error {
+	return g.group.Wait()
+}
+
+func (g *grepper) grep(fPath, relPath string) error {
+	file, err := files.NewFileInfo(&files.FileOptions{
+		Fs:         g.fs,
+		Path:       fPath,
+		Modify:     true,
+		Expand:     true,
+		ReadHeader: true,
+		Checker:    allowAll{},
+	})
+	if err != nil || file.Type != "text" {
+		// Files that can't be read are skipped, like the walk skips the
+		// directories it can't read.
+		return nil
+	}
+
+	f, err := g.fs.Open(fPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	needle := []byte(g.search.Content)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxGrepLineSize)
+
+	matches := 0
+	for line := 1; scanner.Scan(); line++ {
+		if err := g.ctx.Err(); err != nil {
+			return context.Cause(g.ctx)
+		}
+
+		text := scanner.Bytes()
+		haystack := text
+		if !g.search.CaseSensitive {
+			haystack = bytes.ToLower(text)
+		}
+
+		i := bytes.Index(haystack, needle)
+		if i == -1 {
+			continue
+		}
+
+		err := g.report(Result{
+			Path:    relPath,
+			Line:    line,
+			Excerpt: excerpt(text, i, len(needle)),
+		})
+		if err != nil {
+			return err
+		}
+
+		matches++
+		if matches == maxGrepMatches {
+			break
+		}
+	}
+
+	// A read error or an overly long line ends the search of the file,
+	// keeping what was found so far.
+	return nil
+}
+
+func (g *grepper) report(r Result) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.found(r)
+}
+
+// excerpt returns the part of the line around the match at i, of length n.
+// Lowercasing doesn't change the length of ASCII text, for anything else
+// the window may be slightly off, which is fine for an excerpt.
+func excerpt(line []byte, i, n int) string {
+	if len(line) > excerptSize {
+		start := max(i-(excerptSize-n)/2, 0)
+		end := min(start+excerptSize, len(line))
+		start = max(end-excerptSize, 0)
+		line = line[start:end]
+	}
+
+	// Drop the multi-byte characters that were cut in half.
+	return strings.TrimSpace(strings.ToValidUTF8(string(line), ""))
+}
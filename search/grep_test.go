@@ -0,0 +1,85 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestContentSearch(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for name, content := range map[string]string{
+		"/etc/app.conf":    "# settings\nlisten = 0.0.0.0\nPort = 8080\n",
+		"/etc/other.yaml":  "port: 9090\nhost: example.com\n",
+		"/etc/secret.conf": "port = 1\n",
+		"/bin/app":         "\x00\x01\x02port\x00\x7f",
+		"/docs/readme.md":  "Nothing to see here.\n",
+	} {
+		if err := afero.WriteFile(fs, name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"content:port", []string{"etc/app.conf:3:Port = 8080", "etc/other.yaml:1:port: 9090"}},
+		{"content:Port case:sensitive", []string{"etc/app.conf:3:Port = 8080"}},
+		{"content:port ext:yaml", []string{"etc/other.yaml:1:port: 9090"}},
+		{`content:"example.com"`, []string{"etc/other.yaml:2:host: example.com"}},
+		{"content:missing", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			var got []string
+			err := Search(context.Background(), fs, "/", tc.query, denyChecker("/etc/secret.conf"), func(r Result) error {
+				got = append(got, strings.Join([]string{r.Path, strconv.Itoa(r.Line), r.Excerpt}, ":"))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(got)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestContentSearchCancel(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "/a.txt", []byte("needle\nneedle\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Search(ctx, fs, "/", "content:needle", denyChecker(""), func(Result) error {
+		t.Error("no result expected once canceled")
+		return nil
+	})
+	if err == nil {
+		t.Error("expected the search to be canceled")
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	long := strings.Repeat("a", 300) + "needle" + strings.Repeat("b", 300)
+	got := excerpt([]byte(long), 300, len("needle"))
+	if len(got) != excerptSize || !strings.Contains(got, "needle") {
+		t.Errorf("expected a %d characters excerpt around the match, got %q", excerptSize, got)
+	}
+
+	if got := excerpt([]byte("\t  short line\r"), 4, 5); got != "short line" {
+		t.Errorf("expected the line to be trimmed, got %q", got)
+	}
+}
@@ -0,0 +1,593 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/afero"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/thevickypedia/filebrowser/v2/files"
+	"github.com/thevickypedia/filebrowser/v2/rules"
+)
+
+const (
+	// indexBatchSize is the number of entries written per transaction while
+	// building the index.
+	indexBatchSize = 1000
+
+	// maxIndexedContent is the number of bytes of a text file that are kept
+	// in the index when content indexing is enabled.
+	maxIndexedContent = 1 << 20 // 1 MiB
+
+	// maxContentFileSize mirrors the size limit detectType applies before
+	// classifying a file as text.
+	maxContentFileSize = 10 * 1024 * 1024 // 10 MB
+
+	// watchDelay is how long file system events are collected before the
+	// affected paths are indexed again.
+	watchDelay = time.Second
+)
+
+var (
+	filesBucket   = []byte("files")
+	contentBucket = []byte("content")
+	metaBucket    = []byte("meta")
+	builtKey      = []byte("built")
+)
+
+// entry is the indexed information of a single path.
+type entry struct {
+	Dir     bool   `json:"d,omitempty"`
+	Size    int64  `json:"s"`
+	ModTime int64  `json:"m"`
+	Gen     uint64 `json:"g"`
+	Text    bool   `json:"t,omitempty"`
+	Link    bool   `json:"l,omitempty"`
+}
+
+type allowAll struct{}
+
+func (allowAll) Check(string) bool { return true }
+
+// Index is a persistent index of every path below a root directory, stored in
+// its own bolt database. It is built in the background, kept current by a
+// file system watcher and by explicit updates from the write paths, and lets
+// searches skip walking the whole tree.
+//
+// Symbolic links are indexed but never followed, which matches what Search
+// does when it walks a user scope.
+type Index struct {
+	db      *bolt.DB
+	fs      afero.Fs
+	root    string
+	content bool
+
+	ready atomic.Bool
+	gen   atomic.Uint64
+
+	watcher     *fsnotify.Watcher
+	watchFailed atomic.Bool
+}
+
+// OpenIndex opens or creates the index database at path for the files below
+// root. When content is true, the content of text files is indexed as well
+// and search terms also match it.
+func OpenIndex(path, root string, content bool) (*Index, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &Index{
+		db:      db,
+		fs:      afero.NewBasePathFs(afero.NewOsFs(), root),
+		root:    filepath.Clean(root),
+		content: content,
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{filesBucket, contentBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		// An index built without content can't answer content queries, and
+		// the other way around it holds content nobody asked for.
+		built := tx.Bucket(metaBucket).Get(builtKey)
+		idx.ready.Store(built != nil && string(built) == indexMode(content))
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("search index: file system watcher unavailable: %v", err)
+	} else {
+		idx.watcher = watcher
+	}
+
+	return idx, nil
+}
+
+func indexMode(content bool) string {
+	if content {
+		return "content"
+	}
+	return "names"
+}
+
+// Ready reports whether the index has been completely built at least once.
+// A persisted index stays ready across restarts while it is refreshed.
+func (i *Index) Ready() bool {
+	return i.ready.Load()
+}
+
+// Run builds the index and keeps it current until ctx is done.
+func (i *Index) Run(ctx context.Context) {
+	start := time.Now()
+	if err := i.build(ctx); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("search index: build failed: %v", err)
+		}
+		return
+	}
+	log.Printf("search index: built in %s", time.Since(start).Round(time.Millisecond))
+
+	if i.watcher == nil {
+		<-ctx.Done()
+		return
+	}
+
+	i.watch(ctx)
+}
+
+// Close stops watching the file system and closes the index database.
+func (i *Index) Close() error {
+	if i.watcher != nil {
+		i.watcher.Close()
+	}
+	return i.db.Close()
+}
+
+// Update indexes the file or directory at the given real path again,
+// recursively for directories. A path that no longer exists is removed from
+// the index along with everything below it. Updating a nil index is a no-op,
+// so that callers don't have to care whether indexing is enabled.
+func (i *Index) Update(realPath string) {
+	if i == nil {
+		return
+	}
+
+	p, ok := i.rel(realPath)
+	if !ok {
+		return
+	}
+
+	if err := i.update(context.Background(), p); err != nil {
+		log.Printf("search index: failed to update %s: %v", p, err)
+	}
+}
+
+// Remove removes the given real path and everything below it from the index.
+// Like Update, it is a no-op on a nil index.
+func (i *Index) Remove(realPath string) {
+	if i == nil {
+		return
+	}
+
+	p, ok := i.rel(realPath)
+	if !ok {
+		return
+	}
+
+	if err := i.db.Update(func(tx *bolt.Tx) error { return removeTree(tx, p) }); err != nil {
+		log.Printf("search index: failed to remove %s: %v", p, err)
+	}
+}
+
+// Search searches the index like Search does for the scope directory of a
+// filesystem whose root is found at the real path base. It falls back to
+// walking fs while the index isn't ready or doesn't cover base.
+func (i *Index) Search(ctx context.Context, fs afero.Fs, base, scope, query string,
+	checker rules.Checker, found func(r Result) error) error {
+	baseRel, ok := i.rel(base)
+	if !ok || !i.Ready() || !i.isDir(baseRel) {
+		return Search(ctx, fs, scope, query, checker, found)
+	}
+
+	search, err := parseSearch(query)
+	if err != nil {
+		return err
+	}
+
+	scope = filepath.ToSlash(filepath.Clean(scope))
+	scope = path.Join("/", scope)
+	prefix := path.Join(baseRel, scope)
+	seek := prefix + "/"
+	if prefix == "/" {
+		seek = prefix
+	}
+
+	// Matches are handed to found outside of the read transaction, so that a
+	// slow client doesn't hold it open and stall the writers.
+	type match struct {
+		path    string
+		relPath string
+		info    os.FileInfo
+		content []byte
+	}
+
+	var grep *grepper
+	if search.Content != "" {
+		grep = newGrepper(ctx, fs, search, found)
+		ctx = grep.ctx
+	}
+
+	next := []byte(seek)
+	for next != nil {
+		var matches []match
+
+		err := i.db.View(func(tx *bolt.Tx) error {
+			content := tx.Bucket(contentBucket)
+			c := tx.Bucket(filesBucket).Cursor()
+
+			k, v := c.Seek(next)
+			next = nil
+			for ; k != nil && bytes.HasPrefix(k, []byte(seek)); k, v = c.Next() {
+				if len(matches) == indexBatchSize {
+					next = append([]byte(nil), k...)
+					return nil
+				}
+				if ctx.Err() != nil {
+					return context.Cause(ctx)
+				}
+
+				key := string(k)
+				fPath := path.Join("/", strings.TrimPrefix(key, baseRel))
+				if fPath == scope || !checker.Check(fPath) {
+					continue
+				}
+
+				var e entry
+				if err := json.Unmarshal(v, &e); err != nil {
+					return err
+				}
+
+				var text []byte
+				if e.Text {
+					text = content.Get(k)
+				}
+
+				relativePath := strings.TrimPrefix(strings.TrimPrefix(fPath, scope), "/")
+				info := &entryInfo{name: path.Base(key), entry: e}
+				if !search.matches(&candidate{path: fPath, relPath: relativePath, info: info, content: text}) {
+					continue
+				}
+
+				m := match{path: fPath, relPath: relativePath, info: info}
+				if grep != nil && text != nil {
+					// The content is only valid during the transaction.
+					m.content = append([]byte(nil), text...)
+				}
+				matches = append(matches, m)
+			}
+			return nil
+		})
+
+		for _, m := range matches {
+			if err != nil {
+				break
+			}
+			if grep != nil {
+				err = grep.add(m.path, m.relPath, m.info, m.content)
+			} else {
+				err = found(Result{Path: m.relPath, Dir: m.info.IsDir()})
+			}
+		}
+
+		if err != nil {
+			if grep != nil {
+				_ = grep.wait()
+			}
+			return err
+		}
+	}
+
+	if grep != nil {
+		return grep.wait()
+	}
+	return nil
+}
+
+// rel converts a real path to its key in the index.
+func (i *Index) rel(realPath string) (string, bool) {
+	rel, err := filepath.Rel(i.root, filepath.Clean(realPath))
+	if err != nil {
+		return "", false
+	}
+
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return path.Join("/", rel), true
+}
+
+func (i *Index) isDir(p string) bool {
+	var e entry
+	err := i.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(filesBucket).Get([]byte(p))
+		if v == nil {
+			return os.ErrNotExist
+		}
+		return json.Unmarshal(v, &e)
+	})
+	return err == nil && e.Dir
+}
+
+// build walks the whole root, writes every path found and then drops the
+// entries of paths that no longer exist.
+func (i *Index) build(ctx context.Context) error {
+	gen := uint64(time.Now().UnixNano())
+	i.gen.Store(gen)
+
+	if err := i.walk(ctx, "/", gen); err != nil {
+		return err
+	}
+
+	err := i.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+		var stale [][]byte
+
+		err := b.ForEach(func(k, v []byte) error {
+			var e entry
+			if err := json.Unmarshal(v, &e); err != nil || e.Gen < gen {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			if err := tx.Bucket(contentBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(metaBucket).Put(builtKey, []byte(indexMode(i.content)))
+	})
+	if err != nil {
+		return err
+	}
+
+	i.ready.Store(true)
+	return nil
+}
+
+// update indexes p again or removes it if it doesn't exist anymore.
+func (i *Index) update(ctx context.Context, p string) error {
+	info, err := lstat(i.fs, p)
+	if errors.Is(err, os.ErrNotExist) {
+		return i.db.Update(func(tx *bolt.Tx) error { return removeTree(tx, p) })
+	} else if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return i.walk(ctx, p, i.gen.Load())
+	}
+
+	return i.write(map[string]os.FileInfo{p: info}, i.gen.Load())
+}
+
+func (i *Index) walk(ctx context.Context, root string, gen uint64) error {
+	batch := make(map[string]os.FileInfo, indexBatchSize)
+
+	err := afero.Walk(i.fs, root, func(fPath string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if err != nil {
+			// Skip what we can't read, it will be picked up by the next
+			// update of the directory.
+			return nil
+		}
+
+		fPath = path.Join("/", filepath.ToSlash(fPath))
+		if info.IsDir() {
+			i.addWatch(fPath)
+		}
+
+		batch[fPath] = info
+		if len(batch) < indexBatchSize {
+			return nil
+		}
+
+		err = i.write(batch, gen)
+		clear(batch)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return i.write(batch, gen)
+}
+
+// write stores the given entries. Content is only read again for files whose
+// size or modification time changed since they were last indexed.
+func (i *Index) write(batch map[string]os.FileInfo, gen uint64) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	entries := make(map[string]entry, len(batch))
+	contents := map[string][]byte{}
+
+	err := i.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+		for p, info := range batch {
+			e := entry{
+				Dir:     info.IsDir(),
+				Size:    info.Size(),
+				ModTime: info.ModTime().UnixNano(),
+				Gen:     gen,
+				Link:    info.Mode()&os.ModeSymlink != 0,
+			}
+
+			var old entry
+			if v := b.Get([]byte(p)); v != nil && json.Unmarshal(v, &old) == nil &&
+				old.Dir == e.Dir && old.Link == e.Link && old.Size == e.Size && old.ModTime == e.ModTime {
+				e.Text = old.Text && i.content
+				entries[p] = e
+				continue
+			}
+
+			if i.content && info.Mode().IsRegular() {
+				if text, ok := i.readText(p, info); ok {
+					e.Text = true
+					contents[p] = text
+				}
+			}
+			entries[p] = e
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return i.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+		cb := tx.Bucket(contentBucket)
+
+		for p, e := range entries {
+			v, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(p), v); err != nil {
+				return err
+			}
+
+			if text, ok := contents[p]; ok {
+				err = cb.Put([]byte(p), text)
+			} else if !e.Text {
+				err = cb.Delete([]byte(p))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// readText returns the content of p if it's classified as text, the same way
+// the file info of the resources API does.
+func (i *Index) readText(p string, info os.FileInfo) ([]byte, bool) {
+	if info.Size() > maxContentFileSize {
+		return nil, false
+	}
+
+	// Skip the types that are known by their extension, saving a read.
+	mimetype := mime.TypeByExtension(filepath.Ext(p))
+	for _, prefix := range []string{"video", "audio", "image"} {
+		if strings.HasPrefix(mimetype, prefix) {
+			return nil, false
+		}
+	}
+
+	file, err := files.NewFileInfo(&files.FileOptions{
+		Fs:         i.fs,
+		Path:       p,
+		Modify:     true,
+		Expand:     true,
+		ReadHeader: true,
+		Checker:    allowAll{},
+		Content:    true,
+	})
+	if err != nil || file.Type != "text" {
+		return nil, false
+	}
+
+	text := []byte(file.Content)
+	if len(text) > maxIndexedContent {
+		text = text[:maxIndexedContent]
+	}
+	return text, true
+}
+
+func removeTree(tx *bolt.Tx, p string) error {
+	b := tx.Bucket(filesBucket)
+	cb := tx.Bucket(contentBucket)
+
+	keys := [][]byte{[]byte(p)}
+	prefix := []byte(strings.TrimSuffix(p, "/") + "/")
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+		if err := cb.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lstat(afs afero.Fs, name string) (os.FileInfo, error) {
+	if lstater, ok := afs.(afero.Lstater); ok {
+		info, _, err := lstater.LstatIfPossible(name)
+		return info, err
+	}
+	return afs.Stat(name)
+}
+
+// entryInfo implements os.FileInfo for an index entry.
+type entryInfo struct {
+	name  string
+	entry entry
+}
+
+func (e *entryInfo) Name() string       { return e.name }
+func (e *entryInfo) Size() int64        { return e.entry.Size }
+func (e *entryInfo) ModTime() time.Time { return time.Unix(0, e.entry.ModTime) }
+func (e *entryInfo) IsDir() bool        { return e.entry.Dir }
+func (e *entryInfo) Sys() interface{}   { return nil }
+
+func (e *entryInfo) Mode() os.FileMode {
+	switch {
+	case e.entry.Dir:
+		return os.ModeDir | 0755
+	case e.entry.Link:
+		return os.ModeSymlink | 0777
+	default:
+		return 0644
+	}
+}
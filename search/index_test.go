@@ -0,0 +1,110 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+type denyChecker string
+
+func (d denyChecker) Check(path string) bool { return path != string(d) }
+
+func TestIndexSearch(t *testing.T) {
+	root := t.TempDir()
+	scope := filepath.Join(root, "user")
+	for name, content := range map[string]string{
+		"notes.txt":          "remember the milk",
+		"docs/report.md":     "quarterly numbers",
+		"docs/secret.txt":    "nothing to see",
+		"docs/photo.jpg":     "",
+		"../other/notes.txt": "not in scope",
+	} {
+		p := filepath.Join(scope, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx, err := OpenIndex(filepath.Join(t.TempDir(), "index.db"), root, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = idx.Close() })
+
+	if err := idx.build(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !idx.Ready() {
+		t.Fatal("expected index to be ready after building")
+	}
+
+	fs := afero.NewBasePathFs(afero.NewOsFs(), scope)
+	search := func(dir, query string) []string {
+		t.Helper()
+		var found []string
+		err := idx.Search(context.Background(), fs, scope, dir, query, denyChecker("/docs/secret.txt"),
+			func(r Result) error {
+				found = append(found, r.Path)
+				return nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(found)
+		return found
+	}
+
+	tests := []struct {
+		name  string
+		dir   string
+		query string
+		want  []string
+	}{
+		{"file name", "/", "notes", []string{"notes.txt"}},
+		{"content", "/", "quarterly", []string{"docs/report.md"}},
+		{"rules apply", "/", "txt", []string{"notes.txt"}},
+		{"type condition", "/", "type:image", []string{"docs/photo.jpg"}},
+		{"sub directory", "/docs", "", []string{"photo.jpg", "report.md"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := search(tc.dir, tc.query)
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("expected %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+
+	t.Run("update and remove", func(t *testing.T) {
+		newFile := filepath.Join(scope, "docs", "todo.txt")
+		if err := os.WriteFile(newFile, []byte("buy groceries"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		idx.Update(newFile)
+		if got := search("/", "groceries"); len(got) != 1 || got[0] != "docs/todo.txt" {
+			t.Fatalf("expected the new file to be found, got %v", got)
+		}
+
+		if err := os.RemoveAll(filepath.Join(scope, "docs")); err != nil {
+			t.Fatal(err)
+		}
+		idx.Remove(filepath.Join(scope, "docs"))
+		if got := search("/", ""); len(got) != 1 || got[0] != "notes.txt" {
+			t.Fatalf("expected only notes.txt to be left, got %v", got)
+		}
+	})
+}
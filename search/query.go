@@ -0,0 +1,499 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError is returned for search queries that can't be parsed.
+type SyntaxError struct {
+	Pos int // 1-based character position in the query
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	// key is set for predicates such as size:>1MB, text holds the word or
+	// the value of the predicate.
+	key    string
+	text   string
+	quoted bool
+}
+
+var predicates = map[string]bool{
+	"case":     true,
+	"content":  true,
+	"type":     true,
+	"ext":      true,
+	"size":     true,
+	"modified": true,
+	"regex":    true,
+	"path":     true,
+}
+
+// tokenize splits a query into tokens. Words end at white space; parentheses
+// only group when they don't belong to a word, so that names like
+// "file(1).txt" can be searched for without quoting them.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, pos: pos})
+			i++
+			continue
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, pos: pos})
+			i++
+			continue
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, token{kind: tokenNot, pos: pos})
+			i++
+			continue
+		}
+
+		tok := token{kind: tokenWord, pos: pos}
+
+		// A predicate key is only recognized when it is a known one, any
+		// other colon is part of the word.
+		if j := indexRune(runes[i:], ':'); j > 0 {
+			key := strings.ToLower(string(runes[i : i+j]))
+			if predicates[key] {
+				tok.key = key
+				i += j + 1
+			}
+		}
+
+		var text strings.Builder
+		if i < len(runes) && runes[i] == '"' {
+			end, err := readQuoted(runes, i, &text)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tok.quoted = true
+		} else {
+			depth := 0
+			for ; i < len(runes) && !unicode.IsSpace(runes[i]); i++ {
+				if runes[i] == '(' {
+					depth++
+				} else if runes[i] == ')' {
+					if depth == 0 {
+						break
+					}
+					depth--
+				}
+				text.WriteRune(runes[i])
+			}
+		}
+		tok.text = text.String()
+
+		if tok.key == "" && !tok.quoted {
+			switch tok.text {
+			case "AND":
+				tok.kind = tokenAnd
+			case "OR":
+				tok.kind = tokenOr
+			}
+		} else if tok.text == "" {
+			return nil, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("missing value for %s:", tok.key)}
+		}
+
+		tokens = append(tokens, tok)
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes) + 1}), nil
+}
+
+func indexRune(runes []rune, r rune) int {
+	for i, c := range runes {
+		if c == r {
+			return i
+		}
+		if unicode.IsSpace(c) || c == '"' {
+			return -1
+		}
+	}
+	return -1
+}
+
+// readQuoted reads the quoted string starting at runes[start] into text and
+// returns the index following the closing quote.
+func readQuoted(runes []rune, start int, text *strings.Builder) (int, error) {
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			// Only quotes and backslashes are escaped, anything else is kept
+			// as is for the sake of regular expressions.
+			if i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+			}
+			text.WriteRune(runes[i])
+		case '"':
+			return i + 1, nil
+		default:
+			text.WriteRune(runes[i])
+		}
+	}
+	return 0, &SyntaxError{Pos: start + 1, Msg: "unterminated quoted string"}
+}
+
+// node is an element of a parsed query.
+type node interface {
+	match(c *candidate) bool
+}
+
+type andNode []node
+
+func (n andNode) match(c *candidate) bool {
+	for _, child := range n {
+		if !child.match(c) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []node
+
+func (n orNode) match(c *candidate) bool {
+	for _, child := range n {
+		if child.match(c) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct {
+	node
+}
+
+func (n notNode) match(c *candidate) bool {
+	return !n.node.match(c)
+}
+
+// termNode matches a term found in the file name or in its indexed content.
+type termNode string
+
+func (n termNode) match(c *candidate) bool {
+	term := string(n)
+	if strings.Contains(c.name(), term) {
+		return true
+	}
+	return bytes.Contains(c.text(), []byte(term))
+}
+
+type conditionNode condition
+
+func (n conditionNode) match(c *candidate) bool {
+	return n(c)
+}
+
+type searchOptions struct {
+	CaseSensitive bool
+	Expr          node
+	// Content is the text looked up in the lines of the files by a content
+	// search.
+	Content string
+}
+
+// matches reports whether the candidate matches the search.
+func (s *searchOptions) matches(c *candidate) bool {
+	c.caseSensitive = s.CaseSensitive
+	return s.Expr == nil || s.Expr.match(c)
+}
+
+type parser struct {
+	tokens        []token
+	pos           int
+	caseSensitive bool
+	now           time.Time
+}
+
+// parseSearch parses a search query. The grammar is, from the lowest to the
+// highest precedence:
+//
+//	query    = or
+//	or       = and { "OR" and }
+//	and      = sequence { "AND" sequence }
+//	sequence = unary { unary }
+//	unary    = "-" unary | "(" or ")" | predicate | term
+//
+// Within a sequence, plain terms match if any of them is found in the name,
+// and so do type: predicates, like searches always did. Every other element
+// of a sequence must match. case:sensitive applies to the whole query, and
+// so does content:, which turns the search into a search of the lines of the
+// files matching the rest of the query.
+func parseSearch(value string) (*searchOptions, error) {
+	tokens, err := tokenize(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// The options applying to the whole query are taken out before parsing
+	// the rest.
+	p := &parser{now: time.Now()}
+	var content *token
+	depth := 0
+	for i, tok := range tokens {
+		switch tok.kind {
+		case tokenOpen:
+			depth++
+		case tokenClose:
+			depth--
+		}
+
+		if tok.key != "case" && tok.key != "content" {
+			p.tokens = append(p.tokens, tok)
+			continue
+		}
+
+		if i > 0 && tokens[i-1].kind == tokenNot {
+			return nil, &SyntaxError{Pos: tokens[i-1].pos, Msg: fmt.Sprintf("%s: can't be negated", tok.key)}
+		}
+
+		if tok.key == "content" {
+			switch {
+			case content != nil:
+				return nil, &SyntaxError{Pos: tok.pos, Msg: "content: can only be used once"}
+			case depth > 0:
+				return nil, &SyntaxError{Pos: tok.pos, Msg: "content: can't be used in a group"}
+			}
+			content = &tokens[i]
+			continue
+		}
+
+		switch strings.ToLower(tok.text) {
+		case "sensitive":
+			p.caseSensitive = true
+		case "insensitive":
+		default:
+			return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("invalid case option %q", tok.text)}
+		}
+	}
+
+	opts := &searchOptions{CaseSensitive: p.caseSensitive}
+	if content != nil {
+		opts.Content = content.text
+		if !p.caseSensitive {
+			opts.Content = strings.ToLower(opts.Content)
+		}
+	}
+
+	if p.peek().kind == tokenEOF {
+		return opts, nil
+	}
+
+	opts.Expr, err = p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.unexpected(tok)
+	}
+
+	return opts, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) unexpected(tok token) error {
+	switch tok.kind {
+	case tokenEOF:
+		return &SyntaxError{Pos: tok.pos, Msg: "unexpected end of query"}
+	case tokenClose:
+		return &SyntaxError{Pos: tok.pos, Msg: "unexpected )"}
+	case tokenAnd, tokenOr:
+		return &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %s", tok.text)}
+	default:
+		return &SyntaxError{Pos: tok.pos, Msg: "unexpected token"}
+	}
+}
+
+func (p *parser) parseOr() (node, error) {
+	var nodes orNode
+	for {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+
+		if p.peek().kind != tokenOr {
+			break
+		}
+		p.next()
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	var nodes andNode
+	for {
+		n, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+
+		if p.peek().kind != tokenAnd {
+			break
+		}
+		p.next()
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseSequence() (node, error) {
+	var terms, types orNode
+	var nodes andNode
+
+	for {
+		switch tok := p.peek(); tok.kind {
+		case tokenWord, tokenNot, tokenOpen:
+		default:
+			if len(terms) == 0 && len(types) == 0 && len(nodes) == 0 {
+				return nil, p.unexpected(tok)
+			}
+
+			if len(types) > 0 {
+				nodes = append(andNode{types}, nodes...)
+			}
+			if len(terms) > 0 {
+				nodes = append(nodes, terms)
+			}
+			if len(nodes) == 1 {
+				return nodes[0], nil
+			}
+			return nodes, nil
+		}
+
+		tok := p.peek()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case tok.kind == tokenWord && tok.key == "":
+			terms = append(terms, n)
+		case tok.kind == tokenWord && tok.key == "type":
+			types = append(types, n)
+		default:
+			nodes = append(nodes, n)
+		}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenNot:
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case tokenOpen:
+		if p.peek().kind == tokenClose {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: "empty group"}
+		}
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next := p.next(); next.kind != tokenClose {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: "missing )"}
+		}
+		return n, nil
+	case tokenWord:
+		return p.predicate(tok)
+	default:
+		return nil, p.unexpected(tok)
+	}
+}
+
+func (p *parser) predicate(tok token) (node, error) {
+	value := tok.text
+	if !p.caseSensitive && (tok.key == "" || tok.key == "path") {
+		value = strings.ToLower(value)
+	}
+
+	var cond condition
+	var err error
+
+	switch tok.key {
+	case "":
+		return termNode(value), nil
+	case "type":
+		cond = typeCondition(value)
+	case "ext":
+		cond = extCondition(value)
+	case "path":
+		cond = pathCondition(value)
+	case "regex":
+		cond, err = regexCondition(value, p.caseSensitive)
+	case "size":
+		cond, err = sizeCondition(value)
+	case "modified":
+		cond, err = modifiedCondition(value, p.now)
+	}
+
+	if err != nil {
+		// Point at the value rather than at the key.
+		pos := tok.pos + utf8.RuneCountInString(tok.key) + 1
+		return nil, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("%s: %v", tok.key, err)}
+	}
+
+	return conditionNode(cond), nil
+}
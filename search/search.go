@@ -12,21 +12,24 @@ import (
 	"github.com/thevickypedia/filebrowser/v2/rules"
 )
 
-type searchOptions struct {
-	CaseSensitive bool
-	Conditions    []condition
-	Terms         []string
-}
-
 // Search searches for a query in a fs.
 func Search(ctx context.Context,
-	fs afero.Fs, scope, query string, checker rules.Checker, found func(path string, f os.FileInfo) error) error {
-	search := parseSearch(query)
+	fs afero.Fs, scope, query string, checker rules.Checker, found func(r Result) error) error {
+	search, err := parseSearch(query)
+	if err != nil {
+		return err
+	}
+
+	var grep *grepper
+	if search.Content != "" {
+		grep = newGrepper(ctx, fs, search, found)
+		ctx = grep.ctx
+	}
 
 	scope = filepath.ToSlash(filepath.Clean(scope))
 	scope = path.Join("/", scope)
 
-	return afero.Walk(fs, scope, func(fPath string, f os.FileInfo, _ error) error {
+	err = afero.Walk(fs, scope, func(fPath string, f os.FileInfo, _ error) error {
 		if ctx.Err() != nil {
 			return context.Cause(ctx)
 		}
@@ -35,7 +38,7 @@ func Search(ctx context.Context,
 		relativePath := strings.TrimPrefix(fPath, scope)
 		relativePath = strings.TrimPrefix(relativePath, "/")
 
-		if fPath == scope {
+		if fPath == scope || f == nil {
 			return nil
 		}
 
@@ -43,35 +46,20 @@ func Search(ctx context.Context,
 			return nil
 		}
 
-		if len(search.Conditions) > 0 {
-			match := false
-
-			for _, t := range search.Conditions {
-				if t(fPath) {
-					match = true
-					break
-				}
-			}
-
-			if !match {
-				return nil
-			}
-		}
-
-		if len(search.Terms) > 0 {
-			for _, term := range search.Terms {
-				_, fileName := path.Split(fPath)
-				if !search.CaseSensitive {
-					fileName = strings.ToLower(fileName)
-					term = strings.ToLower(term)
-				}
-				if strings.Contains(fileName, term) {
-					return found(relativePath, f)
-				}
-			}
+		if !search.matches(&candidate{path: fPath, relPath: relativePath, info: f}) {
 			return nil
 		}
 
-		return found(relativePath, f)
+		if grep != nil {
+			return grep.add(fPath, relativePath, f, nil)
+		}
+		return found(Result{Path: relativePath, Dir: f.IsDir()})
 	})
+
+	if grep != nil {
+		if waitErr := grep.wait(); err == nil {
+			err = waitErr
+		}
+	}
+	return err
 }
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// addWatch starts watching the directory p, which is relative to the root.
+// Watches are per directory, so running out of them (e.g. the inotify limit
+// on Linux) only leaves part of the tree to the explicit updates.
+func (i *Index) addWatch(p string) {
+	if i.watcher == nil {
+		return
+	}
+
+	err := i.watcher.Add(filepath.Join(i.root, filepath.FromSlash(p)))
+	if err != nil && !i.watchFailed.Swap(true) {
+		log.Printf("search index: can't watch every directory, changes made outside of File Browser may be missed: %v", err)
+	}
+}
+
+// removeWatches stops watching the directory p and everything below it.
+func (i *Index) removeWatches(p string) {
+	if i.watcher == nil {
+		return
+	}
+
+	dir := filepath.Join(i.root, filepath.FromSlash(p))
+	for _, name := range i.watcher.WatchList() {
+		if name == dir || strings.HasPrefix(name, dir+string(filepath.Separator)) {
+			_ = i.watcher.Remove(name)
+		}
+	}
+}
+
+// watch processes the watcher events until ctx is done. Events are collected
+// for a short while before the affected paths are indexed again, so that a
+// file being written doesn't get indexed on every single write.
+func (i *Index) watch(ctx context.Context) {
+	ticker := time.NewTicker(watchDelay)
+	defer ticker.Stop()
+
+	pending := map[string]struct{}{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-i.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			p, ok := i.rel(event.Name)
+			if !ok {
+				continue
+			}
+
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				i.removeWatches(p)
+			}
+
+			pending[p] = struct{}{}
+		case err, ok := <-i.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("search index: watcher error: %v", err)
+		case <-ticker.C:
+			i.flush(ctx, pending)
+			clear(pending)
+		}
+	}
+}
+
+func (i *Index) flush(ctx context.Context, pending map[string]struct{}) {
+	for p := range pending {
+		// The parent is going to be indexed recursively anyway.
+		if _, ok := pending[path.Dir(p)]; ok && p != "/" {
+			continue
+		}
+
+		if err := i.update(ctx, p); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("search index: failed to update %s: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package settings
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Namespaces are the Linux namespaces the commands can be isolated in.
+var Namespaces = []string{"user", "mount", "pid", "net", "ipc", "uts"}
+
+// CommandPolicy restricts how a command is run, whether by the users or as a
+// hook. The commands with a policy are never run through the shell, so that
+// their arguments can't smuggle in other commands. Zero values don't
+// restrict anything.
+type CommandPolicy struct {
+	// Timeout is how long the command may run before it is killed.
+	Timeout string `json:"timeout"`
+	// MaxOutput is how many bytes the command may output before it is
+	// killed.
+	MaxOutput int64 `json:"maxOutput"`
+	// Args are the regular expressions the arguments must match in full, any
+	// of them for each argument.
+	Args []string `json:"args"`
+	// ClearEnv runs the command without the environment of the server, but
+	// for the variables listed in Env.
+	ClearEnv bool     `json:"clearEnv"`
+	Env      []string `json:"env"`
+	// The resource limits of the command, only enforced on Linux.
+	MaxMemory    uint64 `json:"maxMemory"`
+	MaxCPUTime   string `json:"maxCpuTime"`
+	MaxFileSize  uint64 `json:"maxFileSize"`
+	MaxOpenFiles uint64 `json:"maxOpenFiles"`
+	// Namespaces are those of Namespaces the command is isolated in, only on
+	// Linux. Without the user namespace, the others require privileges.
+	Namespaces []string `json:"namespaces"`
+}
+
+// GetTimeout returns how long the command may run, zero for as long as it
+// takes.
+func (p CommandPolicy) GetTimeout() time.Duration {
+	d, _ := time.ParseDuration(p.Timeout)
+	return max(d, 0)
+}
+
+// GetMaxCPUTime returns how much CPU time the command may use, zero for no
+// limit.
+func (p CommandPolicy) GetMaxCPUTime() time.Duration {
+	d, _ := time.ParseDuration(p.MaxCPUTime)
+	return max(d, 0)
+}
+
+// AllowsArgs reports whether the arguments all match the patterns of the
+// policy.
+func (p CommandPolicy) AllowsArgs(args []string) bool {
+	if len(p.Args) == 0 {
+		return true
+	}
+
+	for _, arg := range args {
+		if !slices.ContainsFunc(p.Args, func(pattern string) bool {
+			matched, err := regexp.MatchString("^(?:"+pattern+")$", arg)
+			return err == nil && matched
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// KeepsEnv reports whether the variable of the environment of the server is
+// passed on to the command.
+func (p CommandPolicy) KeepsEnv(key string) bool {
+	return !p.ClearEnv || slices.Contains(p.Env, key)
+}
+
+// Validate checks that the durations, patterns and namespaces of the policy
+// can be parsed.
+func (p CommandPolicy) Validate() error {
+	for name, value := range map[string]string{"timeout": p.Timeout, "maxCpuTime": p.MaxCPUTime} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid command policy %s: %q", name, value)
+		}
+	}
+	for _, pattern := range p.Args {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid command policy argument pattern %q: %w", pattern, err)
+		}
+	}
+	for _, ns := range p.Namespaces {
+		if !slices.Contains(Namespaces, ns) {
+			return fmt.Errorf("invalid command policy namespace: %q", ns)
+		}
+	}
+	return nil
+}
@@ -8,17 +8,19 @@ import (
 // UserDefaults is a type that holds the default values
 // for some fields on User.
 type UserDefaults struct {
-	Scope                 string            `json:"scope"`
-	Locale                string            `json:"locale"`
-	ViewMode              users.ViewMode    `json:"viewMode"`
-	SingleClick           bool              `json:"singleClick"`
-	RedirectAfterCopyMove bool              `json:"redirectAfterCopyMove"`
-	Sorting               files.Sorting     `json:"sorting"`
-	Perm                  users.Permissions `json:"perm"`
-	Commands              []string          `json:"commands"`
-	HideDotfiles          bool              `json:"hideDotfiles"`
-	DateFormat            bool              `json:"dateFormat"`
-	AceEditorTheme        string            `json:"aceEditorTheme"`
+	Scope                 string             `json:"scope"`
+	Locale                string             `json:"locale"`
+	ViewMode              users.ViewMode     `json:"viewMode"`
+	SingleClick           bool               `json:"singleClick"`
+	RedirectAfterCopyMove bool               `json:"redirectAfterCopyMove"`
+	Sorting               files.Sorting      `json:"sorting"`
+	Perm                  users.Permissions  `json:"perm"`
+	Commands              []string           `json:"commands"`
+	HideDotfiles          bool               `json:"hideDotfiles"`
+	DateFormat            bool               `json:"dateFormat"`
+	AceEditorTheme        string             `json:"aceEditorTheme"`
+	Quota                 users.Quota        `json:"quota"`
+	SecondFactor          users.SecondFactor `json:"secondFactor"`
 }
 
 // Apply applies the default options to a user.
@@ -34,4 +36,6 @@ func (d *UserDefaults) Apply(u *users.User) {
 	u.HideDotfiles = d.HideDotfiles
 	u.DateFormat = d.DateFormat
 	u.AceEditorTheme = d.AceEditorTheme
+	u.Quota = d.Quota
+	u.SecondFactor = d.SecondFactor
 }
@@ -0,0 +1,98 @@
+package settings
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const DefaultLoginAttempts = 3
+const DefaultLoginLockout = 5 * time.Minute
+const DefaultLoginMaxLockout = 30 * 24 * time.Hour
+const DefaultLoginWindow = 24 * time.Hour
+
+// LoginLimits configure how the clients and users who fail to log in too
+// often are locked out. Zero values stand for the defaults.
+type LoginLimits struct {
+	// Attempts is how many failed logins are allowed before being locked out.
+	Attempts uint `json:"attempts"`
+	// Lockout is how long the first lockout lasts. Every failure after it
+	// doubles it, up to MaxLockout.
+	Lockout    string `json:"lockout"`
+	MaxLockout string `json:"maxLockout"`
+	// Window is how long failures are remembered once the last lockout ended.
+	Window string `json:"window"`
+	// TrustedProxies are the addresses, or CIDR ranges, of the proxies told
+	// to forward the address of the clients they serve. The clients are
+	// otherwise locked out by the address of their connection.
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// GetAttempts returns how many failed logins are allowed before lockouts.
+func (l LoginLimits) GetAttempts() uint {
+	if l.Attempts == 0 {
+		return DefaultLoginAttempts
+	}
+	return l.Attempts
+}
+
+// GetLockout returns how long the first lockout lasts.
+func (l LoginLimits) GetLockout() time.Duration {
+	return parseLimit(l.Lockout, DefaultLoginLockout)
+}
+
+// GetMaxLockout returns how long lockouts last at most.
+func (l LoginLimits) GetMaxLockout() time.Duration {
+	return parseLimit(l.MaxLockout, DefaultLoginMaxLockout)
+}
+
+// GetWindow returns how long failures are remembered.
+func (l LoginLimits) GetWindow() time.Duration {
+	return parseLimit(l.Window, DefaultLoginWindow)
+}
+
+// TrustsProxy reports whether ip is that of a trusted proxy.
+func (l LoginLimits) TrustsProxy(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range l.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if addr.Equal(net.ParseIP(proxy)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the durations of the limits, and the trusted proxies,
+// can be parsed.
+func (l LoginLimits) Validate() error {
+	for _, proxy := range l.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid trusted proxy: %q", proxy)
+		}
+	}
+
+	for name, value := range map[string]string{"lockout": l.Lockout, "maxLockout": l.MaxLockout, "window": l.Window} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid login limit %s: %q", name, value)
+		}
+	}
+	return nil
+}
+
+func parseLimit(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -15,6 +15,7 @@ const DefaultLogoutPage = "/login"
 const DefaultMinimumPasswordLength = 12
 const DefaultFileMode = 0640
 const DefaultDirMode = 0750
+const DefaultTrashRetention = 30 * 24 * time.Hour
 
 // AuthMethod describes an authentication method.
 type AuthMethod string
@@ -38,6 +39,12 @@ type Settings struct {
 	FileMode              fs.FileMode         `json:"fileMode"`
 	DirMode               fs.FileMode         `json:"dirMode"`
 	HideDotfiles          bool                `json:"hideDotfiles"`
+	Versions              uint                `json:"versions"`
+	LoginLimits           LoginLimits         `json:"loginLimits"`
+	Webhooks              []Webhook           `json:"webhooks"`
+
+	// CommandPolicies restrict how the commands are run, by their name.
+	CommandPolicies map[string]CommandPolicy `json:"commandPolicies"`
 }
 
 // GetRules implements rules.Provider.
@@ -67,11 +74,21 @@ type Server struct {
 	AuthHook               string   `json:"authHook"`
 	TokenExpirationTime    string   `json:"tokenExpirationTime"`
 	FollowExternalSymlinks bool     `json:"followExternalSymlinks"`
+	WebDAVPrefix           string   `json:"webdavPrefix"`
+	TrashDir               string   `json:"trashDir"`
+	TrashRetention         string   `json:"trashRetention"`
+	VersionsDir            string   `json:"versionsDir"`
+	AuditLog               string   `json:"auditLog"`
+	EnableMetrics          bool     `json:"enableMetrics"`
+	MetricsToken           string   `json:"metricsToken"`
 }
 
 // Clean cleans any variables that might need cleaning.
 func (s *Server) Clean() {
 	s.BaseURL = strings.TrimSuffix(s.BaseURL, "/")
+	if s.WebDAVPrefix != "" {
+		s.WebDAVPrefix = "/" + strings.Trim(s.WebDAVPrefix, "/")
+	}
 }
 
 func (s *Server) GetTokenExpirationTime(fallback time.Duration) time.Duration {
@@ -87,6 +104,21 @@ func (s *Server) GetTokenExpirationTime(fallback time.Duration) time.Duration {
 	return duration
 }
 
+// GetTrashRetention returns how long trashed files are kept, zero meaning
+// forever.
+func (s *Server) GetTrashRetention(fallback time.Duration) time.Duration {
+	if s.TrashRetention == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(s.TrashRetention)
+	if err != nil {
+		log.Printf("[WARN] Failed to parse trashRetention: %v", err)
+		return fallback
+	}
+	return duration
+}
+
 // GenerateKey generates a key of 512 bits.
 func GenerateKey() ([]byte, error) {
 	b := make([]byte, 64)
@@ -67,6 +67,10 @@ var defaultEvents = []string{
 	"rename",
 	"upload",
 	"delete",
+	"trash",
+	"restore",
+	"extract",
+	"archive",
 }
 
 // Save saves the settings for the current instance.
@@ -99,6 +103,14 @@ func (s *Storage) Save(set *Settings) error {
 		set.Commands = map[string][]string{}
 	}
 
+	if set.Webhooks == nil {
+		set.Webhooks = []Webhook{}
+	}
+
+	if set.CommandPolicies == nil {
+		set.CommandPolicies = map[string]CommandPolicy{}
+	}
+
 	for _, event := range defaultEvents {
 		if _, ok := set.Commands["before_"+event]; !ok {
 			set.Commands["before_"+event] = []string{}
@@ -0,0 +1,58 @@
+package settings
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// WebhookEvents are the events webhooks can subscribe to, prefixed with
+// before_ or after_ like the commands.
+var WebhookEvents = append(slices.Clone(defaultEvents), "share")
+
+// Webhook is a subscription of a URL to events. The JSON payloads of the
+// events are posted to it, signed with its secret.
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// Subscribed reports whether the webhook subscribed to the event.
+func (w Webhook) Subscribed(evt string) bool {
+	return slices.Contains(w.Events, evt)
+}
+
+// Validate checks that the URL of the webhook is absolute and that it
+// subscribed to known events.
+func (w Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL: %q", w.URL)
+	}
+	if len(w.Events) == 0 {
+		return fmt.Errorf("webhook %s subscribed to no event", w.URL)
+	}
+	for _, evt := range w.Events {
+		name, ok := strings.CutPrefix(evt, "before_")
+		if !ok {
+			name, ok = strings.CutPrefix(evt, "after_")
+		}
+		if !ok || !slices.Contains(WebhookEvents, name) {
+			return fmt.Errorf("invalid webhook event: %q", evt)
+		}
+	}
+	return nil
+}
+
+// GetWebhook returns the webhook with the ID, if any.
+func (s *Settings) GetWebhook(id string) (Webhook, bool) {
+	for _, w := range s.Webhooks {
+		if w.ID == id {
+			return w, true
+		}
+	}
+	return Webhook{}, false
+}
@@ -0,0 +1,22 @@
+package share
+
+import "time"
+
+// Access is a visit or download of a share by whoever has its link. Accesses
+// are kept once the share is revoked, so that its owner can still tell who
+// got what.
+type Access struct {
+	ID   uint   `json:"id" storm:"id,increment"`
+	Hash string `json:"hash" storm:"index"`
+	// UserID is the owner of the share.
+	UserID    uint      `json:"userID"`
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	// File is the path of the file served, relative to the scope of the
+	// owner, and Bytes how much of it was sent.
+	File   string `json:"file"`
+	Bytes  int64  `json:"bytes"`
+	Status int    `json:"status"`
+}
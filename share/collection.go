@@ -0,0 +1,101 @@
+package share
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/fileutils"
+)
+
+// IsCollection reports whether the share is a collection: a share of several
+// files and directories of its owner, presented as a directory of them by
+// their names. Its Path is the directory they have in common.
+func (l *Link) IsCollection() bool {
+	return len(l.Paths) > 0
+}
+
+// Member returns the path of the member of the collection of the name.
+func (l *Link) Member(name string) (string, bool) {
+	for _, p := range l.Paths {
+		if path.Base(p) == name {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// SetMembers makes the share a collection of the paths, which are cleaned.
+// Their names must all differ, since they are told apart by them.
+func (l *Link) SetMembers(paths []string) error {
+	members := make([]string, 0, len(paths))
+	names := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		p = path.Clean("/" + p)
+		name := path.Base(p)
+		if p == "/" || names[name] {
+			return fmt.Errorf("%w: the members of a collection must be named differently, and not be the root", fberrors.ErrInvalidRequestParams)
+		}
+		names[name] = true
+		members = append(members, p)
+	}
+
+	l.Paths = members
+	l.Path = commonDir(members)
+	return nil
+}
+
+// removeMembers removes the members of the collection which are the path or
+// within it, reporting whether there were any.
+func (l *Link) removeMembers(p string) bool {
+	var members []string
+	for _, member := range l.Paths {
+		if !within(member, p) {
+			members = append(members, member)
+		}
+	}
+	if len(members) == len(l.Paths) {
+		return false
+	}
+
+	l.Paths = members
+	l.Path = commonDir(members)
+	return true
+}
+
+// renameMembers moves the members of the collection which are the old path
+// or within it to the new one, reporting whether there were any.
+func (l *Link) renameMembers(oldPath, newPath string) bool {
+	renamed := false
+	for i, member := range l.Paths {
+		if within(member, oldPath) {
+			l.Paths[i] = path.Join(newPath, strings.TrimPrefix(member, strings.TrimSuffix(oldPath, "/")))
+			renamed = true
+		}
+	}
+	if renamed {
+		l.Path = commonDir(l.Paths)
+	}
+	return renamed
+}
+
+// commonDir returns the directory the paths are all within.
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	parents := make([]string, 0, len(paths))
+	for _, p := range paths {
+		parents = append(parents, path.Dir(p))
+	}
+	if dir := fileutils.CommonPrefix('/', parents...); dir != "" {
+		return dir
+	}
+	return "/"
+}
+
+func within(p, dir string) bool {
+	dir = strings.TrimSuffix(dir, "/")
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
@@ -1,9 +1,66 @@
 package share
 
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+// ErrRequestFull is returned when a file request can't take another file.
+var ErrRequestFull = errors.New("the file request takes no more files")
+
+// ErrUsedUp is returned when a share was visited or downloaded as many times
+// as it allows.
+var ErrUsedUp = errors.New("the share was used up")
+
+// The kinds of accesses to shares, counted against their limits.
+const (
+	AccessVisit    = "visit"
+	AccessDownload = "download"
+)
+
 type CreateBody struct {
 	Password string `json:"password"`
 	Expires  string `json:"expires"`
 	Unit     string `json:"unit"`
+	// Upload creates a file request, with the limits that follow.
+	Upload     bool     `json:"upload"`
+	MaxFiles   uint     `json:"maxFiles"`
+	MaxBytes   int64    `json:"maxBytes"`
+	Extensions []string `json:"extensions"`
+	// The limits of the accesses to the share, zero for none.
+	MaxDownloads uint `json:"maxDownloads"`
+	MaxVisits    uint `json:"maxVisits"`
+	// Paths creates a collection of them, relative to the path shared, under
+	// the name, if any.
+	Paths []string `json:"paths"`
+	Name  string   `json:"name"`
+}
+
+// UpdateBody is the changes to a share, those left out being kept.
+type UpdateBody struct {
+	// Expires is the number of the unit the share expires in from now, or
+	// empty for never.
+	Expires *string `json:"expires"`
+	Unit    string  `json:"unit"`
+	// Password is the new password of the share, or empty to remove it.
+	Password     *string `json:"password"`
+	MaxDownloads *uint   `json:"maxDownloads"`
+	MaxVisits    *uint   `json:"maxVisits"`
+	// The limits of file requests.
+	MaxFiles   *uint     `json:"maxFiles"`
+	MaxBytes   *int64    `json:"maxBytes"`
+	Extensions *[]string `json:"extensions"`
 }
 
 // Link is the information needed to build a shareable link.
@@ -17,4 +74,180 @@ type Link struct {
 	// URL-Safe and is used to download links in password-protected shares via a
 	// query arg.
 	Token string `json:"token,omitempty"`
+	// Upload makes the link a file request into the directory shared: whoever
+	// has it can upload files there, but never list or download them.
+	Upload bool `json:"upload,omitempty"`
+	// The limits of a file request, zero for none. The extensions are
+	// lowercase, with their dot.
+	MaxFiles   uint     `json:"maxFiles,omitempty"`
+	MaxBytes   int64    `json:"maxBytes,omitempty"`
+	Extensions []string `json:"extensions,omitempty"`
+	// Files and Bytes are how much was uploaded to a file request so far.
+	Files uint  `json:"files,omitempty"`
+	Bytes int64 `json:"bytes,omitempty"`
+	// The limits of the accesses to the share, zero for none, and how many
+	// were made so far. The share is revoked once used up.
+	MaxDownloads uint `json:"maxDownloads,omitempty"`
+	MaxVisits    uint `json:"maxVisits,omitempty"`
+	Downloads    uint `json:"downloads,omitempty"`
+	Visits       uint `json:"visits,omitempty"`
+	// Paths are the members of a collection, and Name the name of the
+	// directory it is presented as.
+	Paths []string `json:"paths,omitempty"`
+	Name  string   `json:"name,omitempty"`
+}
+
+// NormalizeExtensions returns the extensions lowercase and with their dot.
+func NormalizeExtensions(extensions []string) []string {
+	var normalized []string
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		normalized = append(normalized, ext)
+	}
+	return normalized
+}
+
+// AllowsName reports whether a file of the name can be uploaded to the file
+// request, as far as its extension goes.
+func (l *Link) AllowsName(name string) bool {
+	return len(l.Extensions) == 0 || slices.Contains(l.Extensions, strings.ToLower(path.Ext(name)))
+}
+
+// Reserve counts a file of the size as uploaded to the file request, unless
+// it exceeds its limits.
+func (l *Link) Reserve(size int64) error {
+	if l.MaxFiles != 0 && l.Files >= l.MaxFiles {
+		return ErrRequestFull
+	}
+	if l.MaxBytes != 0 && l.Bytes+size > l.MaxBytes {
+		return ErrRequestFull
+	}
+	l.Files++
+	l.Bytes += size
+	return nil
+}
+
+// Release uncounts a file reserved, which failed to be uploaded.
+func (l *Link) Release(size int64) {
+	l.Files--
+	l.Bytes -= size
+}
+
+// Count counts an access of the kind to the share, unless it was used up for
+// that kind.
+func (l *Link) Count(kind string) error {
+	switch kind {
+	case AccessVisit:
+		if l.MaxVisits != 0 && l.Visits >= l.MaxVisits {
+			return ErrUsedUp
+		}
+		l.Visits++
+	case AccessDownload:
+		if l.MaxDownloads != 0 && l.Downloads >= l.MaxDownloads {
+			return ErrUsedUp
+		}
+		l.Downloads++
+	}
+	return nil
+}
+
+// Uncount uncounts an access counted, which failed to be served.
+func (l *Link) Uncount(kind string) {
+	switch kind {
+	case AccessVisit:
+		l.Visits--
+	case AccessDownload:
+		l.Downloads--
+	}
+}
+
+// Expiry returns when a share expiring in the number of the unit from now
+// expires, as a Unix time, or zero for never when the number is empty.
+func Expiry(expires, unit string, now time.Time) (int64, error) {
+	if expires == "" {
+		return 0, nil
+	}
+	num, err := strconv.Atoi(expires)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid expiry %q", fberrors.ErrInvalidRequestParams, expires)
+	}
+
+	var add time.Duration
+	switch unit {
+	case "seconds":
+		add = time.Second * time.Duration(num)
+	case "minutes":
+		add = time.Minute * time.Duration(num)
+	case "days":
+		add = time.Hour * 24 * time.Duration(num)
+	default:
+		add = time.Hour * time.Duration(num)
+	}
+	return now.Add(add).Unix(), nil
+}
+
+// SetPassword protects the share with the password, along with a new token
+// for the links to its files, or removes its protection when the password is
+// empty.
+func (l *Link) SetPassword(password string) error {
+	if password == "" {
+		l.PasswordHash = ""
+		l.Token = ""
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	token := make([]byte, 96)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	l.PasswordHash = string(hash)
+	l.Token = base64.URLEncoding.EncodeToString(token)
+	return nil
+}
+
+// Update applies the changes to the share. The limits of file requests can't
+// be set on other shares.
+func (l *Link) Update(body *UpdateBody, now time.Time) error {
+	if !l.Upload && (body.MaxFiles != nil || body.MaxBytes != nil || body.Extensions != nil) {
+		return fmt.Errorf("%w: only file requests limit their files", fberrors.ErrInvalidRequestParams)
+	}
+
+	if body.Expires != nil {
+		expire, err := Expiry(*body.Expires, body.Unit, now)
+		if err != nil {
+			return err
+		}
+		l.Expire = expire
+	}
+	if body.Password != nil {
+		if err := l.SetPassword(*body.Password); err != nil {
+			return err
+		}
+	}
+	if body.MaxDownloads != nil {
+		l.MaxDownloads = *body.MaxDownloads
+	}
+	if body.MaxVisits != nil {
+		l.MaxVisits = *body.MaxVisits
+	}
+	if body.MaxFiles != nil {
+		l.MaxFiles = *body.MaxFiles
+	}
+	if body.MaxBytes != nil {
+		l.MaxBytes = max(*body.MaxBytes, 0)
+	}
+	if body.Extensions != nil {
+		l.Extensions = NormalizeExtensions(*body.Extensions)
+	}
+	return nil
 }
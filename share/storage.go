@@ -1,6 +1,7 @@
 package share
 
 import (
+	"errors"
 	"time"
 
 	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
@@ -16,6 +17,9 @@ type StorageBackend interface {
 	Save(s *Link) error
 	Delete(hash string) error
 	DeleteWithPathPrefix(path string, userID uint) error
+	SaveAccess(a *Access) error
+	// Accesses returns the accesses to the share, the earliest first.
+	Accesses(hash string) ([]*Access, error)
 }
 
 // Storage is a storage.
@@ -120,6 +124,53 @@ func (s *Storage) Delete(hash string) error {
 	return s.back.Delete(hash)
 }
 
+// DeleteWithPathPrefix wraps a StorageBackend.DeleteWithPathPrefix, also
+// removing the members of the collections which are the path or within it,
+// and the collections left without any.
 func (s *Storage) DeleteWithPathPrefix(path string, userID uint) error {
-	return s.back.DeleteWithPathPrefix(path, userID)
+	err := s.back.DeleteWithPathPrefix(path, userID)
+	return errors.Join(err, s.updateCollections(userID, func(l *Link) bool {
+		return l.removeMembers(path)
+	}))
+}
+
+// RenamePathPrefix moves the members of the collections of the user which
+// are the old path or within it to the new one.
+func (s *Storage) RenamePathPrefix(oldPath, newPath string, userID uint) error {
+	return s.updateCollections(userID, func(l *Link) bool {
+		return l.renameMembers(oldPath, newPath)
+	})
+}
+
+// updateCollections saves the collections of the user fn changed.
+func (s *Storage) updateCollections(userID uint, fn func(l *Link) bool) error {
+	links, err := s.back.FindByUserID(userID)
+	if errors.Is(err, fberrors.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		if !link.IsCollection() || !fn(link) {
+			continue
+		}
+		if link.IsCollection() {
+			err = errors.Join(err, s.back.Save(link))
+		} else {
+			err = errors.Join(err, s.back.Delete(link.Hash))
+		}
+	}
+	return err
+}
+
+// SaveAccess wraps a StorageBackend.SaveAccess
+func (s *Storage) SaveAccess(a *Access) error {
+	return s.back.SaveAccess(a)
+}
+
+// Accesses wraps a StorageBackend.Accesses
+func (s *Storage) Accesses(hash string) ([]*Access, error) {
+	return s.back.Accesses(hash)
 }
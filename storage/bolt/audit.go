@@ -0,0 +1,44 @@
+package bolt
+
+import (
+	"errors"
+
+	"github.com/asdine/storm/v3"
+
+	"github.com/thevickypedia/filebrowser/v2/audit"
+)
+
+type auditBackend struct {
+	db *storm.DB
+}
+
+// auditMatcher selects the events of a filter in a query.
+type auditMatcher audit.Filter
+
+func (m auditMatcher) Match(i interface{}) (bool, error) {
+	switch e := i.(type) {
+	case audit.Event:
+		return audit.Filter(m).Matches(&e), nil
+	case *audit.Event:
+		return audit.Filter(m).Matches(e), nil
+	}
+	return false, nil
+}
+
+func (s auditBackend) Save(e *audit.Event) error {
+	return s.db.Save(e)
+}
+
+func (s auditBackend) Find(f audit.Filter) ([]*audit.Event, error) {
+	v := []*audit.Event{}
+	query := s.db.Select(auditMatcher(f)).OrderBy("ID").Reverse()
+	if f.Limit > 0 {
+		query = query.Limit(f.Limit)
+	}
+	err := query.Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
@@ -5,11 +5,13 @@ import (
 
 	"github.com/thevickypedia/filebrowser/v2/auth"
 	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
 	"github.com/thevickypedia/filebrowser/v2/settings"
 )
 
 type authBackend struct {
-	db *storm.DB
+	db       *storm.DB
+	passkeys *passkeys.Storage
 }
 
 func (s authBackend) Get(t settings.AuthMethod) (auth.Auther, error) {
@@ -17,11 +19,15 @@ func (s authBackend) Get(t settings.AuthMethod) (auth.Auther, error) {
 
 	switch t {
 	case auth.MethodJSONAuth:
-		auther = &auth.JSONAuth{}
+		auther = &auth.JSONAuth{Passkeys: s.passkeys}
 	case auth.MethodProxyAuth:
 		auther = &auth.ProxyAuth{}
 	case auth.MethodHookAuth:
 		auther = &auth.HookAuth{}
+	case auth.MethodOIDCAuth:
+		auther = &auth.OIDCAuth{}
+	case auth.MethodLDAPAuth:
+		auther = &auth.LDAPAuth{}
 	case auth.MethodNoAuth:
 		auther = &auth.NoAuth{}
 	default:
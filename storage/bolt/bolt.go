@@ -3,11 +3,19 @@ package bolt
 import (
 	"github.com/asdine/storm/v3"
 
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	"github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/grants"
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
 	"github.com/thevickypedia/filebrowser/v2/settings"
 	"github.com/thevickypedia/filebrowser/v2/share"
 	"github.com/thevickypedia/filebrowser/v2/storage"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
+	"github.com/thevickypedia/filebrowser/v2/trash"
 	"github.com/thevickypedia/filebrowser/v2/users"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+	"github.com/thevickypedia/filebrowser/v2/webhooks"
 )
 
 // NewStorage creates a storage.Storage based on Bolt DB.
@@ -15,7 +23,15 @@ func NewStorage(db *storm.DB) (*storage.Storage, error) {
 	userStore := users.NewStorage(usersBackend{db: db})
 	shareStore := share.NewStorage(shareBackend{db: db})
 	settingsStore := settings.NewStorage(settingsBackend{db: db})
-	authStore := auth.NewStorage(authBackend{db: db}, userStore)
+	passkeysStore := passkeys.NewStorage(passkeysBackend{db: db})
+	authStore := auth.NewStorage(authBackend{db: db, passkeys: passkeysStore}, userStore)
+	trashStore := trash.NewStorage(trashBackend{db: db})
+	versionsStore := versions.NewStorage(versionsBackend{db: db})
+	jobsStore := jobs.NewStorage(jobsBackend{db: db})
+	tokensStore := tokens.NewStorage(tokensBackend{db: db})
+	auditStore := audit.NewStorage(auditBackend{db: db})
+	webhooksStore := webhooks.NewStorage(webhooksBackend{db: db})
+	grantsStore := grants.NewStorage(grantsBackend{db: db})
 
 	err := save(db, "version", 2)
 	if err != nil {
@@ -27,5 +43,13 @@ func NewStorage(db *storm.DB) (*storage.Storage, error) {
 		Users:    userStore,
 		Share:    shareStore,
 		Settings: settingsStore,
+		Trash:    trashStore,
+		Versions: versionsStore,
+		Jobs:     jobsStore,
+		Passkeys: passkeysStore,
+		Tokens:   tokensStore,
+		Audit:    auditStore,
+		Webhooks: webhooksStore,
+		Grants:   grantsStore,
 	}, nil
 }
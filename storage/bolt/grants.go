@@ -0,0 +1,77 @@
+package bolt
+
+import (
+	"errors"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/grants"
+)
+
+type grantsBackend struct {
+	db *storm.DB
+}
+
+func (s grantsBackend) All() ([]*grants.Grant, error) {
+	var v []*grants.Grant
+	err := s.db.All(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s grantsBackend) FindByOwner(id uint) ([]*grants.Grant, error) {
+	var v []*grants.Grant
+	err := s.db.Select(q.Eq("OwnerID", id)).Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s grantsBackend) FindByGrantee(id uint) ([]*grants.Grant, error) {
+	var v []*grants.Grant
+	err := s.db.Select(q.Eq("GranteeID", id)).Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s grantsBackend) FindByGroup(group string) ([]*grants.Grant, error) {
+	var v []*grants.Grant
+	err := s.db.Select(q.Eq("Group", group)).Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s grantsBackend) Get(id uint) (*grants.Grant, error) {
+	var v grants.Grant
+	err := s.db.One("ID", id, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, fberrors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s grantsBackend) Save(g *grants.Grant) error {
+	return s.db.Save(g)
+}
+
+func (s grantsBackend) Delete(id uint) error {
+	err := s.db.DeleteStruct(&grants.Grant{ID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
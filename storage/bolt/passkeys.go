@@ -0,0 +1,47 @@
+package bolt
+
+import (
+	"errors"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
+)
+
+type passkeysBackend struct {
+	db *storm.DB
+}
+
+func (s passkeysBackend) FindByUserID(id uint) ([]*passkeys.Credential, error) {
+	var v []*passkeys.Credential
+	err := s.db.Select(q.Eq("UserID", id)).Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s passkeysBackend) Get(id string) (*passkeys.Credential, error) {
+	var v passkeys.Credential
+	err := s.db.One("ID", id, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, fberrors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s passkeysBackend) Save(c *passkeys.Credential) error {
+	return s.db.Save(c)
+}
+
+func (s passkeysBackend) Delete(id string) error {
+	err := s.db.DeleteStruct(&passkeys.Credential{ID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -103,3 +103,17 @@ func (s shareBackend) DeleteWithPathPrefix(pathPrefix string, userID uint) error
 	}
 	return err
 }
+
+func (s shareBackend) SaveAccess(a *share.Access) error {
+	return s.db.Save(a)
+}
+
+func (s shareBackend) Accesses(hash string) ([]*share.Access, error) {
+	v := []*share.Access{}
+	err := s.db.Select(q.Eq("Hash", hash)).OrderBy("ID").Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
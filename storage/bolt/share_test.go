@@ -133,3 +133,51 @@ func TestDeleteWithPathPrefixNoMatch(t *testing.T) {
 		t.Fatalf("DeleteWithPathPrefix on empty store returned error: %v", err)
 	}
 }
+
+func TestCollectionMembersFollowPaths(t *testing.T) {
+	t.Parallel()
+
+	back := newTestShareBackend(t)
+	s := share.NewStorage(back)
+
+	link := &share.Link{Hash: "c", UserID: 1}
+	if err := link.SetMembers([]string{"/docs/a.txt", "/docs/reports/b.pdf", "/photos"}); err != nil {
+		t.Fatal(err)
+	}
+	other := &share.Link{Hash: "o", UserID: 1}
+	if err := other.SetMembers([]string{"/tmp/x.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []*share.Link{link, other} {
+		if err := s.Save(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.RenamePathPrefix("/docs/reports", "/archive/2025", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteWithPathPrefix("/photos", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetByHash("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/docs/a.txt", "/archive/2025/b.pdf"}
+	if len(got.Paths) != len(want) || got.Paths[0] != want[0] || got.Paths[1] != want[1] {
+		t.Fatalf("expected the members %v, got %v", want, got.Paths)
+	}
+	if got.Path != "/" {
+		t.Fatalf("expected the members to be within /, got %q", got.Path)
+	}
+
+	// A collection left without members is deleted.
+	if err := s.DeleteWithPathPrefix("/tmp/x.txt", 1); err != nil {
+		t.Fatal(err)
+	}
+	if hashes := remainingHashes(t, back); len(hashes) != 1 || hashes[0] != "c" {
+		t.Fatalf("expected only the collection c to remain, got %v", hashes)
+	}
+}
@@ -0,0 +1,47 @@
+package bolt
+
+import (
+	"errors"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
+)
+
+type tokensBackend struct {
+	db *storm.DB
+}
+
+func (s tokensBackend) FindByUserID(id uint) ([]*tokens.Token, error) {
+	var v []*tokens.Token
+	err := s.db.Select(q.Eq("UserID", id)).Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s tokensBackend) Get(id string) (*tokens.Token, error) {
+	var v tokens.Token
+	err := s.db.One("ID", id, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, fberrors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s tokensBackend) Save(t *tokens.Token) error {
+	return s.db.Save(t)
+}
+
+func (s tokensBackend) Delete(id string) error {
+	err := s.db.DeleteStruct(&tokens.Token{ID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package bolt
+
+import (
+	"errors"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+)
+
+type versionsBackend struct {
+	db *storm.DB
+}
+
+func (s versionsBackend) FindByPath(path string) ([]*versions.Version, error) {
+	var v []*versions.Version
+	err := s.db.Select(q.Eq("Path", path)).Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s versionsBackend) FindByPathPrefix(prefix string) ([]*versions.Version, error) {
+	var v []*versions.Version
+	err := s.db.Prefix("Path", prefix, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s versionsBackend) Get(id string) (*versions.Version, error) {
+	var v versions.Version
+	err := s.db.One("ID", id, &v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil, fberrors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s versionsBackend) Save(v *versions.Version) error {
+	return s.db.Save(v)
+}
+
+func (s versionsBackend) Delete(id string) error {
+	err := s.db.DeleteStruct(&versions.Version{ID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
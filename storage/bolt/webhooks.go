@@ -0,0 +1,47 @@
+package bolt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+
+	"github.com/thevickypedia/filebrowser/v2/webhooks"
+)
+
+type webhooksBackend struct {
+	db *storm.DB
+}
+
+func (s webhooksBackend) All() ([]*webhooks.Delivery, error) {
+	var v []*webhooks.Delivery
+	err := s.db.All(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s webhooksBackend) Due(t time.Time) ([]*webhooks.Delivery, error) {
+	var v []*webhooks.Delivery
+	err := s.db.Select(q.Lte("Next", t)).OrderBy("Next").Find(&v)
+	if errors.Is(err, storm.ErrNotFound) {
+		return v, nil
+	}
+
+	return v, err
+}
+
+func (s webhooksBackend) Save(d *webhooks.Delivery) error {
+	return s.db.Save(d)
+}
+
+func (s webhooksBackend) Delete(id uint) error {
+	err := s.db.DeleteStruct(&webhooks.Delivery{ID: id})
+	if errors.Is(err, storm.ErrNotFound) {
+		return nil
+	}
+	return err
+}
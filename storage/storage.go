@@ -1,10 +1,18 @@
 package storage
 
 import (
+	"github.com/thevickypedia/filebrowser/v2/audit"
 	"github.com/thevickypedia/filebrowser/v2/auth"
+	"github.com/thevickypedia/filebrowser/v2/grants"
+	"github.com/thevickypedia/filebrowser/v2/jobs"
+	"github.com/thevickypedia/filebrowser/v2/passkeys"
 	"github.com/thevickypedia/filebrowser/v2/settings"
 	"github.com/thevickypedia/filebrowser/v2/share"
+	"github.com/thevickypedia/filebrowser/v2/tokens"
+	"github.com/thevickypedia/filebrowser/v2/trash"
 	"github.com/thevickypedia/filebrowser/v2/users"
+	"github.com/thevickypedia/filebrowser/v2/versions"
+	"github.com/thevickypedia/filebrowser/v2/webhooks"
 )
 
 // Storage is a storage powered by a Backend which makes the necessary
@@ -14,4 +22,19 @@ type Storage struct {
 	Share    *share.Storage
 	Auth     *auth.Storage
 	Settings *settings.Storage
+	Trash    *trash.Storage
+	Versions *versions.Storage
+	Jobs     *jobs.Storage
+	Passkeys *passkeys.Storage
+	Tokens   *tokens.Storage
+	// Audit records the file and admin actions in the database, unless the
+	// server sets it to a file, or to nil when the audit log is disabled.
+	Audit *audit.Storage
+	// Webhooks queues the after events for the webhooks until posted.
+	Webhooks *webhooks.Storage
+	// Grants gives users access to the directories of others.
+	Grants *grants.Storage
+	// Limits locks out the clients and users failing to log in too often.
+	// It is left nil, not limiting logins, until the server sets it up.
+	Limits *auth.Limiter
 }
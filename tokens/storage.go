@@ -0,0 +1,92 @@
+package tokens
+
+import (
+	"errors"
+	"time"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+// lastUsedResolution is how often the time a token was last used is recorded
+// at most, so that scripts don't write to the database on every request.
+const lastUsedResolution = time.Minute
+
+// StorageBackend is the interface to implement for a tokens storage.
+type StorageBackend interface {
+	FindByUserID(id uint) ([]*Token, error)
+	Get(id string) (*Token, error)
+	Save(t *Token) error
+	Delete(id string) error
+}
+
+// Storage is a storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a tokens storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// FindByUserID wraps a StorageBackend.FindByUserID.
+func (s *Storage) FindByUserID(id uint) ([]*Token, error) {
+	return s.back.FindByUserID(id)
+}
+
+// Get wraps a StorageBackend.Get.
+func (s *Storage) Get(id string) (*Token, error) {
+	return s.back.Get(id)
+}
+
+// Save wraps a StorageBackend.Save.
+func (s *Storage) Save(t *Token) error {
+	return s.back.Save(t)
+}
+
+// Delete wraps a StorageBackend.Delete.
+func (s *Storage) Delete(id string) error {
+	return s.back.Delete(id)
+}
+
+// DeleteByUserID deletes all the tokens of a user.
+func (s *Storage) DeleteByUserID(id uint) error {
+	tokens, err := s.back.FindByUserID(id)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if err := s.back.Delete(t.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Authenticate returns the token raw is, unless it is unknown, wrong or
+// expired, recording that it was used.
+func (s *Storage) Authenticate(raw string) (*Token, error) {
+	id, secret, ok := parse(raw)
+	if !ok {
+		return nil, fberrors.ErrPermissionDenied
+	}
+
+	t, err := s.back.Get(id)
+	switch {
+	case errors.Is(err, fberrors.ErrNotExist):
+		return nil, fberrors.ErrPermissionDenied
+	case err != nil:
+		return nil, err
+	}
+	if !t.verify(secret) || t.Expired() {
+		return nil, fberrors.ErrPermissionDenied
+	}
+
+	if now := time.Now(); now.Sub(t.LastUsedAt) >= lastUsedResolution {
+		t.LastUsedAt = now
+		if err := s.back.Save(t); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,100 @@
+// Package tokens keeps the personal API tokens users create to automate
+// File Browser.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+// Prefix starts every token, which tells them apart from the JWTs of the
+// sessions.
+const Prefix = "fbpat_"
+
+// Token is a personal API token of a user. It grants at most Perm of the
+// permissions of the user, within Path of their scope, until it expires.
+type Token struct {
+	ID         string            `json:"id" storm:"id"`
+	UserID     uint              `json:"userID" storm:"index"`
+	Name       string            `json:"name"`
+	Hash       string            `json:"hash"` // SHA-256 of the secret
+	Perm       users.Permissions `json:"perm"`
+	Path       string            `json:"path"`
+	ExpiresAt  time.Time         `json:"expires"`
+	CreatedAt  time.Time         `json:"created"`
+	LastUsedAt time.Time         `json:"lastUsed"`
+}
+
+// New returns a token of a user along with the token itself, which is only
+// ever given then since just its hash is kept.
+func New(userID uint, name string, perm users.Permissions, scope string, expires time.Time) (*Token, string) {
+	id := strings.ToLower(rand.Text()[:12])
+	secret := rand.Text()
+	return &Token{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Hash:      hash(secret),
+		Perm:      perm,
+		Path:      CleanPath(scope),
+		ExpiresAt: expires,
+		CreatedAt: time.Now(),
+	}, Prefix + id + "_" + secret
+}
+
+// CleanPath returns the path tokens are restricted to for p, relative to the
+// scope of their users.
+func CleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// parse splits a token into the ID it is stored by and its secret.
+func parse(raw string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(raw, Prefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, "_")
+}
+
+// Expired reports whether the token expired.
+func (t *Token) Expired() bool {
+	return !time.Now().Before(t.ExpiresAt)
+}
+
+func (t *Token) verify(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash(secret))) == 1
+}
+
+// Allows reports whether p, relative to the scope of the user, is within the
+// path of the token.
+func (t *Token) Allows(p string) bool {
+	p = CleanPath(p)
+	return t.Path == "/" || p == t.Path || strings.HasPrefix(p, t.Path+"/")
+}
+
+// Restrict returns the permissions of a user the token grants.
+func (t *Token) Restrict(perm users.Permissions) users.Permissions {
+	return users.Permissions{
+		Admin:    perm.Admin && t.Perm.Admin,
+		Execute:  perm.Execute && t.Perm.Execute,
+		Create:   perm.Create && t.Perm.Create,
+		Rename:   perm.Rename && t.Perm.Rename,
+		Modify:   perm.Modify && t.Perm.Modify,
+		Delete:   perm.Delete && t.Perm.Delete,
+		Share:    perm.Share && t.Perm.Share,
+		Download: perm.Download && t.Perm.Download,
+	}
+}
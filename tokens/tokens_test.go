@@ -0,0 +1,44 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thevickypedia/filebrowser/v2/users"
+)
+
+func TestTokenAllows(t *testing.T) {
+	tk, _ := New(1, "ci", users.Permissions{}, "backups/", time.Now().Add(time.Hour))
+	for p, want := range map[string]bool{
+		"/backups":          true,
+		"/backups/":         true,
+		"/backups/db.tar":   true,
+		"backups/a/../b":    true,
+		"/backups/../etc":   false,
+		"/backups-old/file": false,
+		"/":                 false,
+	} {
+		if got := tk.Allows(p); got != want {
+			t.Errorf("Allows(%q) = %t, want %t", p, got, want)
+		}
+	}
+
+	root, _ := New(1, "ci", users.Permissions{}, "", time.Now().Add(time.Hour))
+	if !root.Allows("/anything") {
+		t.Error("expected a token of the whole scope to allow anything")
+	}
+}
+
+func TestTokenParse(t *testing.T) {
+	tk, raw := New(1, "ci", users.Permissions{}, "/", time.Now().Add(time.Hour))
+	id, secret, ok := parse(raw)
+	if !ok || id != tk.ID || !tk.verify(secret) {
+		t.Fatalf("expected %q to be the token %s", raw, tk.ID)
+	}
+	if tk.verify(secret + "x") {
+		t.Error("expected another secret to be refused")
+	}
+	if _, _, ok := parse("eyJhbGciOi.x.y"); ok {
+		t.Error("expected a JWT not to be a token")
+	}
+}
@@ -0,0 +1,227 @@
+// Package trash keeps what users delete for a while, so that it can be
+// restored, in a directory that is outside of every user's scope.
+package trash
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/afero"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+	"github.com/thevickypedia/filebrowser/v2/fileutils"
+)
+
+const (
+	// Trashed files are only readable by File Browser, whatever their
+	// permissions were in the user's scope.
+	dirMode  = 0o700
+	fileMode = 0o600
+
+	// expireInterval is how often expired items are looked for.
+	expireInterval = time.Hour
+)
+
+// Item is a file or a directory moved to the trash.
+type Item struct {
+	ID        string    `json:"id" storm:"id"`
+	UserID    uint      `json:"userID" storm:"index"`
+	Path      string    `json:"path"` // original path within the user's scope
+	IsDir     bool      `json:"isDir"`
+	Size      int64     `json:"size"`
+	DeletedBy string    `json:"deletedBy"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// Bin moves files to and from the trash directory, where each user has their
+// own directory, and keeps track of them in the storage. A nil Bin means the
+// trash is disabled.
+type Bin struct {
+	dir       string
+	retention time.Duration
+	store     *Storage
+}
+
+// NewBin returns a bin keeping the trashed files in dir for retention, or
+// forever if retention is zero.
+func NewBin(dir string, retention time.Duration, store *Storage) (*Bin, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, err
+	}
+
+	return &Bin{dir: dir, retention: retention, store: store}, nil
+}
+
+// Put moves the file or directory at realPath, which is path within the
+// user's scope, to the trash.
+func (b *Bin) Put(userID uint, path, realPath, deletedBy string) (*Item, error) {
+	info, err := os.Lstat(realPath)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	item := &Item{
+		ID:        id,
+		UserID:    userID,
+		Path:      path,
+		IsDir:     info.IsDir(),
+		Size:      size(realPath, info),
+		DeletedBy: deletedBy,
+		DeletedAt: time.Now(),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.Path(item)), dirMode); err != nil {
+		return nil, err
+	}
+	if err := move(realPath, b.Path(item)); err != nil {
+		return nil, err
+	}
+
+	if err := b.store.Save(item); err != nil {
+		// Put the file back rather than losing track of it.
+		if moveErr := move(b.Path(item), realPath); moveErr != nil {
+			log.Printf("trash: could not put %s back: %v", realPath, moveErr)
+		}
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// List returns the items trashed by a user, most recent first.
+func (b *Bin) List(userID uint) ([]*Item, error) {
+	items, err := b.store.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// Get returns an item trashed by a user.
+func (b *Bin) Get(userID uint, id string) (*Item, error) {
+	item, err := b.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.UserID != userID {
+		return nil, fberrors.ErrNotExist
+	}
+	return item, nil
+}
+
+// Path returns the real path of a trashed item.
+func (b *Bin) Path(item *Item) string {
+	return filepath.Join(b.dir, strconv.FormatUint(uint64(item.UserID), 10), item.ID)
+}
+
+// Restore moves an item out of the trash to realPath, whose parent directory
+// must exist.
+func (b *Bin) Restore(item *Item, realPath string) error {
+	if err := move(b.Path(item), realPath); err != nil {
+		return err
+	}
+	return b.store.Delete(item.ID)
+}
+
+// Purge deletes an item for good.
+func (b *Bin) Purge(item *Item) error {
+	if err := os.RemoveAll(b.Path(item)); err != nil {
+		return err
+	}
+	return b.store.Delete(item.ID)
+}
+
+// Run purges the expired items until ctx is canceled.
+func (b *Bin) Run(ctx context.Context) {
+	if b.retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(min(b.retention, expireInterval))
+	defer ticker.Stop()
+
+	for {
+		b.Expire(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Expire purges the items trashed longer than the retention ago.
+func (b *Bin) Expire(now time.Time) {
+	if b.retention <= 0 {
+		return
+	}
+
+	items, err := b.store.All()
+	if err != nil {
+		log.Printf("trash: could not list items: %v", err)
+		return
+	}
+
+	for _, item := range items {
+		if now.Sub(item.DeletedAt) < b.retention {
+			continue
+		}
+		if err := b.Purge(item); err != nil {
+			log.Printf("trash: could not purge %s: %v", b.Path(item), err)
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// move renames src to dst, copying it when they are on different devices.
+func move(src, dst string) error {
+	return fileutils.MoveFile(afero.NewOsFs(), src, dst, fileMode, dirMode)
+}
+
+func size(realPath string, info os.FileInfo) int64 {
+	if !info.IsDir() {
+		return info.Size()
+	}
+
+	var total int64
+	_ = filepath.WalkDir(realPath, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
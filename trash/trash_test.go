@@ -0,0 +1,87 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+type memoryBackend map[string]*Item
+
+func (m memoryBackend) All() ([]*Item, error) {
+	items := make([]*Item, 0, len(m))
+	for _, item := range m {
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (m memoryBackend) FindByUserID(id uint) ([]*Item, error) {
+	var items []*Item
+	for _, item := range m {
+		if item.UserID == id {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m memoryBackend) Get(id string) (*Item, error) {
+	if item, ok := m[id]; ok {
+		return item, nil
+	}
+	return nil, fberrors.ErrNotExist
+}
+
+func (m memoryBackend) Save(i *Item) error {
+	m[i.ID] = i
+	return nil
+}
+
+func (m memoryBackend) Delete(id string) error {
+	delete(m, id)
+	return nil
+}
+
+func TestBinExpire(t *testing.T) {
+	scope := t.TempDir()
+	back := memoryBackend{}
+	bin, err := NewBin(t.TempDir(), 24*time.Hour, NewStorage(back))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []*Item
+	for _, name := range []string{"old.txt", "new.txt"} {
+		p := filepath.Join(scope, name)
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		item, err := bin.Put(1, "/"+name, p, "u")
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+	}
+	items[0].DeletedAt = time.Now().Add(-48 * time.Hour)
+
+	if _, err := bin.Get(2, items[1].ID); err == nil {
+		t.Error("expected the items of other users to be hidden")
+	}
+
+	bin.Expire(time.Now())
+
+	left, err := bin.List(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].ID != items[1].ID {
+		t.Fatalf("expected only the recent item to be left, got %+v", left)
+	}
+	if _, err := os.Stat(bin.Path(items[0])); !os.IsNotExist(err) {
+		t.Errorf("expected the expired file to be purged, got %v", err)
+	}
+}
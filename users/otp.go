@@ -1,14 +1,136 @@
 package users
 
 import (
+	"crypto/rand"
+	"slices"
+	"strings"
+
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
 )
 
-func CheckOtp(otp, authenticatorToken string) bool {
-	// OTP validation: only enforce if authenticatorToken is set in the database (filebrowser config)
-	if authenticatorToken == "" {
+// recoveryCodes is how many recovery codes a user gets on enrolling an
+// authenticator.
+const recoveryCodes = 10
+
+// SecondFactor is what a user must prove, besides their password, to log in.
+type SecondFactor string
+
+const (
+	// SecondFactorDefault only requires a one-time password from users who
+	// enrolled an authenticator.
+	SecondFactorDefault SecondFactor = ""
+	// SecondFactorTOTP requires a one-time password. Users who didn't enroll
+	// an authenticator yet must do so before anything else once logged in.
+	SecondFactorTOTP SecondFactor = "totp"
+	// SecondFactorPasskey requires an assertion of one of the user's passkeys.
+	SecondFactorPasskey SecondFactor = "passkey"
+	// SecondFactorAny requires either a one-time password or a passkey.
+	SecondFactorAny SecondFactor = "any"
+)
+
+// Valid reports whether the second factor is a known one.
+func (f SecondFactor) Valid() bool {
+	switch f {
+	case SecondFactorDefault, SecondFactorTOTP, SecondFactorPasskey, SecondFactorAny:
 		return true
+	default:
+		return false
+	}
+}
+
+// TOTP is the time-based one-time password authenticator of a user.
+type TOTP struct {
+	// Secret is the seed of the authenticator, once a code of it was verified.
+	Secret string `json:"secret"`
+	// Pending is the otpauth URI of the authenticator being enrolled.
+	Pending string `json:"pending"`
+	// RecoveryCodes are the hashes of the codes left to log in without the
+	// authenticator. Each of them can only be used once.
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// Enrolled reports whether there is an authenticator.
+func (t TOTP) Enrolled() bool {
+	return t.Secret != ""
+}
+
+// MustEnrollOtp reports whether the user is required to prove one-time
+// passwords, but didn't enroll an authenticator yet.
+func (u *User) MustEnrollOtp() bool {
+	return u.SecondFactor == SecondFactorTOTP && !u.TOTP.Enrolled()
+}
+
+// EnrollOtp begins enrolling a new authenticator for the user. Until one of
+// its codes is verified, the current one, if any, is kept.
+func (u *User) EnrollOtp(issuer string) (*otp.Key, error) {
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: issuer, AccountName: u.Username})
+	if err != nil {
+		return nil, err
+	}
+	u.TOTP.Pending = key.URL()
+	return key, nil
+}
+
+// PendingOtp returns the authenticator being enrolled.
+func (u *User) PendingOtp() (*otp.Key, error) {
+	if u.TOTP.Pending == "" {
+		return nil, fberrors.ErrNotExist
+	}
+	return otp.NewKeyFromURL(u.TOTP.Pending)
+}
+
+// VerifyOtp completes enrolling the pending authenticator with one of its
+// codes. It returns the new recovery codes of the user, which aren't kept
+// but hashed.
+func (u *User) VerifyOtp(code string) ([]string, error) {
+	key, err := u.PendingOtp()
+	if err != nil {
+		return nil, err
+	}
+	if !totp.Validate(code, key.Secret()) {
+		return nil, fberrors.ErrInvalidOtp
+	}
+
+	codes := make([]string, 0, recoveryCodes)
+	hashes := make([]string, 0, recoveryCodes)
+	for range recoveryCodes {
+		code := strings.ToLower(rand.Text()[:10])
+		hash, err := HashPwd(code)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hash)
+	}
+
+	u.TOTP = TOTP{Secret: key.Secret(), RecoveryCodes: hashes}
+	return codes, nil
+}
+
+// CheckOtp reports whether otp proves the user holds their authenticator: it
+// is either one of its current codes, or one of the user's recovery codes,
+// which is then removed from them. It never does for users who didn't enroll
+// an authenticator.
+func CheckOtp(u *User, otp string) bool {
+	if !u.TOTP.Enrolled() || otp == "" {
+		return false
+	}
+	if totp.Validate(otp, u.TOTP.Secret) {
+		return true
+	}
+
+	code := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(otp), "-", ""))
+	if len(code) != 10 {
+		return false
+	}
+	for i, hash := range u.TOTP.RecoveryCodes {
+		if CheckPwd(code, hash) {
+			u.TOTP.RecoveryCodes = slices.Delete(u.TOTP.RecoveryCodes, i, i+1)
+			return true
+		}
 	}
-	// Validate the TOTP code using the TOTP library
-	return totp.Validate(otp, authenticatorToken)
+	return false
 }
@@ -0,0 +1,98 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+func TestOtpEnrollment(t *testing.T) {
+	u := &User{Username: "u", SecondFactor: SecondFactorTOTP}
+	if !u.MustEnrollOtp() {
+		t.Fatal("expected the user to have to enroll an authenticator")
+	}
+	if _, err := u.VerifyOtp("123456"); !errors.Is(err, fberrors.ErrNotExist) {
+		t.Errorf("expected nothing to verify before enrolling, got %v", err)
+	}
+
+	key, err := u.EnrollOtp("File Browser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.AccountName() != "u" || key.Issuer() != "File Browser" {
+		t.Errorf("unexpected key %s", key.URL())
+	}
+	if pending, err := u.PendingOtp(); err != nil || pending.Secret() != key.Secret() {
+		t.Errorf("expected the key to be pending, got %v %v", pending, err)
+	}
+	if u.TOTP.Enrolled() || CheckOtp(u, "123456") {
+		t.Fatal("expected a pending authenticator not to be used yet")
+	}
+
+	if _, err := u.VerifyOtp("000000"); !errors.Is(err, fberrors.ErrInvalidOtp) {
+		t.Errorf("expected a wrong code to be refused, got %v", err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := u.VerifyOtp(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodes || len(u.TOTP.RecoveryCodes) != recoveryCodes {
+		t.Fatalf("expected %d recovery codes, got %v", recoveryCodes, codes)
+	}
+	for i, c := range codes {
+		if u.TOTP.RecoveryCodes[i] == c {
+			t.Errorf("expected recovery code %d to be hashed", i)
+		}
+	}
+	if !u.TOTP.Enrolled() || u.TOTP.Pending != "" || u.MustEnrollOtp() {
+		t.Errorf("expected the authenticator to be enrolled, got %+v", u.TOTP)
+	}
+	if !CheckOtp(u, code) {
+		t.Error("expected a code of the authenticator to be accepted")
+	}
+}
+
+func TestCheckOtpRecoveryCodes(t *testing.T) {
+	u := &User{Username: "u"}
+	if CheckOtp(u, "123456") {
+		t.Fatal("expected users without an authenticator to be refused")
+	}
+
+	key, err := u.EnrollOtp("File Browser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := u.VerifyOtp(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if CheckOtp(u, "") || CheckOtp(u, "aaaaa-aaaaa") {
+		t.Error("expected unknown codes to be refused")
+	}
+	if !CheckOtp(u, " "+strings.ToUpper(codes[3])+" ") {
+		t.Fatal("expected a recovery code to be accepted")
+	}
+	if len(u.TOTP.RecoveryCodes) != recoveryCodes-1 {
+		t.Errorf("expected the recovery code to be used up, %d are left", len(u.TOTP.RecoveryCodes))
+	}
+	if CheckOtp(u, codes[3]) {
+		t.Error("expected a recovery code to be used only once")
+	}
+	if !CheckOtp(u, strings.ReplaceAll(codes[0], "-", "")) {
+		t.Error("expected the other recovery codes to be kept")
+	}
+}
@@ -11,3 +11,15 @@ type Permissions struct {
 	Share    bool `json:"share"`
 	Download bool `json:"download"`
 }
+
+// Merge grants the permissions of o on top of p.
+func (p *Permissions) Merge(o Permissions) {
+	p.Admin = p.Admin || o.Admin
+	p.Execute = p.Execute || o.Execute
+	p.Create = p.Create || o.Create
+	p.Rename = p.Rename || o.Rename
+	p.Modify = p.Modify || o.Modify
+	p.Delete = p.Delete || o.Delete
+	p.Share = p.Share || o.Share
+	p.Download = p.Download || o.Download
+}
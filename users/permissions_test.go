@@ -0,0 +1,11 @@
+package users
+
+import "testing"
+
+func TestPermissionsMerge(t *testing.T) {
+	perm := Permissions{Create: true, Download: true}
+	perm.Merge(Permissions{Modify: true, Download: true})
+	if want := (Permissions{Create: true, Modify: true, Download: true}); perm != want {
+		t.Errorf("expected %+v, got %+v", want, perm)
+	}
+}
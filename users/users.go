@@ -36,6 +36,27 @@ type User struct {
 	HideDotfiles          bool          `json:"hideDotfiles"`
 	DateFormat            bool          `json:"dateFormat"`
 	AceEditorTheme        string        `json:"aceEditorTheme"`
+	Quota                 Quota         `json:"quota"`
+	SecondFactor          SecondFactor  `json:"secondFactor"`
+	TOTP                  TOTP          `json:"totp"`
+	// Groups are the groups the user is in, which directories can be
+	// granted to.
+	Groups []string `json:"groups"`
+	// OIDCSubject is the issuer and subject of the identity the user was
+	// created for by OpenID Connect auth, the only one signing in as them.
+	OIDCSubject string `json:"oidcSubject,omitempty"`
+}
+
+// Quota limits the storage a user can use within their scope. Zero values
+// mean no limit.
+type Quota struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// Unlimited reports whether the quota limits nothing.
+func (q Quota) Unlimited() bool {
+	return q.Bytes <= 0 && q.Files <= 0
 }
 
 // GetRules implements rules.Provider.
@@ -51,6 +72,8 @@ var checkableFields = []string{
 	"Commands",
 	"Sorting",
 	"Rules",
+	"SecondFactor",
+	"Groups",
 }
 
 // Clean cleans up a user and verifies if all its fields
@@ -86,6 +109,14 @@ func (u *User) Clean(baseScope string, followExternalSymlinks bool, fields ...st
 			if u.Rules == nil {
 				u.Rules = []rules.Rule{}
 			}
+		case "SecondFactor":
+			if !u.SecondFactor.Valid() {
+				return fberrors.ErrInvalidOption
+			}
+		case "Groups":
+			if u.Groups == nil {
+				u.Groups = []string{}
+			}
 		}
 	}
 
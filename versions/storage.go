@@ -0,0 +1,45 @@
+package versions
+
+// StorageBackend is the interface to implement for a versions storage.
+type StorageBackend interface {
+	FindByPath(path string) ([]*Version, error)
+	FindByPathPrefix(prefix string) ([]*Version, error)
+	Get(id string) (*Version, error)
+	Save(v *Version) error
+	Delete(id string) error
+}
+
+// Storage is a storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a versions storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// FindByPath wraps a StorageBackend.FindByPath.
+func (s *Storage) FindByPath(path string) ([]*Version, error) {
+	return s.back.FindByPath(path)
+}
+
+// FindByPathPrefix wraps a StorageBackend.FindByPathPrefix.
+func (s *Storage) FindByPathPrefix(prefix string) ([]*Version, error) {
+	return s.back.FindByPathPrefix(prefix)
+}
+
+// Get wraps a StorageBackend.Get.
+func (s *Storage) Get(id string) (*Version, error) {
+	return s.back.Get(id)
+}
+
+// Save wraps a StorageBackend.Save.
+func (s *Storage) Save(v *Version) error {
+	return s.back.Save(v)
+}
+
+// Delete wraps a StorageBackend.Delete.
+func (s *Storage) Delete(id string) error {
+	return s.back.Delete(id)
+}
@@ -0,0 +1,238 @@
+// Package versions keeps the previous contents of the files that are
+// overwritten, in a directory that is outside of every user's scope.
+package versions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+// Versions are only readable by File Browser, whatever the permissions of
+// the files they were taken from.
+const (
+	dirMode  = 0o700
+	fileMode = 0o600
+)
+
+// Version is a previous content of a file.
+type Version struct {
+	ID        string    `json:"id" storm:"id"`
+	Path      string    `json:"path" storm:"index"` // real path of the file
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modified"`
+	CreatedAt time.Time `json:"created"`
+}
+
+// History stores the versions of the files in a directory, each version in
+// its own file, and keeps track of them in the storage. A nil History keeps
+// no version.
+type History struct {
+	dir   string
+	store *Storage
+}
+
+// NewHistory returns a history keeping the versions in dir.
+func NewHistory(dir string, store *Storage) (*History, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, err
+	}
+
+	return &History{dir: dir, store: store}, nil
+}
+
+// Save keeps the current content of the file name of afs as a version of the
+// file at realPath, and forgets the oldest versions beyond keep. Nothing is
+// kept if keep is zero or if the file doesn't exist.
+func (h *History) Save(afs afero.Fs, name, realPath string, keep uint) error {
+	if h == nil || keep == 0 {
+		return nil
+	}
+
+	src, err := afs.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	v := &Version{
+		ID:        id,
+		Path:      realPath,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		CreatedAt: time.Now(),
+	}
+
+	if err := copyTo(h.Path(v), src); err != nil {
+		_ = os.Remove(h.Path(v))
+		return err
+	}
+
+	if err := h.store.Save(v); err != nil {
+		_ = os.Remove(h.Path(v))
+		return err
+	}
+
+	return h.Prune(realPath, keep)
+}
+
+// List returns the versions of the file at realPath, most recent first.
+func (h *History) List(realPath string) ([]*Version, error) {
+	if h == nil {
+		return []*Version{}, nil
+	}
+
+	versions, err := h.store.FindByPath(realPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].CreatedAt.After(versions[j].CreatedAt)
+	})
+	return versions, nil
+}
+
+// Get returns a version of the file at realPath.
+func (h *History) Get(realPath, id string) (*Version, error) {
+	if h == nil {
+		return nil, fberrors.ErrNotExist
+	}
+
+	v, err := h.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if v.Path != realPath {
+		return nil, fberrors.ErrNotExist
+	}
+	return v, nil
+}
+
+// Path returns the real path of the content of a version.
+func (h *History) Path(v *Version) string {
+	return filepath.Join(h.dir, v.ID)
+}
+
+// Move makes the versions of the file at src, or of the files under it when
+// it is a directory, the versions of the file at dst.
+func (h *History) Move(src, dst string) error {
+	if h == nil {
+		return nil
+	}
+
+	versions, err := h.store.FindByPathPrefix(src)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, v := range versions {
+		if !within(v.Path, src) {
+			// A sibling sharing the prefix, like /a/b.txt.bak for /a/b.txt.
+			continue
+		}
+
+		v.Path = dst + strings.TrimPrefix(v.Path, src)
+		errs = append(errs, h.store.Save(v))
+	}
+	return errors.Join(errs...)
+}
+
+// Size returns the size of the versions kept of the file at realPath, or of
+// the files under it when it is a directory.
+func (h *History) Size(realPath string) (int64, error) {
+	if h == nil {
+		return 0, nil
+	}
+
+	versions, err := h.store.FindByPathPrefix(realPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, v := range versions {
+		if within(v.Path, realPath) {
+			size += v.Size
+		}
+	}
+	return size, nil
+}
+
+// Prune forgets the oldest versions of the file at realPath beyond keep.
+func (h *History) Prune(realPath string, keep uint) error {
+	if h == nil {
+		return nil
+	}
+
+	versions, err := h.List(realPath)
+	if err != nil || len(versions) <= int(keep) {
+		return err
+	}
+
+	var errs []error
+	for _, v := range versions[keep:] {
+		if err := os.Remove(h.Path(v)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, h.store.Delete(v.ID))
+	}
+	return errors.Join(errs...)
+}
+
+// within reports whether p is dir or a path under it.
+func within(p, dir string) bool {
+	rel, ok := strings.CutPrefix(p, dir)
+	return ok && (rel == "" || strings.HasPrefix(rel, string(filepath.Separator)) ||
+		strings.HasSuffix(dir, string(filepath.Separator)))
+}
+
+func copyTo(dst string, src io.Reader) error {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
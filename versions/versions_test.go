@@ -0,0 +1,137 @@
+package versions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+
+	fberrors "github.com/thevickypedia/filebrowser/v2/errors"
+)
+
+type memoryBackend map[string]*Version
+
+func (m memoryBackend) FindByPath(path string) ([]*Version, error) {
+	var versions []*Version
+	for _, v := range m {
+		if v.Path == path {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+func (m memoryBackend) FindByPathPrefix(prefix string) ([]*Version, error) {
+	var versions []*Version
+	for _, v := range m {
+		if strings.HasPrefix(v.Path, prefix) {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+func (m memoryBackend) Get(id string) (*Version, error) {
+	if v, ok := m[id]; ok {
+		return v, nil
+	}
+	return nil, fberrors.ErrNotExist
+}
+
+func (m memoryBackend) Save(v *Version) error {
+	m[v.ID] = v
+	return nil
+}
+
+func (m memoryBackend) Delete(id string) error {
+	delete(m, id)
+	return nil
+}
+
+func TestHistory(t *testing.T) {
+	scope := t.TempDir()
+	afs := afero.NewBasePathFs(afero.NewOsFs(), scope)
+	back := memoryBackend{}
+	history, err := NewHistory(t.TempDir(), NewStorage(back))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	real := filepath.Join(scope, "a.txt")
+	for _, content := range []string{"one", "two", "three"} {
+		if err := os.WriteFile(real, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := history.Save(afs, "/a.txt", real, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Neither a missing file nor a directory has versions.
+	if err := history.Save(afs, "/missing.txt", filepath.Join(scope, "missing.txt"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Save(afs, "/", scope, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := history.List(real)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || len(back) != 2 {
+		t.Fatalf("expected the 2 most recent versions to be kept, got %d listed and %d stored", len(list), len(back))
+	}
+	for i, want := range []string{"three", "two"} {
+		content, err := os.ReadFile(history.Path(list[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("version %d: expected %q, got %q", i, want, content)
+		}
+	}
+
+	if _, err := history.Get(filepath.Join(scope, "b.txt"), list[0].ID); err == nil {
+		t.Error("expected the version of another file not to be found")
+	}
+
+	// A sibling sharing the prefix of the moved file keeps its versions.
+	sibling := real + ".bak"
+	if err := os.WriteFile(sibling, []byte("bak"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Save(afs, "/a.txt.bak", sibling, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if size, err := history.Size(real); err != nil || size != int64(len("three")+len("two")) {
+		t.Errorf("expected the size of the versions of the file alone, got %d (%v)", size, err)
+	}
+	if size, err := history.Size(scope); err != nil || size != int64(len("three")+len("two")+len("bak")) {
+		t.Errorf("expected the size of the versions under the directory, got %d (%v)", size, err)
+	}
+
+	moved := filepath.Join(scope, "dir", "b.txt")
+	if err := history.Move(real, moved); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := history.List(moved); len(list) != 2 {
+		t.Errorf("expected the versions to follow the file, got %d", len(list))
+	}
+	if list, _ := history.List(real); len(list) != 0 {
+		t.Errorf("expected no version left at the old path, got %d", len(list))
+	}
+	if list, _ := history.List(sibling); len(list) != 1 {
+		t.Errorf("expected the sibling to keep its version, got %d", len(list))
+	}
+
+	if err := history.Move(scope, scope+"-moved"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := history.List(filepath.Join(scope+"-moved", "dir", "b.txt")); len(list) != 2 {
+		t.Errorf("expected the versions to follow the directory, got %d", len(list))
+	}
+}
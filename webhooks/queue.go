@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+// The deliveries failing are retried after a delay doubling from
+// RetryDelay up to MaxRetryDelay, and given up on after MaxAttempts.
+const (
+	RetryDelay    = 30 * time.Second
+	MaxRetryDelay = time.Hour
+	MaxAttempts   = 10
+)
+
+// pollInterval is how often the queue looks for deliveries due, when none
+// were added meanwhile.
+const pollInterval = 10 * time.Second
+
+// Enqueue queues the payload of an after event for the webhooks subscribed to
+// it, to be posted by Run.
+func (s *Storage) Enqueue(hooks []settings.Webhook, p *Payload) error {
+	var body []byte
+	for _, hook := range hooks {
+		if !hook.Subscribed(p.Event) {
+			continue
+		}
+
+		if body == nil {
+			var err error
+			body, err = json.Marshal(p)
+			if err != nil {
+				return err
+			}
+		}
+		err := s.Save(&Delivery{
+			Webhook: hook.ID,
+			Event:   p.Event,
+			Body:    body,
+			Next:    time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run posts the deliveries as they are due until the context is done. The
+// webhooks are looked up in the settings at each attempt, so that the
+// deliveries of those removed are dropped.
+func (s *Storage) Run(ctx context.Context, settingsStore *settings.Storage) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.deliver(settingsStore, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// deliver posts the deliveries due by now.
+func (s *Storage) deliver(settingsStore *settings.Storage, now time.Time) {
+	due, err := s.Due(now)
+	if err != nil {
+		log.Printf("Warning: Failed to read the webhook deliveries: %v", err)
+		return
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	set, err := settingsStore.Get()
+	if err != nil {
+		log.Printf("Warning: Failed to read the webhooks: %v", err)
+		return
+	}
+
+	for _, d := range due {
+		hook, ok := set.GetWebhook(d.Webhook)
+		if ok {
+			err = post(hook, d.Event, strconv.FormatUint(uint64(d.ID), 10), d.Body)
+			if err != nil {
+				d.Attempts++
+				d.Error = err.Error()
+				if d.Attempts < MaxAttempts {
+					d.Next = now.Add(retryDelay(d.Attempts))
+					if err := s.back.Save(d); err != nil {
+						log.Printf("Warning: Failed to requeue the %s webhook delivery %d: %v", d.Event, d.ID, err)
+					}
+					continue
+				}
+				log.Printf("Warning: Gave up on the %s webhook delivery %d to %s: %v", d.Event, d.ID, hook.URL, err)
+			}
+		}
+
+		if err := s.Delete(d.ID); err != nil {
+			log.Printf("Warning: Failed to remove the %s webhook delivery %d: %v", d.Event, d.ID, err)
+		}
+	}
+}
+
+// retryDelay returns how long to wait before the attempt after those failed.
+func retryDelay(failed int) time.Duration {
+	delay := RetryDelay
+	for i := 1; i < failed && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxRetryDelay)
+}
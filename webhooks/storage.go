@@ -0,0 +1,66 @@
+package webhooks
+
+import "time"
+
+// Delivery is the payload of an after event queued for a webhook, until it
+// is posted or given up on.
+type Delivery struct {
+	ID uint `json:"id" storm:"id,increment"`
+	// Webhook is the ID of the subscription, whose URL and secret are those
+	// current when posting.
+	Webhook  string    `json:"webhook" storm:"index"`
+	Event    string    `json:"event"`
+	Body     []byte    `json:"body"`
+	Attempts int       `json:"attempts"`
+	Next     time.Time `json:"next" storm:"index"`
+	// Error is why the last attempt failed.
+	Error string `json:"error,omitempty"`
+}
+
+// StorageBackend is the interface to implement for a queue of deliveries.
+type StorageBackend interface {
+	All() ([]*Delivery, error)
+	// Due returns the deliveries to post by the time, the earliest first.
+	Due(t time.Time) ([]*Delivery, error)
+	Save(d *Delivery) error
+	Delete(id uint) error
+}
+
+// Storage is a storage. It wakes up the queue when deliveries are added.
+type Storage struct {
+	back StorageBackend
+	wake chan struct{}
+}
+
+// NewStorage creates a queue storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back, wake: make(chan struct{}, 1)}
+}
+
+// All wraps a StorageBackend.All.
+func (s *Storage) All() ([]*Delivery, error) {
+	return s.back.All()
+}
+
+// Due wraps a StorageBackend.Due.
+func (s *Storage) Due(t time.Time) ([]*Delivery, error) {
+	return s.back.Due(t)
+}
+
+// Save wraps a StorageBackend.Save, waking up the queue.
+func (s *Storage) Save(d *Delivery) error {
+	if err := s.back.Save(d); err != nil {
+		return err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Delete wraps a StorageBackend.Delete.
+func (s *Storage) Delete(id uint) error {
+	return s.back.Delete(id)
+}
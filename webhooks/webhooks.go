@@ -0,0 +1,99 @@
+// Package webhooks posts the events of the files to the URLs subscribed to
+// them, signing the payloads with the secrets of the subscriptions.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+// The headers of the requests posted to the webhooks.
+const (
+	EventHeader     = "X-Filebrowser-Event"
+	DeliveryHeader  = "X-Filebrowser-Delivery"
+	SignatureHeader = "X-Filebrowser-Signature"
+)
+
+// ErrVetoed is returned when a webhook refused a before event, the operation
+// being canceled.
+var ErrVetoed = errors.New("vetoed by a webhook")
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Payload is the JSON body posted to the webhooks. Its paths are relative to
+// the scope of the user.
+type Payload struct {
+	Event       string `json:"event"`
+	User        string `json:"user"`
+	Path        string `json:"path"`
+	Destination string `json:"destination,omitempty"`
+	// Size is that of the file once it exists, zero for directories.
+	Size      int64     `json:"size"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Sign returns the signature of a body, its HMAC-SHA256 with the secret in
+// hex, prefixed with sha256= as in the signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Before posts the payload of a before event to the webhooks subscribed to
+// it, one after the other. Any of them failing to answer with a 2xx status
+// vetoes the event, failing with ErrVetoed.
+func Before(hooks []settings.Webhook, p *Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		if !hook.Subscribed(p.Event) {
+			continue
+		}
+		if err := post(hook, p.Event, "", body); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrVetoed, p.Event, err)
+		}
+	}
+	return nil
+}
+
+// post posts a body to a webhook, failing unless it answers with a 2xx
+// status.
+func post(hook settings.Webhook, evt, delivery string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "File Browser")
+	req.Header.Set(EventHeader, evt)
+	if delivery != "" {
+		req.Header.Set(DeliveryHeader, delivery)
+	}
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %d", hook.URL, resp.StatusCode)
+	}
+	return nil
+}
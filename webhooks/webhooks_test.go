@@ -0,0 +1,174 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thevickypedia/filebrowser/v2/settings"
+)
+
+type memoryBackend struct {
+	mu         sync.Mutex
+	deliveries []*Delivery
+	lastID     uint
+}
+
+func (b *memoryBackend) All() ([]*Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.deliveries), nil
+}
+
+func (b *memoryBackend) Due(t time.Time) ([]*Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var due []*Delivery
+	for _, d := range b.deliveries {
+		if !d.Next.After(t) {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (b *memoryBackend) Save(d *Delivery) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d.ID == 0 {
+		b.lastID++
+		d.ID = b.lastID
+		b.deliveries = append(b.deliveries, d)
+	}
+	return nil
+}
+
+func (b *memoryBackend) Delete(id uint) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliveries = slices.DeleteFunc(b.deliveries, func(d *Delivery) bool { return d.ID == id })
+	return nil
+}
+
+type settingsBackend struct {
+	set *settings.Settings
+}
+
+func (b settingsBackend) Get() (*settings.Settings, error)     { return b.set, nil }
+func (b settingsBackend) Save(*settings.Settings) error        { return nil }
+func (b settingsBackend) GetServer() (*settings.Server, error) { return &settings.Server{}, nil }
+func (b settingsBackend) SaveServer(*settings.Server) error    { return nil }
+
+func TestBefore(t *testing.T) {
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		if r.Header.Get(EventHeader) != "before_upload" || signature != Sign("secret", body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/veto" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	hooks := []settings.Webhook{{ID: "a", URL: srv.URL, Secret: "secret", Events: []string{"before_upload"}}}
+	if err := Before(hooks, &Payload{Event: "before_upload", Path: "/a.txt"}); err != nil {
+		t.Fatalf("expected the upload to be allowed, got %v", err)
+	}
+	if signature == "" {
+		t.Fatal("expected a signed request")
+	}
+
+	hooks = append(hooks, settings.Webhook{ID: "b", URL: srv.URL + "/veto", Secret: "secret", Events: []string{"before_upload"}})
+	if err := Before(hooks, &Payload{Event: "before_delete"}); err != nil {
+		t.Fatalf("expected the events not subscribed to to be allowed, got %v", err)
+	}
+	if err := Before(hooks, &Payload{Event: "before_upload"}); err == nil {
+		t.Fatal("expected the upload to be vetoed")
+	}
+}
+
+func TestQueue(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received int
+		fail     = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received++
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	set := &settings.Settings{Webhooks: []settings.Webhook{
+		{ID: "a", URL: srv.URL, Events: []string{"after_upload"}},
+		{ID: "b", URL: srv.URL, Events: []string{"after_delete"}},
+	}}
+	settingsStore := settings.NewStorage(settingsBackend{set: set})
+	back := &memoryBackend{}
+	s := NewStorage(back)
+
+	if err := s.Enqueue(set.Webhooks, &Payload{Event: "after_upload"}); err != nil {
+		t.Fatal(err)
+	}
+	queued, _ := s.All()
+	if len(queued) != 1 || queued[0].Webhook != "a" {
+		t.Fatalf("expected a delivery for the webhook subscribed, got %+v", queued)
+	}
+
+	now := time.Now()
+	s.deliver(settingsStore, now)
+	queued, _ = s.All()
+	if len(queued) != 1 || queued[0].Attempts != 1 || !queued[0].Next.Equal(now.Add(RetryDelay)) {
+		t.Fatalf("expected the delivery to be retried after %s, got %+v", RetryDelay, queued)
+	}
+
+	// It is not retried before it is due.
+	s.deliver(settingsStore, now.Add(time.Second))
+	if received != 1 {
+		t.Fatalf("expected 1 request, got %d", received)
+	}
+
+	fail = false
+	s.deliver(settingsStore, now.Add(RetryDelay))
+	queued, _ = s.All()
+	if len(queued) != 0 || received != 2 {
+		t.Fatalf("expected the delivery to be posted, got %+v after %d requests", queued, received)
+	}
+
+	// The deliveries of the webhooks removed are dropped.
+	if err := s.Enqueue(set.Webhooks, &Payload{Event: "after_delete"}); err != nil {
+		t.Fatal(err)
+	}
+	set.Webhooks = set.Webhooks[:1]
+	s.deliver(settingsStore, time.Now())
+	queued, _ = s.All()
+	if len(queued) != 0 || received != 2 {
+		t.Fatalf("expected the delivery to be dropped, got %+v after %d requests", queued, received)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for failed, want := range map[int]time.Duration{
+		1:  RetryDelay,
+		2:  2 * RetryDelay,
+		3:  4 * RetryDelay,
+		9:  MaxRetryDelay,
+		20: MaxRetryDelay,
+	} {
+		if got := retryDelay(failed); got != want {
+			t.Errorf("retryDelay(%d) = %s, want %s", failed, got, want)
+		}
+	}
+}